@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ianzepp/monk-api-fuse/pkg/monkapi"
+	"github.com/ianzepp/monk-api-fuse/pkg/monkfs"
+)
+
+// hmacSigner builds the request signer for --hmac-key-id, reading the
+// secret from secretFile or MONK_HMAC_SECRET; no key ID means no signing
+func hmacSigner(keyID, secretFile string) (*monkapi.HMACSigner, error) {
+	if keyID == "" {
+		if secretFile != "" {
+			return nil, errors.New("--hmac-secret-file requires --hmac-key-id")
+		}
+		return nil, nil
+	}
+
+	secret := os.Getenv("MONK_HMAC_SECRET")
+	if secretFile != "" {
+		data, err := os.ReadFile(secretFile)
+		if err != nil {
+			return nil, fmt.Errorf("read HMAC secret: %w", err)
+		}
+		secret = strings.TrimSpace(string(data))
+	}
+	if secret == "" {
+		return nil, errors.New("--hmac-key-id needs a secret: set MONK_HMAC_SECRET or use --hmac-secret-file")
+	}
+	return &monkapi.HMACSigner{KeyID: keyID, Secret: []byte(secret)}, nil
+}
+
+// contentCipher builds the cipher for --encryption-key-file, reading the
+// key from keyFile or MONK_ENCRYPTION_KEY; neither means no encryption
+func contentCipher(keyFile string) (*monkfs.ContentCipher, error) {
+	key := []byte(os.Getenv("MONK_ENCRYPTION_KEY"))
+	if keyFile != "" {
+		data, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("read encryption key: %w", err)
+		}
+		key = bytes.TrimSpace(data)
+	}
+	if len(key) == 0 {
+		return nil, nil
+	}
+	return monkfs.NewContentCipher(key)
+}
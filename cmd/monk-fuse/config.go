@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/ianzepp/monk-api-fuse/pkg/monkfs"
+)
+
+// Config holds mount settings too structured for command-line flags,
+// loaded from the JSON file given with --config
+type Config struct {
+	CachePolicy *monkfs.CachePolicy `json:"cache_policy"`
+	Owners      *monkfs.OwnerMap    `json:"owners"`
+	Groups      *monkfs.GroupAccess `json:"groups"`
+	Headers     map[string]string   `json:"headers"`
+}
+
+// loadConfig reads a config file; an empty path yields an empty config
+func loadConfig(path string) (*Config, error) {
+	cfg := &Config{}
+	if path == "" {
+		return cfg, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("parse config %s: %w", path, err)
+	}
+
+	for _, rule := range cfg.cacheRules() {
+		if rule.Mode != monkfs.CacheKeep && rule.Mode != monkfs.CacheDirect {
+			return nil, fmt.Errorf("config %s: cache rule %q: mode must be %q or %q", path, rule.Pattern, monkfs.CacheKeep, monkfs.CacheDirect)
+		}
+	}
+
+	for name := range cfg.Headers {
+		if _, _, err := parseHeader(name + ":"); err != nil {
+			return nil, fmt.Errorf("config %s: %w", path, err)
+		}
+	}
+
+	return cfg, nil
+}
+
+func (c *Config) cacheRules() []monkfs.CacheRule {
+	if c.CachePolicy == nil {
+		return nil
+	}
+	return c.CachePolicy.Rules
+}
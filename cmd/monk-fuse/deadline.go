@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ianzepp/monk-api-fuse/pkg/monkfs"
+)
+
+// deadlineFlag is a repeatable flag of CLASS=DURATION operation deadlines,
+// where CLASS is metadata, read or write, e.g. metadata=5s,write=2m
+type deadlineFlag monkfs.Deadlines
+
+func (d *deadlineFlag) String() string {
+	var parts []string
+	for _, c := range []struct {
+		name  string
+		value time.Duration
+	}{{"metadata", d.Metadata}, {"read", d.Read}, {"write", d.Write}} {
+		if c.value > 0 {
+			parts = append(parts, c.name+"="+c.value.String())
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+func (d *deadlineFlag) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		name, dur, ok := strings.Cut(strings.TrimSpace(item), "=")
+		timeout, err := time.ParseDuration(dur)
+		if !ok || err != nil || timeout < 0 {
+			return fmt.Errorf("invalid deadline %q: want CLASS=DURATION, e.g. metadata=5s", item)
+		}
+		switch name {
+		case "metadata":
+			d.Metadata = timeout
+		case "read":
+			d.Read = timeout
+		case "write":
+			d.Write = timeout
+		default:
+			return fmt.Errorf("unknown operation class %q: want metadata, read or write", name)
+		}
+	}
+	return nil
+}
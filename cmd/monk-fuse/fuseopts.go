@@ -0,0 +1,43 @@
+package main
+
+import "strings"
+
+// stringList is a repeatable flag; each value may also hold a
+// comma-separated list
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
+
+// fuseOptions merges the platform defaults with user --fuse-opt values; a
+// user option replaces a default with the same name
+func fuseOptions(user []string) []string {
+	set := make(map[string]bool, len(user))
+	for _, opt := range user {
+		set[optionName(opt)] = true
+	}
+
+	var options []string
+	for _, opt := range defaultFuseOptions {
+		if !set[optionName(opt)] {
+			options = append(options, opt)
+		}
+	}
+	return append(options, user...)
+}
+
+// optionName returns the name of a key=value mount option
+func optionName(opt string) string {
+	name, _, _ := strings.Cut(opt, "=")
+	return name
+}
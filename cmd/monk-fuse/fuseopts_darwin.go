@@ -0,0 +1,7 @@
+package main
+
+// defaultFuseOptions names the volume in Finder (instead of a generated
+// macFUSE name) and stops Finder writing ._ AppleDouble files into the
+// API. noapplexattr is left out because it would also hide the
+// com.apple.TextEncoding attribute the filesystem provides.
+var defaultFuseOptions = []string{"volname=Monk", "noappledouble"}
@@ -0,0 +1,6 @@
+//go:build !darwin
+
+package main
+
+// defaultFuseOptions are passed to the mount helper unless overridden
+var defaultFuseOptions []string
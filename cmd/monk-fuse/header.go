@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"strings"
+)
+
+// headerList is a repeatable flag of "Name: value" request headers. Values
+// are kept whole, since header values may themselves contain commas.
+type headerList []string
+
+func (l *headerList) String() string {
+	return strings.Join(*l, "; ")
+}
+
+func (l *headerList) Set(value string) error {
+	if _, _, err := parseHeader(value); err != nil {
+		return err
+	}
+	*l = append(*l, value)
+	return nil
+}
+
+// parseHeader splits "Name: value" into a canonical name and its value
+func parseHeader(s string) (string, string, error) {
+	name, value, ok := strings.Cut(s, ":")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" || strings.ContainsAny(name, " \t") {
+		return "", "", fmt.Errorf("invalid header %q: want \"Name: value\"", s)
+	}
+	return textproto.CanonicalMIMEHeaderKey(name), strings.TrimSpace(value), nil
+}
+
+// requestHeaders merges headers from the config file with --header flags;
+// a flag replaces a config header of the same name
+func requestHeaders(config map[string]string, flags headerList) http.Header {
+	if len(config) == 0 && len(flags) == 0 {
+		return nil
+	}
+
+	h := make(http.Header)
+	for name, value := range config {
+		h.Set(name, value)
+	}
+	overridden := make(map[string]bool)
+	for _, flag := range flags {
+		name, value, _ := parseHeader(flag)
+		if !overridden[name] {
+			h.Del(name)
+			overridden[name] = true
+		}
+		h.Add(name, value)
+	}
+	return h
+}
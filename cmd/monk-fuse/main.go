@@ -1,18 +1,18 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"os"
-	"os/exec"
 	"os/signal"
+	"path"
+	"runtime"
 	"syscall"
 
-	"github.com/hanwen/go-fuse/v2/fs"
-	"github.com/hanwen/go-fuse/v2/fuse"
-	"github.com/ianzepp/monk-api-fuse/pkg/monkapi"
 	"github.com/ianzepp/monk-api-fuse/pkg/monkfs"
+	"github.com/ianzepp/monk-api-fuse/pkg/monkfuse"
 )
 
 func main() {
@@ -28,6 +28,8 @@ func main() {
 		mountCmd()
 	case "unmount":
 		unmountCmd()
+	case "serve":
+		serveCmd()
 	case "help", "--help", "-h":
 		printUsage()
 	default:
@@ -39,9 +41,52 @@ func main() {
 
 func mountCmd() {
 	mountFlags := flag.NewFlagSet("mount", flag.ExitOnError)
-	apiURL := mountFlags.String("api-url", "http://localhost:8000", "Monk API base URL")
-	token := mountFlags.String("token", "", "JWT authentication token")
+	api := addAPIFlags(mountFlags)
 	debug := mountFlags.Bool("debug", false, "Enable FUSE debug logging")
+	dataAPI := mountFlags.Bool("data-api", false, "Serve /data from the Data API as <schema>/<id>.json records")
+	wildcards := mountFlags.Bool("wildcards", false, "Forward glob-like names as pattern list requests")
+	prettyJSON := mountFlags.Bool("pretty-json", false, "Indent JSON content on read and compact it on write")
+	verifyReads := mountFlags.Bool("verify-reads", false, "Verify downloaded content against server SHA-256 checksums")
+	binary := mountFlags.Bool("binary", false, "Transport file content base64-encoded (binary-safe)")
+	directIO := mountFlags.Bool("direct-io", false, "Bypass the kernel page cache so reads always see remote writes")
+	expandFields := mountFlags.Bool("expand-fields", false, "With --data-api, also show records as directories of fields")
+	deferUnlink := mountFlags.Bool("defer-unlink", false, "Keep unlinked files on the server until their last open handle is closed")
+	locks := mountFlags.Bool("locks", false, "Back flock() with server-side advisory locks shared across machines")
+	escalateLocks := mountFlags.Bool("escalate-locks", false, "With --locks, hold a server-side whole-file lock while any fcntl() range lock is held")
+	writeLeases := mountFlags.Bool("write-leases", false, "Hold a server-side lease on files while they are open for writing")
+	recursiveList := mountFlags.Bool("recursive-list", false, "Fetch whole subtrees in one list request to speed up find and grep -r")
+	staleIfError := mountFlags.Bool("stale-if-error", false, "Serve expired cached metadata and content when the API fails transiently, instead of EIO")
+	staleWhileRevalidate := mountFlags.Duration("stale-while-revalidate", 0, "Answer stat calls from metadata expired no longer ago than this, refreshing it in the background (e.g. 1m)")
+	encryptionKeyFile := mountFlags.String("encryption-key-file", "", "Encrypt file content with the key in this file before it reaches the API (or set MONK_ENCRYPTION_KEY)")
+	auditLog := mountFlags.String("audit-log", "", "Append a JSON line for every change made through the mount to this file")
+	auditOnly := mountFlags.Bool("audit-only", false, "With --audit-log, log changes without sending them to the API and fail them with EROFS")
+	dryRun := mountFlags.Bool("dry-run", false, "Queue changes instead of sending them until \"commit\" is written to /.monk/dryrun")
+	var protect stringList
+	mountFlags.Var(&protect, "protect", "Refuse to delete paths matching these globs until approved in /.monk/approve (repeatable, e.g. /data/users/*)")
+	trash := mountFlags.Duration("trash", 0, "Move deleted files to /.Trash and purge them after this long (e.g. 168h)")
+	caseInsensitive := mountFlags.Bool("case-insensitive", false, "Find files looked up with the wrong case, as macOS applications expect")
+	var deadlines deadlineFlag
+	mountFlags.Var(&deadlines, "deadline", "Bound the total time of metadata, read or write operations (repeatable, e.g. metadata=5s,write=2m)")
+	idleCheck := mountFlags.Duration("idle-check", 0, "Ping the API at this interval while idle and drop connections that no longer answer (e.g. 30s)")
+	verify := mountFlags.Bool("verify", true, "Check the API URL and credentials before mounting (--verify=false to skip)")
+	cacheEntries := mountFlags.Int("cache-entries", 0, "Cache metadata for at most this many paths, evicting the least recently used (default: unbounded)")
+	atime := mountFlags.String("atime", "", "Access time tracking: off, relatime or strict (default: shown but never written)")
+	var cacheMemory byteSize
+	mountFlags.Var(&cacheMemory, "cache-memory-limit", "Bound the memory of all caches together, e.g. 256M (default: unbounded)")
+	compressCache := mountFlags.Bool("compress-cache", false, "With --stale-if-error, keep the content it caches compressed, fitting more into --cache-memory-limit")
+	maxOpenFiles := mountFlags.Int("max-open-files", 0, "Fail opens beyond this many open files with EMFILE (default: unbounded)")
+	var fileMode, dirMode, umask octalMode
+	mountFlags.Var(&fileMode, "file-mode", "Permissions of files the API reports none for, in octal (default 0644)")
+	mountFlags.Var(&dirMode, "dir-mode", "Permissions of directories the API reports none for, in octal (default 0755)")
+	mountFlags.Var(&umask, "umask", "Permission bits to clear from every file and directory, in octal (e.g. 077)")
+	var warm stringList
+	mountFlags.Var(&warm, "warm", "Prefetch metadata for these subtrees after mounting (repeatable, e.g. /projects,/data/users)")
+	maxBackground := mountFlags.Int("max-background", 0, "Asynchronous kernel requests kept in flight; throttling starts at 3/4 of it (default 12)")
+	var maxWrite, maxReadAhead byteSize
+	mountFlags.Var(&maxWrite, "max-write", "Largest kernel read or write request, and so the largest range fetched per read (default 128K, at most 1M)")
+	mountFlags.Var(&maxReadAhead, "max-readahead", "How far the kernel reads ahead of sequential reads (default 128K; more needs root)")
+	var fuseOpts stringList
+	mountFlags.Var(&fuseOpts, "fuse-opt", "Extra mount option passed to the FUSE helper (repeatable, e.g. volname=Monk,local)")
 
 	mountFlags.Parse(os.Args[2:])
 
@@ -53,39 +98,113 @@ func mountCmd() {
 
 	mountPoint := mountFlags.Arg(0)
 
-	// Get token from environment if not provided
-	if *token == "" {
-		*token = os.Getenv("MONK_TOKEN")
+	opts, cfg, err := api.options()
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	encryption, err := contentCipher(*encryptionKeyFile)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	if *maxOpenFiles < 0 {
+		log.Fatal("Error: --max-open-files must not be negative")
 	}
-	if *token == "" {
-		log.Fatal("Error: No token provided. Use --token or set MONK_TOKEN environment variable")
+	if *maxBackground < 0 || *maxBackground > 65535 {
+		log.Fatal("Error: --max-background must be between 0 and 65535")
+	}
+	if maxReadAhead > 128<<10 && os.Geteuid() != 0 && runtime.GOOS == "linux" {
+		log.Printf("Warning: --max-readahead above 128K needs root; the kernel's 128K applies")
 	}
 
-	// Create API client
-	apiClient := monkapi.NewClient(*apiURL, *token)
+	for _, pattern := range protect {
+		if _, err := path.Match(pattern, ""); err != nil {
+			log.Fatalf("Error: --protect %q: %v", pattern, err)
+		}
+	}
 
-	// Create FUSE filesystem
-	root := monkfs.NewMonkFS(apiClient)
+	// Only the --stale-if-error content store holds file content; metadata
+	// and listings are never compressed
+	if *compressCache && !*staleIfError {
+		log.Fatal("Error: --compress-cache needs --stale-if-error")
+	}
 
-	// Mount options
-	opts := &fs.Options{
-		MountOptions: fuse.MountOptions{
-			Name:          "monk-fuse",
-			FsName:        "monk",
-			Debug:         *debug,
-			AllowOther:    false,
-			DisableXAttrs: true,
-		},
+	if *auditOnly && *auditLog == "" {
+		log.Fatal("Error: --audit-only needs --audit-log")
+	}
+	var audit *monkfs.AuditLog
+	if *auditLog != "" {
+		if audit, err = monkfs.OpenAuditLog(*auditLog); err != nil {
+			log.Fatalf("Error: open audit log: %v", err)
+		}
+		defer audit.Close()
 	}
 
-	// Mount the filesystem
-	server, err := fs.Mount(mountPoint, root, opts)
+	// A lease is an exclusive server-side lock, so flock() from this mount
+	// would conflict with the mount's own leases
+	if *writeLeases && *locks {
+		log.Fatal("Error: --write-leases cannot be combined with --locks")
+	}
+
+	switch monkfs.AtimePolicy(*atime) {
+	case "", monkfs.AtimeOff, monkfs.AtimeRelatime, monkfs.AtimeStrict:
+	default:
+		log.Fatalf("Error: --atime must be off, relatime or strict, not %q", *atime)
+	}
+
+	opts.Mountpoint = mountPoint
+	opts.FS = monkfs.Options{
+		DataAPI:              *dataAPI,
+		Wildcards:            *wildcards,
+		PrettyJSON:           *prettyJSON,
+		ExpandFields:         *expandFields,
+		VerifyReads:          *verifyReads,
+		Binary:               *binary,
+		DirectIO:             *directIO,
+		RecursiveList:        *recursiveList,
+		DeferUnlink:          *deferUnlink,
+		Locks:                *locks,
+		EscalateLocks:        *escalateLocks,
+		WriteLeases:          *writeLeases,
+		FileMode:             uint32(fileMode),
+		DirMode:              uint32(dirMode),
+		Umask:                uint32(umask),
+		Atime:                monkfs.AtimePolicy(*atime),
+		CacheEntries:         *cacheEntries,
+		CacheMemoryLimit:     int64(cacheMemory),
+		CompressCache:        *compressCache,
+		MaxOpenFiles:         *maxOpenFiles,
+		Deadlines:            monkfs.Deadlines(deadlines),
+		Audit:                audit,
+		AuditOnly:            *auditOnly,
+		DryRun:               *dryRun,
+		Protect:              protect,
+		Trash:                *trash,
+		CaseInsensitive:      *caseInsensitive,
+		Warm:                 warm,
+		Owners:               cfg.Owners,
+		Groups:               cfg.Groups,
+		StaleIfError:         *staleIfError,
+		Encryption:           encryption,
+		StaleWhileRevalidate: *staleWhileRevalidate,
+		CachePolicy:          cfg.CachePolicy,
+	}
+	opts.FuseOptions = fuseOptions(fuseOpts)
+	opts.MaxBackground = *maxBackground
+	opts.MaxWrite = int(maxWrite)
+	opts.MaxReadAhead = int(maxReadAhead)
+	opts.IdleCheck = *idleCheck
+	opts.Verify = *verify
+	opts.Debug = *debug
+
+	session, err := monkfuse.Mount(context.Background(), opts)
 	if err != nil {
 		log.Fatalf("Mount failed: %v", err)
 	}
 
 	fmt.Printf("Mounted Monk File API at: %s\n", mountPoint)
-	fmt.Printf("API URL: %s\n", *apiURL)
+	fmt.Printf("API URL: %s\n", opts.APIURL)
 	fmt.Println("Press Ctrl+C to unmount...")
 
 	// Handle signals for graceful unmount
@@ -95,14 +214,14 @@ func mountCmd() {
 	go func() {
 		<-sigChan
 		fmt.Println("\nUnmounting...")
-		err := server.Unmount()
+		err := session.Close()
 		if err != nil {
 			log.Printf("Unmount error: %v", err)
 		}
 	}()
 
 	// Wait for filesystem to be unmounted
-	server.Wait()
+	session.Wait()
 	fmt.Println("Unmounted successfully")
 }
 
@@ -114,8 +233,7 @@ func unmountCmd() {
 
 	mountPoint := os.Args[2]
 
-	// Use umount command (works on macOS)
-	cmd := exec.Command("umount", mountPoint)
+	cmd := unmountCommand(mountPoint)
 	err := cmd.Run()
 	if err != nil {
 		log.Fatalf("Unmount failed: %v", err)
@@ -130,17 +248,86 @@ func printUsage() {
 	fmt.Println("Usage:")
 	fmt.Println("  monk-fuse mount [options] MOUNTPOINT")
 	fmt.Println("  monk-fuse unmount MOUNTPOINT")
+	fmt.Println("  monk-fuse serve PROTOCOL [options]")
 	fmt.Println("  monk-fuse help")
 	fmt.Println()
 	fmt.Println("Commands:")
 	fmt.Println("  mount      Mount the filesystem")
 	fmt.Println("  unmount    Unmount the filesystem")
+	fmt.Println("  serve      Serve the File API over a network protocol (webdav, 9p, ftp)")
 	fmt.Println("  help       Show this help message")
 	fmt.Println()
 	fmt.Println("Mount options:")
 	fmt.Println("  --api-url URL     Monk API base URL (default: http://localhost:8000)")
+	fmt.Println("  --api-replica URLS")
+	fmt.Println("                    Further replicas of the API to spread requests over (repeatable)")
+	fmt.Println("  --balance POLICY  How requests are spread over replicas: round-robin, least-pending or fastest")
 	fmt.Println("  --token TOKEN     JWT authentication token (or set MONK_TOKEN env var)")
 	fmt.Println("  --debug           Enable FUSE debug logging")
+	fmt.Println("  --config FILE     JSON config file with structured settings")
+	fmt.Println("  --data-api        Serve /data from the Data API as <schema>/<id>.json records")
+	fmt.Println("  --wildcards       Forward glob-like names as pattern list requests")
+	fmt.Println("  --pretty-json     Indent JSON content on read and compact it on write")
+	fmt.Println("  --expand-fields   With --data-api, also show records as directories of fields")
+	fmt.Println("  --verify-reads    Verify downloaded content against server SHA-256 checksums")
+	fmt.Println("  --binary          Transport file content base64-encoded (binary-safe)")
+	fmt.Println("  --direct-io       Bypass the kernel page cache so reads always see remote writes")
+	fmt.Println("  --recursive-list  Fetch whole subtrees in one list request to speed up find and grep -r")
+	fmt.Println("  --defer-unlink    Keep unlinked files on the server until their last open handle is closed")
+	fmt.Println("  --locks           Back flock() with server-side advisory locks shared across machines")
+	fmt.Println("  --escalate-locks  With --locks, hold a server-side whole-file lock while any fcntl() range lock is held")
+	fmt.Println("  --write-leases    Hold a server-side lease on files while they are open for writing")
+	fmt.Println("  --file-mode MODE  Permissions of files the API reports none for (default 0644)")
+	fmt.Println("  --dir-mode MODE   Permissions of directories the API reports none for (default 0755)")
+	fmt.Println("  --umask MASK      Permission bits to clear from every file and directory (e.g. 077)")
+	fmt.Println("  --cache-entries N Cache metadata for at most N paths, evicting the least recently used")
+	fmt.Println("  --cache-memory-limit SIZE")
+	fmt.Println("                    Bound the memory of all caches together (e.g. 256M), evicting from each in proportion")
+	fmt.Println("  --compress-cache  With --stale-if-error, compress the content it caches to fit more under the limit")
+	fmt.Println("  --max-open-files N")
+	fmt.Println("                    Fail opens beyond N open files with EMFILE (default: unbounded)")
+	fmt.Println("  --warm PATHS      Prefetch metadata for these subtrees after mounting (e.g. /projects,/docs)")
+	fmt.Println("  --atime POLICY    Access time tracking: off, relatime or strict (default: shown, never written)")
+	fmt.Println("  --stale-if-error  Serve expired cached metadata and content when the API fails transiently")
+	fmt.Println("  --stale-while-revalidate DURATION")
+	fmt.Println("                    Answer stat calls from recently expired metadata, refreshing it in the background")
+	fmt.Println("  --get-reads       Send stat, list and retrieve requests as cacheable GETs")
+	fmt.Println("  --strict-api      Fail requests whose responses use field names of other API versions")
+	fmt.Println("  --audit-log FILE  Append a JSON line for every change made through the mount to FILE")
+	fmt.Println("  --audit-only      With --audit-log, log changes without sending them and fail them with EROFS")
+	fmt.Println("  --dry-run         Queue changes until \"commit\" is written to /.monk/dryrun")
+	fmt.Println("  --protect GLOBS   Refuse to delete matching paths until approved in /.monk/approve (e.g. /data/users/*)")
+	fmt.Println("  --trash DURATION  Move deleted files to /.Trash and purge them after this long (e.g. 168h)")
+	fmt.Println("  --case-insensitive")
+	fmt.Println("                    Find files looked up with the wrong case, as macOS applications expect")
+	fmt.Println("  --deadline CLASS=DURATION")
+	fmt.Println("                    Bound the total time of metadata, read or write operations (e.g. metadata=5s)")
+	fmt.Println("  --idle-check DURATION")
+	fmt.Println("                    Ping the API at this interval while idle and drop connections that no longer answer")
+	fmt.Println("  --verify=false    Mount without first checking the API URL and credentials")
+	fmt.Println("  --mount-id ID     Identify this mount to the server in the X-Client-Mount-ID header")
+	fmt.Println("  --header HEADER   Extra request header sent to the API, as 'Name: value' (repeatable)")
+	fmt.Println("  --hmac-key-id ID  Sign requests with this HMAC key instead of a JWT (secret in MONK_HMAC_SECRET)")
+	fmt.Println("  --hmac-secret-file FILE")
+	fmt.Println("                    File holding the HMAC shared secret")
+	fmt.Println("  --encryption-key-file FILE")
+	fmt.Println("                    Encrypt file content with this key before it reaches the API (or MONK_ENCRYPTION_KEY)")
+	fmt.Println("  --max-background N")
+	fmt.Println("                    Asynchronous kernel requests kept in flight; throttling starts at 3/4 (default 12)")
+	fmt.Println("  --max-write SIZE  Largest kernel read or write request (default 128K, at most 1M)")
+	fmt.Println("  --max-readahead SIZE")
+	fmt.Println("                    How far the kernel reads ahead of sequential reads (default 128K; more needs root)")
+	fmt.Println("  --fuse-opt OPT    Extra mount option passed to the FUSE helper (repeatable)")
+	fmt.Println()
+	fmt.Println("Serve options:")
+	fmt.Println("  --api-url URL     Monk API base URL (default: http://localhost:8000)")
+	fmt.Println("  --token TOKEN     JWT authentication token (or set MONK_TOKEN env var)")
+	fmt.Println("  --listen ADDR     Address to listen on (default: 127.0.0.1:8080 webdav, :5640 9p, :2121 ftp)")
+	fmt.Println("  --read-only       Reject requests that modify data")
+	fmt.Println("  --user NAME       User name clients log in with (default: monk)")
+	fmt.Println("  --password-file FILE")
+	fmt.Println("                    Password clients log in with (or MONK_SERVE_PASSWORD); needed off loopback")
+	fmt.Println("                    The API flags of mount, such as --hmac-key-id and --header, apply too")
 	fmt.Println()
 	fmt.Println("Examples:")
 	fmt.Println("  # Mount with token from environment")
@@ -150,6 +337,9 @@ func printUsage() {
 	fmt.Println("  # Mount with explicit token")
 	fmt.Println("  monk-fuse mount --token eyJhbGc... ~/monk-data")
 	fmt.Println()
+	fmt.Println("  # Serve over WebDAV instead of mounting")
+	fmt.Println("  monk-fuse serve webdav --listen 127.0.0.1:8080")
+	fmt.Println()
 	fmt.Println("  # Unmount")
 	fmt.Println("  monk-fuse unmount ~/monk-data")
 }
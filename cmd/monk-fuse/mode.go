@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// octalMode is a permission flag given in octal, such as 0600 or 077
+type octalMode uint32
+
+func (m *octalMode) String() string {
+	return fmt.Sprintf("%#o", uint32(*m))
+}
+
+func (m *octalMode) Set(value string) error {
+	v, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || v > 0777 {
+		return fmt.Errorf("invalid mode %q: want octal permission bits such as 0644", value)
+	}
+	*m = octalMode(v)
+	return nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/ianzepp/monk-api-fuse/pkg/monk9p"
+	"github.com/ianzepp/monk-api-fuse/pkg/monkdav"
+	"github.com/ianzepp/monk-api-fuse/pkg/monkftp"
+	"github.com/ianzepp/monk-api-fuse/pkg/monkfuse"
+)
+
+// serveCmd exposes the File API over a network protocol instead of FUSE
+func serveCmd() {
+	if len(os.Args) < 3 {
+		fmt.Fprintln(os.Stderr, "Usage: monk-fuse serve PROTOCOL [options]")
+		fmt.Fprintln(os.Stderr, "Protocols: webdav, 9p, ftp")
+		os.Exit(1)
+	}
+
+	protocol := os.Args[2]
+	serveFlags := flag.NewFlagSet("serve "+protocol, flag.ExitOnError)
+	api := addAPIFlags(serveFlags)
+	listen := serveFlags.String("listen", "", "Address to listen on (default: 127.0.0.1:8080 for webdav, 127.0.0.1:5640 for 9p, 127.0.0.1:2121 for ftp)")
+	readOnly := serveFlags.Bool("read-only", false, "Reject requests that modify data")
+	user := serveFlags.String("user", "monk", "User name clients log in with")
+	passwordFile := serveFlags.String("password-file", "", "File holding the password clients log in with (or set MONK_SERVE_PASSWORD)")
+
+	serveFlags.Parse(os.Args[3:])
+
+	opts, _, err := api.options()
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	apiClient, err := monkfuse.NewClient(opts)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	// Learn what the server supports up front, as a mount does
+	if _, err := apiClient.Negotiate(context.Background()); err != nil {
+		log.Fatalf("Error: negotiate capabilities: %v", err)
+	}
+
+	password, err := servePassword(*passwordFile)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	switch protocol {
+	case "webdav":
+		if *listen == "" {
+			*listen = "127.0.0.1:8080"
+		}
+		// Every client acts with the API credentials given here, so only
+		// local users may connect without logging in
+		if password == "" && !loopback(*listen) {
+			log.Fatalf("Error: %s is not a loopback address; serving WebDAV on it needs a password (--password-file or MONK_SERVE_PASSWORD)", *listen)
+		}
+		handler := monkdav.NewHandler(apiClient, *readOnly)
+		if password != "" {
+			handler.RequireAuth(*user, password)
+		}
+		fmt.Printf("Serving Monk File API over WebDAV at http://%s/\n", *listen)
+		fmt.Printf("API URL: %s\n", opts.APIURL)
+		log.Fatal(http.ListenAndServe(*listen, handler))
+	case "9p":
+		if *listen == "" {
+			*listen = "127.0.0.1:5640"
+		}
+		if !*readOnly {
+			fmt.Println("Note: 9p is always served read-only")
+		}
+		if !loopback(*listen) {
+			log.Printf("Warning: 9P is served without login; anyone who can reach %s reads with these API credentials", *listen)
+		}
+		l, err := net.Listen("tcp", *listen)
+		if err != nil {
+			log.Fatalf("Listen failed: %v", err)
+		}
+		fmt.Printf("Serving Monk File API over 9P2000.L at %s\n", *listen)
+		fmt.Printf("API URL: %s\n", opts.APIURL)
+		log.Fatal(monk9p.NewServer(apiClient, "/").Serve(l))
+	case "ftp":
+		if *listen == "" {
+			*listen = "127.0.0.1:2121"
+		}
+		if !*readOnly {
+			fmt.Println("Note: ftp is always served read-only")
+		}
+		if password == "" && !loopback(*listen) {
+			log.Fatalf("Error: %s is not a loopback address; serving FTP on it needs a password (--password-file or MONK_SERVE_PASSWORD)", *listen)
+		}
+		server := monkftp.NewServer(apiClient)
+		if password != "" {
+			server.RequireLogin(*user, password)
+		}
+		l, err := net.Listen("tcp", *listen)
+		if err != nil {
+			log.Fatalf("Listen failed: %v", err)
+		}
+		fmt.Printf("Serving Monk File API over FTP at %s\n", *listen)
+		fmt.Printf("API URL: %s\n", opts.APIURL)
+		log.Fatal(server.Serve(l))
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown protocol: %s\n", protocol)
+		os.Exit(1)
+	}
+}
+
+// servePassword reads the password clients log in with from passwordFile
+// or MONK_SERVE_PASSWORD; neither means no login
+func servePassword(passwordFile string) (string, error) {
+	password := os.Getenv("MONK_SERVE_PASSWORD")
+	if passwordFile != "" {
+		data, err := os.ReadFile(passwordFile)
+		if err != nil {
+			return "", fmt.Errorf("read password: %w", err)
+		}
+		password = strings.TrimSpace(string(data))
+	}
+	return password, nil
+}
+
+// loopback reports whether a listen address only accepts local
+// connections; an empty host listens on every interface
+func loopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// byteSize is a flag holding a size in bytes, given as a number with an
+// optional K, M, G or T suffix (powers of 1024)
+type byteSize int64
+
+var sizeUnits = []string{"", "K", "M", "G", "T"}
+
+func (s *byteSize) String() string {
+	v, unit := int64(*s), 0
+	for v != 0 && v%1024 == 0 && unit < len(sizeUnits)-1 {
+		v /= 1024
+		unit++
+	}
+	return strconv.FormatInt(v, 10) + sizeUnits[unit]
+}
+
+func (s *byteSize) Set(value string) error {
+	number := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(value)), "B")
+	shift := 0
+	for i := len(sizeUnits) - 1; i > 0; i-- {
+		if strings.HasSuffix(number, sizeUnits[i]) {
+			number, shift = strings.TrimSuffix(number, sizeUnits[i]), 10*i
+			break
+		}
+	}
+	v, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || v < 0 || v > (1<<63-1)>>shift {
+		return fmt.Errorf("invalid size %q: want bytes or a number with a K, M, G or T suffix", value)
+	}
+	*s = byteSize(v << shift)
+	return nil
+}
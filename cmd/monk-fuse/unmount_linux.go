@@ -0,0 +1,15 @@
+package main
+
+import "os/exec"
+
+// unmountCommand returns the command that unmounts mountPoint. Unprivileged
+// FUSE mounts on Linux must be released through the setuid fusermount
+// helper; umount only works as root.
+func unmountCommand(mountPoint string) *exec.Cmd {
+	for _, helper := range []string{"fusermount3", "fusermount"} {
+		if path, err := exec.LookPath(helper); err == nil {
+			return exec.Command(path, "-u", mountPoint)
+		}
+	}
+	return exec.Command("umount", mountPoint)
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package main
+
+import "os/exec"
+
+// unmountCommand returns the command that unmounts mountPoint. macOS and
+// FreeBSD let the mounting user release FUSE mounts with umount.
+func unmountCommand(mountPoint string) *exec.Cmd {
+	return exec.Command("umount", mountPoint)
+}
@@ -2,9 +2,7 @@ module github.com/ianzepp/monk-api-fuse
 
 go 1.25.4
 
-require github.com/hanwen/go-fuse/v2 v2.9.0
-
 require (
-	github.com/google/uuid v1.6.0 // indirect
-	golang.org/x/sys v0.28.0 // indirect
+	github.com/hanwen/go-fuse/v2 v2.9.0
+	golang.org/x/sys v0.28.0
 )
@@ -0,0 +1,117 @@
+package cache
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Budget is a memory limit shared by several stores. When their entries
+// together exceed it, every store evicts its least recently used entries
+// in proportion to the memory it holds, so one busy kind of cached data
+// can't starve the others and the total stays near the limit.
+//
+// Sizes are estimates of the memory an entry keeps alive, not exact heap
+// accounting.
+type Budget struct {
+	limit int64
+	used  atomic.Int64
+
+	mu      sync.Mutex
+	members []*budgetShare
+
+	// reclaiming is held by the one goroutine evicting; others that push
+	// the budget over the limit meanwhile leave the work to it
+	reclaiming sync.Mutex
+}
+
+// budgetMember is a store sharing a budget
+type budgetMember interface {
+	usage() int64
+	evict(bytes int64) int64
+}
+
+// budgetShare is a member and the bytes it still owes from earlier
+// reclaims. Stores evict whole entries, so a store whose share of one
+// reclaim is smaller than an entry pays it off over several; a negative
+// balance is credit for having freed more than its share.
+type budgetShare struct {
+	member budgetMember
+	owed   int64
+}
+
+// NewBudget creates a budget of limit bytes
+func NewBudget(limit int64) *Budget {
+	return &Budget{limit: limit}
+}
+
+// Limit returns the budget in bytes
+func (b *Budget) Limit() int64 {
+	return b.limit
+}
+
+// Used returns the bytes currently held by the stores sharing the budget
+func (b *Budget) Used() int64 {
+	return b.used.Load()
+}
+
+// join adds a store to the budget
+func (b *Budget) join(m budgetMember) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.members = append(b.members, &budgetShare{member: m})
+}
+
+// charge records that a store's usage changed by delta bytes, reclaiming
+// memory if that puts the budget over its limit. Stores call it without
+// holding any shard lock, since reclaiming locks their shards.
+func (b *Budget) charge(delta int64) {
+	if b.used.Add(delta) > b.limit {
+		b.reclaim()
+	}
+}
+
+// reclaim evicts from every member in proportion to its share of the
+// usage until the budget is back under its limit
+func (b *Budget) reclaim() {
+	if !b.reclaiming.TryLock() {
+		return
+	}
+	defer b.reclaiming.Unlock()
+
+	// Members are only ever added, and balances are only touched while
+	// reclaiming
+	b.mu.Lock()
+	members := b.members
+	b.mu.Unlock()
+
+	for {
+		used := b.used.Load()
+		over := used - b.limit
+		if over <= 0 {
+			return
+		}
+
+		freed := int64(0)
+		for _, s := range members {
+			s.owed += int64(float64(over) * float64(s.member.usage()) / float64(used))
+			if s.owed > 0 {
+				n := s.member.evict(s.owed)
+				s.owed -= n
+				freed += n
+			}
+		}
+		if freed == 0 {
+			// Nothing owed enough yet; take the rest from whichever store
+			// can give it
+			for _, s := range members {
+				if freed = s.member.evict(over); freed > 0 {
+					s.owed -= freed
+					break
+				}
+			}
+		}
+		if freed == 0 {
+			return
+		}
+	}
+}
@@ -2,7 +2,6 @@ package cache
 
 import (
 	"path/filepath"
-	"sync"
 	"time"
 
 	"github.com/ianzepp/monk-api-fuse/pkg/monkapi"
@@ -10,71 +9,65 @@ import (
 
 // MetadataCache caches file and directory metadata to reduce API calls
 type MetadataCache struct {
-	mu      sync.RWMutex
-	entries map[string]*CacheEntry
-	ttl     time.Duration
+	store *Store[*monkapi.StatResponse]
 }
 
-// CacheEntry represents a cached metadata entry
-type CacheEntry struct {
-	data      *monkapi.StatResponse
-	timestamp time.Time
+// NewMetadataCache creates a new metadata cache with the specified TTL,
+// holding at most maxEntries paths; zero is unbounded
+func NewMetadataCache(ttl time.Duration, maxEntries int) *MetadataCache {
+	return &MetadataCache{store: NewStore[*monkapi.StatResponse](ttl, maxEntries)}
 }
 
-// NewMetadataCache creates a new metadata cache with the specified TTL
-func NewMetadataCache(ttl time.Duration) *MetadataCache {
-	return &MetadataCache{
-		entries: make(map[string]*CacheEntry),
-		ttl:     ttl,
-	}
+// ShareBudget counts the cached metadata against b
+func (c *MetadataCache) ShareBudget(b *Budget) {
+	c.store.ShareBudget(b, MetadataSize)
 }
 
 // Get retrieves metadata from cache if available and not expired
 func (c *MetadataCache) Get(path string) *monkapi.StatResponse {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-
-	entry, ok := c.entries[path]
-	if !ok {
-		return nil
-	}
+	data, _ := c.store.Get(path)
+	return data
+}
 
-	// Check TTL
-	if time.Since(entry.timestamp) > c.ttl {
-		return nil
-	}
+// GetStale retrieves metadata from cache even if it has expired
+func (c *MetadataCache) GetStale(path string) *monkapi.StatResponse {
+	data, _ := c.store.GetStale(path)
+	return data
+}
 
-	return entry.data
+// Peek retrieves metadata from cache, expired or not, and when it expires
+func (c *MetadataCache) Peek(path string) (*monkapi.StatResponse, time.Time) {
+	data, expires, _ := c.store.Peek(path)
+	return data, expires
 }
 
 // Set stores metadata in cache
 func (c *MetadataCache) Set(path string, data *monkapi.StatResponse) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	c.store.Set(path, data)
+}
 
-	c.entries[path] = &CacheEntry{
-		data:      data,
-		timestamp: time.Now(),
-	}
+// Generation returns a number that changes whenever metadata is
+// invalidated; read it before fetching metadata to store with SetSince
+func (c *MetadataCache) Generation() uint64 {
+	return c.store.Generation()
+}
+
+// SetSince stores metadata fetched after Generation returned gen, unless
+// metadata was invalidated since
+func (c *MetadataCache) SetSince(path string, data *monkapi.StatResponse, gen uint64) {
+	c.store.SetSince(path, data, gen)
 }
 
 // Invalidate removes a path and its parent directories from cache
 func (c *MetadataCache) Invalidate(path string) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	delete(c.entries, path)
-
-	// Invalidate parent directories
+	paths := []string{path}
 	for parent := filepath.Dir(path); parent != "/" && parent != "."; parent = filepath.Dir(parent) {
-		delete(c.entries, parent)
+		paths = append(paths, parent)
 	}
+	c.store.Delete(paths...)
 }
 
 // Clear removes all entries from cache
 func (c *MetadataCache) Clear() {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	c.entries = make(map[string]*CacheEntry)
+	c.store.Clear()
 }
@@ -0,0 +1,62 @@
+package cache
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/ianzepp/monk-api-fuse/pkg/monkapi"
+)
+
+// ListingCache caches directory listings, so repeated Readdir calls on the
+// same directory don't each cost a list request
+type ListingCache struct {
+	store *Store[[]monkapi.FileEntry]
+}
+
+// NewListingCache creates a new listing cache with the specified TTL
+func NewListingCache(ttl time.Duration) *ListingCache {
+	return &ListingCache{store: NewStore[[]monkapi.FileEntry](ttl, 0)}
+}
+
+// ShareBudget counts the cached listings against b
+func (c *ListingCache) ShareBudget(b *Budget) {
+	c.store.ShareBudget(b, ListingSize)
+}
+
+// Get retrieves the listing of dir if available and not expired
+func (c *ListingCache) Get(dir string) ([]monkapi.FileEntry, bool) {
+	return c.store.Get(dir)
+}
+
+// GetStale retrieves the listing of dir even if it has expired
+func (c *ListingCache) GetStale(dir string) ([]monkapi.FileEntry, bool) {
+	return c.store.GetStale(dir)
+}
+
+// Set stores the listing of dir
+func (c *ListingCache) Set(dir string, entries []monkapi.FileEntry) {
+	c.store.Set(dir, entries)
+}
+
+// Generation returns a number that changes whenever listings are
+// invalidated; read it before listing a directory to store with SetSince
+func (c *ListingCache) Generation() uint64 {
+	return c.store.Generation()
+}
+
+// SetSince stores the listing of dir fetched after Generation returned
+// gen, unless listings were invalidated since
+func (c *ListingCache) SetSince(dir string, entries []monkapi.FileEntry, gen uint64) {
+	c.store.SetSince(dir, entries, gen)
+}
+
+// Invalidate removes the listing of path, if it is a directory, and of the
+// directory containing it, after path was written, created or removed
+func (c *ListingCache) Invalidate(path string) {
+	c.store.Delete(path, filepath.Dir(path))
+}
+
+// Clear removes all listings from cache
+func (c *ListingCache) Clear() {
+	c.store.Clear()
+}
@@ -0,0 +1,55 @@
+package cache
+
+import (
+	"unsafe"
+
+	"github.com/ianzepp/monk-api-fuse/pkg/monkapi"
+)
+
+// contextEntryOverhead estimates the memory of one api_context map entry
+// besides its key and value contents
+const contextEntryOverhead = 48
+
+// MetadataSize estimates the memory a cached stat response keeps alive
+func MetadataSize(stat *monkapi.StatResponse) int64 {
+	if stat == nil {
+		return 0
+	}
+	m := &stat.FileMetadata
+	return int64(unsafe.Sizeof(*stat)) +
+		int64(len(m.ModifiedTime)+len(m.CreatedTime)+len(m.AccessTime)+len(m.Type)+
+			len(m.Permissions)+len(m.ContentType)+len(m.SHA256)+len(stat.Type)) +
+		contextSize(stat.APIContext)
+}
+
+// ListingSize estimates the memory a cached directory listing keeps alive
+func ListingSize(entries []monkapi.FileEntry) int64 {
+	size := int64(cap(entries)) * int64(unsafe.Sizeof(monkapi.FileEntry{}))
+	for i := range entries {
+		e := &entries[i]
+		size += int64(len(e.Name)+len(e.FileType)+len(e.FilePermissions)+len(e.FileModified)+len(e.Path)) +
+			contextSize(e.APIContext)
+	}
+	return size
+}
+
+// contextSize estimates the memory of decoded api_context JSON
+func contextSize(v interface{}) int64 {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		size := int64(0)
+		for key, value := range v {
+			size += contextEntryOverhead + int64(len(key)) + contextSize(value)
+		}
+		return size
+	case []interface{}:
+		size := int64(0)
+		for _, value := range v {
+			size += 16 + contextSize(value)
+		}
+		return size
+	case string:
+		return int64(len(v))
+	}
+	return 0
+}
@@ -0,0 +1,320 @@
+package cache
+
+import (
+	"container/list"
+	"hash/maphash"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// storeShards is the number of independently locked parts of a store.
+// Parallel builds call Getattr on many paths at once, and a single lock
+// over the whole map becomes their bottleneck.
+const storeShards = 32
+
+// ttlJitter spreads each entry's lifetime over ±10% of the TTL. Entries
+// stored together, such as the children of a listed directory, would
+// otherwise all expire at once and be revalidated in one burst.
+const ttlJitter = 0.1
+
+// Store is a cache of one kind of value keyed by path, whose entries
+// expire after the store's TTL. The metadata and listing caches are built
+// on it, and new kinds of cached data should be too.
+//
+// A store created with a maximum entry count evicts the least recently
+// used paths beyond it. Recency is tracked per shard, so eviction is LRU
+// within each shard, which approximates it over the whole store. A store
+// sharing a Budget also evicts that way when the budget runs out.
+type Store[V any] struct {
+	seed     maphash.Seed
+	shards   []storeShard[V]
+	ttl      time.Duration
+	shardMax int // entries per shard; zero is unbounded
+
+	budget *Budget       // nil unless ShareBudget was called
+	sizeOf func(V) int64 // estimated size of a value, with a budget
+	used   atomic.Int64  // bytes held, with a budget
+	next   atomic.Uint32 // shard to evict from next
+
+	// gen counts calls to Delete and Clear, so a value fetched before
+	// one is not stored after it
+	gen atomic.Uint64
+}
+
+// entryOverhead estimates the memory an entry costs besides its path and
+// value: the map slot, list element and entry struct
+const entryOverhead = 128
+
+// storeShard holds the entries of the paths hashing to it, most recently
+// used first
+type storeShard[V any] struct {
+	mu      sync.RWMutex
+	entries map[string]*list.Element
+	lru     list.List
+}
+
+// storeEntry is a cached value and when it expires
+type storeEntry[V any] struct {
+	path    string
+	value   V
+	expires time.Time
+	size    int64 // estimated bytes, with a budget
+}
+
+// NewStore creates a store whose entries expire after ttl and which holds
+// at most maxEntries paths; zero is unbounded
+func NewStore[V any](ttl time.Duration, maxEntries int) *Store[V] {
+	return newStore[V](ttl, maxEntries, storeShards)
+}
+
+// newStore creates a store split into the given number of shards
+func newStore[V any](ttl time.Duration, maxEntries, shards int) *Store[V] {
+	s := &Store[V]{seed: maphash.MakeSeed(), ttl: ttl, shards: make([]storeShard[V], shards)}
+	if maxEntries > 0 {
+		s.shardMax = max(maxEntries/shards, 1)
+	}
+	for i := range s.shards {
+		s.shards[i].entries = make(map[string]*list.Element)
+	}
+	return s
+}
+
+// ShareBudget makes the store count its entries against b, using size to
+// estimate the memory of each value. It must be called before the store is
+// used.
+func (s *Store[V]) ShareBudget(b *Budget, size func(V) int64) {
+	s.budget, s.sizeOf = b, size
+	b.join(s)
+}
+
+// tracksUse reports whether Get records recency for eviction
+func (s *Store[V]) tracksUse() bool {
+	return s.shardMax > 0 || s.budget != nil
+}
+
+// shard returns the shard holding path
+func (s *Store[V]) shard(path string) *storeShard[V] {
+	return &s.shards[maphash.String(s.seed, path)%uint64(len(s.shards))]
+}
+
+// Get retrieves the value for path if available and not expired
+func (s *Store[V]) Get(path string) (V, bool) {
+	var zero V
+	sh := s.shard(path)
+
+	// Only a bounded store records use, which needs the write lock
+	if s.tracksUse() {
+		sh.mu.Lock()
+		defer sh.mu.Unlock()
+	} else {
+		sh.mu.RLock()
+		defer sh.mu.RUnlock()
+	}
+
+	elem, ok := sh.entries[path]
+	if !ok {
+		return zero, false
+	}
+	entry := elem.Value.(*storeEntry[V])
+	if time.Now().After(entry.expires) {
+		return zero, false
+	}
+	if s.tracksUse() {
+		sh.lru.MoveToFront(elem)
+	}
+	return entry.value, true
+}
+
+// GetStale retrieves the value for path even if it has expired, as long as
+// it has not been evicted or deleted
+func (s *Store[V]) GetStale(path string) (V, bool) {
+	value, _, ok := s.Peek(path)
+	return value, ok
+}
+
+// Peek retrieves the value for path, expired or not, and when it expires
+func (s *Store[V]) Peek(path string) (V, time.Time, bool) {
+	var zero V
+	sh := s.shard(path)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	elem, ok := sh.entries[path]
+	if !ok {
+		return zero, time.Time{}, false
+	}
+	entry := elem.Value.(*storeEntry[V])
+	return entry.value, entry.expires, true
+}
+
+// Set stores the value for path, evicting the least recently used path of
+// its shard if that makes the shard too large
+func (s *Store[V]) Set(path string, value V) {
+	s.set(path, value, false, 0)
+}
+
+// Generation returns a number that changes whenever values are deleted or
+// cleared. Read it before fetching a value to store with SetSince.
+func (s *Store[V]) Generation() uint64 {
+	return s.gen.Load()
+}
+
+// SetSince stores the value for path like Set, unless values were deleted
+// since Generation returned gen: the value was fetched before then and may
+// be what was deleted. It reports whether the value was stored.
+func (s *Store[V]) SetSince(path string, value V, gen uint64) bool {
+	return s.set(path, value, true, gen)
+}
+
+// set stores the value for path, if checked only when the generation is
+// still gen. The generation is checked under the shard lock, and Delete
+// moves it on before taking the lock, so a value it races with is either
+// not stored or deleted.
+func (s *Store[V]) set(path string, value V, checked bool, gen uint64) bool {
+	entry := &storeEntry[V]{path: path, value: value, expires: time.Now().Add(s.jitteredTTL())}
+	if s.budget != nil {
+		entry.size = entryOverhead + int64(len(path)) + s.sizeOf(value)
+	}
+
+	sh := s.shard(path)
+	sh.mu.Lock()
+	if checked && s.gen.Load() != gen {
+		sh.mu.Unlock()
+		return false
+	}
+	delta := entry.size
+	if elem, ok := sh.entries[path]; ok {
+		delta -= elem.Value.(*storeEntry[V]).size
+		elem.Value = entry
+		sh.lru.MoveToFront(elem)
+	} else {
+		sh.entries[path] = sh.lru.PushFront(entry)
+		if s.shardMax > 0 && sh.lru.Len() > s.shardMax {
+			delta -= sh.removeOldest()
+		}
+	}
+	sh.mu.Unlock()
+
+	s.charge(delta)
+	return true
+}
+
+// removeOldest removes the least recently used entry of the shard, which
+// must be locked and not empty, returning its size
+func (sh *storeShard[V]) removeOldest() int64 {
+	oldest := sh.lru.Back()
+	sh.lru.Remove(oldest)
+	entry := oldest.Value.(*storeEntry[V])
+	delete(sh.entries, entry.path)
+	return entry.size
+}
+
+// charge records a change in the bytes the store holds against its budget
+func (s *Store[V]) charge(delta int64) {
+	if s.budget == nil || delta == 0 {
+		return
+	}
+	s.used.Add(delta)
+	s.budget.charge(delta)
+}
+
+// usage returns the bytes the store holds against its budget
+func (s *Store[V]) usage() int64 {
+	return s.used.Load()
+}
+
+// evict removes least recently used entries, a shard at a time, until at
+// least bytes have been freed or the store is empty, returning the bytes
+// freed
+func (s *Store[V]) evict(bytes int64) int64 {
+	freed := int64(0)
+	for empty := 0; freed < bytes && empty < len(s.shards); {
+		sh := &s.shards[s.next.Add(1)%uint32(len(s.shards))]
+		sh.mu.Lock()
+		if sh.lru.Len() == 0 {
+			empty++
+		} else {
+			empty = 0
+			freed += sh.removeOldest()
+		}
+		sh.mu.Unlock()
+	}
+	s.used.Add(-freed)
+	s.budget.used.Add(-freed)
+	return freed
+}
+
+// Delete removes the values for paths
+func (s *Store[V]) Delete(paths ...string) {
+	s.gen.Add(1)
+	freed := int64(0)
+	for _, path := range paths {
+		sh := s.shard(path)
+		sh.mu.Lock()
+		if elem, ok := sh.entries[path]; ok {
+			sh.lru.Remove(elem)
+			delete(sh.entries, path)
+			freed += elem.Value.(*storeEntry[V]).size
+		}
+		sh.mu.Unlock()
+	}
+	s.charge(-freed)
+}
+
+// Clear removes all values
+func (s *Store[V]) Clear() {
+	s.gen.Add(1)
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.Lock()
+		freed := int64(0)
+		for elem := sh.lru.Front(); elem != nil && s.budget != nil; elem = elem.Next() {
+			freed += elem.Value.(*storeEntry[V]).size
+		}
+		sh.entries = make(map[string]*list.Element)
+		sh.lru.Init()
+		sh.mu.Unlock()
+		s.charge(-freed)
+	}
+}
+
+// Sweep removes expired values. It is for stores whose expired values are
+// never read with GetStale or Peek, and so would only hold memory until
+// evicted.
+func (s *Store[V]) Sweep() {
+	now := time.Now()
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.Lock()
+		freed := int64(0)
+		for path, elem := range sh.entries {
+			if entry := elem.Value.(*storeEntry[V]); now.After(entry.expires) {
+				sh.lru.Remove(elem)
+				delete(sh.entries, path)
+				freed += entry.size
+			}
+		}
+		sh.mu.Unlock()
+		s.charge(-freed)
+	}
+}
+
+// Len returns the number of stored paths, including expired ones not yet
+// evicted
+func (s *Store[V]) Len() int {
+	n := 0
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.RLock()
+		n += len(sh.entries)
+		sh.mu.RUnlock()
+	}
+	return n
+}
+
+// jitteredTTL returns the TTL varied randomly by up to ttlJitter
+func (s *Store[V]) jitteredTTL() time.Duration {
+	return time.Duration(float64(s.ttl) * (1 + ttlJitter*(2*rand.Float64()-1)))
+}
@@ -0,0 +1,53 @@
+package cache
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// benchmarkStore runs Get and Set from parallel goroutines against a store
+// with the given number of shards, one Set for every setEvery operations;
+// zero only gets
+func benchmarkStore(b *testing.B, shards, setEvery int) {
+	const paths = 4096
+	s := newStore[int](time.Minute, 0, shards)
+	keys := make([]string, paths)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("/dir%02d/file%04d", i%64, i)
+		s.Set(keys[i], i)
+	}
+
+	var worker atomic.Int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := int(worker.Add(1)) * 7919
+		for pb.Next() {
+			key := keys[i%paths]
+			if setEvery > 0 && i%setEvery == 0 {
+				s.Set(key, i)
+			} else {
+				s.Get(key)
+			}
+			i++
+		}
+	})
+}
+
+func BenchmarkStore(b *testing.B) {
+	for _, bench := range []struct {
+		name     string
+		setEvery int
+	}{
+		{"Get", 0},
+		{"Mixed", 10},
+		{"Set", 1},
+	} {
+		for _, shards := range []int{1, storeShards} {
+			b.Run(fmt.Sprintf("%s/shards=%d", bench.name, shards), func(b *testing.B) {
+				benchmarkStore(b, shards, bench.setEvery)
+			})
+		}
+	}
+}
@@ -0,0 +1,696 @@
+// Package mockserver implements the Monk File API over an in-memory tree,
+// for exercising the client and filesystem without a real Monk API
+package mockserver
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// node is a file or directory in the tree
+type node struct {
+	dir      bool
+	content  []byte
+	modified time.Time
+	sha256   string // hex digest of content, computed on first use
+	perm     string // symbolic permissions set by update, if any
+	accessed time.Time
+	context  map[string]interface{}
+}
+
+// fault is an injected failure for a path
+type fault struct {
+	status int
+	code   string
+}
+
+// Server serves the File API endpoints (list, stat, retrieve, store,
+// delete, copy, move, lock, unlock) from memory. Pick parameters filter the fields of
+// the response data as the real API does.
+type Server struct {
+	mu     sync.Mutex
+	nodes  map[string]*node
+	faults map[string]fault
+	locks  map[string]*lock
+	lockID int
+
+	// features are advertised by the capabilities endpoint; nil serves
+	// a server that predates it
+	features []string
+}
+
+// lock is the set of advisory locks held on a path
+type lock struct {
+	exclusive bool
+	holders   map[string]time.Time // lock ID to expiry
+}
+
+// New creates a server with an empty root directory
+func New() *Server {
+	return &Server{
+		nodes:  map[string]*node{"/": {dir: true, modified: time.Now()}},
+		faults: make(map[string]fault),
+		locks:  make(map[string]*lock),
+	}
+}
+
+// Put creates or replaces a file, creating parent directories
+func (s *Server) Put(p string, content []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p = path.Clean("/" + p)
+	s.mkdirAll(path.Dir(p))
+	s.nodes[p] = &node{content: content, modified: time.Now()}
+}
+
+// Mkdir creates a directory and its parents
+func (s *Server) Mkdir(p string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mkdirAll(path.Clean("/" + p))
+}
+
+// Get returns a file's content
+func (s *Server) Get(p string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n, ok := s.nodes[path.Clean("/"+p)]
+	if !ok || n.dir {
+		return nil, false
+	}
+	return n.content, true
+}
+
+// SetFeatures makes the server advertise features and behave like a server
+// with exactly those: ranges are ignored without ranged_reads, and move and
+// stat_batch exist only when listed
+func (s *Server) SetFeatures(features ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.features = append([]string{}, features...)
+}
+
+// hasFeature reports whether the server supports feature; one without a
+// feature list has the features every server has
+func (s *Server) hasFeature(feature string) bool {
+	if s.features == nil {
+		return feature == "ranged_reads" || feature == "move"
+	}
+	return slices.Contains(s.features, feature)
+}
+
+// SetContext sets the api_context reported for an existing path
+func (s *Server) SetContext(p string, apiContext map[string]interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if n, ok := s.nodes[p]; ok {
+		n.context = apiContext
+	}
+}
+
+// Inject makes every request for path, including copies and moves from
+// it, fail with status and errorCode until ClearFaults is called
+func (s *Server) Inject(p string, status int, errorCode string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults[path.Clean("/"+p)] = fault{status: status, code: errorCode}
+}
+
+// ClearFaults removes all injected failures
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = make(map[string]fault)
+}
+
+func (s *Server) mkdirAll(p string) {
+	for dir := p; ; dir = path.Dir(dir) {
+		if _, ok := s.nodes[dir]; !ok {
+			s.nodes[dir] = &node{dir: true, modified: time.Now()}
+		}
+		if dir == "/" {
+			return
+		}
+	}
+}
+
+// request is the union of the File API request bodies
+type request struct {
+	Path        string          `json:"path"`
+	Paths       []string        `json:"paths"`
+	Source      string          `json:"source"`
+	Destination string          `json:"destination"`
+	Content     json.RawMessage `json:"content"`
+	Ranges      []struct {
+		Offset  int    `json:"offset"`
+		Content string `json:"content"`
+	} `json:"ranges"`
+	LockID   string `json:"lock_id"`
+	Metadata struct {
+		Permissions  string `json:"permissions"`
+		AccessTime   string `json:"access_time"`
+		ModifiedTime string `json:"modified_time"`
+		Owner        string `json:"owner"`
+	} `json:"file_metadata"`
+	FileOptions struct {
+		Recursive     bool   `json:"recursive"`
+		StartOffset   int    `json:"start_offset"`
+		MaxBytes      int    `json:"max_bytes"`
+		Encoding      string `json:"encoding"`
+		CreateMissing bool   `json:"create_missing"`
+		Overwrite     bool   `json:"overwrite"`
+		Exclusive     bool   `json:"exclusive"`
+		TTL           int    `json:"ttl"`
+		LockID        string `json:"lock_id"`
+		Size          *int   `json:"size"`
+	} `json:"file_options"`
+}
+
+// queryRequest decodes a GET read request: the path, and each other
+// parameter except pick as a file option. Values that parse as JSON
+// (numbers, booleans) keep their type.
+func queryRequest(q url.Values, req *request) error {
+	req.Path = q.Get("path")
+
+	opts := make(map[string]json.RawMessage)
+	for name := range q {
+		if name == "path" || name == "pick" {
+			continue
+		}
+		v := q.Get(name)
+		if json.Valid([]byte(v)) && !strings.HasPrefix(v, "\"") {
+			opts[name] = json.RawMessage(v)
+		} else {
+			opts[name], _ = json.Marshal(v)
+		}
+	}
+	data, err := json.Marshal(opts)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &req.FileOptions)
+}
+
+// apiError is a failed request
+type apiError struct {
+	status int
+	code   string
+	msg    string
+}
+
+var errNotFound = &apiError{http.StatusNotFound, "NOT_FOUND", "not found"}
+
+// ServeHTTP handles a File API request
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	op, ok := strings.CutPrefix(r.URL.Path, "/api/file/")
+	if !ok {
+		writeError(w, &apiError{http.StatusNotFound, "NOT_FOUND", "unknown endpoint"})
+		return
+	}
+
+	var req request
+	switch r.Method {
+	case "POST":
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, &apiError{http.StatusBadRequest, "INVALID_REQUEST", err.Error()})
+			return
+		}
+	case "GET":
+		if op != "list" && op != "stat" && op != "retrieve" && op != "capabilities" {
+			writeError(w, &apiError{http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "use POST"})
+			return
+		}
+		if err := queryRequest(r.URL.Query(), &req); err != nil {
+			writeError(w, &apiError{http.StatusBadRequest, "INVALID_REQUEST", err.Error()})
+			return
+		}
+	default:
+		writeError(w, &apiError{http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "use GET or POST"})
+		return
+	}
+	req.Path = path.Clean("/" + req.Path)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, ok := s.faults[req.Path]
+	if !ok && req.Source != "" {
+		f, ok = s.faults[path.Clean("/"+req.Source)]
+	}
+	if ok {
+		writeError(w, &apiError{f.status, f.code, "injected failure"})
+		return
+	}
+
+	var data map[string]interface{}
+	var apiErr *apiError
+	switch op {
+	case "list":
+		data, apiErr = s.list(req)
+	case "stat":
+		data, apiErr = s.stat(req)
+	case "retrieve":
+		data, apiErr = s.retrieve(req)
+	case "store":
+		data, apiErr = s.store(req)
+	case "patch":
+		if !s.hasFeature("patch") {
+			apiErr = &apiError{http.StatusNotFound, "NOT_FOUND", "unknown endpoint"}
+			break
+		}
+		data, apiErr = s.patch(req)
+	case "delete":
+		data, apiErr = s.delete(req)
+	case "copy":
+		data, apiErr = s.relocate(req, false)
+	case "move":
+		if !s.hasFeature("move") {
+			apiErr = &apiError{http.StatusNotFound, "NOT_FOUND", "unknown endpoint"}
+			break
+		}
+		data, apiErr = s.relocate(req, true)
+	case "stat_batch":
+		data, apiErr = s.statBatch(req)
+	case "capabilities":
+		if s.features == nil {
+			apiErr = &apiError{http.StatusNotFound, "NOT_FOUND", "unknown endpoint"}
+			break
+		}
+		data = map[string]interface{}{"version": "mock", "features": s.features}
+	case "update":
+		data, apiErr = s.update(req)
+	case "lock":
+		data, apiErr = s.lock(req)
+	case "unlock":
+		data, apiErr = s.unlock(req)
+	default:
+		apiErr = &apiError{http.StatusNotFound, "NOT_FOUND", "unknown endpoint"}
+	}
+	if apiErr != nil {
+		writeError(w, apiErr)
+		return
+	}
+
+	if pick := r.URL.Query().Get("pick"); pick != "" {
+		picked := make(map[string]interface{})
+		for _, field := range strings.Split(pick, ",") {
+			if v, ok := data[field]; ok {
+				picked[field] = v
+			}
+		}
+		data = picked
+	}
+
+	data["success"] = true
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "data": data})
+}
+
+func (s *Server) list(req request) (map[string]interface{}, *apiError) {
+	n, ok := s.nodes[req.Path]
+	if !ok {
+		return nil, errNotFound
+	}
+	if !n.dir {
+		return nil, &apiError{http.StatusBadRequest, "NOT_A_DIRECTORY", "not a directory"}
+	}
+
+	var paths []string
+	for p := range s.nodes {
+		if p == req.Path {
+			continue
+		}
+		if req.FileOptions.Recursive && isBelow(p, req.Path) || path.Dir(p) == req.Path {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+
+	entries := make([]map[string]interface{}, 0, len(paths))
+	for _, p := range paths {
+		entries = append(entries, entry(p, s.nodes[p]))
+	}
+	return map[string]interface{}{
+		"entries":       entries,
+		"total":         len(entries),
+		"has_more":      false,
+		"file_metadata": metadata(n),
+	}, nil
+}
+
+func (s *Server) stat(req request) (map[string]interface{}, *apiError) {
+	n, ok := s.nodes[req.Path]
+	if !ok {
+		return nil, errNotFound
+	}
+	return map[string]interface{}{
+		"type":          fileType(n),
+		"file_metadata": metadata(n),
+		"api_context":   n.context,
+	}, nil
+}
+
+func (s *Server) statBatch(req request) (map[string]interface{}, *apiError) {
+	if !s.hasFeature("batch_stat") {
+		return nil, &apiError{http.StatusNotFound, "NOT_FOUND", "unknown endpoint"}
+	}
+
+	results := make([]map[string]interface{}, 0, len(req.Paths))
+	for _, p := range req.Paths {
+		p = path.Clean("/" + p)
+		stat, apiErr := s.stat(request{Path: p})
+		if apiErr != nil {
+			results = append(results, map[string]interface{}{
+				"path": p, "status": apiErr.status, "error_code": apiErr.code, "error": apiErr.msg,
+			})
+			continue
+		}
+		results = append(results, map[string]interface{}{"path": p, "stat": stat})
+	}
+	return map[string]interface{}{"results": results}, nil
+}
+
+func (s *Server) retrieve(req request) (map[string]interface{}, *apiError) {
+	n, ok := s.nodes[req.Path]
+	if !ok {
+		return nil, errNotFound
+	}
+	if n.dir {
+		return nil, &apiError{http.StatusBadRequest, "IS_A_DIRECTORY", "is a directory"}
+	}
+
+	content := n.content
+	if s.hasFeature("ranged_reads") {
+		start := min(req.FileOptions.StartOffset, len(content))
+		content = content[start:]
+		if max := req.FileOptions.MaxBytes; max > 0 && max < len(content) {
+			content = content[:max]
+		}
+	}
+
+	data := map[string]interface{}{"file_metadata": metadata(n)}
+	if req.FileOptions.Encoding == "base64" {
+		data["content"] = base64.StdEncoding.EncodeToString(content)
+		data["encoding"] = "base64"
+	} else {
+		data["content"] = string(content)
+	}
+	return data, nil
+}
+
+func (s *Server) store(req request) (map[string]interface{}, *apiError) {
+	if n, ok := s.nodes[req.Path]; ok && n.dir {
+		return nil, &apiError{http.StatusBadRequest, "IS_A_DIRECTORY", "is a directory"}
+	}
+	parent, ok := s.nodes[path.Dir(req.Path)]
+	if !ok && !req.FileOptions.CreateMissing {
+		return nil, errNotFound
+	}
+	if ok && !parent.dir {
+		return nil, &apiError{http.StatusBadRequest, "NOT_A_DIRECTORY", "parent is not a directory"}
+	}
+
+	var content []byte
+	var text string
+	if err := json.Unmarshal(req.Content, &text); err == nil {
+		content = []byte(text)
+		if req.FileOptions.Encoding == "base64" {
+			decoded, err := base64.StdEncoding.DecodeString(text)
+			if err != nil {
+				return nil, &apiError{http.StatusUnprocessableEntity, "VALIDATION_FAILED", "invalid base64 content"}
+			}
+			content = decoded
+		}
+	} else {
+		// Structured content is stored in its JSON form
+		content = []byte(req.Content)
+	}
+
+	s.mkdirAll(path.Dir(req.Path))
+	n := &node{content: content, modified: time.Now()}
+	if old, ok := s.nodes[req.Path]; ok {
+		n.perm = old.perm
+	}
+	s.nodes[req.Path] = n
+	return map[string]interface{}{"file_metadata": metadata(n)}, nil
+}
+
+func (s *Server) patch(req request) (map[string]interface{}, *apiError) {
+	n, ok := s.nodes[req.Path]
+	if !ok {
+		return nil, errNotFound
+	}
+	if n.dir {
+		return nil, &apiError{http.StatusBadRequest, "IS_A_DIRECTORY", "is a directory"}
+	}
+
+	content := n.content
+	for _, r := range req.Ranges {
+		data, err := base64.StdEncoding.DecodeString(r.Content)
+		if err != nil || r.Offset < 0 {
+			return nil, &apiError{http.StatusUnprocessableEntity, "VALIDATION_FAILED", "invalid range"}
+		}
+		if end := r.Offset + len(data); end > len(content) {
+			content = append(content, make([]byte, end-len(content))...)
+		}
+		copy(content[r.Offset:], data)
+	}
+	if size := req.FileOptions.Size; size != nil {
+		if *size < len(content) {
+			content = content[:*size]
+		} else {
+			content = append(content, make([]byte, *size-len(content))...)
+		}
+	}
+
+	n.content = content
+	n.modified = time.Now()
+	return map[string]interface{}{"file_metadata": metadata(n)}, nil
+}
+
+func (s *Server) delete(req request) (map[string]interface{}, *apiError) {
+	n, ok := s.nodes[req.Path]
+	if !ok {
+		return nil, errNotFound
+	}
+	if req.Path == "/" {
+		return nil, &apiError{http.StatusForbidden, "FORBIDDEN", "cannot delete root"}
+	}
+
+	children := false
+	for p := range s.nodes {
+		if isBelow(p, req.Path) {
+			children = true
+			break
+		}
+	}
+	if n.dir && children && !req.FileOptions.Recursive {
+		return nil, &apiError{http.StatusConflict, "DIRECTORY_NOT_EMPTY", "directory not empty"}
+	}
+
+	for p := range s.nodes {
+		if p == req.Path || isBelow(p, req.Path) {
+			delete(s.nodes, p)
+		}
+	}
+	return map[string]interface{}{}, nil
+}
+
+func (s *Server) relocate(req request, move bool) (map[string]interface{}, *apiError) {
+	source := path.Clean("/" + req.Source)
+	dest := path.Clean("/" + req.Destination)
+
+	n, ok := s.nodes[source]
+	if !ok {
+		return nil, errNotFound
+	}
+	if n.dir {
+		return nil, &apiError{http.StatusBadRequest, "IS_A_DIRECTORY", "only files can be copied or moved"}
+	}
+	if _, exists := s.nodes[dest]; exists && !req.FileOptions.Overwrite {
+		return nil, &apiError{http.StatusConflict, "ALREADY_EXISTS", "destination exists"}
+	}
+	if parent, ok := s.nodes[path.Dir(dest)]; !ok || !parent.dir {
+		return nil, errNotFound
+	}
+
+	copied := &node{content: append([]byte(nil), n.content...), modified: time.Now(), perm: n.perm}
+	s.nodes[dest] = copied
+	if move {
+		delete(s.nodes, source)
+	}
+	return map[string]interface{}{"file_metadata": metadata(copied)}, nil
+}
+
+func (s *Server) update(req request) (map[string]interface{}, *apiError) {
+	n, ok := s.nodes[req.Path]
+	if !ok {
+		return nil, errNotFound
+	}
+	if p := req.Metadata.Permissions; p != "" {
+		if len(p) != 9 || strings.Trim(p, "rwx-") != "" {
+			return nil, &apiError{http.StatusUnprocessableEntity, "VALIDATION_FAILED", "invalid permissions"}
+		}
+		n.perm = p
+	}
+	if t := req.Metadata.AccessTime; t != "" {
+		accessed, err := time.Parse(time.RFC3339, t)
+		if err != nil {
+			return nil, &apiError{http.StatusUnprocessableEntity, "VALIDATION_FAILED", "invalid access_time"}
+		}
+		n.accessed = accessed
+	}
+	if t := req.Metadata.ModifiedTime; t != "" {
+		modified, err := time.Parse(time.RFC3339, t)
+		if err != nil {
+			return nil, &apiError{http.StatusUnprocessableEntity, "VALIDATION_FAILED", "invalid modified_time"}
+		}
+		n.modified = modified
+	}
+	if req.Metadata.Owner != "" {
+		if n.context == nil {
+			n.context = make(map[string]interface{})
+		}
+		n.context["owner"] = req.Metadata.Owner
+	}
+	return map[string]interface{}{"file_metadata": metadata(n)}, nil
+}
+
+func (s *Server) lock(req request) (map[string]interface{}, *apiError) {
+	if _, ok := s.nodes[req.Path]; !ok {
+		return nil, errNotFound
+	}
+
+	l, ok := s.locks[req.Path]
+	if !ok {
+		l = &lock{holders: make(map[string]time.Time)}
+		s.locks[req.Path] = l
+	}
+	for id, expires := range l.holders {
+		if time.Now().After(expires) {
+			delete(l.holders, id)
+		}
+	}
+
+	ttl := time.Duration(max(req.FileOptions.TTL, 1)) * time.Second
+	id := req.FileOptions.LockID
+	if _, held := l.holders[id]; !held {
+		if len(l.holders) > 0 && (l.exclusive || req.FileOptions.Exclusive) {
+			return nil, &apiError{http.StatusLocked, "LOCKED", "conflicting lock held"}
+		}
+		s.lockID++
+		id = fmt.Sprintf("lock-%d", s.lockID)
+		l.exclusive = req.FileOptions.Exclusive
+	}
+
+	expires := time.Now().Add(ttl)
+	l.holders[id] = expires
+	return map[string]interface{}{
+		"lock_id": id,
+		"expires": expires.UTC().Format(time.RFC3339),
+	}, nil
+}
+
+func (s *Server) unlock(req request) (map[string]interface{}, *apiError) {
+	l, ok := s.locks[req.Path]
+	if !ok {
+		return nil, errNotFound
+	}
+	if _, held := l.holders[req.LockID]; !held {
+		return nil, errNotFound
+	}
+
+	delete(l.holders, req.LockID)
+	if len(l.holders) == 0 {
+		delete(s.locks, req.Path)
+	}
+	return map[string]interface{}{}, nil
+}
+
+func writeError(w http.ResponseWriter, e *apiError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(e.status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    false,
+		"error":      e.msg,
+		"error_code": e.code,
+	})
+}
+
+func isBelow(p, dir string) bool {
+	if dir == "/" {
+		return p != "/"
+	}
+	return strings.HasPrefix(p, dir+"/")
+}
+
+func fileType(n *node) string {
+	if n.dir {
+		return "directory"
+	}
+	return "file"
+}
+
+func metadata(n *node) map[string]interface{} {
+	md := map[string]interface{}{
+		"size":          len(n.content),
+		"modified_time": n.modified.UTC().Format(time.RFC3339),
+		"created_time":  n.modified.UTC().Format(time.RFC3339),
+		"access_time":   accessTime(n).UTC().Format(time.RFC3339),
+		"type":          fileType(n),
+		"permissions":   permissions(n),
+	}
+	if !n.dir {
+		if n.sha256 == "" {
+			sum := sha256.Sum256(n.content)
+			n.sha256 = hex.EncodeToString(sum[:])
+		}
+		md["sha256"] = n.sha256
+	}
+	return md
+}
+
+func accessTime(n *node) time.Time {
+	if n.accessed.After(n.modified) {
+		return n.accessed
+	}
+	return n.modified
+}
+
+func permissions(n *node) string {
+	if n.perm != "" {
+		return n.perm
+	}
+	if n.dir {
+		return "rwxr-xr-x"
+	}
+	return "rw-r--r--"
+}
+
+func entry(p string, n *node) map[string]interface{} {
+	fileType := "f"
+	if n.dir {
+		fileType = "d"
+	}
+	return map[string]interface{}{
+		"name":             path.Base(p),
+		"file_type":        fileType,
+		"file_size":        len(n.content),
+		"file_permissions": permissions(n),
+		"file_modified":    n.modified.UTC().Format(time.RFC3339),
+		"path":             p,
+		"api_context":      n.context,
+	}
+}
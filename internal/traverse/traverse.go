@@ -0,0 +1,217 @@
+// Package traverse walks File API directory trees with a bounded pool of
+// workers. Commands that visit whole subtrees (warming the cache today;
+// export, diff and import later) share it instead of each writing their
+// own queue, retry and cancellation handling.
+package traverse
+
+import (
+	"context"
+	"errors"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/ianzepp/monk-api-fuse/pkg/monkapi"
+)
+
+// Default tuning, used for zero Options fields
+const (
+	DefaultWorkers = 8
+	DefaultRetries = 2
+	DefaultBackoff = 250 * time.Millisecond
+)
+
+// ListFunc lists the entries of dir
+type ListFunc func(ctx context.Context, dir string) ([]monkapi.FileEntry, error)
+
+// Options tunes a walk. Visit is required; the other fields are optional.
+type Options struct {
+	// Workers is how many directories are listed at once
+	Workers int
+
+	// Retries is how many more times a failed listing is attempted,
+	// waiting Backoff, then twice that, and so on; negative disables
+	// retries. Not found and cancellation are not retried.
+	Retries int
+	Backoff time.Duration
+
+	// MaxEntries stops the walk once this many entries have been visited;
+	// zero is unbounded
+	MaxEntries int
+
+	// Visit is called for every entry below the roots and reports whether
+	// to descend into it, which only matters for directories. It is called
+	// from several workers at once.
+	Visit func(entry monkapi.FileEntry) bool
+
+	// Failed is called for each directory whose listing still failed after
+	// the retries; the walk carries on without it
+	Failed func(dir string, err error)
+
+	// Progress is called after each directory is listed or given up on.
+	// Calls are serialized.
+	Progress func(Progress)
+}
+
+// Progress counts what a walk has done so far
+type Progress struct {
+	Dirs    int // directories listed
+	Entries int // entries visited
+	Failed  int // directories given up on
+	Queued  int // directories waiting to be listed
+	Done    bool
+}
+
+// walker is the shared state of one walk
+type walker struct {
+	opts Options
+	list ListFunc
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	queue    []string
+	active   int // directories being listed
+	stopped  bool
+	progress Progress
+}
+
+// Walk lists roots and every directory below them, calling opts.Visit for
+// each entry, until the tree is exhausted, MaxEntries is reached or ctx is
+// done. It returns ctx's error if the walk was cut short by it.
+func Walk(ctx context.Context, roots []string, list ListFunc, opts Options) error {
+	if opts.Workers <= 0 {
+		opts.Workers = DefaultWorkers
+	}
+	if opts.Retries == 0 {
+		opts.Retries = DefaultRetries
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = DefaultBackoff
+	}
+
+	w := &walker{opts: opts, list: list}
+	w.cond = sync.NewCond(&w.mu)
+	for _, root := range roots {
+		w.queue = append(w.queue, path.Clean("/"+root))
+	}
+	w.progress.Queued = len(w.queue)
+
+	stop := context.AfterFunc(ctx, w.stop)
+	defer stop()
+
+	var wg sync.WaitGroup
+	for range opts.Workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.work(ctx)
+		}()
+	}
+	wg.Wait()
+
+	w.progress.Done = true
+	w.report()
+	return ctx.Err()
+}
+
+// stop ends the walk once the directories being listed are done
+func (w *walker) stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stopped = true
+	w.cond.Broadcast()
+}
+
+// work lists queued directories until none are left and none are being
+// listed, or the walk is stopped
+func (w *walker) work(ctx context.Context) {
+	for {
+		w.mu.Lock()
+		for len(w.queue) == 0 && w.active > 0 && !w.stopped {
+			w.cond.Wait()
+		}
+		if len(w.queue) == 0 || w.stopped {
+			w.cond.Broadcast()
+			w.mu.Unlock()
+			return
+		}
+		dir := w.queue[0]
+		w.queue = w.queue[1:]
+		w.active++
+		w.mu.Unlock()
+
+		entries, err := w.listWithRetry(ctx, dir)
+
+		var subdirs []string
+		visited := 0
+		for _, entry := range entries {
+			if w.full(visited) {
+				break
+			}
+			visited++
+			if w.opts.Visit(entry) && entry.FileType == "d" {
+				subdirs = append(subdirs, entry.Path)
+			}
+		}
+
+		w.mu.Lock()
+		w.active--
+		w.progress.Entries += visited
+		switch {
+		case err == nil:
+			w.progress.Dirs++
+		case ctx.Err() == nil:
+			w.progress.Failed++
+		}
+		if w.opts.MaxEntries > 0 && w.progress.Entries >= w.opts.MaxEntries {
+			w.stopped = true
+		}
+		w.queue = append(w.queue, subdirs...)
+		w.progress.Queued = len(w.queue)
+		w.report()
+		w.cond.Broadcast()
+		w.mu.Unlock()
+
+		if err != nil && w.opts.Failed != nil && ctx.Err() == nil {
+			w.opts.Failed(dir, err)
+		}
+	}
+}
+
+// full reports whether visiting visited more entries in the current
+// directory reaches MaxEntries
+func (w *walker) full(visited int) bool {
+	if w.opts.MaxEntries <= 0 {
+		return false
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.progress.Entries+visited >= w.opts.MaxEntries
+}
+
+// report passes the progress to the callback; w.mu must be held, or the
+// workers finished
+func (w *walker) report() {
+	if w.opts.Progress != nil {
+		w.opts.Progress(w.progress)
+	}
+}
+
+// listWithRetry lists dir, retrying failures with exponential backoff
+func (w *walker) listWithRetry(ctx context.Context, dir string) ([]monkapi.FileEntry, error) {
+	delay := w.opts.Backoff
+	for attempt := 0; ; attempt++ {
+		entries, err := w.list(ctx, dir)
+		if err == nil || attempt >= w.opts.Retries || monkapi.IsNotFound(err) ||
+			errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return entries, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
@@ -0,0 +1,564 @@
+// Package monk9p serves the Monk File API namespace read-only over
+// 9P2000.L, so VM and WSL2 guests can mount it with the kernel v9fs client
+// without running FUSE inside the guest
+package monk9p
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"io"
+	"log"
+	"math"
+	"net"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ianzepp/monk-api-fuse/pkg/monkapi"
+)
+
+// protocolVersion is the only dialect the server speaks
+const protocolVersion = "9P2000.L"
+
+// maxMessageSize caps the negotiated msize
+const maxMessageSize = 128*1024 + 24
+
+// Linux errno values, which 9P2000.L uses on the wire on every platform
+const (
+	eNOENT     = 2
+	eIO        = 5
+	eBADF      = 9
+	eACCES     = 13
+	eNOTDIR    = 20
+	eISDIR     = 21
+	eINVAL     = 22
+	eROFS      = 30
+	eOPNOTSUPP = 95
+)
+
+// Messages that would modify the tree; all fail with EROFS
+var writeMessages = map[uint8]bool{
+	14:  true, // Tlcreate
+	16:  true, // Tsymlink
+	18:  true, // Tmknod
+	20:  true, // Trename
+	26:  true, // Tsetattr
+	32:  true, // Txattrcreate
+	70:  true, // Tlink
+	72:  true, // Tmkdir
+	74:  true, // Trenameat
+	76:  true, // Tunlinkat
+	118: true, // Twrite
+}
+
+// Server serves a File API subtree over 9P2000.L
+type Server struct {
+	client monkapi.API
+	root   string
+}
+
+// NewServer creates a server exposing root and everything below it
+func NewServer(client monkapi.API, root string) *Server {
+	return &Server{client: client, root: path.Clean("/" + root)}
+}
+
+// Serve accepts connections on l until it is closed
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		nc, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		c := &conn{server: s, rw: nc, fids: make(map[uint32]*fid), inflight: make(map[uint16]chan struct{})}
+		c.msize.Store(maxMessageSize)
+		go c.serve()
+	}
+}
+
+// conn is one client connection and its fid table
+type conn struct {
+	server *Server
+	rw     net.Conn
+	msize  atomic.Uint32
+
+	mu       sync.Mutex
+	fids     map[uint32]*fid
+	inflight map[uint16]chan struct{} // by tag; closed once answered
+
+	wmu sync.Mutex
+}
+
+// fid is a client reference to a path
+type fid struct {
+	path    string
+	dir     bool
+	entries []dirent // readdir snapshot, taken at offset 0
+}
+
+// dirent is one directory entry as sent by Rreaddir
+type dirent struct {
+	name string
+	qid  qid
+}
+
+// serve reads requests until the connection closes. Version negotiation is
+// handled in order; everything else runs concurrently so a slow read does
+// not stall the connection.
+func (c *conn) serve() {
+	defer c.rw.Close()
+
+	for {
+		typ, tag, body, err := readMessage(c.rw, c.msize.Load())
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				log.Printf("9p: %s: %v", c.rw.RemoteAddr(), err)
+			}
+			return
+		}
+
+		if typ == tversion {
+			c.reply(c.version(tag, body))
+			continue
+		}
+		// Registered before the next message is read, so a flush always
+		// finds the requests sent ahead of it
+		done := make(chan struct{})
+		c.mu.Lock()
+		c.inflight[tag] = done
+		c.mu.Unlock()
+		go c.handle(typ, tag, body, done)
+	}
+}
+
+// handle answers a single request, then closes done
+func (c *conn) handle(typ uint8, tag uint16, body []byte, done chan struct{}) {
+	defer c.answered(tag, done)
+	ctx := context.Background()
+	d := &decoder{buf: body}
+
+	var resp *encoder
+	var ecode uint32
+	switch {
+	case typ == tattach:
+		resp, ecode = c.attach(ctx, tag, d)
+	case typ == twalk:
+		resp, ecode = c.walk(ctx, tag, d)
+	case typ == tlopen:
+		resp, ecode = c.lopen(ctx, tag, d)
+	case typ == tread:
+		resp, ecode = c.read(ctx, tag, d)
+	case typ == treaddir:
+		resp, ecode = c.readdir(ctx, tag, d)
+	case typ == tgetattr:
+		resp, ecode = c.getattr(ctx, tag, d)
+	case typ == tstatfs:
+		resp = c.statfs(tag)
+	case typ == tclunk:
+		c.mu.Lock()
+		delete(c.fids, d.u32())
+		c.mu.Unlock()
+		resp = newMessage(rclunk, tag)
+	case typ == tflush:
+		// Requests are not cancellable, so the flush is answered once the
+		// request it names has been, as the protocol requires
+		if oldtag := d.u16(); oldtag != tag {
+			c.awaitReply(oldtag)
+		}
+		resp = newMessage(rflush, tag)
+	case typ == 50: // Tfsync: nothing is ever dirty
+		resp = newMessage(51, tag)
+	case writeMessages[typ]:
+		ecode = eROFS
+	default:
+		// Includes Txattrwalk, Tlock and Tgetlock
+		ecode = eOPNOTSUPP
+	}
+
+	if d.err != nil {
+		resp, ecode = nil, eINVAL
+	}
+	if ecode != 0 {
+		resp = newMessage(rlerror, tag)
+		resp.u32(ecode)
+	}
+	c.reply(resp)
+}
+
+// answered retires a request's tag once its reply is sent; the client may
+// have reused the tag already
+func (c *conn) answered(tag uint16, done chan struct{}) {
+	c.mu.Lock()
+	if c.inflight[tag] == done {
+		delete(c.inflight, tag)
+	}
+	c.mu.Unlock()
+	close(done)
+}
+
+// awaitReply waits until the request with tag, if any, has been answered
+func (c *conn) awaitReply(tag uint16) {
+	c.mu.Lock()
+	done := c.inflight[tag]
+	c.mu.Unlock()
+	if done != nil {
+		<-done
+	}
+}
+
+func (c *conn) reply(resp *encoder) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	if _, err := c.rw.Write(resp.bytes()); err != nil {
+		log.Printf("9p: %s: %v", c.rw.RemoteAddr(), err)
+	}
+}
+
+// version negotiates msize and resets the session
+func (c *conn) version(tag uint16, body []byte) *encoder {
+	d := &decoder{buf: body}
+	msize := d.u32()
+	version := d.str()
+
+	resp := newMessage(rversion, tag)
+	if d.err != nil || !strings.HasPrefix(version, protocolVersion) {
+		resp.u32(c.msize.Load())
+		resp.str("unknown")
+		return resp
+	}
+
+	c.mu.Lock()
+	c.fids = make(map[uint32]*fid)
+	c.mu.Unlock()
+
+	msize = min(msize, maxMessageSize)
+	c.msize.Store(msize)
+	resp.u32(msize)
+	resp.str(protocolVersion)
+	return resp
+}
+
+func (c *conn) attach(ctx context.Context, tag uint16, d *decoder) (*encoder, uint32) {
+	newfid := d.u32()
+	d.u32() // afid: authentication is by the server's API token
+	d.str() // uname
+	aname := d.str()
+	d.u32() // n_uname
+
+	root := c.server.root
+	if aname != "" {
+		root = path.Join(root, path.Clean("/"+aname))
+	}
+
+	stat, err := c.server.client.Stat(ctx, root, "file_metadata")
+	if err != nil {
+		return nil, errno(err)
+	}
+	if !isDir(stat) {
+		return nil, eNOTDIR
+	}
+
+	c.setFid(newfid, &fid{path: root, dir: true})
+	resp := newMessage(rattach, tag)
+	resp.qid(makeQid(root, true))
+	return resp, 0
+}
+
+func (c *conn) walk(ctx context.Context, tag uint16, d *decoder) (*encoder, uint32) {
+	oldfid := d.u32()
+	newfid := d.u32()
+	names := make([]string, d.u16())
+	for i := range names {
+		names[i] = d.str()
+	}
+	if d.err != nil {
+		return nil, eINVAL
+	}
+
+	f := c.getFid(oldfid)
+	if f == nil {
+		return nil, eBADF
+	}
+
+	current, dir := f.path, f.dir
+	var qids []qid
+	for i, name := range names {
+		next, ok := c.child(current, name)
+		if !ok {
+			if i == 0 {
+				return nil, eNOENT
+			}
+			break
+		}
+
+		stat, err := c.server.client.Stat(ctx, next, "file_metadata")
+		if err != nil {
+			if i == 0 {
+				return nil, errno(err)
+			}
+			break
+		}
+		current, dir = next, isDir(stat)
+		qids = append(qids, makeQid(current, dir))
+	}
+
+	// A partial walk returns the qids found but does not bind newfid
+	if len(qids) == len(names) {
+		c.setFid(newfid, &fid{path: current, dir: dir})
+	}
+
+	resp := newMessage(rwalk, tag)
+	resp.u16(uint16(len(qids)))
+	for _, q := range qids {
+		resp.qid(q)
+	}
+	return resp, 0
+}
+
+// child resolves one walk element, keeping ".." inside the served root
+func (c *conn) child(dir, name string) (string, bool) {
+	switch {
+	case name == "" || name == "." || strings.Contains(name, "/"):
+		return "", false
+	case name == "..":
+		if dir == c.server.root {
+			return dir, true
+		}
+		return path.Dir(dir), true
+	default:
+		return path.Join(dir, name), true
+	}
+}
+
+func (c *conn) lopen(ctx context.Context, tag uint16, d *decoder) (*encoder, uint32) {
+	f := c.getFid(d.u32())
+	flags := d.u32()
+	if f == nil {
+		return nil, eBADF
+	}
+
+	// O_WRONLY, O_RDWR and O_TRUNC use Linux values on the wire
+	if flags&3 != 0 || flags&0o1000 != 0 {
+		return nil, eROFS
+	}
+
+	resp := newMessage(rlopen, tag)
+	resp.qid(makeQid(f.path, f.dir))
+	resp.u32(0) // iounit: use msize
+	return resp, 0
+}
+
+func (c *conn) read(ctx context.Context, tag uint16, d *decoder) (*encoder, uint32) {
+	f := c.getFid(d.u32())
+	offset := d.u64()
+	count := d.u32()
+	if f == nil {
+		return nil, eBADF
+	}
+	if f.dir {
+		return nil, eISDIR
+	}
+	if offset > math.MaxInt {
+		return nil, eINVAL
+	}
+
+	// size[4] type[1] tag[2] count[4]
+	count = min(count, c.msize.Load()-headerSize-4)
+
+	stream, err := c.server.client.RetrieveStream(ctx, f.path, monkapi.RetrieveOptions{
+		StartOffset: int(offset),
+		MaxBytes:    int(count),
+	})
+	if err != nil {
+		return nil, errno(err)
+	}
+	defer stream.Close()
+
+	data := make([]byte, count)
+	n, err := io.ReadFull(stream, data)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, errno(err)
+	}
+
+	resp := newMessage(rread, tag)
+	resp.u32(uint32(n))
+	resp.buf = append(resp.buf, data[:n]...)
+	return resp, 0
+}
+
+func (c *conn) readdir(ctx context.Context, tag uint16, d *decoder) (*encoder, uint32) {
+	f := c.getFid(d.u32())
+	offset := d.u64()
+	count := d.u32()
+	if f == nil {
+		return nil, eBADF
+	}
+	if !f.dir {
+		return nil, eNOTDIR
+	}
+
+	c.mu.Lock()
+	entries := f.entries
+	c.mu.Unlock()
+
+	if offset == 0 || entries == nil {
+		list, err := c.server.client.List(ctx, f.path, monkapi.ListOptions{LongFormat: true}, "entries")
+		if err != nil {
+			return nil, errno(err)
+		}
+
+		entries = []dirent{
+			{name: ".", qid: makeQid(f.path, true)},
+			{name: "..", qid: makeQid(path.Dir(f.path), true)},
+		}
+		for _, entry := range list.Entries {
+			entries = append(entries, dirent{
+				name: entry.Name,
+				qid:  makeQid(path.Join(f.path, entry.Name), entry.FileType == "d"),
+			})
+		}
+
+		c.mu.Lock()
+		f.entries = entries
+		c.mu.Unlock()
+	}
+	// Offsets are cookies this server handed out, at most one per entry
+	if offset > uint64(len(entries)) {
+		return nil, eINVAL
+	}
+
+	count = min(count, c.msize.Load()-headerSize-4)
+	resp := newMessage(rreaddir, tag)
+	resp.u32(0) // patched below
+	start := len(resp.buf)
+
+	// Each entry's offset is the cookie of the entry after it
+	for i := int(offset); i < len(entries); i++ {
+		entry := entries[i]
+		if uint32(len(resp.buf)-start+qidSize+8+1+2+len(entry.name)) > count {
+			break
+		}
+		resp.qid(entry.qid)
+		resp.u64(uint64(i + 1))
+		if entry.qid.typ == qidTypeDir {
+			resp.u8(4) // DT_DIR
+		} else {
+			resp.u8(8) // DT_REG
+		}
+		resp.str(entry.name)
+	}
+
+	size := uint32(len(resp.buf) - start)
+	binary.LittleEndian.PutUint32(resp.buf[start-4:], size)
+	return resp, 0
+}
+
+func (c *conn) getattr(ctx context.Context, tag uint16, d *decoder) (*encoder, uint32) {
+	f := c.getFid(d.u32())
+	d.u64() // request_mask: everything basic is always returned
+	if f == nil {
+		return nil, eBADF
+	}
+
+	stat, err := c.server.client.Stat(ctx, f.path, "file_metadata")
+	if err != nil {
+		return nil, errno(err)
+	}
+
+	dir := isDir(stat)
+	mode := uint32(0o100444) // S_IFREG
+	if dir {
+		mode = 0o40555 // S_IFDIR
+	}
+	size := uint64(stat.FileMetadata.Size)
+	atime := parseTime(stat.FileMetadata.AccessTime)
+	mtime := parseTime(stat.FileMetadata.ModifiedTime)
+	ctime := parseTime(stat.FileMetadata.CreatedTime)
+
+	resp := newMessage(rgetattr, tag)
+	resp.u64(0x7ff) // P9_GETATTR_BASIC
+	resp.qid(makeQid(f.path, dir))
+	resp.u32(mode)
+	resp.u32(0) // uid
+	resp.u32(0) // gid
+	resp.u64(1) // nlink
+	resp.u64(0) // rdev
+	resp.u64(size)
+	resp.u64(4096)
+	resp.u64((size + 511) / 512)
+	for _, t := range []time.Time{atime, mtime, ctime, {}} {
+		if t.IsZero() {
+			resp.u64(0)
+			resp.u64(0)
+			continue
+		}
+		resp.u64(uint64(t.Unix()))
+		resp.u64(uint64(t.Nanosecond()))
+	}
+	resp.u64(0) // gen
+	resp.u64(0) // data_version
+	return resp, 0
+}
+
+func (c *conn) statfs(tag uint16) *encoder {
+	resp := newMessage(rstatfs, tag)
+	resp.u32(0x01021997) // V9FS_MAGIC
+	resp.u32(4096)       // bsize
+	resp.u64(0)          // blocks
+	resp.u64(0)          // bfree
+	resp.u64(0)          // bavail
+	resp.u64(0)          // files
+	resp.u64(0)          // ffree
+	resp.u64(0)          // fsid
+	resp.u32(255)        // namelen
+	return resp
+}
+
+func (c *conn) getFid(id uint32) *fid {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.fids[id]
+}
+
+func (c *conn) setFid(id uint32, f *fid) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.fids[id] = f
+}
+
+// errno maps an API error onto a Linux errno
+func errno(err error) uint32 {
+	var apiErr *monkapi.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case 404:
+			return eNOENT
+		case 401, 403:
+			return eACCES
+		}
+	}
+	log.Printf("9p: %v", err)
+	return eIO
+}
+
+func isDir(stat *monkapi.StatResponse) bool {
+	return stat.Type == "directory" || stat.FileMetadata.Type == "directory"
+}
+
+func makeQid(p string, dir bool) qid {
+	h := fnv.New64a()
+	h.Write([]byte(p))
+	if dir {
+		return qid{typ: qidTypeDir, path: h.Sum64()}
+	}
+	return qid{typ: qidTypeFile, path: h.Sum64()}
+}
+
+func parseTime(ts string) time.Time {
+	t, _ := time.Parse(time.RFC3339, ts)
+	return t
+}
@@ -0,0 +1,307 @@
+package monk9p
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ianzepp/monk-api-fuse/internal/mockserver"
+	"github.com/ianzepp/monk-api-fuse/pkg/monkapi"
+)
+
+// testClient is the client end of a connection to a Server
+type testClient struct {
+	t  *testing.T
+	nc net.Conn
+}
+
+// testServer serves client over 9P and connects to it
+func testServer(t *testing.T, client monkapi.API) *testClient {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go NewServer(client, "/").Serve(l)
+
+	nc, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { nc.Close() })
+	return &testClient{t: t, nc: nc}
+}
+
+// mockAPI serves s over HTTP and returns a client for it
+func mockAPI(t *testing.T, s *mockserver.Server) *monkapi.Client {
+	api := httptest.NewServer(s)
+	t.Cleanup(api.Close)
+	return monkapi.NewClient(api.URL, "token")
+}
+
+func (c *testClient) send(m *encoder) {
+	c.t.Helper()
+	if _, err := c.nc.Write(m.bytes()); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// recv reads the next reply, failing unless it has the wanted type and tag
+func (c *testClient) recv(want uint8, tag uint16) *decoder {
+	c.t.Helper()
+	c.nc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	typ, got, body, err := readMessage(c.nc, maxMessageSize)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if typ == rlerror && want != rlerror {
+		c.t.Fatalf("tag %d: Rlerror %d, want type %d", got, (&decoder{buf: body}).u32(), want)
+	}
+	if typ != want || got != tag {
+		c.t.Fatalf("reply type %d tag %d, want type %d tag %d", typ, got, want, tag)
+	}
+	return &decoder{buf: body}
+}
+
+// rpc sends m and returns the body of its reply
+func (c *testClient) rpc(m *encoder, want uint8) *decoder {
+	c.t.Helper()
+	c.send(m)
+	return c.recv(want, tagOf(m))
+}
+
+// rerror sends m and returns the errno it fails with
+func (c *testClient) rerror(m *encoder) uint32 {
+	c.t.Helper()
+	c.send(m)
+	return c.recv(rlerror, tagOf(m)).u32()
+}
+
+func tagOf(m *encoder) uint16 {
+	return uint16(m.buf[5]) | uint16(m.buf[6])<<8
+}
+
+// attach negotiates the version and attaches fid 0 to the root
+func (c *testClient) attach() {
+	c.t.Helper()
+	m := newMessage(tversion, noTag)
+	m.u32(8192)
+	m.str(protocolVersion)
+	d := c.rpc(m, rversion)
+	if msize, version := d.u32(), d.str(); msize != 8192 || version != protocolVersion {
+		c.t.Fatalf("Rversion = %d %q", msize, version)
+	}
+
+	m = newMessage(tattach, 1)
+	m.u32(0)          // fid
+	m.u32(^uint32(0)) // afid
+	m.str("user")
+	m.str("")
+	m.u32(0)
+	c.rpc(m, rattach)
+}
+
+func walkMessage(tag uint16, fid, newfid uint32, names ...string) *encoder {
+	m := newMessage(twalk, tag)
+	m.u32(fid)
+	m.u32(newfid)
+	m.u16(uint16(len(names)))
+	for _, name := range names {
+		m.str(name)
+	}
+	return m
+}
+
+func readMessageFor(typ uint8, tag uint16, fid uint32, offset uint64, count uint32) *encoder {
+	m := newMessage(typ, tag)
+	m.u32(fid)
+	m.u64(offset)
+	m.u32(count)
+	return m
+}
+
+func TestVersion(t *testing.T) {
+	c := testServer(t, mockAPI(t, mockserver.New()))
+
+	m := newMessage(tversion, noTag)
+	m.u32(1 << 20)
+	m.str("9P2000")
+	d := c.rpc(m, rversion)
+	if _, version := d.u32(), d.str(); version != "unknown" {
+		t.Errorf("version for 9P2000 = %q, want unknown", version)
+	}
+
+	m = newMessage(tversion, noTag)
+	m.u32(1 << 20)
+	m.str(protocolVersion)
+	d = c.rpc(m, rversion)
+	if msize, version := d.u32(), d.str(); msize != maxMessageSize || version != protocolVersion {
+		t.Errorf("Rversion = %d %q, want msize capped at %d", msize, version, maxMessageSize)
+	}
+}
+
+func TestWalk(t *testing.T) {
+	s := mockserver.New()
+	s.Put("/docs/notes/todo.txt", []byte("one\n"))
+	c := testServer(t, mockAPI(t, s))
+	c.attach()
+
+	d := c.rpc(walkMessage(2, 0, 1, "docs", "notes", "todo.txt"), rwalk)
+	if n := d.u16(); n != 3 {
+		t.Fatalf("walk found %d qids, want 3", n)
+	}
+	var types []uint8
+	for range 3 {
+		types = append(types, d.take(1)[0])
+		d.u32()
+		d.u64()
+	}
+	if !slices.Equal(types, []uint8{qidTypeDir, qidTypeDir, qidTypeFile}) {
+		t.Errorf("qid types = %v", types)
+	}
+
+	// A partial walk reports how far it got and leaves newfid unbound
+	d = c.rpc(walkMessage(3, 0, 2, "docs", "missing"), rwalk)
+	if n := d.u16(); n != 1 {
+		t.Errorf("partial walk found %d qids, want 1", n)
+	}
+	if e := c.rerror(walkMessage(4, 2, 3)); e != eBADF {
+		t.Errorf("walk from unbound fid: errno %d, want EBADF", e)
+	}
+	if e := c.rerror(walkMessage(5, 0, 3, "missing")); e != eNOENT {
+		t.Errorf("walk to missing: errno %d, want ENOENT", e)
+	}
+
+	// ".." stops at the served root
+	d = c.rpc(walkMessage(6, 0, 4, ".."), rwalk)
+	if n := d.u16(); n != 1 {
+		t.Errorf("walk .. found %d qids, want 1", n)
+	}
+}
+
+func TestReaddir(t *testing.T) {
+	s := mockserver.New()
+	for _, name := range []string{"a", "b", "c"} {
+		s.Put("/docs/"+name, []byte(name))
+	}
+	s.Mkdir("/docs/sub")
+	c := testServer(t, mockAPI(t, s))
+	c.attach()
+	c.rpc(walkMessage(2, 0, 1, "docs"), rwalk)
+
+	m := newMessage(tlopen, 3)
+	m.u32(1)
+	m.u32(0) // O_RDONLY
+	c.rpc(m, rlopen)
+
+	// Read with a small count so the listing takes several requests,
+	// resuming from the last cookie each time
+	var names []string
+	var offset uint64
+	for tag := uint16(4); ; tag++ {
+		d := c.rpc(readMessageFor(treaddir, tag, 1, offset, 64), rreaddir)
+		d = &decoder{buf: d.take(int(d.u32()))}
+		if len(d.buf) == 0 {
+			break
+		}
+		for len(d.buf) > 0 {
+			d.take(qidSize)
+			offset = d.u64()
+			d.take(1) // type
+			names = append(names, d.str())
+		}
+		if d.err != nil {
+			t.Fatal(d.err)
+		}
+	}
+	if want := []string{".", "..", "a", "b", "c", "sub"}; !slices.Equal(names, want) {
+		t.Errorf("readdir = %v, want %v", names, want)
+	}
+
+	if e := c.rerror(readMessageFor(treaddir, 20, 1, 7, 8192)); e != eINVAL {
+		t.Errorf("readdir past the end: errno %d, want EINVAL", e)
+	}
+	if e := c.rerror(readMessageFor(treaddir, 21, 1, 1<<63, 8192)); e != eINVAL {
+		t.Errorf("readdir at a huge offset: errno %d, want EINVAL", e)
+	}
+}
+
+func TestRead(t *testing.T) {
+	s := mockserver.New()
+	s.Put("/docs/readme.md", []byte("hello, world\n"))
+	c := testServer(t, mockAPI(t, s))
+	c.attach()
+	c.rpc(walkMessage(2, 0, 1, "docs", "readme.md"), rwalk)
+
+	m := newMessage(tlopen, 3)
+	m.u32(1)
+	m.u32(1) // O_WRONLY
+	if e := c.rerror(m); e != eROFS {
+		t.Errorf("open for writing: errno %d, want EROFS", e)
+	}
+
+	for _, tc := range []struct {
+		offset uint64
+		count  uint32
+		want   string
+	}{
+		{0, 5, "hello"},
+		{7, 100, "world\n"},
+		{13, 100, ""},
+	} {
+		d := c.rpc(readMessageFor(tread, 4, 1, tc.offset, tc.count), rread)
+		if got := string(d.take(int(d.u32()))); got != tc.want {
+			t.Errorf("read %d+%d = %q, want %q", tc.offset, tc.count, got, tc.want)
+		}
+	}
+
+	if e := c.rerror(readMessageFor(tread, 5, 1, 1<<63, 100)); e != eINVAL {
+		t.Errorf("read at a huge offset: errno %d, want EINVAL", e)
+	}
+	if e := c.rerror(readMessageFor(tread, 6, 0, 0, 100)); e != eISDIR {
+		t.Errorf("read of a directory: errno %d, want EISDIR", e)
+	}
+}
+
+// stalledAPI holds reads until release is closed
+type stalledAPI struct {
+	monkapi.API
+	release chan struct{}
+}
+
+func (a *stalledAPI) RetrieveStream(ctx context.Context, p string, opts monkapi.RetrieveOptions) (io.ReadCloser, error) {
+	<-a.release
+	return a.API.RetrieveStream(ctx, p, opts)
+}
+
+func TestFlushWaitsForReply(t *testing.T) {
+	s := mockserver.New()
+	s.Put("/readme.md", []byte("hello"))
+	api := &stalledAPI{API: mockAPI(t, s), release: make(chan struct{})}
+	c := testServer(t, api)
+	c.attach()
+	c.rpc(walkMessage(2, 0, 1, "readme.md"), rwalk)
+
+	c.send(readMessageFor(tread, 3, 1, 0, 100))
+	flush := newMessage(tflush, 4)
+	flush.u16(3)
+	c.send(flush)
+
+	// Neither reply may arrive while the read is stalled
+	c.nc.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, _, _, err := readMessage(c.nc, maxMessageSize); err == nil {
+		t.Fatal("reply arrived before the read finished")
+	}
+
+	close(api.release)
+	d := c.recv(rread, 3)
+	if got := string(d.take(int(d.u32()))); got != "hello" {
+		t.Errorf("read = %q", got)
+	}
+	c.recv(rflush, 4)
+}
@@ -0,0 +1,148 @@
+package monk9p
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// 9P2000.L message types used by the server
+const (
+	tlerror     = 6
+	rlerror     = 7
+	tstatfs     = 8
+	rstatfs     = 9
+	tlopen      = 12
+	rlopen      = 13
+	tgetattr    = 24
+	rgetattr    = 25
+	txattrwalk  = 30
+	treaddir    = 40
+	rreaddir    = 41
+	tversion    = 100
+	rversion    = 101
+	tattach     = 104
+	rattach     = 105
+	tflush      = 108
+	rflush      = 109
+	twalk       = 110
+	rwalk       = 111
+	tread       = 116
+	rread       = 117
+	tclunk      = 120
+	rclunk      = 121
+	headerSize  = 7 // size[4] type[1] tag[2]
+	qidSize     = 13
+	noTag       = 0xffff
+	qidTypeDir  = 0x80
+	qidTypeFile = 0x00
+)
+
+var errShortMessage = errors.New("9p: short message")
+
+// decoder reads the fields of a message body
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) take(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if len(d.buf) < n {
+		d.err = errShortMessage
+		return nil
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *decoder) u16() uint16 {
+	if b := d.take(2); b != nil {
+		return binary.LittleEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (d *decoder) u32() uint32 {
+	if b := d.take(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (d *decoder) u64() uint64 {
+	if b := d.take(8); b != nil {
+		return binary.LittleEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (d *decoder) str() string {
+	n := d.u16()
+	return string(d.take(int(n)))
+}
+
+// encoder builds a response message; the size field is filled in by bytes
+type encoder struct {
+	buf []byte
+}
+
+func newMessage(msgType uint8, tag uint16) *encoder {
+	e := &encoder{buf: make([]byte, headerSize, 64)}
+	e.buf[4] = msgType
+	binary.LittleEndian.PutUint16(e.buf[5:], tag)
+	return e
+}
+
+func (e *encoder) u8(v uint8) { e.buf = append(e.buf, v) }
+
+func (e *encoder) u16(v uint16) { e.buf = binary.LittleEndian.AppendUint16(e.buf, v) }
+
+func (e *encoder) u32(v uint32) { e.buf = binary.LittleEndian.AppendUint32(e.buf, v) }
+
+func (e *encoder) u64(v uint64) { e.buf = binary.LittleEndian.AppendUint64(e.buf, v) }
+
+func (e *encoder) str(s string) {
+	e.u16(uint16(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *encoder) qid(q qid) {
+	e.u8(q.typ)
+	e.u32(q.version)
+	e.u64(q.path)
+}
+
+func (e *encoder) bytes() []byte {
+	binary.LittleEndian.PutUint32(e.buf, uint32(len(e.buf)))
+	return e.buf
+}
+
+// readMessage reads one message, returning its type, tag and body
+func readMessage(r io.Reader, msize uint32) (uint8, uint16, []byte, error) {
+	var header [headerSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, 0, nil, err
+	}
+
+	size := binary.LittleEndian.Uint32(header[:])
+	if size < headerSize || size > msize {
+		return 0, 0, nil, errors.New("9p: invalid message size")
+	}
+
+	body := make([]byte, size-headerSize)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, 0, nil, err
+	}
+	return header[4], binary.LittleEndian.Uint16(header[5:]), body, nil
+}
+
+// qid identifies a file to the client
+type qid struct {
+	typ     uint8
+	version uint32
+	path    uint64
+}
@@ -0,0 +1,22 @@
+package monkapi
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// ACL is the access lists of a record: the users and roles that may read,
+// edit or fully control it, and those denied access
+type ACL struct {
+	Read []string `json:"access_read,omitempty"`
+	Edit []string `json:"access_edit,omitempty"`
+	Full []string `json:"access_full,omitempty"`
+	Deny []string `json:"access_deny,omitempty"`
+}
+
+// SetACL replaces the access lists of a record through the ACLs API
+func (c *Client) SetACL(ctx context.Context, schema, id string, acl ACL) error {
+	_, err := c.send(ctx, http.MethodPut, "/api/acls/"+url.PathEscape(schema)+"/"+url.PathEscape(id), acl)
+	return err
+}
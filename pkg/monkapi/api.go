@@ -0,0 +1,47 @@
+package monkapi
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+)
+
+// API is the set of Monk API operations used by the filesystem and the
+// protocol servers. *Client implements it over HTTP; tests and alternative
+// transports can provide their own.
+type API interface {
+	// File API
+	List(ctx context.Context, path string, opts ListOptions, pick string) (*ListResponse, error)
+	Stat(ctx context.Context, path string, pick string) (*StatResponse, error)
+	StatBatch(ctx context.Context, paths []string, pick string) []StatResult
+	Retrieve(ctx context.Context, path string, opts RetrieveOptions, pick string) (*RetrieveResponse, error)
+	RetrieveStream(ctx context.Context, path string, opts RetrieveOptions) (io.ReadCloser, error)
+	Store(ctx context.Context, path string, content interface{}, opts StoreOptions, pick string) (*StoreResponse, error)
+	Delete(ctx context.Context, path string, opts DeleteOptions, pick string) (*DeleteResponse, error)
+	Copy(ctx context.Context, source, destination string, opts CopyOptions, pick string) (*CopyResponse, error)
+	Move(ctx context.Context, source, destination string, opts MoveOptions, pick string) (*MoveResponse, error)
+	Update(ctx context.Context, path string, opts UpdateOptions, pick string) (*UpdateResponse, error)
+	Lock(ctx context.Context, path string, opts LockOptions) (*LockResponse, error)
+	Unlock(ctx context.Context, path, lockID string) error
+
+	// Describe API
+	ListSchemas(ctx context.Context) ([]string, error)
+	Describe(ctx context.Context, schema string) (json.RawMessage, error)
+	CreateSchema(ctx context.Context, schema string, definition json.RawMessage) error
+	UpdateSchema(ctx context.Context, schema string, definition json.RawMessage) error
+	DeleteSchema(ctx context.Context, schema string) error
+	DescribeColumn(ctx context.Context, schema, column string) (json.RawMessage, error)
+	UpdateColumn(ctx context.Context, schema, column string, definition json.RawMessage) error
+
+	// Data API
+	ListRecords(ctx context.Context, schema string) ([]json.RawMessage, error)
+	GetRecord(ctx context.Context, schema, id string) (json.RawMessage, error)
+	CreateRecord(ctx context.Context, schema string, record json.RawMessage) error
+	UpdateRecord(ctx context.Context, schema, id string, record json.RawMessage) error
+	DeleteRecord(ctx context.Context, schema, id string) error
+
+	// ACLs API
+	SetACL(ctx context.Context, schema, id string, acl ACL) error
+}
+
+var _ API = (*Client)(nil)
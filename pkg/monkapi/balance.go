@@ -0,0 +1,291 @@
+package monkapi
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// BalancePolicy chooses which replica serves each request
+type BalancePolicy string
+
+const (
+	// RoundRobin sends requests to each replica in turn
+	RoundRobin BalancePolicy = "round-robin"
+
+	// LeastPending sends each request to the replica with the fewest
+	// requests in flight, so a slow replica gets less of the load
+	LeastPending BalancePolicy = "least-pending"
+
+	// Fastest sends requests to the replica that has recently answered
+	// quickest, so a mount uses its nearest region
+	Fastest BalancePolicy = "fastest"
+)
+
+// Latency tracking for Fastest: each answer moves a replica's average a
+// fraction of the way to its latency, and a replica not measured for
+// latencyRefresh gets the next request, so one that got faster or came back
+// is noticed
+const (
+	latencyWeight  = 0.2
+	latencyRefresh = 30 * time.Second
+)
+
+// Balancer is a transport spreading requests over replicas of the API.
+// Requests are built against the client's base URL, and the balancer sends
+// each to one replica instead; replicas must serve the API at the same
+// path, since HMAC signatures cover it.
+//
+// A replica that can't be reached or answers with a gateway error is left
+// out for a while, backing off from 1 second up to 30, unless every
+// replica is. Requests that could not connect at all are sent to the next
+// replica, as nothing reached the server, within a retry budget of one
+// failover per ten requests (and a burst of ten), so that while replicas
+// flap, failovers can't multiply the load on the ones still up. Failovers
+// share the request's context, so its deadline bounds them all.
+type Balancer struct {
+	// Base performs the requests; NewBalancer sets a pooled transport
+	Base http.RoundTripper
+
+	policy    BalancePolicy
+	endpoints []*endpoint
+	next      atomic.Uint64
+	retries   retryBudget
+}
+
+// Retry budget: each request earns retryRatio of a failover, and at most
+// retryBurst can be saved up
+const (
+	retryRatio = 0.1
+	retryBurst = 10
+)
+
+// retryBudget is a token bucket of failovers
+type retryBudget struct {
+	mu     sync.Mutex
+	tokens float64
+}
+
+// earn credits the budget for one request
+func (r *retryBudget) earn() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tokens = min(r.tokens+retryRatio, retryBurst)
+}
+
+// spend takes one failover from the budget, if there is one
+func (r *retryBudget) spend() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.tokens < 1 {
+		return false
+	}
+	r.tokens--
+	return true
+}
+
+// endpoint is one replica and its recent health
+type endpoint struct {
+	url     *url.URL
+	pending atomic.Int64
+
+	mu        sync.Mutex
+	failures  int
+	downUntil time.Time
+	latency   time.Duration // moving average of the time to response headers
+	measured  time.Time     // when a request to measure latency was last sent
+}
+
+// NewBalancer creates a balancer over replicas, given as base URLs
+func NewBalancer(replicas []string, policy BalancePolicy) (*Balancer, error) {
+	if policy == "" {
+		policy = RoundRobin
+	}
+	if policy != RoundRobin && policy != LeastPending && policy != Fastest {
+		return nil, fmt.Errorf("unknown balance policy %q: want %s, %s or %s", policy, RoundRobin, LeastPending, Fastest)
+	}
+	if len(replicas) == 0 {
+		return nil, errors.New("no replicas to balance over")
+	}
+
+	b := &Balancer{Base: newTransport(), policy: policy}
+	b.retries.tokens = retryBurst
+	for _, replica := range replicas {
+		u, err := url.Parse(replica)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("invalid replica URL %q", replica)
+		}
+		if first := b.endpoints; len(first) > 0 && u.Path != first[0].url.Path {
+			return nil, fmt.Errorf("replica %s must serve the API at the same path as %s", replica, first[0].url)
+		}
+		b.endpoints = append(b.endpoints, &endpoint{url: u})
+	}
+	return b, nil
+}
+
+// RoundTrip implements http.RoundTripper
+func (b *Balancer) RoundTrip(req *http.Request) (*http.Response, error) {
+	b.retries.earn()
+	tried := make([]bool, len(b.endpoints))
+	for attempt := 0; ; attempt++ {
+		i := b.pick(tried)
+		tried[i] = true
+		e := b.endpoints[i]
+
+		out := req.Clone(req.Context())
+		out.URL.Scheme = e.url.Scheme
+		out.URL.Host = e.url.Host
+		out.Host = ""
+		if attempt > 0 && req.Body != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			out.Body = body
+		}
+
+		e.pending.Add(1)
+		sent := time.Now()
+		resp, err := b.Base.RoundTrip(out)
+		if err != nil {
+			e.pending.Add(-1)
+			if req.Context().Err() != nil {
+				return nil, err
+			}
+			e.markFailed()
+			if !unconnected(err) || attempt+1 == len(b.endpoints) || (req.Body != nil && req.GetBody == nil) ||
+				!b.retries.spend() {
+				return nil, err
+			}
+			continue
+		}
+
+		if gatewayError(resp.StatusCode) {
+			e.markFailed()
+		} else {
+			e.markHealthy(time.Since(sent))
+		}
+		resp.Body = &pendingBody{ReadCloser: resp.Body, endpoint: e}
+		return resp, nil
+	}
+}
+
+// CloseIdleConnections closes the base transport's idle connections
+func (b *Balancer) CloseIdleConnections() {
+	if ci, ok := b.Base.(interface{ CloseIdleConnections() }); ok {
+		ci.CloseIdleConnections()
+	}
+}
+
+// pick chooses a replica not yet tried for this request, preferring
+// healthy ones
+func (b *Balancer) pick(tried []bool) int {
+	now := time.Now()
+	var candidates []int
+	for _, healthyOnly := range []bool{true, false} {
+		for i, e := range b.endpoints {
+			if !tried[i] && (!healthyOnly || e.up(now)) {
+				candidates = append(candidates, i)
+			}
+		}
+		if len(candidates) > 0 {
+			break
+		}
+	}
+
+	// Rotating over the candidates rather than all replicas keeps the
+	// share of one that is down from all going to its neighbour
+	start := int(b.next.Add(1) % uint64(len(candidates)))
+	switch b.policy {
+	case RoundRobin:
+		return candidates[start]
+	case Fastest:
+		return b.fastest(candidates, now)
+	}
+	best := candidates[start]
+	for k := range candidates {
+		i := candidates[(start+k)%len(candidates)]
+		if b.endpoints[i].pending.Load() < b.endpoints[best].pending.Load() {
+			best = i
+		}
+	}
+	return best
+}
+
+// fastest picks the candidate with the lowest average latency, or one due
+// to be measured again
+func (b *Balancer) fastest(candidates []int, now time.Time) int {
+	best, bestLatency := candidates[0], time.Duration(0)
+	for _, i := range candidates {
+		e := b.endpoints[i]
+		e.mu.Lock()
+		if now.Sub(e.measured) >= latencyRefresh {
+			// Only this request measures it; others carry on elsewhere
+			e.measured = now
+			e.mu.Unlock()
+			return i
+		}
+		latency := e.latency
+		e.mu.Unlock()
+		if bestLatency == 0 || latency > 0 && latency < bestLatency {
+			best, bestLatency = i, latency
+		}
+	}
+	return best
+}
+
+// up reports whether the replica is not backing off from a failure
+func (e *endpoint) up(now time.Time) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return !now.Before(e.downUntil)
+}
+
+// markFailed leaves the replica out for twice as long as after its last
+// failure, from probeMinInterval up to probeMaxInterval
+func (e *endpoint) markFailed() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	backoff := min(probeMinInterval<<min(e.failures, 5), probeMaxInterval)
+	e.failures++
+	e.downUntil = time.Now().Add(backoff)
+}
+
+// markHealthy records that the replica answered after latency
+func (e *endpoint) markHealthy(latency time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.failures = 0
+	e.downUntil = time.Time{}
+	if e.latency == 0 {
+		e.latency = latency
+	} else {
+		e.latency += time.Duration(latencyWeight * float64(latency-e.latency))
+	}
+}
+
+// unconnected reports whether a request failed before it reached the
+// server, so sending it elsewhere can't apply it twice
+func unconnected(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// pendingBody counts its request as in flight until the body is closed
+type pendingBody struct {
+	io.ReadCloser
+	endpoint *endpoint
+	once     sync.Once
+}
+
+// Close implements io.Closer
+func (b *pendingBody) Close() error {
+	b.once.Do(func() { b.endpoint.pending.Add(-1) })
+	return b.ReadCloser.Close()
+}
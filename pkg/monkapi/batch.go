@@ -0,0 +1,46 @@
+package monkapi
+
+import (
+	"context"
+	"sync"
+)
+
+// maxBatchConcurrency bounds the requests a batch keeps in flight
+const maxBatchConcurrency = 8
+
+// StatResult is the outcome of one path in a StatBatch call
+type StatResult struct {
+	Path string
+	Stat *StatResponse
+	Err  error
+}
+
+// StatBatch stats many paths at once, in one request when the server has
+// a batch stat endpoint and otherwise fanned out with bounded concurrency.
+// Results are returned in the order of paths.
+func (c *Client) StatBatch(ctx context.Context, paths []string, pick string) []StatResult {
+	if c.supports(FeatureBatchStat) {
+		if results, err := c.statBatch(ctx, paths); err == nil {
+			return results
+		}
+	}
+
+	results := make([]StatResult, len(paths))
+	sem := make(chan struct{}, maxBatchConcurrency)
+
+	var wg sync.WaitGroup
+	for i, path := range paths {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			stat, err := c.Stat(ctx, path, pick)
+			results[i] = StatResult{Path: path, Stat: stat, Err: err}
+		}()
+	}
+	wg.Wait()
+
+	return results
+}
@@ -0,0 +1,217 @@
+package monkapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+)
+
+// Optional File API features a server can advertise
+const (
+	FeatureRangedReads = "ranged_reads" // retrieve honors start_offset and max_bytes
+	FeatureMove        = "move"         // the move endpoint exists
+	FeatureBatchStat   = "batch_stat"   // the stat_batch endpoint exists
+	FeatureChangeFeed  = "change_feed"  // changes can be followed instead of polled
+)
+
+// legacyFeatures are assumed of servers without a capabilities endpoint
+var legacyFeatures = []string{FeatureRangedReads, FeatureMove}
+
+// Capabilities describes what a server supports
+type Capabilities struct {
+	Version  string   `json:"version"`
+	Features []string `json:"features"`
+
+	// Length limits in bytes the server enforces on paths and on each name
+	// in them; zero when it reports none
+	MaxPathLength int `json:"max_path_length,omitempty"`
+	MaxNameLength int `json:"max_name_length,omitempty"`
+}
+
+// Has reports whether the server advertises feature
+func (c *Capabilities) Has(feature string) bool {
+	return slices.Contains(c.Features, feature)
+}
+
+// Negotiate asks the server which optional features it supports and adapts
+// the client to them: reads are windowed locally when the server ignores
+// ranges, moves become copy and delete without a move endpoint, and
+// StatBatch uses the batch endpoint when there is one. Servers that predate
+// the capabilities endpoint are assumed to have the long-standing features.
+// Until Negotiate is called the client behaves as it always has.
+func (c *Client) Negotiate(ctx context.Context) (*Capabilities, error) {
+	respBody, err := c.get(ctx, "/api/file/capabilities")
+	if err != nil {
+		if IsNotFound(err) || isMethodNotAllowed(err) {
+			caps := &Capabilities{Features: legacyFeatures}
+			c.caps.Store(caps)
+			return caps, nil
+		}
+		return nil, err
+	}
+
+	// Unwrap the API response
+	var wrapper APIWrapper
+	if err := json.Unmarshal(respBody, &wrapper); err != nil {
+		return nil, fmt.Errorf("unmarshal wrapper: %w", err)
+	}
+
+	var caps Capabilities
+	if err := json.Unmarshal(wrapper.Data, &caps); err != nil {
+		return nil, fmt.Errorf("unmarshal capabilities response: %w", err)
+	}
+
+	c.caps.Store(&caps)
+	return &caps, nil
+}
+
+// Capabilities returns what the server reported when negotiated, or nil
+// before Negotiate is called
+func (c *Client) Capabilities() *Capabilities {
+	return c.caps.Load()
+}
+
+// supports reports whether the server has feature, as far as is known
+func (c *Client) supports(feature string) bool {
+	caps := c.caps.Load()
+	if caps == nil {
+		return slices.Contains(legacyFeatures, feature)
+	}
+	return caps.Has(feature)
+}
+
+// unranged strips the range from opts when the server cannot honor it,
+// returning the range to apply locally
+func (c *Client) unranged(opts RetrieveOptions) (RetrieveOptions, int, int) {
+	if c.supports(FeatureRangedReads) {
+		return opts, 0, 0
+	}
+	start, maxBytes := opts.StartOffset, opts.MaxBytes
+	opts.StartOffset, opts.MaxBytes = 0, 0
+	return opts, start, maxBytes
+}
+
+// window limits r to maxBytes (if positive) after skipping start bytes
+func window(r io.Reader, start, maxBytes int) (io.Reader, error) {
+	if start > 0 {
+		if _, err := io.CopyN(io.Discard, r, int64(start)); err != nil && err != io.EOF {
+			return nil, err
+		}
+	}
+	if maxBytes > 0 {
+		r = io.LimitReader(r, int64(maxBytes))
+	}
+	return r, nil
+}
+
+// sliceContent applies a range to the content of a retrieve response
+// fetched whole. Non-string content is ranged over its JSON representation,
+// as a string.
+func sliceContent(resp *RetrieveResponse, start, maxBytes int) error {
+	if resp.Content == nil || (start == 0 && maxBytes == 0) {
+		return nil
+	}
+
+	var data []byte
+	var text string
+	if json.Unmarshal(resp.Content, &text) == nil {
+		data = []byte(text)
+	} else {
+		data = resp.Content
+	}
+	if resp.Encoding == "base64" {
+		decoded, err := base64.StdEncoding.DecodeString(text)
+		if err != nil {
+			return fmt.Errorf("decode base64 content: %w", err)
+		}
+		data = decoded
+	}
+
+	r, err := window(bytes.NewReader(data), start, maxBytes)
+	if err != nil {
+		return err
+	}
+	data, _ = io.ReadAll(r)
+
+	if resp.Encoding == "base64" {
+		text = base64.StdEncoding.EncodeToString(data)
+	} else {
+		text = string(data)
+	}
+	resp.Content, err = json.Marshal(text)
+	return err
+}
+
+// moveByCopy emulates a move as a copy followed by deleting the source,
+// for servers without a move endpoint
+func (c *Client) moveByCopy(ctx context.Context, source, destination string, opts MoveOptions, pick string) (*MoveResponse, error) {
+	copied, err := c.Copy(ctx, source, destination, CopyOptions{Overwrite: opts.Overwrite}, pick)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := c.Delete(ctx, source, DeleteOptions{Recursive: true}, ""); err != nil {
+		return nil, err
+	}
+	return &MoveResponse{Success: copied.Success, FileMetadata: copied.FileMetadata}, nil
+}
+
+// batchStatResult is one entry of a stat_batch response: the stat, or the
+// error for that path
+type batchStatResult struct {
+	Path      string        `json:"path"`
+	Stat      *StatResponse `json:"stat"`
+	Status    int           `json:"status"`
+	Error     string        `json:"error"`
+	ErrorCode string        `json:"error_code"`
+}
+
+// statBatch stats paths in one stat_batch request. Per-path failures are
+// reported in the results; an error is returned only if the whole request
+// failed.
+func (c *Client) statBatch(ctx context.Context, paths []string) ([]StatResult, error) {
+	respBody, err := c.post(ctx, "/api/file/stat_batch", map[string]interface{}{"paths": paths})
+	if err != nil {
+		return nil, err
+	}
+
+	// Unwrap the API response
+	var wrapper APIWrapper
+	if err := json.Unmarshal(respBody, &wrapper); err != nil {
+		return nil, fmt.Errorf("unmarshal wrapper: %w", err)
+	}
+
+	var result struct {
+		Results []batchStatResult `json:"results"`
+	}
+	if err := json.Unmarshal(wrapper.Data, &result); err != nil {
+		return nil, fmt.Errorf("unmarshal stat_batch response: %w", err)
+	}
+
+	byPath := make(map[string]batchStatResult, len(result.Results))
+	for _, r := range result.Results {
+		byPath[r.Path] = r
+	}
+
+	results := make([]StatResult, len(paths))
+	for i, path := range paths {
+		r, ok := byPath[path]
+		switch {
+		case !ok:
+			results[i] = StatResult{Path: path, Err: &FieldError{Response: "stat_batch", Field: "results." + path}}
+		case r.Stat == nil:
+			if r.Status == 0 {
+				r.Status = http.StatusInternalServerError
+			}
+			results[i] = StatResult{Path: path, Err: &APIError{StatusCode: r.Status, ErrorCode: r.ErrorCode, Message: r.Error}}
+		default:
+			r.Stat.FileMetadata.Size = max(r.Stat.FileMetadata.Size, 0)
+			results[i] = StatResult{Path: path, Stat: r.Stat}
+		}
+	}
+	return results, nil
+}
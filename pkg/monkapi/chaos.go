@@ -0,0 +1,98 @@
+package monkapi
+
+import (
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ChaosTransport injects faults into a fraction of requests, for checking
+// how caching and error handling behave against an unreliable API. Each
+// faulty request gets one of: added latency, a synthesized 503, a response
+// body cut off partway through, or a connection reset.
+type ChaosTransport struct {
+	// Base performs the real requests; nil means http.DefaultTransport
+	Base http.RoundTripper
+
+	// Rate is the fraction of requests that fail, from 0 to 1
+	Rate float64
+
+	// MaxLatency bounds the delay added to slow requests
+	MaxLatency time.Duration
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *ChaosTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if rand.Float64() >= t.Rate {
+		return base.RoundTrip(req)
+	}
+
+	switch rand.IntN(4) {
+	case 0:
+		delay := time.Duration(rand.Int64N(int64(max(t.MaxLatency, time.Millisecond))))
+		select {
+		case <-time.After(delay):
+		case <-req.Context().Done():
+			closeBody(req)
+			return nil, req.Context().Err()
+		}
+		return base.RoundTrip(req)
+	case 1:
+		closeBody(req)
+		body := `{"success":false,"error":"chaos: injected failure","error_code":"SERVICE_UNAVAILABLE"}`
+		return &http.Response{
+			Status:        "503 Service Unavailable",
+			StatusCode:    http.StatusServiceUnavailable,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        http.Header{"Content-Type": {"application/json"}},
+			Body:          io.NopCloser(strings.NewReader(body)),
+			ContentLength: int64(len(body)),
+			Request:       req,
+		}, nil
+	case 2:
+		resp, err := base.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+		resp.Body = &truncatedBody{ReadCloser: resp.Body, remaining: rand.Int64N(512)}
+		resp.ContentLength = -1
+		return resp, nil
+	default:
+		closeBody(req)
+		return nil, fmt.Errorf("chaos: %w", syscall.ECONNRESET)
+	}
+}
+
+func closeBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
+
+// truncatedBody fails with io.ErrUnexpectedEOF after remaining bytes
+type truncatedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (b *truncatedBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	return n, err
+}
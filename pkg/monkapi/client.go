@@ -8,89 +8,193 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"sync/atomic"
 	"time"
 )
 
 // Client handles communication with the Monk File API
 type Client struct {
 	baseURL    string
-	token      string
+	tokens     TokenSource
 	httpClient *http.Client
+	userAgent  string
+	mountID    string
+	headers    http.Header
+	signer     *HMACSigner
+	getReads   atomic.Bool
+	strict     atomic.Bool
+	caps       atomic.Pointer[Capabilities]
+	failFast   atomic.Bool
+	health     health
+
+	// lastRequest is when the last request was sent, with its monotonic
+	// reading, to tell idle connections and suspends apart
+	lastRequest atomic.Pointer[time.Time]
 }
 
 // NewClient creates a new Monk API client with connection pooling
 func NewClient(baseURL, token string) *Client {
+	return NewClientWithTokenSource(baseURL, StaticToken(token))
+}
+
+// NewClientWithTokenSource creates a client that asks tokens for the bearer
+// token of every request
+func NewClientWithTokenSource(baseURL string, tokens TokenSource) *Client {
 	return &Client{
-		baseURL: baseURL,
-		token:   token,
+		baseURL:   baseURL,
+		tokens:    tokens,
+		userAgent: userAgent(),
 		httpClient: &http.Client{
-			Transport: &http.Transport{
-				MaxIdleConns:        100,
-				MaxIdleConnsPerHost: 10,
-				IdleConnTimeout:     90 * time.Second,
-			},
-			Timeout: 30 * time.Second,
+			Transport: newTransport(),
+			Timeout:   30 * time.Second,
 		},
 	}
 }
 
+// newTransport returns a transport that keeps connections to the API open
+// between requests
+func newTransport() *http.Transport {
+	return &http.Transport{
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 10,
+		IdleConnTimeout:     90 * time.Second,
+	}
+}
+
+// SetTransport replaces the transport used for API requests
+func (c *Client) SetTransport(rt http.RoundTripper) {
+	c.httpClient.Transport = rt
+}
+
 // post performs a POST request to the API
 func (c *Client) post(ctx context.Context, endpoint string, body interface{}) ([]byte, error) {
-	jsonData, err := json.Marshal(body)
+	return c.send(ctx, "POST", endpoint, body)
+}
+
+// send performs a request with a JSON body to the API
+func (c *Client) send(ctx context.Context, method string, endpoint string, body interface{}) ([]byte, error) {
+	// Request bodies are not pooled: the transport may still read one
+	// after the response has arrived, and retries read it again
+	data, err := json.Marshal(body)
 	if err != nil {
 		return nil, fmt.Errorf("marshal request: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+endpoint, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+endpoint, bytes.NewReader(data))
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	if c.token != "" {
-		req.Header.Set("Authorization", "Bearer "+c.token)
-	}
+	return c.do(req)
+}
 
-	resp, err := c.httpClient.Do(req)
+// get performs a GET request to the API
+func (c *Client) get(ctx context.Context, endpoint string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+endpoint, nil)
 	if err != nil {
-		return nil, fmt.Errorf("http request: %w", err)
+		return nil, fmt.Errorf("create request: %w", err)
 	}
-	defer resp.Body.Close()
 
-	respBody, err := io.ReadAll(resp.Body)
+	return c.do(req)
+}
+
+// do sends an authenticated request and returns the response body,
+// converting non-200 responses into errors
+func (c *Client) do(req *http.Request) ([]byte, error) {
+	body, err := c.doStream(req)
 	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	// Read through a pooled buffer and copy out once at the final size,
+	// instead of growing a fresh slice for every response
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	if _, err := buf.ReadFrom(body); err != nil {
 		return nil, fmt.Errorf("read response: %w", err)
 	}
 
+	return bytes.Clone(buf.Bytes()), nil
+}
+
+// doStream sends an authenticated request and returns the unread response
+// body, converting non-200 responses into errors. The caller must close it.
+func (c *Client) doStream(req *http.Request) (io.ReadCloser, error) {
+	if err := c.available(); err != nil {
+		return nil, err
+	}
+	c.dropIfResumed()
+
+	token, err := c.tokens.Token(req.Context())
+	if err != nil {
+		return nil, fmt.Errorf("get token: %w", err)
+	}
+	req.Header.Set("User-Agent", c.userAgent)
+	if c.mountID != "" {
+		req.Header.Set("X-Client-Mount-ID", c.mountID)
+	}
+	if id := requestID(req.Context()); id != "" {
+		req.Header.Set("X-Request-ID", id)
+	}
+	for name, values := range c.headers {
+		req.Header[name] = values
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if c.signer != nil {
+		if err := c.signer.sign(req); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		// A cancelled request says nothing about the server
+		if req.Context().Err() == nil {
+			c.markDown(err.Error())
+		}
+		return nil, fmt.Errorf("http request: %w", err)
+	}
+
 	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		if gatewayError(resp.StatusCode) {
+			c.markDown(resp.Status)
+		}
+
+		respBody, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("read response: %w", err)
+		}
+
+		// Servers without GET support may answer with an arbitrary body
+		if resp.StatusCode == http.StatusMethodNotAllowed {
+			return nil, &APIError{StatusCode: resp.StatusCode, ErrorCode: "METHOD_NOT_ALLOWED", Message: string(respBody)}
+		}
+
 		var errResp ErrorResponse
 		if err := json.Unmarshal(respBody, &errResp); err == nil {
 			return nil, &APIError{
 				StatusCode: resp.StatusCode,
 				ErrorCode:  errResp.ErrorCode,
 				Message:    errResp.Error,
+				Details:    errResp.Data,
 			}
 		}
 		return nil, fmt.Errorf("http %d: %s", resp.StatusCode, string(respBody))
 	}
 
-	return respBody, nil
+	return resp.Body, nil
 }
 
 // List retrieves directory listing from the File API
 // Use pick parameter to reduce bandwidth (e.g., "entries" for 60% reduction)
 func (c *Client) List(ctx context.Context, path string, opts ListOptions, pick string) (*ListResponse, error) {
-	req := map[string]interface{}{
-		"path":         path,
-		"file_options": opts,
-	}
-
-	endpoint := "/api/file/list"
-	if pick != "" {
-		endpoint += "?pick=" + url.QueryEscape(pick)
-	}
-
-	respBody, err := c.post(ctx, endpoint, req)
+	respBody, err := c.read(ctx, "/api/file/list", path, opts, pick)
 	if err != nil {
 		return nil, err
 	}
@@ -101,10 +205,23 @@ func (c *Client) List(ctx context.Context, path string, opts ListOptions, pick s
 		return nil, fmt.Errorf("unmarshal wrapper: %w", err)
 	}
 
+	if err := c.checkFieldNames("list", wrapper.Data); err != nil {
+		return nil, err
+	}
+
 	var result ListResponse
 	if err := json.Unmarshal(wrapper.Data, &result); err != nil {
 		return nil, fmt.Errorf("unmarshal list response: %w", err)
 	}
+	if err := result.validate(pick); err != nil {
+		return nil, err
+	}
+
+	// A negative size would wrap to an enormous unsigned size in callers
+	result.FileMetadata.Size = max(result.FileMetadata.Size, 0)
+	for i := range result.Entries {
+		result.Entries[i].FileSize = max(result.Entries[i].FileSize, 0)
+	}
 
 	return &result, nil
 }
@@ -112,16 +229,7 @@ func (c *Client) List(ctx context.Context, path string, opts ListOptions, pick s
 // Stat retrieves file/directory metadata from the File API
 // Use pick parameter to reduce bandwidth (e.g., "file_metadata" for 40-50% reduction)
 func (c *Client) Stat(ctx context.Context, path string, pick string) (*StatResponse, error) {
-	req := map[string]interface{}{
-		"path": path,
-	}
-
-	endpoint := "/api/file/stat"
-	if pick != "" {
-		endpoint += "?pick=" + url.QueryEscape(pick)
-	}
-
-	respBody, err := c.post(ctx, endpoint, req)
+	respBody, err := c.read(ctx, "/api/file/stat", path, nil, pick)
 	if err != nil {
 		return nil, err
 	}
@@ -132,10 +240,18 @@ func (c *Client) Stat(ctx context.Context, path string, pick string) (*StatRespo
 		return nil, fmt.Errorf("unmarshal wrapper: %w", err)
 	}
 
+	if err := c.checkFieldNames("stat", wrapper.Data); err != nil {
+		return nil, err
+	}
+
 	var result StatResponse
 	if err := json.Unmarshal(wrapper.Data, &result); err != nil {
 		return nil, fmt.Errorf("unmarshal stat response: %w", err)
 	}
+	if err := result.validate(pick); err != nil {
+		return nil, err
+	}
+	result.FileMetadata.Size = max(result.FileMetadata.Size, 0)
 
 	return &result, nil
 }
@@ -143,17 +259,8 @@ func (c *Client) Stat(ctx context.Context, path string, pick string) (*StatRespo
 // Retrieve retrieves file content from the File API
 // Use pick parameter to reduce bandwidth (e.g., "content" for 80% reduction)
 func (c *Client) Retrieve(ctx context.Context, path string, opts RetrieveOptions, pick string) (*RetrieveResponse, error) {
-	req := map[string]interface{}{
-		"path":         path,
-		"file_options": opts,
-	}
-
-	endpoint := "/api/file/retrieve"
-	if pick != "" {
-		endpoint += "?pick=" + url.QueryEscape(pick)
-	}
-
-	respBody, err := c.post(ctx, endpoint, req)
+	opts, start, maxBytes := c.unranged(opts)
+	respBody, err := c.read(ctx, "/api/file/retrieve", path, opts, pick)
 	if err != nil {
 		return nil, err
 	}
@@ -164,10 +271,20 @@ func (c *Client) Retrieve(ctx context.Context, path string, opts RetrieveOptions
 		return nil, fmt.Errorf("unmarshal wrapper: %w", err)
 	}
 
+	if err := c.checkFieldNames("retrieve", wrapper.Data); err != nil {
+		return nil, err
+	}
+
 	var result RetrieveResponse
 	if err := json.Unmarshal(wrapper.Data, &result); err != nil {
 		return nil, fmt.Errorf("unmarshal retrieve response: %w", err)
 	}
+	if err := result.validate(pick); err != nil {
+		return nil, err
+	}
+	if err := sliceContent(&result, start, maxBytes); err != nil {
+		return nil, err
+	}
 
 	return &result, nil
 }
@@ -177,6 +294,7 @@ type APIError struct {
 	StatusCode int
 	ErrorCode  string
 	Message    string
+	Details    json.RawMessage
 }
 
 func (e *APIError) Error() string {
@@ -207,6 +325,10 @@ func (c *Client) Store(ctx context.Context, path string, content interface{}, op
 		return nil, fmt.Errorf("unmarshal wrapper: %w", err)
 	}
 
+	if err := c.checkFieldNames("store", wrapper.Data); err != nil {
+		return nil, err
+	}
+
 	var result StoreResponse
 	if err := json.Unmarshal(wrapper.Data, &result); err != nil {
 		return nil, fmt.Errorf("unmarshal store response: %w", err)
@@ -215,8 +337,165 @@ func (c *Client) Store(ctx context.Context, path string, content interface{}, op
 	return &result, nil
 }
 
+// Delete removes a file from the File API
+func (c *Client) Delete(ctx context.Context, path string, opts DeleteOptions, pick string) (*DeleteResponse, error) {
+	req := map[string]interface{}{
+		"path":         path,
+		"file_options": opts,
+	}
+
+	endpoint := "/api/file/delete"
+	if pick != "" {
+		endpoint += "?pick=" + url.QueryEscape(pick)
+	}
+
+	respBody, err := c.post(ctx, endpoint, req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unwrap the API response
+	var wrapper APIWrapper
+	if err := json.Unmarshal(respBody, &wrapper); err != nil {
+		return nil, fmt.Errorf("unmarshal wrapper: %w", err)
+	}
+
+	var result DeleteResponse
+	if err := json.Unmarshal(wrapper.Data, &result); err != nil {
+		return nil, fmt.Errorf("unmarshal delete response: %w", err)
+	}
+
+	return &result, nil
+}
+
+// Copy copies a file on the server without transferring its content
+func (c *Client) Copy(ctx context.Context, source, destination string, opts CopyOptions, pick string) (*CopyResponse, error) {
+	req := map[string]interface{}{
+		"source":       source,
+		"destination":  destination,
+		"file_options": opts,
+	}
+
+	endpoint := "/api/file/copy"
+	if pick != "" {
+		endpoint += "?pick=" + url.QueryEscape(pick)
+	}
+
+	respBody, err := c.post(ctx, endpoint, req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unwrap the API response
+	var wrapper APIWrapper
+	if err := json.Unmarshal(respBody, &wrapper); err != nil {
+		return nil, fmt.Errorf("unmarshal wrapper: %w", err)
+	}
+
+	if err := c.checkFieldNames("copy", wrapper.Data); err != nil {
+		return nil, err
+	}
+
+	var result CopyResponse
+	if err := json.Unmarshal(wrapper.Data, &result); err != nil {
+		return nil, fmt.Errorf("unmarshal copy response: %w", err)
+	}
+
+	return &result, nil
+}
+
+// Move renames or relocates a file on the server
+func (c *Client) Move(ctx context.Context, source, destination string, opts MoveOptions, pick string) (*MoveResponse, error) {
+	if !c.supports(FeatureMove) {
+		return c.moveByCopy(ctx, source, destination, opts, pick)
+	}
+
+	req := map[string]interface{}{
+		"source":       source,
+		"destination":  destination,
+		"file_options": opts,
+	}
+
+	endpoint := "/api/file/move"
+	if pick != "" {
+		endpoint += "?pick=" + url.QueryEscape(pick)
+	}
+
+	respBody, err := c.post(ctx, endpoint, req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unwrap the API response
+	var wrapper APIWrapper
+	if err := json.Unmarshal(respBody, &wrapper); err != nil {
+		return nil, fmt.Errorf("unmarshal wrapper: %w", err)
+	}
+
+	if err := c.checkFieldNames("move", wrapper.Data); err != nil {
+		return nil, err
+	}
+
+	var result MoveResponse
+	if err := json.Unmarshal(wrapper.Data, &result); err != nil {
+		return nil, fmt.Errorf("unmarshal move response: %w", err)
+	}
+
+	return &result, nil
+}
+
+// Update changes a file's metadata, such as its permissions, without
+// transferring its content
+func (c *Client) Update(ctx context.Context, path string, opts UpdateOptions, pick string) (*UpdateResponse, error) {
+	req := map[string]interface{}{
+		"path":          path,
+		"file_metadata": opts,
+	}
+
+	endpoint := "/api/file/update"
+	if pick != "" {
+		endpoint += "?pick=" + url.QueryEscape(pick)
+	}
+
+	respBody, err := c.post(ctx, endpoint, req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unwrap the API response
+	var wrapper APIWrapper
+	if err := json.Unmarshal(respBody, &wrapper); err != nil {
+		return nil, fmt.Errorf("unmarshal wrapper: %w", err)
+	}
+
+	if err := c.checkFieldNames("update", wrapper.Data); err != nil {
+		return nil, err
+	}
+
+	var result UpdateResponse
+	if err := json.Unmarshal(wrapper.Data, &result); err != nil {
+		return nil, fmt.Errorf("unmarshal update response: %w", err)
+	}
+
+	return &result, nil
+}
+
 // IsNotFound returns true if the error is a 404 not found
 func IsNotFound(err error) bool {
 	apiErr, ok := err.(*APIError)
 	return ok && apiErr.StatusCode == 404
 }
+
+// IsLocked returns true if the error is a lock request refused because
+// another holder's lock conflicts with it
+func IsLocked(err error) bool {
+	apiErr, ok := err.(*APIError)
+	return ok && (apiErr.StatusCode == 423 || apiErr.ErrorCode == "LOCKED")
+}
+
+// IsValidation returns true if the error is a rejected write due to
+// record validation
+func IsValidation(err error) bool {
+	apiErr, ok := err.(*APIError)
+	return ok && (apiErr.ErrorCode == "VALIDATION_FAILED" || apiErr.StatusCode == 422)
+}
@@ -0,0 +1,73 @@
+package monkapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// ListRecords retrieves all records of a schema from the Data API
+func (c *Client) ListRecords(ctx context.Context, schema string) ([]json.RawMessage, error) {
+	respBody, err := c.get(ctx, "/api/data/"+url.PathEscape(schema))
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := unwrap(respBody)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []json.RawMessage
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("unmarshal records: %w", err)
+	}
+
+	return records, nil
+}
+
+// GetRecord retrieves a single record from the Data API
+func (c *Client) GetRecord(ctx context.Context, schema, id string) (json.RawMessage, error) {
+	respBody, err := c.get(ctx, "/api/data/"+url.PathEscape(schema)+"/"+url.PathEscape(id))
+	if err != nil {
+		return nil, err
+	}
+
+	return unwrap(respBody)
+}
+
+// CreateRecord creates a record in the Data API
+func (c *Client) CreateRecord(ctx context.Context, schema string, record json.RawMessage) error {
+	_, err := c.send(ctx, http.MethodPost, "/api/data/"+url.PathEscape(schema), []json.RawMessage{record})
+	return err
+}
+
+// UpdateRecord replaces a record in the Data API
+func (c *Client) UpdateRecord(ctx context.Context, schema, id string, record json.RawMessage) error {
+	_, err := c.send(ctx, http.MethodPut, "/api/data/"+url.PathEscape(schema)+"/"+url.PathEscape(id), record)
+	return err
+}
+
+// DeleteRecord removes a record from the Data API
+func (c *Client) DeleteRecord(ctx context.Context, schema, id string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, c.baseURL+"/api/data/"+url.PathEscape(schema)+"/"+url.PathEscape(id), nil)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+
+	_, err = c.do(req)
+	return err
+}
+
+// RecordID extracts the id field from a record
+func RecordID(record json.RawMessage) string {
+	var rec struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(record, &rec); err != nil {
+		return ""
+	}
+	return rec.ID
+}
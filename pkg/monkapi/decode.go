@@ -0,0 +1,278 @@
+package monkapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Responses are decoded leniently: fields renamed between API versions
+// are also accepted under their other names, with the current name taking
+// precedence when both are set. The tables below list the alternate name
+// for each current one; the UnmarshalJSON methods implement them and
+// strict decoding rejects them.
+var (
+	responseAliases = map[string]string{
+		"metadata":  "file_metadata",
+		"file_type": "type",
+		"files":     "entries",
+	}
+	metadataAliases = map[string]string{
+		"file_size":        "size",
+		"modified_at":      "modified_time",
+		"created_at":       "created_time",
+		"accessed_at":      "access_time",
+		"file_type":        "type",
+		"file_permissions": "permissions",
+		"mime_type":        "content_type",
+	}
+	entryAliases = map[string]string{
+		"type":          "file_type",
+		"size":          "file_size",
+		"permissions":   "file_permissions",
+		"modified_time": "file_modified",
+	}
+)
+
+// FieldError reports a response that is missing a required field, or that
+// uses an alternate field name while strict decoding is enabled
+type FieldError struct {
+	Response string // Operation, e.g. "stat"
+	Field    string
+	Alias    string // Alternate name used instead of Field, if any
+}
+
+func (e *FieldError) Error() string {
+	if e.Alias != "" {
+		return fmt.Sprintf("%s response uses %q instead of %q", e.Response, e.Alias, e.Field)
+	}
+	return fmt.Sprintf("%s response is missing required field %q", e.Response, e.Field)
+}
+
+// SetStrictDecoding makes responses that use alternate field names fail
+// with a FieldError instead of being accepted, to catch API drift when
+// testing against a new server version
+func (c *Client) SetStrictDecoding(strict bool) {
+	c.strict.Store(strict)
+}
+
+// checkFieldNames rejects alternate field names in the data of a response
+// when strict decoding is enabled
+func (c *Client) checkFieldNames(response string, data json.RawMessage) error {
+	if !c.strict.Load() {
+		return nil
+	}
+
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(data, &fields) != nil {
+		// Not an object; decoding reports the error
+		return nil
+	}
+	if err := checkAliases(response, fields, responseAliases); err != nil {
+		return err
+	}
+
+	var metadata map[string]json.RawMessage
+	if json.Unmarshal(fields["file_metadata"], &metadata) == nil {
+		if err := checkAliases(response, metadata, metadataAliases); err != nil {
+			return err
+		}
+	}
+
+	var entries []map[string]json.RawMessage
+	if json.Unmarshal(fields["entries"], &entries) == nil {
+		for _, entry := range entries {
+			if err := checkAliases(response, entry, entryAliases); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkAliases returns a FieldError for the first alternate name in fields
+func checkAliases(response string, fields map[string]json.RawMessage, aliases map[string]string) error {
+	for alias, field := range aliases {
+		if _, ok := fields[alias]; ok {
+			return &FieldError{Response: response, Field: field, Alias: alias}
+		}
+	}
+	return nil
+}
+
+// picked reports whether a response requested with pick includes field
+func picked(pick, field string) bool {
+	return pick == "" || slices.Contains(strings.Split(pick, ","), field)
+}
+
+// alternate copies alt into current when current is unset
+func alternate[T comparable](current *T, alt *T) {
+	var zero T
+	if *current == zero && alt != nil {
+		*current = *alt
+	}
+}
+
+func (m *FileMetadata) UnmarshalJSON(data []byte) error {
+	type plain FileMetadata
+	v := struct {
+		*plain
+		FileSize        *int64  `json:"file_size"`
+		ModifiedAt      *string `json:"modified_at"`
+		CreatedAt       *string `json:"created_at"`
+		AccessedAt      *string `json:"accessed_at"`
+		FileType        *string `json:"file_type"`
+		FilePermissions *string `json:"file_permissions"`
+		MimeType        *string `json:"mime_type"`
+	}{plain: (*plain)(m)}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	alternate(&m.Size, v.FileSize)
+	alternate(&m.ModifiedTime, v.ModifiedAt)
+	alternate(&m.CreatedTime, v.CreatedAt)
+	alternate(&m.AccessTime, v.AccessedAt)
+	alternate(&m.Type, v.FileType)
+	alternate(&m.Permissions, v.FilePermissions)
+	alternate(&m.ContentType, v.MimeType)
+	return nil
+}
+
+func (e *FileEntry) UnmarshalJSON(data []byte) error {
+	type plain FileEntry
+	v := struct {
+		*plain
+		Type         *string `json:"type"`
+		Size         *int64  `json:"size"`
+		Permissions  *string `json:"permissions"`
+		ModifiedTime *string `json:"modified_time"`
+	}{plain: (*plain)(e)}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	alternate(&e.FileType, v.Type)
+	alternate(&e.FileSize, v.Size)
+	alternate(&e.FilePermissions, v.Permissions)
+	alternate(&e.FileModified, v.ModifiedTime)
+	return nil
+}
+
+func (r *StatResponse) UnmarshalJSON(data []byte) error {
+	type plain StatResponse
+	v := struct {
+		*plain
+		Metadata *FileMetadata `json:"metadata"`
+		FileType *string       `json:"file_type"`
+	}{plain: (*plain)(r)}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	if r.FileMetadata == (FileMetadata{}) && v.Metadata != nil {
+		r.FileMetadata = *v.Metadata
+	}
+	alternate(&r.Type, v.FileType)
+	return nil
+}
+
+func (r *ListResponse) UnmarshalJSON(data []byte) error {
+	type plain ListResponse
+	v := struct {
+		*plain
+		// Entries shadows the embedded field so a null listing can be
+		// told apart from a missing one
+		Entries  json.RawMessage `json:"entries"`
+		Metadata *FileMetadata   `json:"metadata"`
+		Files    json.RawMessage `json:"files"`
+	}{plain: (*plain)(r)}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	if r.FileMetadata == (FileMetadata{}) && v.Metadata != nil {
+		r.FileMetadata = *v.Metadata
+	}
+	if v.Entries == nil {
+		v.Entries = v.Files
+	}
+	if v.Entries == nil {
+		return nil
+	}
+	if err := json.Unmarshal(v.Entries, &r.Entries); err != nil {
+		return err
+	}
+	if r.Entries == nil {
+		r.Entries = []FileEntry{}
+	}
+	return nil
+}
+
+// metadataResponse decodes the file_metadata of a mutation response,
+// accepting the alternate name "metadata"
+func metadataResponse(data []byte, success *bool, metadata *FileMetadata) error {
+	var v struct {
+		Success      bool          `json:"success"`
+		FileMetadata *FileMetadata `json:"file_metadata"`
+		Metadata     *FileMetadata `json:"metadata"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	*success = v.Success
+	if v.FileMetadata == nil {
+		v.FileMetadata = v.Metadata
+	}
+	if v.FileMetadata != nil {
+		*metadata = *v.FileMetadata
+	}
+	return nil
+}
+
+func (r *StoreResponse) UnmarshalJSON(data []byte) error {
+	return metadataResponse(data, &r.Success, &r.FileMetadata)
+}
+
+func (r *CopyResponse) UnmarshalJSON(data []byte) error {
+	return metadataResponse(data, &r.Success, &r.FileMetadata)
+}
+
+func (r *MoveResponse) UnmarshalJSON(data []byte) error {
+	return metadataResponse(data, &r.Success, &r.FileMetadata)
+}
+
+func (r *UpdateResponse) UnmarshalJSON(data []byte) error {
+	return metadataResponse(data, &r.Success, &r.FileMetadata)
+}
+
+// validate checks the fields a stat response requested with pick needs
+func (r *StatResponse) validate(pick string) error {
+	if picked(pick, "file_metadata") && r.FileMetadata == (FileMetadata{}) {
+		return &FieldError{Response: "stat", Field: "file_metadata"}
+	}
+	return nil
+}
+
+// validate checks the fields a list response requested with pick needs
+func (r *ListResponse) validate(pick string) error {
+	if picked(pick, "entries") && r.Entries == nil {
+		return &FieldError{Response: "list", Field: "entries"}
+	}
+	for _, entry := range r.Entries {
+		if entry.Name == "" {
+			return &FieldError{Response: "list", Field: "entries.name"}
+		}
+	}
+	return nil
+}
+
+// validate checks the fields a retrieve response requested with pick needs
+func (r *RetrieveResponse) validate(pick string) error {
+	if picked(pick, "content") && r.Content == nil {
+		return &FieldError{Response: "retrieve", Field: "content"}
+	}
+	return nil
+}
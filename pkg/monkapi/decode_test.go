@@ -0,0 +1,316 @@
+package monkapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// bodyTransport answers every request with status 200 and a fixed body
+type bodyTransport []byte
+
+func (t bodyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Status:     "200 OK",
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(bytes.NewReader(t)),
+		Request:    req,
+	}, nil
+}
+
+// responseClient returns a client every request of which is answered with
+// body, decoding strictly if strict is set
+func responseClient(body []byte, strict bool) *Client {
+	c := NewClient("http://monk.invalid", "test-token")
+	c.SetTransport(bodyTransport(body))
+	c.SetStrictDecoding(strict)
+	return c
+}
+
+// wrap puts data in the envelope of a successful response
+func wrap(data string) []byte {
+	return []byte(`{"success":true,"data":` + data + `}`)
+}
+
+// responseVersions are the API versions with fixtures under
+// testdata/responses: v1 uses the field names since renamed, v2 the
+// current ones
+var responseVersions = []struct {
+	name    string
+	current bool // uses only the current field names
+}{
+	{"v1", false},
+	{"v2", true},
+}
+
+// fixture returns the response body in testdata/responses/dir/name.json
+func fixture(t *testing.T, dir, name string) []byte {
+	t.Helper()
+	body, err := os.ReadFile(filepath.Join("testdata", "responses", dir, name+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func TestDecodeVersions(t *testing.T) {
+	ctx := context.Background()
+	metadata := FileMetadata{
+		Size:         12,
+		ModifiedTime: "2024-01-02T03:04:05Z",
+		Type:         "file",
+		Permissions:  "rw-r--r--",
+	}
+
+	tests := []struct {
+		name    string
+		renamed bool // v1 names some of its fields differently
+		call    func(c *Client) (any, error)
+		want    any
+	}{
+		{
+			"stat", true,
+			func(c *Client) (any, error) { return c.Stat(ctx, "/docs/notes.txt", "") },
+			&StatResponse{Success: true, Type: "file", FileMetadata: FileMetadata{
+				Size:         12,
+				ModifiedTime: "2024-01-02T03:04:05Z",
+				CreatedTime:  "2023-12-01T00:00:00Z",
+				AccessTime:   "2024-01-03T00:00:00Z",
+				Type:         "file",
+				Permissions:  "rw-r--r--",
+				ContentType:  "text/plain",
+			}},
+		},
+		{
+			"list", true,
+			func(c *Client) (any, error) { return c.List(ctx, "/docs", ListOptions{}, "") },
+			&ListResponse{Success: true, Total: 2, Entries: []FileEntry{
+				{Name: "notes.txt", FileType: "f", FileSize: 12, FilePermissions: "rw-r--r--", FileModified: "20240102030405", Path: "/docs/notes.txt"},
+				{Name: "archive", FileType: "d", FilePermissions: "rwxr-xr-x", FileModified: "20231201000000", Path: "/docs/archive"},
+			}},
+		},
+		{
+			"retrieve", false,
+			func(c *Client) (any, error) { return c.Retrieve(ctx, "/docs/notes.txt", RetrieveOptions{}, "") },
+			&RetrieveResponse{Success: true, Content: json.RawMessage(`"hello world\n"`)},
+		},
+		{
+			"store", true,
+			func(c *Client) (any, error) {
+				return c.Store(ctx, "/docs/notes.txt", "hello world\n", StoreOptions{}, "")
+			},
+			&StoreResponse{Success: true, FileMetadata: metadata},
+		},
+	}
+
+	for _, version := range responseVersions {
+		for _, tt := range tests {
+			t.Run(version.name+"/"+tt.name, func(t *testing.T) {
+				body := fixture(t, version.name, tt.name)
+				got, err := tt.call(responseClient(body, false))
+				if err != nil {
+					t.Fatalf("decode: %v", err)
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("decoded %+v, want %+v", got, tt.want)
+				}
+
+				// Strict decoding accepts only the current field names
+				_, err = tt.call(responseClient(body, true))
+				var fieldErr *FieldError
+				switch {
+				case version.current && err != nil:
+					t.Errorf("strict decode: %v", err)
+				case !version.current && tt.renamed && (!errors.As(err, &fieldErr) || fieldErr.Alias == ""):
+					t.Errorf("strict decode: %v, want a FieldError naming the alternate field", err)
+				}
+			})
+		}
+	}
+}
+
+func TestDecodeMissingFields(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		fixture string
+		field   string
+		call    func(c *Client) error
+	}{
+		{"stat", "file_metadata", func(c *Client) error {
+			_, err := c.Stat(ctx, "/x", "file_metadata")
+			return err
+		}},
+		{"list", "entries", func(c *Client) error {
+			_, err := c.List(ctx, "/", ListOptions{}, "entries")
+			return err
+		}},
+		{"list_name", "entries.name", func(c *Client) error {
+			_, err := c.List(ctx, "/", ListOptions{}, "entries")
+			return err
+		}},
+		{"retrieve", "content", func(c *Client) error {
+			_, err := c.Retrieve(ctx, "/x", RetrieveOptions{}, "content")
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			err := tt.call(responseClient(fixture(t, "missing", tt.fixture), false))
+			var fieldErr *FieldError
+			if !errors.As(err, &fieldErr) || fieldErr.Field != tt.field || fieldErr.Alias != "" {
+				t.Errorf("decode: %v, want missing field %q", err, tt.field)
+			}
+		})
+	}
+}
+
+var (
+	statSeeds = []string{
+		`{"success":true,"type":"file","file_metadata":{"size":12,"modified_time":"2024-01-02T03:04:05Z","type":"file","permissions":"rw-r--r--"}}`,
+		`{"success":true,"file_type":"directory","metadata":{"file_size":0,"modified_at":"2024-01-02T03:04:05Z","file_type":"directory","file_permissions":"rwxr-xr-x"}}`,
+		`{"file_metadata":{"size":-5,"content_type":"text/plain","sha256":"00"},"api_context":{"schema":"users","record_id":"42","n":[1,2.5,{}]}}`,
+		`{"file_metadata":{},"metadata":{"size":1}}`,
+		`{"file_metadata":null}`,
+		`{}`,
+		`null`,
+		`[]`,
+		`"text"`,
+	}
+	listSeeds = []string{
+		`{"success":true,"entries":[{"name":"a.txt","file_type":"f","file_size":3,"file_permissions":"rw-r--r--","file_modified":"20240102030405","path":"/a.txt"}],"total":1}`,
+		`{"files":[{"name":"d","type":"d","size":0,"permissions":"rwxr-xr-x","modified_time":"2024-01-02T03:04:05Z","path":"/d","api_context":{"schema":"users"}}],"has_more":true}`,
+		`{"entries":[{"name":"","file_size":-1}]}`,
+		`{"entries":null,"files":[{"name":"x"}]}`,
+		`{"entries":[],"file_metadata":{"size":4},"metadata":{"size":5}}`,
+		`{"total":7}`,
+		`{"entries":{}}`,
+		`{}`,
+	}
+)
+
+func FuzzAPIWrapper(f *testing.F) {
+	for _, seed := range statSeeds {
+		f.Add(wrap(seed))
+	}
+	f.Add([]byte(`{"success":false}`))
+	f.Add([]byte(`{"success":true,"data":null}`))
+	f.Add([]byte(`{"data":`))
+	f.Add([]byte(``))
+	f.Add([]byte(`[{"success":true}]`))
+
+	f.Fuzz(func(t *testing.T, body []byte) {
+		var wrapper APIWrapper
+		if err := json.Unmarshal(body, &wrapper); err == nil && wrapper.Data != nil && !json.Valid(wrapper.Data) {
+			t.Fatalf("wrapper of %q holds invalid data %q", body, wrapper.Data)
+		}
+
+		// Whatever the body, reads return a response or an error
+		for _, strict := range []bool{false, true} {
+			c := responseClient(body, strict)
+			if stat, err := c.Stat(context.Background(), "/x", ""); err == nil && stat == nil {
+				t.Fatalf("stat of %q returned neither response nor error", body)
+			}
+			if list, err := c.List(context.Background(), "/", ListOptions{}, ""); err == nil && list == nil {
+				t.Fatalf("list of %q returned neither response nor error", body)
+			}
+			if resp, err := c.Retrieve(context.Background(), "/x", RetrieveOptions{}, ""); err == nil && resp == nil {
+				t.Fatalf("retrieve of %q returned neither response nor error", body)
+			}
+		}
+	})
+}
+
+func FuzzStatResponse(f *testing.F) {
+	for _, seed := range statSeeds {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var resp StatResponse
+		if err := json.Unmarshal(data, &resp); err == nil {
+			// Decoding what was decoded, under the current field names,
+			// gives the same response
+			encoded, err := json.Marshal(&resp)
+			if err != nil {
+				t.Fatalf("marshal %+v: %v", resp, err)
+			}
+			var again StatResponse
+			if err := json.Unmarshal(encoded, &again); err != nil {
+				t.Fatalf("decode %s: %v", encoded, err)
+			}
+			if len(resp.APIContext) == 0 {
+				resp.APIContext = nil
+			}
+			if !reflect.DeepEqual(resp, again) {
+				t.Fatalf("%s decoded as %+v, re-encoded as %s and decoded as %+v", data, resp, encoded, again)
+			}
+		}
+
+		for _, strict := range []bool{false, true} {
+			for _, pick := range []string{"", "file_metadata"} {
+				stat, err := responseClient(wrap(string(data)), strict).Stat(context.Background(), "/x", pick)
+				if err != nil {
+					continue
+				}
+				if stat.FileMetadata.Size < 0 {
+					t.Fatalf("stat of %s has negative size %d", data, stat.FileMetadata.Size)
+				}
+				if pick != "" && stat.FileMetadata == (FileMetadata{}) {
+					t.Fatalf("stat of %s picked %q without it", data, pick)
+				}
+			}
+		}
+	})
+}
+
+func FuzzListResponse(f *testing.F) {
+	for _, seed := range listSeeds {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var resp ListResponse
+		if err := json.Unmarshal(data, &resp); err == nil {
+			encoded, err := json.Marshal(&resp)
+			if err != nil {
+				t.Fatalf("marshal %+v: %v", resp, err)
+			}
+			var again ListResponse
+			if err := json.Unmarshal(encoded, &again); err != nil {
+				t.Fatalf("decode %s: %v", encoded, err)
+			}
+			// A missing listing is encoded as null, which decodes as empty
+			if resp.Entries == nil {
+				resp.Entries = []FileEntry{}
+			}
+			if !reflect.DeepEqual(resp, again) {
+				t.Fatalf("%s decoded as %+v, re-encoded as %s and decoded as %+v", data, resp, encoded, again)
+			}
+		}
+
+		for _, strict := range []bool{false, true} {
+			for _, pick := range []string{"", "entries"} {
+				list, err := responseClient(wrap(string(data)), strict).List(context.Background(), "/", ListOptions{}, pick)
+				if err != nil {
+					continue
+				}
+				if pick != "" && list.Entries == nil {
+					t.Fatalf("list of %s picked %q without it", data, pick)
+				}
+				for _, entry := range list.Entries {
+					if entry.Name == "" || entry.FileSize < 0 {
+						t.Fatalf("list of %s has entry %+v", data, entry)
+					}
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,135 @@
+package monkapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+)
+
+// ListSchemas retrieves the names of all schemas from the Describe API
+func (c *Client) ListSchemas(ctx context.Context) ([]string, error) {
+	respBody, err := c.get(ctx, "/api/describe")
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := unwrap(respBody)
+	if err != nil {
+		return nil, err
+	}
+
+	// Entries are either bare names or schema objects with a name field
+	var items []json.RawMessage
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, fmt.Errorf("unmarshal schema list: %w", err)
+	}
+
+	names := make([]string, 0, len(items))
+	for _, item := range items {
+		var name string
+		if err := json.Unmarshal(item, &name); err == nil {
+			names = append(names, name)
+			continue
+		}
+		var obj struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(item, &obj); err == nil && obj.Name != "" {
+			names = append(names, obj.Name)
+		}
+	}
+
+	return names, nil
+}
+
+// Describe retrieves a schema definition from the Describe API
+func (c *Client) Describe(ctx context.Context, schema string) (json.RawMessage, error) {
+	respBody, err := c.get(ctx, "/api/describe/"+url.PathEscape(schema))
+	if err != nil {
+		return nil, err
+	}
+
+	return unwrap(respBody)
+}
+
+// CreateSchema creates a new schema from its definition
+func (c *Client) CreateSchema(ctx context.Context, schema string, definition json.RawMessage) error {
+	_, err := c.send(ctx, http.MethodPost, "/api/describe/"+url.PathEscape(schema), definition)
+	return err
+}
+
+// UpdateSchema replaces an existing schema definition
+func (c *Client) UpdateSchema(ctx context.Context, schema string, definition json.RawMessage) error {
+	_, err := c.send(ctx, http.MethodPut, "/api/describe/"+url.PathEscape(schema), definition)
+	return err
+}
+
+// DeleteSchema removes a schema
+func (c *Client) DeleteSchema(ctx context.Context, schema string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, c.baseURL+"/api/describe/"+url.PathEscape(schema), nil)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+
+	_, err = c.do(req)
+	return err
+}
+
+// DescribeColumn retrieves a single column definition
+func (c *Client) DescribeColumn(ctx context.Context, schema, column string) (json.RawMessage, error) {
+	respBody, err := c.get(ctx, "/api/describe/"+url.PathEscape(schema)+"/"+url.PathEscape(column))
+	if err != nil {
+		return nil, err
+	}
+
+	return unwrap(respBody)
+}
+
+// UpdateColumn replaces a column definition
+func (c *Client) UpdateColumn(ctx context.Context, schema, column string, definition json.RawMessage) error {
+	_, err := c.send(ctx, http.MethodPut, "/api/describe/"+url.PathEscape(schema)+"/"+url.PathEscape(column), definition)
+	return err
+}
+
+// SchemaColumns extracts column names from a schema definition, accepting
+// both JSON Schema "properties" maps and "columns" arrays
+func SchemaColumns(definition json.RawMessage) []string {
+	var def struct {
+		Properties map[string]json.RawMessage `json:"properties"`
+		Columns    []struct {
+			ColumnName string `json:"column_name"`
+			Name       string `json:"name"`
+		} `json:"columns"`
+	}
+	if err := json.Unmarshal(definition, &def); err != nil {
+		return nil
+	}
+
+	names := []string{}
+	for name := range def.Properties {
+		names = append(names, name)
+	}
+	for _, col := range def.Columns {
+		if col.ColumnName != "" {
+			names = append(names, col.ColumnName)
+		} else if col.Name != "" {
+			names = append(names, col.Name)
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// unwrap extracts the data field from an API response envelope
+func unwrap(respBody []byte) (json.RawMessage, error) {
+	var wrapper APIWrapper
+	if err := json.Unmarshal(respBody, &wrapper); err != nil {
+		return nil, fmt.Errorf("unmarshal wrapper: %w", err)
+	}
+
+	return wrapper.Data, nil
+}
@@ -0,0 +1,160 @@
+package monkapi
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrUnavailable is returned without contacting the server while the API
+// is unreachable
+var ErrUnavailable = errors.New("API unavailable")
+
+// Backoff between probes of an unreachable API, and the time each probe
+// may take
+const (
+	probeMinInterval = time.Second
+	probeMaxInterval = 30 * time.Second
+	probeTimeout     = 5 * time.Second
+)
+
+// Health is a snapshot of whether the API is reachable
+type Health struct {
+	Up    bool
+	Since time.Time // When the current state began; zero if never down
+	Cause string    // Failure that took the API down
+}
+
+// health tracks reachability for a client with fail-fast enabled. A request
+// that cannot reach the server takes the API down: later requests fail at
+// once with ErrUnavailable instead of each waiting for the HTTP timeout,
+// while a background probe retries with exponential backoff. The first
+// probe the server answers brings it back up.
+type health struct {
+	mu    sync.Mutex
+	down  bool
+	since time.Time
+	cause string
+
+	// probeCtx ends probes when Close cancels it; no probes start once
+	// closed is set
+	probeCtx context.Context
+	cancel   context.CancelFunc
+	closed   bool
+}
+
+// SetFailFast enables the degraded mode described by Health: while the
+// API is unreachable, requests fail immediately with ErrUnavailable and
+// service resumes on its own once the server answers again
+func (c *Client) SetFailFast(enabled bool) {
+	c.failFast.Store(enabled)
+}
+
+// Health reports whether the API is currently considered reachable
+func (c *Client) Health() Health {
+	c.health.mu.Lock()
+	defer c.health.mu.Unlock()
+	return Health{Up: !c.health.down, Since: c.health.since, Cause: c.health.cause}
+}
+
+// available returns ErrUnavailable while the API is down
+func (c *Client) available() error {
+	if !c.failFast.Load() {
+		return nil
+	}
+
+	c.health.mu.Lock()
+	defer c.health.mu.Unlock()
+	if c.health.down {
+		return ErrUnavailable
+	}
+	return nil
+}
+
+// markDown records that the API could not be reached and starts probing
+// for its recovery
+func (c *Client) markDown(cause string) {
+	if !c.failFast.Load() {
+		return
+	}
+
+	c.health.mu.Lock()
+	defer c.health.mu.Unlock()
+	if c.health.down {
+		return
+	}
+	c.health.down = true
+	c.health.since = time.Now()
+	c.health.cause = cause
+	if c.health.closed {
+		return
+	}
+	if c.health.probeCtx == nil {
+		c.health.probeCtx, c.health.cancel = context.WithCancel(context.Background())
+	}
+	go c.probe(c.health.probeCtx)
+}
+
+// Close stops the background probing of an unreachable API. The client
+// should not be used afterwards: once down, it stays down.
+func (c *Client) Close() {
+	c.health.mu.Lock()
+	defer c.health.mu.Unlock()
+	c.health.closed = true
+	if c.health.cancel != nil {
+		c.health.cancel()
+	}
+}
+
+// probe polls the API with exponential backoff until it answers or ctx
+// is done
+func (c *Client) probe(ctx context.Context) {
+	interval := probeMinInterval
+	for {
+		// Jitter keeps many mounts of one server from probing in lockstep
+		timer := time.NewTimer(interval/2 + rand.N(interval/2))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if c.reachable(ctx) {
+			c.health.mu.Lock()
+			c.health.down = false
+			c.health.since = time.Now()
+			c.health.mu.Unlock()
+			return
+		}
+		interval = min(interval*2, probeMaxInterval)
+	}
+}
+
+// reachable reports whether the server answers a capabilities request with
+// anything but a gateway error. Authentication is irrelevant here, so the
+// request goes straight to the transport.
+func (c *Client) reachable(ctx context.Context) bool {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+"/api/file/capabilities", nil)
+	if err != nil {
+		return false
+	}
+	req.Header.Set("User-Agent", c.userAgent)
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return !gatewayError(resp.StatusCode)
+}
+
+// gatewayError reports whether status means the API behind a proxy or load
+// balancer is not serving
+func gatewayError(status int) bool {
+	return status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout
+}
@@ -0,0 +1,45 @@
+package monkapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// downTransport fails every request as if the server were unreachable
+type downTransport struct {
+	calls atomic.Int32
+}
+
+func (t *downTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.calls.Add(1)
+	return nil, errors.New("connection refused")
+}
+
+func TestCloseStopsProbe(t *testing.T) {
+	transport := &downTransport{}
+	c := NewClient("http://monk.invalid", "token")
+	c.SetTransport(transport)
+	c.SetFailFast(true)
+
+	if _, err := c.Stat(context.Background(), "/", ""); err == nil {
+		t.Fatal("stat succeeded against a down server")
+	}
+	if c.Health().Up {
+		t.Fatal("API still up after a failed request")
+	}
+	if _, err := c.Stat(context.Background(), "/", ""); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("stat while down = %v, want ErrUnavailable", err)
+	}
+
+	c.Close()
+	sent := transport.calls.Load()
+	// The first probe would be sent within probeMinInterval
+	time.Sleep(probeMinInterval + probeMinInterval/2)
+	if n := transport.calls.Load(); n != sent {
+		t.Errorf("%d probes sent after Close", n-sent)
+	}
+}
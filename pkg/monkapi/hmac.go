@@ -0,0 +1,67 @@
+package monkapi
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Headers of an HMAC-signed request
+const (
+	headerKeyID     = "X-Monk-Key-ID"
+	headerTimestamp = "X-Monk-Timestamp"
+	headerDigest    = "X-Monk-Content-SHA256"
+	headerSignature = "X-Monk-Signature"
+)
+
+// HMACSigner authenticates requests with a shared secret instead of a
+// bearer JWT, for service-to-service mounts where long-lived tokens are not
+// allowed. Each request carries the key ID, a Unix timestamp, the hex
+// SHA-256 of its body and the hex HMAC-SHA256 of
+//
+//	METHOD\nREQUEST-URI\nTIMESTAMP\nBODY-SHA256
+//
+// so the server can reject tampered and replayed requests.
+type HMACSigner struct {
+	KeyID  string
+	Secret []byte
+}
+
+// sign adds the signature headers to req, reading its body through GetBody
+// so the request can still be sent
+func (s *HMACSigner) sign(req *http.Request) error {
+	digest := sha256.New()
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return fmt.Errorf("sign request: %w", err)
+		}
+		_, err = io.Copy(digest, body)
+		body.Close()
+		if err != nil {
+			return fmt.Errorf("sign request: %w", err)
+		}
+	}
+	bodyDigest := hex.EncodeToString(digest.Sum(nil))
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	mac := hmac.New(sha256.New, s.Secret)
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s", req.Method, req.URL.RequestURI(), timestamp, bodyDigest)
+
+	req.Header.Set(headerKeyID, s.KeyID)
+	req.Header.Set(headerTimestamp, timestamp)
+	req.Header.Set(headerDigest, bodyDigest)
+	req.Header.Set(headerSignature, hex.EncodeToString(mac.Sum(nil)))
+	return nil
+}
+
+// SetSigner signs every request with s, in addition to any bearer token
+// the client's token source supplies
+func (c *Client) SetSigner(s *HMACSigner) {
+	c.signer = s
+}
@@ -0,0 +1,60 @@
+package monkapi
+
+import (
+	"context"
+	"time"
+)
+
+// suspendThreshold is how far the wall clock must have run ahead of the
+// monotonic clock between two requests for the machine to count as having
+// slept. The monotonic clock stops during suspend; the wall clock doesn't.
+const suspendThreshold = 5 * time.Second
+
+// dropIfResumed closes pooled connections before a request when the
+// machine has slept since the last one. Connections idle across a suspend
+// are usually dead (the server or a NAT on the way timed them out), and a
+// request sent on one waits out the full timeout instead of failing.
+func (c *Client) dropIfResumed() {
+	now := time.Now()
+	last := c.lastRequest.Swap(&now)
+	if last == nil {
+		return
+	}
+	wall := now.Round(0).Sub(last.Round(0))
+	if wall-now.Sub(*last) > suspendThreshold {
+		c.httpClient.CloseIdleConnections()
+	}
+}
+
+// CheckIdle pings the API every interval while no requests are made, until
+// ctx is done. A ping that fails drops the pooled connections, so the next
+// request dials afresh instead of timing out on a dead one; when a fresh
+// connection fails too, the API is marked down as for a failed request.
+func (c *Client) CheckIdle(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// Requests keep their connections checked, and while the API is
+		// down the health probe is already polling it
+		if last := c.lastRequest.Load(); last != nil && time.Since(*last) < interval {
+			continue
+		}
+		if !c.Health().Up {
+			continue
+		}
+
+		if c.reachable(ctx) {
+			continue
+		}
+		c.httpClient.CloseIdleConnections()
+		if !c.reachable(ctx) && ctx.Err() == nil {
+			c.markDown("idle check failed")
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package monkapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Lock takes or renews an advisory lock on a file. Locks are shared unless
+// opts.Exclusive is set and expire after opts.TTL seconds unless renewed by
+// passing the returned lock ID back in opts.LockID. A conflicting lock held
+// by someone else fails with an error for which IsLocked is true.
+func (c *Client) Lock(ctx context.Context, path string, opts LockOptions) (*LockResponse, error) {
+	req := map[string]interface{}{
+		"path":         path,
+		"file_options": opts,
+	}
+
+	respBody, err := c.post(ctx, "/api/file/lock", req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unwrap the API response
+	var wrapper APIWrapper
+	if err := json.Unmarshal(respBody, &wrapper); err != nil {
+		return nil, fmt.Errorf("unmarshal wrapper: %w", err)
+	}
+
+	var result LockResponse
+	if err := json.Unmarshal(wrapper.Data, &result); err != nil {
+		return nil, fmt.Errorf("unmarshal lock response: %w", err)
+	}
+
+	return &result, nil
+}
+
+// Unlock releases a lock taken with Lock
+func (c *Client) Unlock(ctx context.Context, path, lockID string) error {
+	req := map[string]interface{}{
+		"path":    path,
+		"lock_id": lockID,
+	}
+
+	_, err := c.post(ctx, "/api/file/unlock", req)
+	return err
+}
@@ -0,0 +1,77 @@
+package monkapi
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+)
+
+// FeaturePatch is advertised by servers whose patch endpoint rewrites byte
+// ranges of a file in place
+const FeaturePatch = "patch"
+
+// PatchRange is bytes to write at an offset of a file
+type PatchRange struct {
+	Offset int64
+	Data   []byte
+}
+
+// patchRange is a PatchRange as sent, base64-encoded since a range may
+// split a multibyte character
+type patchRange struct {
+	Offset  int64  `json:"offset"`
+	Content string `json:"content"`
+}
+
+// Patch writes ranges into the existing file at path and sets its length
+// to size, so a small edit to a large file doesn't re-upload all of it.
+// It fails with errors.ErrUnsupported when the server has no patch
+// endpoint; callers then Store the whole file.
+func (c *Client) Patch(ctx context.Context, path string, ranges []PatchRange, size int64, pick string) (*StoreResponse, error) {
+	if !c.supports(FeaturePatch) {
+		return nil, fmt.Errorf("patch %s: %w", path, errors.ErrUnsupported)
+	}
+
+	encoded := make([]patchRange, len(ranges))
+	for i, r := range ranges {
+		encoded[i] = patchRange{Offset: r.Offset, Content: base64.StdEncoding.EncodeToString(r.Data)}
+	}
+	req := map[string]interface{}{
+		"path":   path,
+		"ranges": encoded,
+		"file_options": map[string]interface{}{
+			"size":     size,
+			"encoding": "base64",
+		},
+	}
+
+	endpoint := "/api/file/patch"
+	if pick != "" {
+		endpoint += "?pick=" + url.QueryEscape(pick)
+	}
+
+	respBody, err := c.post(ctx, endpoint, req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unwrap the API response
+	var wrapper APIWrapper
+	if err := json.Unmarshal(respBody, &wrapper); err != nil {
+		return nil, fmt.Errorf("unmarshal wrapper: %w", err)
+	}
+
+	if err := c.checkFieldNames("patch", wrapper.Data); err != nil {
+		return nil, err
+	}
+
+	var result StoreResponse
+	if err := json.Unmarshal(wrapper.Data, &result); err != nil {
+		return nil, fmt.Errorf("unmarshal patch response: %w", err)
+	}
+
+	return &result, nil
+}
@@ -0,0 +1,40 @@
+package monkapi
+
+import (
+	"bufio"
+	"bytes"
+	"sync"
+)
+
+// maxPooledBuffer bounds the capacity of buffers returned to the pool so a
+// single huge response does not stay resident
+const maxPooledBuffer = 1 << 20
+
+// streamReaderSize is the read-ahead buffer used when decoding streams
+const streamReaderSize = 32 * 1024
+
+// bufferPool recycles buffers used to read responses. Request bodies are
+// not pooled, since the transport may read them after the response.
+var bufferPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// readerPool recycles buffered readers used by RetrieveStream
+var readerPool = sync.Pool{
+	New: func() interface{} { return bufio.NewReaderSize(nil, streamReaderSize) },
+}
+
+// getBuffer returns an empty buffer from the pool
+func getBuffer() *bytes.Buffer {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+// putBuffer returns a buffer to the pool
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBuffer {
+		return
+	}
+	bufferPool.Put(buf)
+}
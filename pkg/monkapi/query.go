@@ -0,0 +1,113 @@
+package monkapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// SetGETReads makes stat, list and retrieve requests use GET with query
+// parameters instead of POST, so HTTP caches and CDNs in front of the API
+// can serve them. A server answering 405 Method Not Allowed switches the
+// client back to POST.
+func (c *Client) SetGETReads(enabled bool) {
+	c.getReads.Store(enabled)
+}
+
+// read performs a read-only File API request, as GET when enabled
+func (c *Client) read(ctx context.Context, endpoint, path string, opts interface{}, pick string) ([]byte, error) {
+	if c.getReads.Load() {
+		query, err := readQuery(path, opts, pick)
+		if err != nil {
+			return nil, err
+		}
+		body, err := c.get(ctx, endpoint+"?"+query)
+		if !isMethodNotAllowed(err) {
+			return body, err
+		}
+		c.getReads.Store(false)
+	}
+
+	req := map[string]interface{}{"path": path}
+	if opts != nil {
+		req["file_options"] = opts
+	}
+	if pick != "" {
+		endpoint += "?pick=" + url.QueryEscape(pick)
+	}
+	return c.post(ctx, endpoint, req)
+}
+
+// readStream performs a read-only File API request like read, returning
+// the unread response body. The caller must close it.
+func (c *Client) readStream(ctx context.Context, endpoint, path string, opts interface{}) (io.ReadCloser, error) {
+	if c.getReads.Load() {
+		query, err := readQuery(path, opts, "")
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+endpoint+"?"+query, nil)
+		if err != nil {
+			return nil, fmt.Errorf("create request: %w", err)
+		}
+		body, err := c.doStream(req)
+		if !isMethodNotAllowed(err) {
+			return body, err
+		}
+		c.getReads.Store(false)
+	}
+
+	// The body is not pooled, as the response is still streaming when
+	// this returns
+	data, err := json.Marshal(map[string]interface{}{"path": path, "file_options": opts})
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+endpoint, bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	return c.doStream(httpReq)
+}
+
+// readQuery encodes a read request as query parameters: the path, each
+// set option under its JSON name, and the pick
+func readQuery(path string, opts interface{}, pick string) (string, error) {
+	q := url.Values{"path": {path}}
+	if pick != "" {
+		q.Set("pick", pick)
+	}
+	if opts == nil {
+		return q.Encode(), nil
+	}
+
+	data, err := json.Marshal(opts)
+	if err != nil {
+		return "", fmt.Errorf("marshal options: %w", err)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return "", fmt.Errorf("marshal options: %w", err)
+	}
+	for name, raw := range fields {
+		var s string
+		if json.Unmarshal(raw, &s) == nil {
+			q.Set(name, s)
+		} else {
+			q.Set(name, string(raw))
+		}
+	}
+	return q.Encode(), nil
+}
+
+// isMethodNotAllowed reports whether err is a 405 response
+func isMethodNotAllowed(err error) bool {
+	apiErr, ok := err.(*APIError)
+	return ok && apiErr.StatusCode == http.StatusMethodNotAllowed
+}
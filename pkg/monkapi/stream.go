@@ -0,0 +1,333 @@
+package monkapi
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// errContentMissing is returned when a retrieve response has no content
+var errContentMissing = errors.New("retrieve response has no content")
+
+// RetrieveStream retrieves file content as a stream, decoding the content
+// field of the response incrementally so memory use does not depend on the
+// size of the file. Non-string content (e.g. a whole record object) is
+// returned in its JSON representation. The caller must close the reader.
+func (c *Client) RetrieveStream(ctx context.Context, path string, opts RetrieveOptions) (io.ReadCloser, error) {
+	opts, start, maxBytes := c.unranged(opts)
+	body, err := c.readStream(ctx, "/api/file/retrieve", path, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	br := readerPool.Get().(*bufio.Reader)
+	br.Reset(body)
+
+	stream := &contentStream{body: body, br: br}
+	stream.Reader, err = openContent(br)
+	if err == nil {
+		stream.Reader, err = window(stream.Reader, start, maxBytes)
+	}
+	if err != nil {
+		stream.Close()
+		return nil, fmt.Errorf("decode retrieve response: %w", err)
+	}
+
+	return stream, nil
+}
+
+// contentStream is the reader returned by RetrieveStream. Closing it
+// closes the response body and recycles the buffered reader.
+type contentStream struct {
+	io.Reader
+	body io.ReadCloser
+	br   *bufio.Reader
+}
+
+func (s *contentStream) Close() error {
+	err := s.body.Close()
+	if s.br != nil {
+		s.br.Reset(nil)
+		readerPool.Put(s.br)
+		s.br = nil
+	}
+	return err
+}
+
+// openContent positions r at the content value of a retrieve response
+// ({"data": {"content": ...}} or {"data": ...}) and returns a reader of
+// the decoded content
+func openContent(r *bufio.Reader) (io.Reader, error) {
+	if err := findKey(r, "data"); err != nil {
+		return nil, err
+	}
+
+	b, err := peekNonSpace(r)
+	if err != nil {
+		return nil, err
+	}
+	if b == '{' {
+		if err := findKey(r, "content"); err != nil {
+			return nil, err
+		}
+		if b, err = peekNonSpace(r); err != nil {
+			return nil, err
+		}
+	}
+
+	if b == '"' {
+		r.ReadByte()
+		return &jsonStringReader{r: r}, nil
+	}
+
+	var raw json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, err
+	}
+	if string(raw) == "null" {
+		raw = nil
+	}
+	return bytes.NewReader(raw), nil
+}
+
+// findKey consumes an object up to and including the colon after key,
+// skipping the values of other keys
+func findKey(r *bufio.Reader, key string) error {
+	if err := expectByte(r, '{'); err != nil {
+		return err
+	}
+
+	for {
+		b, err := peekNonSpace(r)
+		if err != nil {
+			return err
+		}
+		switch b {
+		case '}':
+			return errContentMissing
+		case ',':
+			r.ReadByte()
+			continue
+		}
+
+		if err := expectByte(r, '"'); err != nil {
+			return err
+		}
+		name, err := io.ReadAll(&jsonStringReader{r: r})
+		if err != nil {
+			return err
+		}
+		if err := expectByte(r, ':'); err != nil {
+			return err
+		}
+		if string(name) == key {
+			return nil
+		}
+		if err := skipValue(r); err != nil {
+			return err
+		}
+	}
+}
+
+// skipValue consumes one JSON value without retaining it
+func skipValue(r *bufio.Reader) error {
+	b, err := peekNonSpace(r)
+	if err != nil {
+		return err
+	}
+
+	switch b {
+	case '"':
+		r.ReadByte()
+		_, err := io.Copy(io.Discard, &jsonStringReader{r: r})
+		return err
+
+	case '{', '[':
+		depth := 0
+		for {
+			c, err := r.ReadByte()
+			if err != nil {
+				return err
+			}
+			switch c {
+			case '{', '[':
+				depth++
+			case '}', ']':
+				depth--
+				if depth == 0 {
+					return nil
+				}
+			case '"':
+				if _, err := io.Copy(io.Discard, &jsonStringReader{r: r}); err != nil {
+					return err
+				}
+			}
+		}
+
+	default:
+		for {
+			c, err := r.ReadByte()
+			if err != nil {
+				return err
+			}
+			if c == ',' || c == '}' || c == ']' {
+				return r.UnreadByte()
+			}
+		}
+	}
+}
+
+// peekNonSpace skips whitespace and returns the next byte without
+// consuming it
+func peekNonSpace(r *bufio.Reader) (byte, error) {
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if b != ' ' && b != '\t' && b != '\n' && b != '\r' {
+			return b, r.UnreadByte()
+		}
+	}
+}
+
+// expectByte skips whitespace and consumes want
+func expectByte(r *bufio.Reader, want byte) error {
+	b, err := peekNonSpace(r)
+	if err != nil {
+		return err
+	}
+	if b != want {
+		return fmt.Errorf("expected %q, found %q", want, b)
+	}
+	_, err = r.ReadByte()
+	return err
+}
+
+// jsonStringReader decodes a JSON string literal incrementally. It starts
+// after the opening quote and returns io.EOF after the closing quote.
+type jsonStringReader struct {
+	r       *bufio.Reader
+	pending []byte  // decoded bytes of an escape not yet returned
+	escape  [4]byte // backing store for pending, so escapes do not allocate
+	done    bool
+}
+
+func (s *jsonStringReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(s.pending) > 0 {
+			c := copy(p[n:], s.pending)
+			s.pending = s.pending[c:]
+			n += c
+			continue
+		}
+		if s.done {
+			break
+		}
+
+		b, err := s.r.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				err = fmt.Errorf("unterminated string: %w", io.ErrUnexpectedEOF)
+			}
+			return n, err
+		}
+
+		switch b {
+		case '"':
+			s.done = true
+		case '\\':
+			if s.pending, err = s.readEscape(); err != nil {
+				return n, err
+			}
+		default:
+			p[n] = b
+			n++
+		}
+	}
+
+	if n == 0 && s.done {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+// readEscape decodes the escape sequence following a backslash
+func (s *jsonStringReader) readEscape() ([]byte, error) {
+	b, err := s.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	switch b {
+	case '"', '\\', '/':
+		return s.escapeByte(b), nil
+	case 'b':
+		return s.escapeByte('\b'), nil
+	case 'f':
+		return s.escapeByte('\f'), nil
+	case 'n':
+		return s.escapeByte('\n'), nil
+	case 'r':
+		return s.escapeByte('\r'), nil
+	case 't':
+		return s.escapeByte('\t'), nil
+	case 'u':
+		r, err := s.readHex()
+		if err != nil {
+			return nil, err
+		}
+		if utf16.IsSurrogate(r) {
+			// A high surrogate must be followed by \uXXXX holding the low half
+			if next, err := s.r.Peek(2); err == nil && next[0] == '\\' && next[1] == 'u' {
+				s.r.Discard(2)
+				low, err := s.readHex()
+				if err != nil {
+					return nil, err
+				}
+				r = utf16.DecodeRune(r, low)
+			} else {
+				r = utf8.RuneError
+			}
+		}
+		return utf8.AppendRune(s.escape[:0], r), nil
+	default:
+		return nil, fmt.Errorf("invalid escape \\%c", b)
+	}
+}
+
+func (s *jsonStringReader) escapeByte(b byte) []byte {
+	s.escape[0] = b
+	return s.escape[:1]
+}
+
+// readHex reads the four hex digits of a \u escape
+func (s *jsonStringReader) readHex() (rune, error) {
+	var digits [4]byte
+	if _, err := io.ReadFull(s.r, digits[:]); err != nil {
+		return 0, err
+	}
+
+	var v rune
+	for _, d := range digits {
+		switch {
+		case '0' <= d && d <= '9':
+			d -= '0'
+		case 'a' <= d && d <= 'f':
+			d -= 'a' - 10
+		case 'A' <= d && d <= 'F':
+			d -= 'A' - 10
+		default:
+			return 0, fmt.Errorf("invalid unicode escape %q", digits[:])
+		}
+		v = v<<4 | rune(d)
+	}
+	return v, nil
+}
@@ -0,0 +1,82 @@
+package monkapi
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestOpenContent(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"null", `null`, ``},
+		{"empty string", `""`, ``},
+		{"plain", `"hello"`, `hello`},
+		{"quoted content keeps its quotes", `"\"hello\""`, `"hello"`},
+		{"newline and tab", `"line1\nline2\tend"`, "line1\nline2\tend"},
+		{"backslash", `"C:\\temp\\x"`, `C:\temp\x`},
+		{"escaped slash", `"a\/b"`, `a/b`},
+		{"backspace and form feed", `"\b\f"`, "\b\f"},
+		{"nul", `"a\u0000b"`, "a\x00b"},
+		{"bmp escape", `"caf\u00e9"`, "café"},
+		{"raw utf-8", `"café ☕"`, "café ☕"},
+		{"surrogate pair", `"\ud83d\ude00"`, "😀"},
+		{"lone surrogate", `"\ud83d"`, "\uFFFD"},
+		{"trailing escaped backslash", `"end\\"`, `end\`},
+		{"nested object", `{"a": {"b": [1, 2, {"c": "d\n"}]}}`, `{"a": {"b": [1, 2, {"c": "d\n"}]}}`},
+		{"array", `[1,"two",null]`, `[1,"two",null]`},
+		{"number", `-1.5e3`, `-1.5e3`},
+		{"bool", `true`, `true`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, body := range []string{
+				`{"success":true,"data":{"content":` + tt.content + `}}`,
+				`{"success":true,"data":` + tt.content + `}`,
+			} {
+				if tt.content[0] == '{' && !strings.Contains(body, `"content"`) {
+					// An object as data is read as the response's fields
+					continue
+				}
+				r, err := openContent(bufio.NewReader(strings.NewReader(body)))
+				if err != nil {
+					t.Fatalf("openContent(%s): %v", body, err)
+				}
+				got, err := io.ReadAll(r)
+				if err != nil {
+					t.Fatalf("read %s: %v", body, err)
+				}
+				if string(got) != tt.want {
+					t.Errorf("openContent(%s) = %q, want %q", body, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestOpenContentSkipsOtherKeys(t *testing.T) {
+	body := `{"success":true,"meta":{"x":"}\"{"},"data":{"file_metadata":{"size":5},"content":"hello","encoding":"utf8"}}`
+	r, err := openContent(bufio.NewReader(strings.NewReader(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := io.ReadAll(r); string(got) != "hello" {
+		t.Errorf("content = %q", got)
+	}
+}
+
+func TestOpenContentMissing(t *testing.T) {
+	for _, body := range []string{
+		`{"success":true}`,
+		`{"success":true,"data":{"file_metadata":{}}}`,
+		`not json`,
+	} {
+		if _, err := openContent(bufio.NewReader(strings.NewReader(body))); err == nil {
+			t.Errorf("openContent(%s) succeeded, want an error", body)
+		}
+	}
+}
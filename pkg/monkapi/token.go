@@ -0,0 +1,17 @@
+package monkapi
+
+import "context"
+
+// TokenSource supplies the bearer token for each request, so long-running
+// embedders can refresh expiring JWTs without recreating the client
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// StaticToken is a TokenSource that always returns the same token
+type StaticToken string
+
+// Token returns the token
+func (t StaticToken) Token(ctx context.Context) (string, error) {
+	return string(t), nil
+}
@@ -21,11 +21,11 @@ type ListOptions struct {
 
 // ListResponse represents the File API list response
 type ListResponse struct {
-	Success      bool              `json:"success"`
-	Entries      []FileEntry       `json:"entries"`
-	Total        int               `json:"total"`
-	HasMore      bool              `json:"has_more"`
-	FileMetadata FileMetadata      `json:"file_metadata"`
+	Success      bool         `json:"success"`
+	Entries      []FileEntry  `json:"entries"`
+	Total        int          `json:"total"`
+	HasMore      bool         `json:"has_more"`
+	FileMetadata FileMetadata `json:"file_metadata"`
 }
 
 // FileEntry represents a single file/directory entry
@@ -47,30 +47,36 @@ type FileMetadata struct {
 	AccessTime   string `json:"access_time"`   // Format: ISO 8601 (RFC3339)
 	Type         string `json:"type"`
 	Permissions  string `json:"permissions"`
+	ContentType  string `json:"content_type,omitempty"` // MIME type, when the server knows it
+	SHA256       string `json:"sha256,omitempty"`       // Hex SHA-256 of the content, when provided
 }
 
 // StatResponse represents the File API stat response
 type StatResponse struct {
-	Success      bool         `json:"success"`
-	FileMetadata FileMetadata `json:"file_metadata"`
-	Type         string       `json:"type"`
+	Success      bool                   `json:"success"`
+	FileMetadata FileMetadata           `json:"file_metadata"`
+	Type         string                 `json:"type"`
+	APIContext   map[string]interface{} `json:"api_context,omitempty"`
 }
 
 // RetrieveOptions represents options for the File API retrieve operation
 type RetrieveOptions struct {
-	StartOffset int `json:"start_offset,omitempty"`
-	MaxBytes    int `json:"max_bytes,omitempty"`
+	StartOffset int    `json:"start_offset,omitempty"`
+	MaxBytes    int    `json:"max_bytes,omitempty"`
+	Encoding    string `json:"encoding,omitempty"` // "base64" requests binary-safe transport
 }
 
 // RetrieveResponse represents the File API retrieve response
 type RetrieveResponse struct {
-	Success bool        `json:"success"`
-	Content interface{} `json:"content"`
+	Success  bool            `json:"success"`
+	Content  json.RawMessage `json:"content"`            // Raw JSON value, decoded by the caller
+	Encoding string          `json:"encoding,omitempty"` // "base64" when content is encoded
 }
 
 // StoreOptions represents options for the File API store operation
 type StoreOptions struct {
-	CreateMissing bool `json:"create_missing,omitempty"`
+	CreateMissing bool   `json:"create_missing,omitempty"`
+	Encoding      string `json:"encoding,omitempty"` // "base64" when content is encoded
 }
 
 // StoreResponse represents the File API store response
@@ -79,9 +85,72 @@ type StoreResponse struct {
 	FileMetadata FileMetadata `json:"file_metadata"`
 }
 
+// DeleteOptions represents options for the File API delete operation
+type DeleteOptions struct {
+	Recursive bool `json:"recursive,omitempty"`
+}
+
+// DeleteResponse represents the File API delete response
+type DeleteResponse struct {
+	Success bool `json:"success"`
+}
+
+// CopyOptions represents options for the File API copy operation
+type CopyOptions struct {
+	Overwrite bool `json:"overwrite,omitempty"`
+}
+
+// CopyResponse represents the File API copy response
+type CopyResponse struct {
+	Success      bool         `json:"success"`
+	FileMetadata FileMetadata `json:"file_metadata"`
+}
+
+// MoveOptions represents options for the File API move operation
+type MoveOptions struct {
+	Overwrite bool `json:"overwrite,omitempty"`
+}
+
+// MoveResponse represents the File API move response
+type MoveResponse struct {
+	Success      bool         `json:"success"`
+	FileMetadata FileMetadata `json:"file_metadata"`
+}
+
+// UpdateOptions represents the metadata changes of a File API update
+// operation; empty fields are left unchanged
+type UpdateOptions struct {
+	Permissions  string `json:"permissions,omitempty"`   // Symbolic, e.g. "rwxr-xr-x"
+	AccessTime   string `json:"access_time,omitempty"`   // ISO 8601 (RFC3339)
+	ModifiedTime string `json:"modified_time,omitempty"` // ISO 8601 (RFC3339)
+	Owner        string `json:"owner,omitempty"`         // Transfers ownership to this user
+}
+
+// UpdateResponse represents the File API update response
+type UpdateResponse struct {
+	Success      bool         `json:"success"`
+	FileMetadata FileMetadata `json:"file_metadata"`
+}
+
+// LockOptions represents options for the File API lock operation
+type LockOptions struct {
+	Exclusive bool   `json:"exclusive,omitempty"`
+	TTL       int    `json:"ttl,omitempty"`     // Seconds until the lock expires unless renewed
+	Owner     string `json:"owner,omitempty"`   // Holder description, shown to conflicting callers
+	LockID    string `json:"lock_id,omitempty"` // Renews an existing lock instead of taking a new one
+}
+
+// LockResponse represents the File API lock response
+type LockResponse struct {
+	Success bool   `json:"success"`
+	LockID  string `json:"lock_id"`
+	Expires string `json:"expires"` // Format: ISO 8601 (RFC3339)
+}
+
 // ErrorResponse represents an API error response
 type ErrorResponse struct {
-	Success   bool   `json:"success"`
-	Error     string `json:"error"`
-	ErrorCode string `json:"error_code"`
+	Success   bool            `json:"success"`
+	Error     string          `json:"error"`
+	ErrorCode string          `json:"error_code"`
+	Data      json.RawMessage `json:"data,omitempty"` // Error details (e.g. validation failures)
 }
@@ -0,0 +1,57 @@
+package monkapi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+)
+
+// Version is the client version reported in the User-Agent. Release
+// builds set it with
+// -ldflags "-X github.com/ianzepp/monk-api-fuse/pkg/monkapi.Version=v1.2.3";
+// otherwise the module version from the build info is used.
+var Version = ""
+
+// userAgent identifies the client to server operators, e.g.
+// "monk-fuse/v1.2.3 (linux/amd64)"
+func userAgent() string {
+	version := Version
+	if version == "" {
+		version = "dev"
+		if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+			version = info.Main.Version
+		}
+	}
+	return fmt.Sprintf("monk-fuse/%s (%s/%s)", version, runtime.GOOS, runtime.GOARCH)
+}
+
+// SetHeaders adds headers to every request, e.g. for gateways that need
+// extra auth or routing headers. They may replace the User-Agent but not
+// the bearer token.
+func (c *Client) SetHeaders(h http.Header) {
+	c.headers = h.Clone()
+}
+
+// SetMountID sends id in the X-Client-Mount-ID header of every request, so
+// server operators can tell the traffic of individual mounts apart
+func (c *Client) SetMountID(id string) {
+	c.mountID = id
+}
+
+// requestIDKey carries a request ID in a context
+type requestIDKey struct{}
+
+// WithRequestID makes requests sent with the returned context carry id in
+// the X-Request-ID header, so a server's logs can be matched to the
+// operation that caused them
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// requestID returns the request ID attached to ctx, if any
+func requestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
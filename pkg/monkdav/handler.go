@@ -0,0 +1,431 @@
+// Package monkdav serves the Monk File API namespace over WebDAV, for
+// clients that cannot mount FUSE filesystems
+package monkdav
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ianzepp/monk-api-fuse/pkg/monkapi"
+)
+
+// Handler implements a WebDAV class 2 server backed by the File API. Reads
+// map to List, Stat and Retrieve; PUT, DELETE, COPY and MOVE map to Store,
+// Delete, Copy and Move. The API creates directories only for the files
+// stored in them, so MKCOL stores an empty marker file in the new
+// collection. LOCK and UNLOCK take exclusive write locks held by this
+// server; see lockTable.
+type Handler struct {
+	client   monkapi.API
+	readOnly bool
+	locks    *lockTable
+
+	// user and password are the Basic credentials required of every
+	// request; no password means none are
+	user, password string
+}
+
+// collectionMarker is the empty file MKCOL stores to create a collection
+const collectionMarker = ".keep"
+
+// NewHandler creates a WebDAV handler. With readOnly, every method that
+// would modify data is rejected.
+func NewHandler(client monkapi.API, readOnly bool) *Handler {
+	return &Handler{client: client, readOnly: readOnly, locks: newLockTable()}
+}
+
+// RequireAuth makes every request authenticate with HTTP Basic
+// credentials. The handler acts with the API client's credentials, so
+// anyone who can reach an unauthenticated handler has them.
+func (h *Handler) RequireAuth(user, password string) {
+	h.user, h.password = user, password
+}
+
+// authorized checks a request's Basic credentials, if any are required
+func (h *Handler) authorized(r *http.Request) bool {
+	if h.password == "" {
+		return true
+	}
+	user, password, ok := r.BasicAuth()
+	userOK := subtle.ConstantTimeCompare([]byte(user), []byte(h.user)) == 1
+	passwordOK := subtle.ConstantTimeCompare([]byte(password), []byte(h.password)) == 1
+	return ok && userOK && passwordOK
+}
+
+// ServeHTTP dispatches a WebDAV request
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !h.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="monk", charset="UTF-8"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	filePath := cleanPath(r.URL.Path)
+
+	var err error
+	switch r.Method {
+	case "OPTIONS":
+		h.options(w)
+	case "PROPFIND":
+		err = h.propfind(w, r, filePath)
+	case "GET", "HEAD":
+		err = h.get(w, r, filePath)
+	case "PUT", "DELETE", "MKCOL", "COPY", "MOVE", "LOCK", "UNLOCK":
+		if h.readOnly {
+			http.Error(w, "read-only", http.StatusForbidden)
+			return
+		}
+		switch r.Method {
+		case "PUT":
+			err = h.put(w, r, filePath)
+		case "DELETE":
+			err = h.delete(w, r, filePath)
+		case "MKCOL":
+			err = h.mkcol(w, r, filePath)
+		case "LOCK":
+			err = h.lock(w, r, filePath)
+		case "UNLOCK":
+			err = h.unlock(w, r, filePath)
+		default:
+			err = h.relocate(w, r, filePath)
+		}
+	default:
+		w.Header().Set("Allow", h.allow())
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+
+	if err != nil {
+		writeError(w, r, err)
+	}
+}
+
+// allow lists the supported methods
+func (h *Handler) allow() string {
+	if h.readOnly {
+		return "OPTIONS, PROPFIND, GET, HEAD"
+	}
+	return "OPTIONS, PROPFIND, GET, HEAD, PUT, DELETE, MKCOL, COPY, MOVE, LOCK, UNLOCK"
+}
+
+// options advertises WebDAV class 1 compliance, and class 2 when writable
+// since locks only guard writes
+func (h *Handler) options(w http.ResponseWriter) {
+	if h.readOnly {
+		w.Header().Set("DAV", "1")
+	} else {
+		w.Header().Set("DAV", "1, 2")
+	}
+	w.Header().Set("Allow", h.allow())
+	w.Header().Set("MS-Author-Via", "DAV")
+	w.WriteHeader(http.StatusOK)
+}
+
+// multistatus is the PROPFIND response body
+type multistatus struct {
+	XMLName   xml.Name   `xml:"D:multistatus"`
+	XMLNS     string     `xml:"xmlns:D,attr"`
+	Responses []response `xml:"D:response"`
+}
+
+type response struct {
+	Href     string   `xml:"D:href"`
+	Propstat propstat `xml:"D:propstat"`
+}
+
+type propstat struct {
+	Prop   prop   `xml:"D:prop"`
+	Status string `xml:"D:status"`
+}
+
+type prop struct {
+	DisplayName   string        `xml:"D:displayname"`
+	ResourceType  *resourceType `xml:"D:resourcetype"`
+	ContentLength *int64        `xml:"D:getcontentlength,omitempty"`
+	LastModified  string        `xml:"D:getlastmodified,omitempty"`
+	ContentType   string        `xml:"D:getcontenttype,omitempty"`
+	SupportedLock *lockEntry    `xml:"D:supportedlock>D:lockentry,omitempty"`
+}
+
+type resourceType struct {
+	Collection *struct{} `xml:"D:collection,omitempty"`
+}
+
+// propfind reports properties of a resource and, at depth 1, its members.
+// Depth infinity is served as depth 1 rather than walking the tree.
+func (h *Handler) propfind(w http.ResponseWriter, r *http.Request, filePath string) error {
+	stat, err := h.client.Stat(r.Context(), filePath, "")
+	if err != nil {
+		return err
+	}
+
+	ms := multistatus{XMLNS: "DAV:"}
+	ms.Responses = append(ms.Responses, statResponse(filePath, stat))
+
+	if isDir(stat) && r.Header.Get("Depth") != "0" {
+		list, err := h.client.List(r.Context(), filePath, monkapi.ListOptions{LongFormat: true}, "entries")
+		if err != nil {
+			return err
+		}
+		for _, entry := range list.Entries {
+			ms.Responses = append(ms.Responses, entryResponse(path.Join(filePath, entry.Name), entry))
+		}
+	}
+
+	w.Header().Set("Content-Type", `application/xml; charset="utf-8"`)
+	w.WriteHeader(http.StatusMultiStatus)
+	io.WriteString(w, xml.Header)
+	return xml.NewEncoder(w).Encode(ms)
+}
+
+// get streams file content
+func (h *Handler) get(w http.ResponseWriter, r *http.Request, filePath string) error {
+	stat, err := h.client.Stat(r.Context(), filePath, "")
+	if err != nil {
+		return err
+	}
+	if isDir(stat) {
+		http.Error(w, "is a collection", http.StatusMethodNotAllowed)
+		return nil
+	}
+
+	if stat.FileMetadata.ContentType != "" {
+		w.Header().Set("Content-Type", stat.FileMetadata.ContentType)
+	}
+	if modified := httpTime(stat.FileMetadata.ModifiedTime); modified != "" {
+		w.Header().Set("Last-Modified", modified)
+	}
+	if r.Method == "HEAD" {
+		w.Header().Set("Content-Length", fmt.Sprint(stat.FileMetadata.Size))
+		w.WriteHeader(http.StatusOK)
+		return nil
+	}
+
+	stream, err := h.client.RetrieveStream(r.Context(), filePath, monkapi.RetrieveOptions{})
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	// Headers are sent with the first byte, so a failure mid-stream can
+	// only be logged
+	if _, err := io.Copy(w, stream); err != nil {
+		log.Printf("webdav: GET %s: %v", filePath, err)
+	}
+	return nil
+}
+
+// put stores the request body, creating the file if needed
+func (h *Handler) put(w http.ResponseWriter, r *http.Request, filePath string) error {
+	if !h.locks.permits(r, false, filePath) {
+		http.Error(w, "locked", http.StatusLocked)
+		return nil
+	}
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+
+	var content interface{} = string(data)
+	opts := monkapi.StoreOptions{CreateMissing: true}
+	if !utf8.Valid(data) {
+		content, opts.Encoding = base64.StdEncoding.EncodeToString(data), "base64"
+	}
+
+	if _, err := h.client.Store(r.Context(), filePath, content, opts, ""); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// delete removes a file, or a collection and everything in it
+func (h *Handler) delete(w http.ResponseWriter, r *http.Request, filePath string) error {
+	if filePath == "/" {
+		http.Error(w, "cannot delete the root", http.StatusForbidden)
+		return nil
+	}
+	if !h.locks.permits(r, true, filePath) {
+		http.Error(w, "locked", http.StatusLocked)
+		return nil
+	}
+	stat, err := h.client.Stat(r.Context(), filePath, "")
+	if err != nil {
+		return err
+	}
+
+	opts := monkapi.DeleteOptions{Recursive: isDir(stat)}
+	if _, err := h.client.Delete(r.Context(), filePath, opts, ""); err != nil {
+		return err
+	}
+	h.locks.release(filePath)
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// mkcol creates a collection by storing an empty marker file in it
+func (h *Handler) mkcol(w http.ResponseWriter, r *http.Request, filePath string) error {
+	if r.ContentLength > 0 {
+		http.Error(w, "MKCOL bodies are not supported", http.StatusUnsupportedMediaType)
+		return nil
+	}
+	if !h.locks.permits(r, false, filePath) {
+		http.Error(w, "locked", http.StatusLocked)
+		return nil
+	}
+
+	_, err := h.client.Stat(r.Context(), filePath, "")
+	if err == nil {
+		http.Error(w, "already exists", http.StatusMethodNotAllowed)
+		return nil
+	}
+	if !monkapi.IsNotFound(err) {
+		return err
+	}
+	// Intermediate collections must exist already
+	parent, err := h.client.Stat(r.Context(), path.Dir(filePath), "")
+	if monkapi.IsNotFound(err) || (err == nil && !isDir(parent)) {
+		http.Error(w, "parent collection missing", http.StatusConflict)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	marker := path.Join(filePath, collectionMarker)
+	if _, err := h.client.Store(r.Context(), marker, "", monkapi.StoreOptions{CreateMissing: true}, ""); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusCreated)
+	return nil
+}
+
+// relocate implements COPY and MOVE with the server-side operations
+func (h *Handler) relocate(w http.ResponseWriter, r *http.Request, filePath string) error {
+	dest, err := url.Parse(r.Header.Get("Destination"))
+	if err != nil || dest.Path == "" {
+		http.Error(w, "bad destination", http.StatusBadRequest)
+		return nil
+	}
+	destination := cleanPath(dest.Path)
+	overwrite := r.Header.Get("Overwrite") != "F"
+
+	// A move changes its source as well as the destination
+	locked := []string{destination}
+	if r.Method == "MOVE" {
+		locked = append(locked, filePath)
+	}
+	if !h.locks.permits(r, true, locked...) {
+		http.Error(w, "locked", http.StatusLocked)
+		return nil
+	}
+
+	if r.Method == "COPY" {
+		_, err = h.client.Copy(r.Context(), filePath, destination, monkapi.CopyOptions{Overwrite: overwrite}, "")
+	} else {
+		_, err = h.client.Move(r.Context(), filePath, destination, monkapi.MoveOptions{Overwrite: overwrite}, "")
+	}
+	if err != nil {
+		return err
+	}
+	if r.Method == "MOVE" {
+		// Locks stay with the path they were taken on, which is gone
+		h.locks.release(filePath)
+	}
+	w.WriteHeader(http.StatusCreated)
+	return nil
+}
+
+// statResponse describes a stat result as a PROPFIND response
+func statResponse(filePath string, stat *monkapi.StatResponse) response {
+	p := prop{
+		DisplayName:  path.Base(filePath),
+		ResourceType: &resourceType{},
+		LastModified: httpTime(stat.FileMetadata.ModifiedTime),
+		ContentType:  stat.FileMetadata.ContentType,
+	}
+	if isDir(stat) {
+		p.ResourceType.Collection = &struct{}{}
+	} else {
+		size := stat.FileMetadata.Size
+		p.ContentLength = &size
+	}
+	return newResponse(filePath, isDir(stat), p)
+}
+
+// entryResponse describes a list entry as a PROPFIND response
+func entryResponse(filePath string, entry monkapi.FileEntry) response {
+	p := prop{
+		DisplayName:  entry.Name,
+		ResourceType: &resourceType{},
+		LastModified: httpTime(entry.FileModified),
+	}
+	dir := entry.FileType == "d"
+	if dir {
+		p.ResourceType.Collection = &struct{}{}
+	} else {
+		size := entry.FileSize
+		p.ContentLength = &size
+	}
+	return newResponse(filePath, dir, p)
+}
+
+func newResponse(filePath string, dir bool, p prop) response {
+	p.SupportedLock = &lockEntry{}
+	href := hrefPath(filePath)
+	if dir && !strings.HasSuffix(href, "/") {
+		href += "/"
+	}
+	return response{
+		Href:     href,
+		Propstat: propstat{Prop: p, Status: "HTTP/1.1 200 OK"},
+	}
+}
+
+// hrefPath escapes a path for an href
+func hrefPath(filePath string) string {
+	return (&url.URL{Path: filePath}).EscapedPath()
+}
+
+// writeError maps an API error onto an HTTP status
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	status := http.StatusBadGateway
+	var apiErr *monkapi.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case 400, 401, 403, 404, 409, 412, 422:
+			status = apiErr.StatusCode
+		}
+	}
+	if status == http.StatusBadGateway {
+		log.Printf("webdav: %s %s: %v", r.Method, r.URL.Path, err)
+	}
+	http.Error(w, http.StatusText(status), status)
+}
+
+func isDir(stat *monkapi.StatResponse) bool {
+	return stat.Type == "directory" || stat.FileMetadata.Type == "directory"
+}
+
+// cleanPath turns a request path into an API path
+func cleanPath(p string) string {
+	return path.Clean("/" + p)
+}
+
+// httpTime converts an API timestamp to the HTTP date format
+func httpTime(ts string) string {
+	t, err := time.Parse(time.RFC3339, ts)
+	if err != nil {
+		return ""
+	}
+	return t.UTC().Format(http.TimeFormat)
+}
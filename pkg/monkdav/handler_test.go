@@ -0,0 +1,155 @@
+package monkdav
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/ianzepp/monk-api-fuse/internal/mockserver"
+	"github.com/ianzepp/monk-api-fuse/pkg/monkapi"
+)
+
+// testHandler serves a Handler over the mock File API
+func testHandler(t *testing.T, s *mockserver.Server) (*Handler, *httptest.Server) {
+	t.Helper()
+	api := httptest.NewServer(s)
+	t.Cleanup(api.Close)
+	h := NewHandler(monkapi.NewClient(api.URL, "token"), false)
+	dav := httptest.NewServer(h)
+	t.Cleanup(dav.Close)
+	return h, dav
+}
+
+// do sends a request and returns its status
+func do(t *testing.T, method, url, body string, header map[string]string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func TestHandlerMkcolDelete(t *testing.T) {
+	s := mockserver.New()
+	s.Put("/docs/readme.md", []byte("hi"))
+	_, dav := testHandler(t, s)
+
+	if resp := do(t, "MKCOL", dav.URL+"/docs/new", "", nil); resp.StatusCode != http.StatusCreated {
+		t.Errorf("MKCOL = %d, want 201", resp.StatusCode)
+	}
+	if _, ok := s.Get("/docs/new/" + collectionMarker); !ok {
+		t.Error("MKCOL stored no marker")
+	}
+	if resp := do(t, "MKCOL", dav.URL+"/docs/new", "", nil); resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("MKCOL existing = %d, want 405", resp.StatusCode)
+	}
+	if resp := do(t, "MKCOL", dav.URL+"/missing/new", "", nil); resp.StatusCode != http.StatusConflict {
+		t.Errorf("MKCOL without parent = %d, want 409", resp.StatusCode)
+	}
+
+	if resp := do(t, "DELETE", dav.URL+"/docs/readme.md", "", nil); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("DELETE file = %d, want 204", resp.StatusCode)
+	}
+	if _, ok := s.Get("/docs/readme.md"); ok {
+		t.Error("DELETE left the file")
+	}
+	if resp := do(t, "DELETE", dav.URL+"/docs", "", nil); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("DELETE collection = %d, want 204", resp.StatusCode)
+	}
+	if _, ok := s.Get("/docs/new/" + collectionMarker); ok {
+		t.Error("DELETE left the collection's files")
+	}
+}
+
+var tokenHeader = regexp.MustCompile(`^<(opaquelocktoken:[0-9a-f]+)>$`)
+
+func TestHandlerLock(t *testing.T) {
+	s := mockserver.New()
+	s.Put("/docs/readme.md", []byte("hi"))
+	_, dav := testHandler(t, s)
+
+	const info = `<?xml version="1.0"?><D:lockinfo xmlns:D="DAV:">` +
+		`<D:lockscope><D:exclusive/></D:lockscope><D:locktype><D:write/></D:locktype>` +
+		`<D:owner><D:href>me</D:href></D:owner></D:lockinfo>`
+	resp := do(t, "LOCK", dav.URL+"/docs", info, map[string]string{"Timeout": "Second-60"})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("LOCK = %d, want 200", resp.StatusCode)
+	}
+	m := tokenHeader.FindStringSubmatch(resp.Header.Get("Lock-Token"))
+	if m == nil {
+		t.Fatalf("Lock-Token = %q", resp.Header.Get("Lock-Token"))
+	}
+	held := map[string]string{"If": "(<" + m[1] + ">)"}
+
+	if resp := do(t, "LOCK", dav.URL+"/docs/readme.md", info, nil); resp.StatusCode != http.StatusLocked {
+		t.Errorf("LOCK inside a depth infinity lock = %d, want 423", resp.StatusCode)
+	}
+	if resp := do(t, "PUT", dav.URL+"/docs/readme.md", "new", nil); resp.StatusCode != http.StatusLocked {
+		t.Errorf("PUT without the token = %d, want 423", resp.StatusCode)
+	}
+	if resp := do(t, "DELETE", dav.URL+"/", "", nil); resp.StatusCode == http.StatusNoContent {
+		t.Error("DELETE of the root succeeded")
+	}
+	if resp := do(t, "PUT", dav.URL+"/docs/readme.md", "new", held); resp.StatusCode/100 != 2 {
+		t.Errorf("PUT with the token = %d", resp.StatusCode)
+	}
+	if data, _ := s.Get("/docs/readme.md"); string(data) != "new" {
+		t.Errorf("content = %q, want new", data)
+	}
+	if resp := do(t, "LOCK", dav.URL+"/docs", "", held); resp.StatusCode != http.StatusOK {
+		t.Errorf("refresh = %d, want 200", resp.StatusCode)
+	}
+
+	unlock := map[string]string{"Lock-Token": "<" + m[1] + ">"}
+	if resp := do(t, "UNLOCK", dav.URL+"/docs", "", unlock); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("UNLOCK = %d, want 204", resp.StatusCode)
+	}
+	if resp := do(t, "PUT", dav.URL+"/docs/readme.md", "again", nil); resp.StatusCode/100 != 2 {
+		t.Errorf("PUT after UNLOCK = %d", resp.StatusCode)
+	}
+
+	// Locking a missing path creates an empty file
+	if resp := do(t, "LOCK", dav.URL+"/docs/new.txt", info, nil); resp.StatusCode != http.StatusCreated {
+		t.Errorf("LOCK missing = %d, want 201", resp.StatusCode)
+	}
+	if data, ok := s.Get("/docs/new.txt"); !ok || len(data) != 0 {
+		t.Errorf("LOCK missing stored %q, %v", data, ok)
+	}
+}
+
+func TestHandlerAuth(t *testing.T) {
+	s := mockserver.New()
+	s.Put("/readme.md", []byte("hi"))
+	h, dav := testHandler(t, s)
+	h.RequireAuth("monk", "secret")
+
+	if resp := do(t, "GET", dav.URL+"/readme.md", "", nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("GET without credentials = %d, want 401", resp.StatusCode)
+	}
+	for _, c := range []struct {
+		password string
+		want     int
+	}{{"wrong", http.StatusUnauthorized}, {"secret", http.StatusOK}} {
+		req, _ := http.NewRequest("GET", dav.URL+"/readme.md", nil)
+		req.SetBasicAuth("monk", c.password)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != c.want {
+			t.Errorf("GET with password %q = %d, want %d", c.password, resp.StatusCode, c.want)
+		}
+	}
+}
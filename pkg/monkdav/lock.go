@@ -0,0 +1,323 @@
+package monkdav
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ianzepp/monk-api-fuse/pkg/monkapi"
+)
+
+// maxLockTimeout caps how long a lock is held without being refreshed;
+// clients asking for longer or infinite timeouts get this
+const maxLockTimeout = time.Hour
+
+// davLock is an exclusive write lock on a resource and, at depth
+// infinity, everything below it
+type davLock struct {
+	token    string
+	root     string
+	infinite bool
+	owner    owner
+	timeout  time.Duration
+	expires  time.Time
+}
+
+// lockTable holds the locks taken through this server. They are kept in
+// memory and are not File API locks: they stop clients of this server
+// from overwriting each other, and let clients that only write to servers
+// they can lock, like macOS Finder, mount it read-write.
+type lockTable struct {
+	mu    sync.Mutex
+	locks map[string]*davLock // by token
+}
+
+func newLockTable() *lockTable {
+	return &lockTable{locks: make(map[string]*davLock)}
+}
+
+// covers reports whether the lock applies to p
+func (l *davLock) covers(p string) bool {
+	return l.root == p || (l.infinite && below(p, l.root))
+}
+
+// below reports whether p is inside the collection dir
+func below(p, dir string) bool {
+	if dir == "/" {
+		return p != "/"
+	}
+	return strings.HasPrefix(p, dir+"/")
+}
+
+// conflicting returns the locks that keep a request not holding their
+// tokens from changing p; with tree, locks inside p count too, as for a
+// DELETE or MOVE of a collection. l.mu must be held.
+func (t *lockTable) conflicting(p string, tree bool) []*davLock {
+	now := time.Now()
+	var found []*davLock
+	for token, l := range t.locks {
+		if now.After(l.expires) {
+			delete(t.locks, token)
+			continue
+		}
+		if l.covers(p) || (tree && below(l.root, p)) {
+			found = append(found, l)
+		}
+	}
+	return found
+}
+
+// tokenPattern finds the lock tokens in an If header. Its tagged and
+// untagged lists are not evaluated: a request holding a lock's token
+// anywhere in it may change what the lock covers.
+var tokenPattern = regexp.MustCompile(`<(opaquelocktoken:[^>]+)>`)
+
+// submitted returns the lock tokens a request holds
+func submitted(r *http.Request) map[string]bool {
+	tokens := make(map[string]bool)
+	for _, m := range tokenPattern.FindAllStringSubmatch(r.Header.Get("If"), -1) {
+		tokens[m[1]] = true
+	}
+	return tokens
+}
+
+// permits reports whether r holds the tokens of every lock on the paths it
+// changes; with tree, locks inside them count too
+func (t *lockTable) permits(r *http.Request, tree bool, paths ...string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tokens := submitted(r)
+	for _, p := range paths {
+		for _, l := range t.conflicting(p, tree) {
+			if !tokens[l.token] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// release drops the locks on p and inside it, after it was deleted or
+// moved away
+func (t *lockTable) release(p string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for token, l := range t.locks {
+		if l.root == p || below(l.root, p) {
+			delete(t.locks, token)
+		}
+	}
+}
+
+// lockInfo is the LOCK request body
+type lockInfo struct {
+	XMLName   xml.Name `xml:"DAV: lockinfo"`
+	LockScope struct {
+		Exclusive *struct{} `xml:"DAV: exclusive"`
+		Shared    *struct{} `xml:"DAV: shared"`
+	} `xml:"DAV: lockscope"`
+	Owner owner `xml:"DAV: owner"`
+}
+
+// owner identifies who holds a lock: an href or plain text. Other markup
+// in the owner element is dropped.
+type owner struct {
+	Href string `xml:"DAV: href"`
+	Text string `xml:",chardata"`
+}
+
+// lockTimeout reads the Timeout header, capped at maxLockTimeout
+func lockTimeout(r *http.Request) time.Duration {
+	for _, v := range strings.Split(r.Header.Get("Timeout"), ",") {
+		if s, ok := strings.CutPrefix(strings.TrimSpace(v), "Second-"); ok {
+			if secs, err := strconv.Atoi(s); err == nil && secs > 0 {
+				return min(time.Duration(secs)*time.Second, maxLockTimeout)
+			}
+		}
+	}
+	return maxLockTimeout
+}
+
+// newToken returns a lock token no other lock has
+func newToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return "opaquelocktoken:" + hex.EncodeToString(b)
+}
+
+// lock takes an exclusive write lock, or refreshes one when the request
+// has no body. Locking a path with nothing at it creates an empty file, as
+// clients expect before they PUT a new one.
+func (h *Handler) lock(w http.ResponseWriter, r *http.Request, filePath string) error {
+	body, err := io.ReadAll(io.LimitReader(r.Body, 64<<10))
+	if err != nil {
+		return err
+	}
+	if len(strings.TrimSpace(string(body))) == 0 {
+		return h.refreshLock(w, r, filePath)
+	}
+
+	var info lockInfo
+	if err := xml.Unmarshal(body, &info); err != nil {
+		http.Error(w, "bad lockinfo", http.StatusBadRequest)
+		return nil
+	}
+	if info.LockScope.Exclusive == nil {
+		http.Error(w, "only exclusive locks are supported", http.StatusNotImplemented)
+		return nil
+	}
+	infinite := r.Header.Get("Depth") != "0"
+
+	created := false
+	if _, err := h.client.Stat(r.Context(), filePath, ""); monkapi.IsNotFound(err) {
+		if !h.locks.permits(r, false, filePath) {
+			http.Error(w, "locked", http.StatusLocked)
+			return nil
+		}
+		if _, err := h.client.Store(r.Context(), filePath, "", monkapi.StoreOptions{CreateMissing: true}, ""); err != nil {
+			return err
+		}
+		created = true
+	} else if err != nil {
+		return err
+	}
+
+	h.locks.mu.Lock()
+	// Any lock on the path, above it, or at depth infinity below it
+	// conflicts with an exclusive one
+	if len(h.locks.conflicting(filePath, infinite)) > 0 {
+		h.locks.mu.Unlock()
+		http.Error(w, "locked", http.StatusLocked)
+		return nil
+	}
+	l := &davLock{
+		token:    newToken(),
+		root:     filePath,
+		infinite: infinite,
+		owner:    owner{Href: info.Owner.Href, Text: strings.TrimSpace(info.Owner.Text)},
+		timeout:  lockTimeout(r),
+	}
+	l.expires = time.Now().Add(l.timeout)
+	h.locks.locks[l.token] = l
+	h.locks.mu.Unlock()
+
+	w.Header().Set("Lock-Token", "<"+l.token+">")
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	return writeLockDiscovery(w, status, l)
+}
+
+// refreshLock extends the lock whose token the request holds
+func (h *Handler) refreshLock(w http.ResponseWriter, r *http.Request, filePath string) error {
+	tokens := submitted(r)
+
+	h.locks.mu.Lock()
+	var refreshed *davLock
+	for _, l := range h.locks.conflicting(filePath, false) {
+		if tokens[l.token] {
+			l.timeout = lockTimeout(r)
+			l.expires = time.Now().Add(l.timeout)
+			copied := *l
+			refreshed = &copied
+			break
+		}
+	}
+	h.locks.mu.Unlock()
+
+	if refreshed == nil {
+		http.Error(w, "no matching lock", http.StatusPreconditionFailed)
+		return nil
+	}
+	return writeLockDiscovery(w, http.StatusOK, refreshed)
+}
+
+// unlock releases the lock named by the Lock-Token header
+func (h *Handler) unlock(w http.ResponseWriter, r *http.Request, filePath string) error {
+	token := strings.Trim(strings.TrimSpace(r.Header.Get("Lock-Token")), "<>")
+
+	h.locks.mu.Lock()
+	l, ok := h.locks.locks[token]
+	if ok && l.covers(filePath) {
+		delete(h.locks.locks, token)
+	}
+	h.locks.mu.Unlock()
+
+	if !ok || !l.covers(filePath) {
+		http.Error(w, "no such lock", http.StatusConflict)
+		return nil
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// activeLock describes a lock in a lockdiscovery property
+type activeLock struct {
+	LockType  lockType   `xml:"D:locktype"`
+	LockScope lockScope  `xml:"D:lockscope"`
+	Depth     string     `xml:"D:depth"`
+	Owner     *ownerXML  `xml:"D:owner,omitempty"`
+	Timeout   string     `xml:"D:timeout"`
+	LockToken hrefHolder `xml:"D:locktoken"`
+	LockRoot  hrefHolder `xml:"D:lockroot"`
+}
+
+type lockType struct {
+	Write struct{} `xml:"D:write"`
+}
+
+type lockScope struct {
+	Exclusive struct{} `xml:"D:exclusive"`
+}
+
+type ownerXML struct {
+	Href string `xml:"D:href,omitempty"`
+	Text string `xml:",chardata"`
+}
+
+type hrefHolder struct {
+	Href string `xml:"D:href"`
+}
+
+// lockEntry describes the one kind of lock supported, for the
+// supportedlock property
+type lockEntry struct {
+	LockScope lockScope `xml:"D:lockscope"`
+	LockType  lockType  `xml:"D:locktype"`
+}
+
+// writeLockDiscovery answers a LOCK with the lock taken or refreshed
+func writeLockDiscovery(w http.ResponseWriter, status int, l *davLock) error {
+	active := activeLock{
+		Depth:     "0",
+		Timeout:   "Second-" + strconv.Itoa(int(l.timeout/time.Second)),
+		LockToken: hrefHolder{Href: l.token},
+		LockRoot:  hrefHolder{Href: hrefPath(l.root)},
+	}
+	if l.infinite {
+		active.Depth = "infinity"
+	}
+	if l.owner != (owner{}) {
+		active.Owner = &ownerXML{Href: l.owner.Href, Text: l.owner.Text}
+	}
+
+	body := struct {
+		XMLName xml.Name   `xml:"D:prop"`
+		XMLNS   string     `xml:"xmlns:D,attr"`
+		Active  activeLock `xml:"D:lockdiscovery>D:activelock"`
+	}{XMLNS: "DAV:", Active: active}
+
+	w.Header().Set("Content-Type", `application/xml; charset="utf-8"`)
+	w.WriteHeader(status)
+	io.WriteString(w, xml.Header)
+	return xml.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,218 @@
+package monkfs
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"slices"
+	"strings"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/ianzepp/monk-api-fuse/pkg/monkapi"
+)
+
+var _ = (fs.NodeSetxattrer)((*MonkFS)(nil))
+
+// Extended attributes exposing a record's access lists
+const (
+	xattrACL      = "user.monk.acl"
+	xattrPosixACL = "system.posix_acl_access"
+)
+
+// POSIX ACL xattr encoding, as in linux/posix_acl_xattr.h
+const (
+	posixACLVersion  = 2
+	posixACLUserObj  = 0x01
+	posixACLUser     = 0x02
+	posixACLGroupObj = 0x04
+	posixACLMask     = 0x10
+	posixACLOther    = 0x20
+	posixACLNoID     = 0xffffffff
+)
+
+// recordACL is the access lists of a record, from its api_context
+type recordACL monkapi.ACL
+
+// parseRecordACL reads the access lists in apiContext, returning nil when
+// there are none
+func parseRecordACL(apiContext map[string]interface{}) *recordACL {
+	var acl recordACL
+	found := false
+	for key, list := range map[string]*[]string{
+		"access_read": &acl.Read,
+		"access_edit": &acl.Edit,
+		"access_full": &acl.Full,
+		"access_deny": &acl.Deny,
+	} {
+		values, ok := apiContext[key].([]interface{})
+		if !ok {
+			continue
+		}
+		found = true
+		for _, v := range values {
+			if id, ok := v.(string); ok && id != "" {
+				*list = append(*list, id)
+			}
+		}
+	}
+	if !found {
+		return nil
+	}
+	return &acl
+}
+
+// perm returns the permission bits the access lists grant id
+func (a *recordACL) perm(id string) uint16 {
+	switch {
+	case slices.Contains(a.Deny, id):
+		return 0
+	case slices.Contains(a.Edit, id) || slices.Contains(a.Full, id):
+		return 06
+	case slices.Contains(a.Read, id):
+		return 04
+	}
+	return 0
+}
+
+// ids returns every user or role named in the access lists
+func (a *recordACL) ids() []string {
+	ids := slices.Concat(a.Read, a.Edit, a.Full, a.Deny)
+	slices.Sort(ids)
+	return slices.Compact(ids)
+}
+
+// recordACL fetches the access lists of the node's record
+func (n *MonkFS) recordACL(ctx context.Context) (*recordACL, syscall.Errno) {
+	path := n.getPath()
+	stat, err := n.apiClient.Stat(ctx, path, "api_context")
+	if err != nil {
+		return nil, n.apiErrno(path, err)
+	}
+	return parseRecordACL(stat.APIContext), 0
+}
+
+// getACLXattr reads the record's access lists as JSON
+func (n *MonkFS) getACLXattr(ctx context.Context, dest []byte) (uint32, syscall.Errno) {
+	acl, errno := n.recordACL(ctx)
+	if errno != 0 {
+		return 0, errno
+	}
+	if acl == nil {
+		return 0, syscall.Errno(fuse.ENOATTR)
+	}
+
+	value, err := json.Marshal(acl)
+	if err != nil {
+		return 0, syscall.EIO
+	}
+	return copyXattr(dest, value)
+}
+
+// getPosixACLXattr renders the record's access lists as a POSIX access
+// ACL, so getfacl can audit them. Only users with a uid in the owner map
+// can be named; the rest are still visible in user.monk.acl.
+func (n *MonkFS) getPosixACLXattr(ctx context.Context, dest []byte) (uint32, syscall.Errno) {
+	acl, errno := n.recordACL(ctx)
+	if errno != 0 {
+		return 0, errno
+	}
+	if acl == nil || n.opts.Owners == nil {
+		return 0, syscall.Errno(fuse.ENOATTR)
+	}
+
+	var out fuse.AttrOut
+	if errno := n.Getattr(ctx, nil, &out); errno != 0 {
+		return 0, errno
+	}
+	mode := out.Attr.Mode
+
+	type entry struct {
+		tag  uint16
+		perm uint16
+		id   uint32
+	}
+	var users []entry
+	for _, id := range acl.ids() {
+		if uid, ok := n.opts.Owners.Users[id]; ok {
+			users = append(users, entry{posixACLUser, acl.perm(id), uid})
+		}
+	}
+	if len(users) == 0 {
+		return 0, syscall.Errno(fuse.ENOATTR)
+	}
+	slices.SortFunc(users, func(a, b entry) int { return cmp.Compare(a.id, b.id) })
+
+	// The mask is the union of the named entries and the owning group, as
+	// setfacl computes it
+	mask := uint16(mode>>3) & 07
+	for _, e := range users {
+		mask |= e.perm
+	}
+
+	entries := []entry{{posixACLUserObj, uint16(mode>>6) & 07, posixACLNoID}}
+	entries = append(entries, users...)
+	entries = append(entries,
+		entry{posixACLGroupObj, uint16(mode>>3) & 07, posixACLNoID},
+		entry{posixACLMask, mask, posixACLNoID},
+		entry{posixACLOther, uint16(mode) & 07, posixACLNoID},
+	)
+
+	value := binary.LittleEndian.AppendUint32(nil, posixACLVersion)
+	for _, e := range entries {
+		value = binary.LittleEndian.AppendUint16(value, e.tag)
+		value = binary.LittleEndian.AppendUint16(value, e.perm)
+		value = binary.LittleEndian.AppendUint32(value, e.id)
+	}
+	return copyXattr(dest, value)
+}
+
+// Setxattr implements writing record fields through user.monk.field.*
+// and access lists through user.monk.acl
+func (n *MonkFS) Setxattr(ctx context.Context, attr string, data []byte, flags uint32) syscall.Errno {
+	ctx, cancel := n.withDeadline(ctx, opWrite)
+	defer cancel()
+
+	if field, ok := strings.CutPrefix(attr, xattrFieldPrefix); ok {
+		return n.setFieldXattr(ctx, field, data)
+	}
+	if attr != xattrACL {
+		return syscall.ENOTSUP
+	}
+	return n.setACL(ctx, data)
+}
+
+// setACL replaces the record's access lists through the ACLs API with a
+// JSON value in the form getfattr shows, e.g.
+// {"access_read":["bob"],"access_edit":["editors"]}. Lists left out are
+// cleared.
+func (n *MonkFS) setACL(ctx context.Context, data []byte) syscall.Errno {
+
+	var acl monkapi.ACL
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&acl); err != nil {
+		return syscall.EINVAL
+	}
+
+	path := n.getPath()
+	stat, err := n.apiClient.Stat(ctx, path, "api_context")
+	if err != nil {
+		return n.apiErrno(path, err)
+	}
+
+	// Only records have access lists
+	schema, id := recordIdentity(stat.APIContext)
+	if schema == "" || id == "" {
+		return syscall.ENOTSUP
+	}
+
+	if err := n.apiClient.SetACL(ctx, schema, id, acl); err != nil {
+		return n.apiErrno(path, err)
+	}
+	n.invalidate(path)
+	return 0
+}
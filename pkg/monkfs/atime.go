@@ -0,0 +1,102 @@
+package monkfs
+
+import (
+	"context"
+	"fmt"
+	"syscall"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/ianzepp/monk-api-fuse/pkg/monkapi"
+)
+
+// AtimePolicy controls how access times are tracked
+type AtimePolicy string
+
+const (
+	// AtimeOff neither fetches nor writes access times; atime shows the
+	// modification time, as after mounting with noatime
+	AtimeOff AtimePolicy = "off"
+	// AtimeRelatime writes the access time back on open when it is older
+	// than the modification time or a day old, as Linux relatime does
+	AtimeRelatime AtimePolicy = "relatime"
+	// AtimeStrict writes the access time back on every open
+	AtimeStrict AtimePolicy = "strict"
+)
+
+// relatimeInterval is how stale an access time may get under relatime
+const relatimeInterval = 24 * time.Hour
+
+// fillAtime sets the access time of attr according to the policy
+func (o *Options) fillAtime(attr *fuse.Attr, stat *monkapi.StatResponse) {
+	if o.Atime == AtimeOff {
+		attr.Atime = attr.Mtime
+		return
+	}
+	attr.Atime = parseMonkTimestamp(stat.FileMetadata.AccessTime)
+}
+
+// touchAtime records an open of the file at path, if the policy writes
+// access times back. It runs in the background so opens do not wait for
+// the API; failures are only logged.
+func (n *MonkFS) touchAtime(path string, stat *monkapi.StatResponse) {
+	now := time.Now()
+	switch n.opts.Atime {
+	case AtimeStrict:
+	case AtimeRelatime:
+		atime := parseMonkTimestamp(stat.FileMetadata.AccessTime)
+		mtime := parseMonkTimestamp(stat.FileMetadata.ModifiedTime)
+		if atime > mtime && now.Sub(time.Unix(int64(atime), 0)) < relatimeInterval {
+			return
+		}
+	default:
+		return
+	}
+
+	go func() {
+		opts := monkapi.UpdateOptions{AccessTime: now.UTC().Format(time.RFC3339)}
+		if _, err := n.apiClient.Update(context.Background(), path, opts, ""); err != nil {
+			n.errLog.Record(path, fmt.Errorf("update access time: %w", err))
+			return
+		}
+		n.invalidate(path)
+	}()
+}
+
+// utimens stores times set with utimensat, as touch -d, make, rsync -t
+// and tar do. Pending writes are stored first, or they would move the
+// modification time again when the file is closed. Servers that refuse
+// to change the times fail with EPERM.
+func (n *MonkFS) utimens(ctx context.Context, atime, mtime time.Time) syscall.Errno {
+	if n.pattern {
+		return syscall.EROFS
+	}
+
+	for _, fh := range n.openFiles.list(n.StableAttr().Ino) {
+		if errno := fh.sync(ctx); errno != 0 {
+			return errno
+		}
+	}
+
+	var opts monkapi.UpdateOptions
+	if !mtime.IsZero() {
+		opts.ModifiedTime = mtime.UTC().Format(time.RFC3339)
+	}
+	if !atime.IsZero() && n.opts.Atime != AtimeOff {
+		opts.AccessTime = atime.UTC().Format(time.RFC3339)
+	}
+	if opts == (monkapi.UpdateOptions{}) {
+		return 0
+	}
+
+	path := n.getPath()
+	if _, err := n.apiClient.Update(ctx, path, opts, ""); err != nil {
+		if monkapi.IsValidation(err) {
+			n.errLog.Record(path, err)
+			return syscall.EPERM
+		}
+		return n.apiErrno(path, err)
+	}
+	n.invalidate(path)
+	return 0
+}
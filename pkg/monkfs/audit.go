@@ -0,0 +1,319 @@
+package monkfs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/ianzepp/monk-api-fuse/pkg/monkapi"
+)
+
+// AuditLog appends a JSON line for every change made through the mount:
+// stores, patches, deletes, moves, copies, attribute updates, and the
+// record, schema and ACL changes of the Data and Describe APIs. Each
+// record names the calling process from the FUSE request and carries the
+// request ID sent to the server in X-Request-ID, so the two logs can be
+// joined.
+type AuditLog struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// AuditRecord is one line of the audit log
+type AuditRecord struct {
+	Time        time.Time `json:"time"`
+	Op          string    `json:"op"`
+	Path        string    `json:"path"`
+	Destination string    `json:"destination,omitempty"` // moves and copies
+	Size        *int64    `json:"size,omitempty"`        // bytes of content sent
+	UID         uint32    `json:"uid"`
+	GID         uint32    `json:"gid"`
+	PID         uint32    `json:"pid"`
+	Result      string    `json:"result"` // "ok", the error, or "not sent"
+	RequestID   string    `json:"request_id"`
+
+	// Details is the body of the request, other than file content. It is
+	// only recorded in audit-only mode, where the log is the only trace of
+	// the change.
+	Details json.RawMessage `json:"details,omitempty"`
+}
+
+// errAuditOnly fails changes that audit-only mode logged instead of sending
+var errAuditOnly = errors.New("audit-only mode: change not sent")
+
+// OpenAuditLog opens path for appending audit records, creating it
+// readable only by its owner if it doesn't exist
+func OpenAuditLog(path string) (*AuditLog, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &AuditLog{file: f}, nil
+}
+
+// Close closes the audit file
+func (l *AuditLog) Close() error {
+	return l.file.Close()
+}
+
+// write appends one record. A record that can't be written is lost rather
+// than failing the change it describes, which has already been made.
+func (l *AuditLog) write(r *AuditRecord) {
+	line, err := json.Marshal(r)
+	if err != nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.file.Write(append(line, '\n'))
+}
+
+// auditAPI records the changes made through an API client in an AuditLog.
+// In audit-only mode the changes are recorded but not sent, and fail with
+// errAuditOnly.
+type auditAPI struct {
+	monkapi.API
+	log  *AuditLog
+	only bool
+}
+
+// begin starts the record of a change, attaching a new request ID to ctx
+func (a *auditAPI) begin(ctx context.Context, op, path string) (context.Context, *AuditRecord) {
+	var id [16]byte
+	rand.Read(id[:])
+	r := &AuditRecord{
+		Time:      time.Now().UTC(),
+		Op:        op,
+		Path:      path,
+		RequestID: hex.EncodeToString(id[:]),
+	}
+	if caller, ok := fuse.FromContext(ctx); ok {
+		r.UID, r.GID, r.PID = caller.Uid, caller.Gid, caller.Pid
+	}
+	return monkapi.WithRequestID(ctx, r.RequestID), r
+}
+
+// withhold reports whether the change is to be recorded without being
+// sent, recording it with details if so
+func (a *auditAPI) withhold(r *AuditRecord, details interface{}) bool {
+	if !a.only {
+		return false
+	}
+	if raw, ok := details.(json.RawMessage); ok {
+		r.Details = raw
+	} else if details != nil {
+		r.Details, _ = json.Marshal(details)
+	}
+	r.Result = "not sent"
+	a.log.write(r)
+	return true
+}
+
+// end records the result of a change
+func (a *auditAPI) end(r *AuditRecord, err error) {
+	r.Result = "ok"
+	if err != nil {
+		r.Result = err.Error()
+	}
+	a.log.write(r)
+}
+
+// contentSize returns the size of content as the store request encodes it
+func contentSize(content interface{}, opts monkapi.StoreOptions) *int64 {
+	var size int64
+	switch c := content.(type) {
+	case string:
+		size = int64(len(c))
+		if opts.Encoding == encodingBase64 {
+			size = int64(base64.StdEncoding.DecodedLen(len(c)) - strings.Count(c, "="))
+		}
+	case []byte:
+		size = int64(len(c))
+	default:
+		return nil
+	}
+	return &size
+}
+
+func (a *auditAPI) Store(ctx context.Context, path string, content interface{}, opts monkapi.StoreOptions, pick string) (*monkapi.StoreResponse, error) {
+	ctx, r := a.begin(ctx, "store", path)
+	r.Size = contentSize(content, opts)
+	if a.withhold(r, opts) {
+		return nil, errAuditOnly
+	}
+	resp, err := a.API.Store(ctx, path, content, opts, pick)
+	a.end(r, err)
+	return resp, err
+}
+
+// Patch forwards to the client's Patch, when it has one
+func (a *auditAPI) Patch(ctx context.Context, path string, ranges []monkapi.PatchRange, size int64, pick string) (*monkapi.StoreResponse, error) {
+	p, ok := a.API.(patcher)
+	if !ok {
+		return nil, errors.ErrUnsupported
+	}
+	ctx, r := a.begin(ctx, "patch", path)
+	var sent int64
+	for _, pr := range ranges {
+		sent += int64(len(pr.Data))
+	}
+	r.Size = &sent
+	if a.withhold(r, patchDetails(ranges, size)) {
+		return nil, errAuditOnly
+	}
+	resp, err := p.Patch(ctx, path, ranges, size, pick)
+	if !errors.Is(err, errors.ErrUnsupported) {
+		a.end(r, err)
+	}
+	return resp, err
+}
+
+func (a *auditAPI) Delete(ctx context.Context, path string, opts monkapi.DeleteOptions, pick string) (*monkapi.DeleteResponse, error) {
+	ctx, r := a.begin(ctx, "delete", path)
+	if a.withhold(r, opts) {
+		return nil, errAuditOnly
+	}
+	resp, err := a.API.Delete(ctx, path, opts, pick)
+	a.end(r, err)
+	return resp, err
+}
+
+func (a *auditAPI) Copy(ctx context.Context, source, destination string, opts monkapi.CopyOptions, pick string) (*monkapi.CopyResponse, error) {
+	ctx, r := a.begin(ctx, "copy", source)
+	r.Destination = destination
+	if a.withhold(r, opts) {
+		return nil, errAuditOnly
+	}
+	resp, err := a.API.Copy(ctx, source, destination, opts, pick)
+	a.end(r, err)
+	return resp, err
+}
+
+func (a *auditAPI) Move(ctx context.Context, source, destination string, opts monkapi.MoveOptions, pick string) (*monkapi.MoveResponse, error) {
+	ctx, r := a.begin(ctx, "move", source)
+	r.Destination = destination
+	if a.withhold(r, opts) {
+		return nil, errAuditOnly
+	}
+	resp, err := a.API.Move(ctx, source, destination, opts, pick)
+	a.end(r, err)
+	return resp, err
+}
+
+func (a *auditAPI) Update(ctx context.Context, path string, opts monkapi.UpdateOptions, pick string) (*monkapi.UpdateResponse, error) {
+	ctx, r := a.begin(ctx, "update", path)
+	if a.withhold(r, opts) {
+		return nil, errAuditOnly
+	}
+	resp, err := a.API.Update(ctx, path, opts, pick)
+	a.end(r, err)
+	return resp, err
+}
+
+func (a *auditAPI) CreateSchema(ctx context.Context, schema string, definition json.RawMessage) error {
+	return a.record(ctx, "create_schema", schemaPath(schema), definition, func(ctx context.Context) error {
+		return a.API.CreateSchema(ctx, schema, definition)
+	})
+}
+
+func (a *auditAPI) UpdateSchema(ctx context.Context, schema string, definition json.RawMessage) error {
+	return a.record(ctx, "update_schema", schemaPath(schema), definition, func(ctx context.Context) error {
+		return a.API.UpdateSchema(ctx, schema, definition)
+	})
+}
+
+func (a *auditAPI) DeleteSchema(ctx context.Context, schema string) error {
+	return a.record(ctx, "delete_schema", schemaPath(schema), nil, func(ctx context.Context) error {
+		return a.API.DeleteSchema(ctx, schema)
+	})
+}
+
+func (a *auditAPI) UpdateColumn(ctx context.Context, schema, column string, definition json.RawMessage) error {
+	path := "/" + metaDirName + "/columns/" + schema + "/" + column
+	return a.record(ctx, "update_column", path, definition, func(ctx context.Context) error {
+		return a.API.UpdateColumn(ctx, schema, column, definition)
+	})
+}
+
+func (a *auditAPI) CreateRecord(ctx context.Context, schema string, record json.RawMessage) error {
+	return a.record(ctx, "create_record", "/"+dataDirName+"/"+schema, record, func(ctx context.Context) error {
+		return a.API.CreateRecord(ctx, schema, record)
+	})
+}
+
+func (a *auditAPI) UpdateRecord(ctx context.Context, schema, id string, record json.RawMessage) error {
+	return a.record(ctx, "update_record", recordPath(schema, id), record, func(ctx context.Context) error {
+		return a.API.UpdateRecord(ctx, schema, id, record)
+	})
+}
+
+func (a *auditAPI) DeleteRecord(ctx context.Context, schema, id string) error {
+	return a.record(ctx, "delete_record", recordPath(schema, id), nil, func(ctx context.Context) error {
+		return a.API.DeleteRecord(ctx, schema, id)
+	})
+}
+
+func (a *auditAPI) SetACL(ctx context.Context, schema, id string, acl monkapi.ACL) error {
+	return a.record(ctx, "set_acl", recordPath(schema, id), acl, func(ctx context.Context) error {
+		return a.API.SetACL(ctx, schema, id, acl)
+	})
+}
+
+// record audits a change that only returns an error, sending body as its
+// details. A JSON body's size is recorded too.
+func (a *auditAPI) record(ctx context.Context, op, path string, body interface{}, change func(context.Context) error) error {
+	ctx, r := a.begin(ctx, op, path)
+	if raw, ok := body.(json.RawMessage); ok {
+		n := int64(len(raw))
+		r.Size = &n
+	}
+	if a.withhold(r, body) {
+		return errAuditOnly
+	}
+	err := change(ctx)
+	a.end(r, err)
+	return err
+}
+
+// patchDetails describes the ranges of a patch, without their content
+func patchDetails(ranges []monkapi.PatchRange, size int64) interface{} {
+	type span struct {
+		Offset int64 `json:"offset"`
+		Length int   `json:"length"`
+	}
+	spans := make([]span, len(ranges))
+	for i, pr := range ranges {
+		spans[i] = span{pr.Offset, len(pr.Data)}
+	}
+	return struct {
+		Ranges []span `json:"ranges"`
+		Size   int64  `json:"size"`
+	}{spans, size}
+}
+
+// schemaPath and recordPath name Describe and Data API objects by where
+// the mount shows them
+func schemaPath(schema string) string {
+	return "/" + metaDirName + "/schemas/" + schema
+}
+
+func recordPath(schema, id string) string {
+	return "/" + dataDirName + "/" + schema + "/" + id
+}
+
+// unaudited returns the client behind an audit wrapper, for checking what
+// optional interfaces it implements
+func unaudited(api monkapi.API) monkapi.API {
+	if a, ok := api.(*auditAPI); ok {
+		return a.API
+	}
+	return api
+}
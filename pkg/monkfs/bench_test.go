@@ -0,0 +1,96 @@
+package monkfs
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ianzepp/monk-api-fuse/internal/mockserver"
+)
+
+// These benchmarks go through a FUSE mount to the mock server, so they
+// measure the kernel round trips and HTTP requests an operation costs as
+// well as the filesystem's own work.
+
+func BenchmarkReaddir10k(b *testing.B) {
+	const files = 10_000
+	s := mockserver.New()
+	for i := 0; i < files; i++ {
+		s.Put(fmt.Sprintf("/big/file%05d.txt", i), []byte("x"))
+	}
+	mnt, root := testMountRoot(b, s, Options{})
+	dir := filepath.Join(mnt, "big")
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// List from the server each time, as a directory not listed within
+		// the listing TTL is
+		root.listings.Clear()
+		root.cache.Clear()
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(entries) != files {
+			b.Fatalf("listed %d entries, want %d", len(entries), files)
+		}
+	}
+}
+
+func BenchmarkGetattrWarm(b *testing.B) {
+	s := mockserver.New()
+	s.Put("/dir/file.txt", []byte("hello"))
+	mnt := testMount(b, s, Options{})
+	name := filepath.Join(mnt, "dir/file.txt")
+	if _, err := os.Stat(name); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := os.Stat(name); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGetattrCold(b *testing.B) {
+	s := mockserver.New()
+	s.Put("/dir/file.txt", []byte("hello"))
+	mnt, root := testMountRoot(b, s, Options{})
+	name := filepath.Join(mnt, "dir/file.txt")
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		root.cache.Clear()
+		if _, err := os.Stat(name); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSequentialRead(b *testing.B) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 1<<20)
+	s := mockserver.New()
+	s.Put("/large.bin", content)
+	mnt := testMount(b, s, Options{DirectIO: true})
+	name := filepath.Join(mnt, "large.bin")
+	buf := make([]byte, 128<<10)
+
+	b.SetBytes(int64(len(content)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f, err := os.Open(name)
+		if err != nil {
+			b.Fatal(err)
+		}
+		n, err := io.CopyBuffer(io.Discard, f, buf)
+		f.Close()
+		if err != nil || n != int64(len(content)) {
+			b.Fatalf("read %d bytes: %v", n, err)
+		}
+	}
+}
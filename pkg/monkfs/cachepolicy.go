@@ -0,0 +1,80 @@
+package monkfs
+
+import (
+	"path"
+	"strings"
+	"time"
+
+	"github.com/ianzepp/monk-api-fuse/pkg/monkapi"
+)
+
+// CacheMode selects how the kernel page cache is used for an open file
+type CacheMode string
+
+const (
+	// CacheKeep keeps cached pages across opens (FOPEN_KEEP_CACHE)
+	CacheKeep CacheMode = "keep"
+	// CacheDirect bypasses the page cache (FOPEN_DIRECT_IO)
+	CacheDirect CacheMode = "direct"
+)
+
+// CacheRule forces a cache mode for paths matching a glob pattern.
+// Patterns containing "/" match the full path; others match the base name.
+type CacheRule struct {
+	Pattern string    `json:"pattern"`
+	Mode    CacheMode `json:"mode"`
+}
+
+// CachePolicy chooses a cache mode per file. Rules are checked in order;
+// when none match, files that were modified recently, JSON records and
+// files smaller than LargeFileSize use direct I/O, since they are the ones
+// most likely to change remotely and cheapest to re-read.
+type CachePolicy struct {
+	Rules []CacheRule `json:"rules"`
+
+	// RecentSeconds is how long after a modification a file counts as
+	// recently modified (default 60)
+	RecentSeconds int `json:"recent_seconds"`
+
+	// LargeFileSize is the size in bytes from which files keep their cache
+	// (default 1 MiB)
+	LargeFileSize int64 `json:"large_file_size"`
+}
+
+// Mode returns the cache mode for a file at path with the given metadata
+func (p *CachePolicy) Mode(filePath string, stat *monkapi.StatResponse) CacheMode {
+	for _, rule := range p.Rules {
+		name := filePath
+		if !strings.Contains(rule.Pattern, "/") {
+			name = path.Base(filePath)
+		}
+		if ok, _ := path.Match(rule.Pattern, name); ok {
+			return rule.Mode
+		}
+	}
+
+	recent := time.Duration(p.RecentSeconds) * time.Second
+	if recent == 0 {
+		recent = 60 * time.Second
+	}
+	large := p.LargeFileSize
+	if large == 0 {
+		large = 1 << 20
+	}
+
+	if stat == nil {
+		return CacheKeep
+	}
+	if modified := parseMonkTimestamp(stat.FileMetadata.ModifiedTime); modified != 0 {
+		if time.Since(time.Unix(int64(modified), 0)) < recent {
+			return CacheDirect
+		}
+	}
+	if path.Ext(filePath) == ".json" || strings.HasPrefix(stat.FileMetadata.ContentType, "application/json") {
+		return CacheDirect
+	}
+	if stat.FileMetadata.Size < large {
+		return CacheDirect
+	}
+	return CacheKeep
+}
@@ -0,0 +1,26 @@
+package monkfs
+
+import (
+	"context"
+	"strings"
+)
+
+// foldedPath finds the API path of the child whose name matches name
+// ignoring case. A name matching several children, such as "readme" with
+// both "README" and "Readme" present, matches none.
+func (n *MonkFS) foldedPath(ctx context.Context, name string) (string, bool) {
+	listing, err := n.listEntries(ctx, n.getPath())
+	if err != nil {
+		return "", false
+	}
+	found := ""
+	for _, entry := range listing {
+		if strings.EqualFold(n.names.display(entry.Name), name) {
+			if found != "" {
+				return "", false
+			}
+			found = n.entryPath(entry.Name)
+		}
+	}
+	return found, found != ""
+}
@@ -0,0 +1,85 @@
+package monkfs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// xattrSHA256 exposes the server-provided content checksum
+const xattrSHA256 = "user.monk.sha256"
+
+// checksum returns the server-provided SHA-256 for this node, or "" if the
+// server does not supply one
+func (n *MonkFS) checksum(ctx context.Context) (string, syscall.Errno) {
+	path := n.getPath()
+
+	stat := n.cache.Get(path)
+	if stat == nil {
+		gen := n.cache.Generation()
+		resp, err := n.apiClient.Stat(ctx, path, n.statPick())
+		if err != nil {
+			return "", n.apiErrno(path, err)
+		}
+		n.cache.SetSince(path, resp, gen)
+		stat = resp
+	}
+
+	return strings.ToLower(stat.FileMetadata.SHA256), 0
+}
+
+// getChecksumXattr implements reads of user.monk.sha256
+func (n *MonkFS) getChecksumXattr(ctx context.Context, dest []byte) (uint32, syscall.Errno) {
+	sum, errno := n.checksum(ctx)
+	if errno != 0 {
+		return 0, errno
+	}
+	if sum == "" {
+		return 0, syscall.Errno(fuse.ENOATTR)
+	}
+	return copyXattr(dest, []byte(sum))
+}
+
+// verifyChecksum compares downloaded content against a freshly fetched
+// server checksum. Content without a server checksum is accepted.
+func (n *MonkFS) verifyChecksum(ctx context.Context, path string, data []byte) syscall.Errno {
+	gen := n.cache.Generation()
+	stat, err := n.apiClient.Stat(ctx, path, n.statPick())
+	if err != nil {
+		return n.apiErrno(path, err)
+	}
+	n.cache.SetSince(path, stat, gen)
+
+	expected := strings.ToLower(stat.FileMetadata.SHA256)
+	if expected == "" {
+		return 0
+	}
+
+	sum := sha256.Sum256(data)
+	if actual := hex.EncodeToString(sum[:]); actual != expected {
+		n.errLog.Record(path, fmt.Errorf("CHECKSUM_MISMATCH: expected sha256 %s, got %s", expected, actual))
+		return syscall.EIO
+	}
+	return 0
+}
+
+// unchanged reports whether content hashing to sum is what the server
+// already holds for the handle's file: the content last loaded or stored
+// through the handle, or what the cached server checksum describes. Editors
+// that rewrite a file on every save then cost no store. fh.mu must be held.
+func (fh *MonkFileHandle) unchanged(sum [sha256.Size]byte) bool {
+	if fh.storedSumOK {
+		return sum == fh.storedSum
+	}
+	// The server's checksum is of the ciphertext
+	if fh.node.opts.Encryption != nil {
+		return false
+	}
+	stat := fh.node.cache.Get(fh.path)
+	return stat != nil && strings.EqualFold(stat.FileMetadata.SHA256, hex.EncodeToString(sum[:]))
+}
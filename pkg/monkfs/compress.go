@@ -0,0 +1,37 @@
+package monkfs
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"sync"
+)
+
+// flateWriters reuses compressors, whose state is large to allocate for
+// every cached file
+var flateWriters = sync.Pool{
+	New: func() any {
+		w, _ := flate.NewWriter(nil, flate.BestSpeed)
+		return w
+	},
+}
+
+// compressContent deflates content for the content cache. JSON records
+// typically shrink to a fifth or less.
+func compressContent(data []byte) []byte {
+	var buf bytes.Buffer
+	w := flateWriters.Get().(*flate.Writer)
+	defer flateWriters.Put(w)
+
+	w.Reset(&buf)
+	w.Write(data)
+	w.Close()
+	return bytes.Clone(buf.Bytes())
+}
+
+// decompressContent inflates content compressed by compressContent
+func decompressContent(data []byte) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(data))
+	defer r.Close()
+	return io.ReadAll(r)
+}
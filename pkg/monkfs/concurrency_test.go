@@ -0,0 +1,199 @@
+package monkfs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/ianzepp/monk-api-fuse/internal/mockserver"
+)
+
+// These tests drive many kernel callbacks on the same inodes at once; run
+// them with go test -race for them to be meaningful.
+
+// version is the content written by one writer; every version has the
+// same length, so a read that mixes two shows as neither
+func version(writer, round int) []byte {
+	return fmt.Appendf(nil, "writer %02d round %03d\n", writer, round)
+}
+
+func TestConcurrentOpenReadWriteFlush(t *testing.T) {
+	const writers, rounds = 8, 20
+	s := mockserver.New()
+	s.Put("/shared.txt", version(0, 0))
+	mnt := testMount(t, s, Options{})
+	name := filepath.Join(mnt, "shared.txt")
+
+	valid := map[string]bool{string(version(0, 0)): true}
+	for w := 1; w <= writers; w++ {
+		for r := 0; r < rounds; r++ {
+			valid[string(version(w, r))] = true
+		}
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*writers*rounds)
+	for w := 1; w <= writers; w++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for r := 0; r < rounds; r++ {
+				f, err := os.OpenFile(name, os.O_RDWR, 0)
+				if err != nil {
+					errs <- err
+					return
+				}
+				buf := make([]byte, 64)
+				f.ReadAt(buf, 0)
+				if _, err := f.WriteAt(version(w, r), 0); err != nil {
+					errs <- err
+				}
+				if err := f.Sync(); err != nil {
+					errs <- fmt.Errorf("fsync: %w", err)
+				}
+				if err := f.Close(); err != nil {
+					errs <- fmt.Errorf("close: %w", err)
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for r := 0; r < rounds; r++ {
+				data, err := os.ReadFile(name)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if !valid[string(data)] {
+					errs <- fmt.Errorf("read torn content %q", data)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	final, _ := s.Get("/shared.txt")
+	if !valid[string(final)] {
+		t.Errorf("stored torn content %q", final)
+	}
+	if got, _ := os.ReadFile(name); !bytes.Equal(got, final) {
+		t.Errorf("mount reads %q, server holds %q", got, final)
+	}
+}
+
+func TestConcurrentHandlesOnOneInode(t *testing.T) {
+	s := mockserver.New()
+	s.Put("/log", nil)
+	mnt := testMount(t, s, Options{})
+	name := filepath.Join(mnt, "log")
+
+	// Handles open at once on one inode each buffer their own writes; each
+	// rewrites the whole file, so it ends up holding those of exactly one
+	const handles = 16
+	files := make([]*os.File, handles)
+	for i := range files {
+		f, err := os.OpenFile(name, os.O_RDWR, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[i] = f
+	}
+
+	var wg sync.WaitGroup
+	for i, f := range files {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f.WriteAt(bytes.Repeat([]byte{'a' + byte(i)}, 100), 0)
+			f.Stat()
+			f.Sync()
+		}()
+	}
+	wg.Wait()
+
+	for i, f := range files {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := f.Close(); err != nil {
+				t.Errorf("close handle %d: %v", i, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	final, _ := s.Get("/log")
+	if len(final) != 100 || !bytes.Equal(final, bytes.Repeat(final[:1], len(final))) {
+		t.Errorf("stored %q, want one handle's writes", final)
+	}
+}
+
+func TestConcurrentCacheInvalidation(t *testing.T) {
+	const files = 20
+	s := mockserver.New()
+	for i := 0; i < files; i++ {
+		s.Put(fmt.Sprintf("/dir/f%02d", i), []byte("0"))
+	}
+	mnt := testMount(t, s, Options{})
+	dir := filepath.Join(mnt, "dir")
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 1000)
+	// Writers change the files through the mount, invalidating their
+	// metadata and the directory's listing while others read both
+	for i := 0; i < files; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			name := filepath.Join(dir, fmt.Sprintf("f%02d", i))
+			for round := 1; round <= 5; round++ {
+				if err := os.WriteFile(name, bytes.Repeat([]byte("x"), round), 0); err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for round := 0; round < 20; round++ {
+				entries, err := os.ReadDir(dir)
+				if err != nil {
+					errs <- err
+					continue
+				}
+				for _, e := range entries {
+					if _, err := e.Info(); err != nil && !errors.Is(err, os.ErrNotExist) {
+						errs <- err
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	// Once the writes are done, every file shows its last size
+	for i := 0; i < files; i++ {
+		info, err := os.Stat(filepath.Join(dir, fmt.Sprintf("f%02d", i)))
+		if err != nil || info.Size() != 5 {
+			t.Errorf("f%02d after writes: %v, %v", i, info, err)
+		}
+	}
+	if names := listNames(t, dir); len(names) != files || !slices.IsSorted(names) {
+		t.Errorf("readdir after writes = %v", names)
+	}
+}
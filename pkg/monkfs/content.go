@@ -0,0 +1,152 @@
+package monkfs
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"unicode/utf8"
+
+	"github.com/ianzepp/monk-api-fuse/pkg/monkapi"
+)
+
+// encodingBase64 marks content transported as base64 text
+const encodingBase64 = "base64"
+
+// retrieve downloads file content as raw bytes. With Options.Binary the
+// content is requested base64-encoded and the full response is fetched so
+// the encoding it was actually sent in is known. With Options.Encryption
+// the whole file is fetched and decrypted, and any range applied after.
+func (n *MonkFS) retrieve(ctx context.Context, path string, opts monkapi.RetrieveOptions) ([]byte, error) {
+	start, maxBytes := opts.StartOffset, opts.MaxBytes
+	if n.opts.Encryption != nil {
+		opts.StartOffset, opts.MaxBytes = 0, 0
+	}
+
+	// Use pick=content to get just the file content (80% reduction for single fields!)
+	pick := "content"
+	if n.opts.Binary || n.opts.Encryption != nil {
+		opts.Encoding = encodingBase64
+		pick = ""
+	}
+
+	resp, err := n.apiClient.Retrieve(ctx, path, opts, pick)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := decodeContent(resp)
+	if err != nil || n.opts.Encryption == nil {
+		return data, err
+	}
+	if data, err = n.opts.Encryption.open(data); err != nil {
+		return nil, err
+	}
+	data = data[min(start, len(data)):]
+	if maxBytes > 0 && maxBytes < len(data) {
+		data = data[:maxBytes]
+	}
+	return data, nil
+}
+
+// retrieveInto reads up to len(dest) bytes of content starting at off,
+// streaming the response so no more than the read window is buffered.
+// Binary transport needs the whole response to know its encoding, and
+// encrypted content the whole file, so both fall back to retrieve.
+func (n *MonkFS) retrieveInto(ctx context.Context, path string, dest []byte, off int64) (int, error) {
+	opts := monkapi.RetrieveOptions{
+		StartOffset: int(off),
+		MaxBytes:    len(dest),
+	}
+
+	if n.opts.Binary || n.opts.Encryption != nil {
+		data, err := n.retrieve(ctx, path, opts)
+		if err != nil {
+			return 0, err
+		}
+		return copy(dest, data), nil
+	}
+
+	stream, err := n.apiClient.RetrieveStream(ctx, path, opts)
+	if err != nil {
+		return 0, err
+	}
+	defer stream.Close()
+
+	read, err := io.ReadFull(stream, dest)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		// Short read at end of file
+		err = nil
+	}
+	return read, err
+}
+
+// store uploads raw bytes as file content. With Options.Binary, content
+// that is not valid UTF-8 is sent base64-encoded so it survives the JSON
+// transport intact. With Options.Encryption, the encrypted content always
+// is.
+func (n *MonkFS) store(ctx context.Context, path string, data []byte) error {
+	binary := n.opts.Binary
+	if n.opts.Encryption != nil {
+		data, binary = n.opts.Encryption.seal(data), true
+	}
+	content, opts := encodeContent(data, binary)
+	_, err := n.apiClient.Store(ctx, path, content, opts, "")
+	return err
+}
+
+// decodeContent converts a retrieve response into raw bytes
+func decodeContent(resp *monkapi.RetrieveResponse) ([]byte, error) {
+	if resp.Encoding != encodingBase64 {
+		return contentToBytes(resp.Content)
+	}
+
+	var encoded string
+	if err := json.Unmarshal(resp.Content, &encoded); err != nil {
+		return nil, fmt.Errorf("base64 content is not a string: %w", err)
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("decode base64 content: %w", err)
+	}
+	return data, nil
+}
+
+// contentToBytes decodes the raw JSON content value of a retrieve response.
+//
+// Strings are unescaped with full JSON semantics (\n, \", \uXXXX and
+// surrogate pairs), once, as the streaming decoder of RetrieveStream does;
+// a file holding a quoted string keeps its quotes. Objects, arrays,
+// numbers and booleans are returned in their exact JSON representation,
+// and null or missing content is empty.
+func contentToBytes(raw json.RawMessage) ([]byte, error) {
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) == 0 || bytes.Equal(trimmed, []byte("null")) {
+		return []byte{}, nil
+	}
+
+	if trimmed[0] != '"' {
+		if !json.Valid(trimmed) {
+			return nil, fmt.Errorf("content is not valid JSON")
+		}
+		return trimmed, nil
+	}
+
+	var text string
+	if err := json.Unmarshal(trimmed, &text); err != nil {
+		return nil, fmt.Errorf("decode content string: %w", err)
+	}
+	return []byte(text), nil
+}
+
+// encodeContent prepares raw bytes for a store request
+func encodeContent(data []byte, binary bool) (interface{}, monkapi.StoreOptions) {
+	if binary && !utf8.Valid(data) {
+		return base64.StdEncoding.EncodeToString(data), monkapi.StoreOptions{
+			Encoding: encodingBase64,
+		}
+	}
+	return string(data), monkapi.StoreOptions{}
+}
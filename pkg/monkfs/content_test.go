@@ -0,0 +1,156 @@
+package monkfs
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/ianzepp/monk-api-fuse/pkg/monkapi"
+)
+
+func TestContentToBytes(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want string
+	}{
+		{"missing", ``, ``},
+		{"whitespace", "  \n\t", ``},
+		{"null", `null`, ``},
+		{"empty string", `""`, ``},
+		{"plain", `"hello"`, `hello`},
+		{"quoted content keeps its quotes", `"\"hello\""`, `"hello"`},
+		{"json text in a string", `"{\"a\": 1}"`, `{"a": 1}`},
+		{"newline and tab", `"line1\nline2\tend"`, "line1\nline2\tend"},
+		{"carriage return", `"a\r\nb"`, "a\r\nb"},
+		{"backslash", `"C:\\temp\\x"`, `C:\temp\x`},
+		{"escaped quote", `"say \"hi\""`, `say "hi"`},
+		{"escaped slash", `"a\/b"`, `a/b`},
+		{"backspace and form feed", `"\b\f"`, "\b\f"},
+		{"nul", `"a\u0000b"`, "a\x00b"},
+		{"bmp escape", `"caf\u00e9"`, "café"},
+		{"raw utf-8", `"café ☕"`, "café ☕"},
+		{"surrogate pair", `"\ud83d\ude00"`, "😀"},
+		{"lone surrogate", `"\ud83d"`, "\uFFFD"},
+		{"trailing escaped backslash", `"end\\"`, `end\`},
+		{"surrounding whitespace", "  \"x\"\n", `x`},
+		{"object", `{"a":1,"b":"two"}`, `{"a":1,"b":"two"}`},
+		{"nested object", `{"a": {"b": [1, 2, {"c": "d\n"}]}}`, `{"a": {"b": [1, 2, {"c": "d\n"}]}}`},
+		{"object keeps escapes", `{"s":"\u00e9\"\\"}`, `{"s":"\u00e9\"\\"}`},
+		{"object trimmed", " {\"a\":1} \n", `{"a":1}`},
+		{"array", `[1,"two",null,{"x":[]}]`, `[1,"two",null,{"x":[]}]`},
+		{"integer", `42`, `42`},
+		{"float", `-1.5e3`, `-1.5e3`},
+		{"true", `true`, `true`},
+		{"false", `false`, `false`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := contentToBytes(json.RawMessage(tt.raw))
+			if err != nil {
+				t.Fatalf("contentToBytes(%s): %v", tt.raw, err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("contentToBytes(%s) = %q, want %q", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContentToBytesInvalid(t *testing.T) {
+	for _, raw := range []string{
+		`"unterminated`,
+		`"bad \x escape"`,
+		`"\u12"`,
+		`{"a":`,
+		`[1,2`,
+		`nul`,
+		`{"a":1} trailing`,
+	} {
+		if got, err := contentToBytes(json.RawMessage(raw)); err == nil {
+			t.Errorf("contentToBytes(%s) = %q, want an error", raw, got)
+		}
+	}
+}
+
+func TestDecodeContentBase64(t *testing.T) {
+	resp := &monkapi.RetrieveResponse{Content: json.RawMessage(`"AP9oaQ=="`), Encoding: encodingBase64}
+	got, err := decodeContent(resp)
+	if err != nil || !bytes.Equal(got, []byte{0x00, 0xff, 'h', 'i'}) {
+		t.Errorf("decodeContent = %q, %v", got, err)
+	}
+
+	for _, raw := range []string{`{"a":1}`, `"not base64!"`} {
+		resp := &monkapi.RetrieveResponse{Content: json.RawMessage(raw), Encoding: encodingBase64}
+		if got, err := decodeContent(resp); err == nil {
+			t.Errorf("decodeContent(%s) = %q, want an error", raw, got)
+		}
+	}
+}
+
+func TestEncodeContentRoundTrip(t *testing.T) {
+	for _, data := range []string{
+		"",
+		"hello\n",
+		`"quoted"`,
+		"tab\tnul\x00 \\ \"",
+		"café ☕ 😀",
+		`{"a": {"b": [1, 2]}}`,
+		"\xff\xfe binary",
+	} {
+		content, opts := encodeContent([]byte(data), true)
+		raw, err := json.Marshal(content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := decodeContent(&monkapi.RetrieveResponse{Content: raw, Encoding: opts.Encoding})
+		if err != nil {
+			t.Fatalf("decode %q: %v", data, err)
+		}
+		if string(got) != data {
+			t.Errorf("round trip of %q = %q", data, got)
+		}
+	}
+}
+
+func FuzzContentToBytes(f *testing.F) {
+	for _, seed := range []string{
+		``, `null`, `""`, `"hello"`, `"\"hello\""`, `"line1\nline2"`, `"😀"`, `"\ud83d"`,
+		`"café"`, `{"a": [1, 2, {"b": "c"}]}`, `[1,"two",null]`, `-1.5e3`, `true`,
+		`"unterminated`, `{"a":`, `nul`, "  \"x\"\n",
+	} {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		got, err := contentToBytes(json.RawMessage(raw))
+		if err != nil {
+			if json.Valid(raw) {
+				t.Fatalf("contentToBytes(%q) rejected valid JSON: %v", raw, err)
+			}
+			return
+		}
+
+		trimmed := bytes.TrimSpace(raw)
+		switch {
+		case len(trimmed) == 0 || string(trimmed) == "null":
+			if len(got) != 0 {
+				t.Fatalf("contentToBytes(%q) = %q, want empty", raw, got)
+			}
+		case trimmed[0] == '"':
+			// A string is decoded once, exactly as encoding/json does
+			var want string
+			if err := json.Unmarshal(trimmed, &want); err != nil {
+				t.Fatalf("contentToBytes(%q) accepted an invalid string", raw)
+			}
+			if string(got) != want {
+				t.Fatalf("contentToBytes(%q) = %q, want %q", raw, got, want)
+			}
+		default:
+			// Anything else is kept as sent
+			if !json.Valid(trimmed) || !bytes.Equal(got, trimmed) {
+				t.Fatalf("contentToBytes(%q) = %q, want it unchanged", raw, got)
+			}
+		}
+	})
+}
@@ -0,0 +1,273 @@
+package monkfs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/ianzepp/monk-api-fuse/pkg/monkapi"
+)
+
+// controlDirName is the virtual directory at the mount root exposing
+// mount diagnostics
+const controlDirName = ".monk"
+
+// controlDir implements the virtual /.monk directory
+type controlDir struct {
+	fs.Inode
+	root *MonkFS
+}
+
+var _ = (fs.NodeReaddirer)((*controlDir)(nil))
+var _ = (fs.NodeLookuper)((*controlDir)(nil))
+var _ = (fs.NodeGetattrer)((*controlDir)(nil))
+var _ = (fs.NodeStatfser)((*controlDir)(nil))
+
+// newControlDir creates the /.monk inode under the root node
+func (n *MonkFS) newControlDir(ctx context.Context, out *fuse.EntryOut) *fs.Inode {
+	out.Attr.Mode = syscall.S_IFDIR | 0555
+	return n.NewInode(ctx, &controlDir{root: n}, n.stableAttr(syscall.S_IFDIR, "/"+controlDirName))
+}
+
+// files returns the generators for each virtual file in /.monk
+func (d *controlDir) files() map[string]func() []byte {
+	return map[string]func() []byte{
+		"errors.log": d.root.errLog.Bytes,
+		"inodes":     d.root.inodes.Bytes,
+		"status":     d.root.statusBytes,
+	}
+}
+
+// commands returns the virtual files in /.monk that take commands: each
+// shows its state when read and runs each line written to it
+func (d *controlDir) commands() map[string]*commandFile {
+	commands := map[string]*commandFile{
+		dryRunFileName: {content: d.root.staging.Bytes, run: d.root.dryRunCommand},
+	}
+	if d.root.protect != nil {
+		commands[approveFileName] = &commandFile{content: d.root.protect.Bytes, run: d.root.protect.approve}
+	}
+	return commands
+}
+
+// healthReporter is implemented by API clients that track reachability
+type healthReporter interface {
+	Health() monkapi.Health
+}
+
+// statusBytes renders whether the API is reachable, how many files are
+// open, how much of the cache memory limit is used and how far warming
+// got, for /.monk/status
+func (n *MonkFS) statusBytes() []byte {
+	status := n.apiStatus()
+	open, peak, refused := n.openFiles.counts()
+	status = fmt.Appendf(status, "handles: %d open, peak %d", open, peak)
+	if n.opts.MaxOpenFiles > 0 {
+		status = fmt.Appendf(status, ", limit %d, %d refused", n.opts.MaxOpenFiles, refused)
+	}
+	status = append(status, '\n')
+	if maxPath, maxName := n.pathLimits(); maxPath > 0 || maxName > 0 {
+		status = fmt.Appendf(status, "limits: paths %s, names %s\n", lengthLimit(maxPath), lengthLimit(maxName))
+	}
+	status = append(status, n.staging.status()...)
+	if n.budget != nil {
+		status = fmt.Appendf(status, "cache: %d of %d bytes\n", n.budget.Used(), n.budget.Limit())
+	}
+	if p := n.warmProgress.Load(); p != nil {
+		state := "running"
+		if p.Done {
+			state = "done"
+		}
+		status = fmt.Appendf(status, "warm: %s, %d directories, %d entries, %d failed, %d queued\n",
+			state, p.Dirs, p.Entries, p.Failed, p.Queued)
+	}
+	return status
+}
+
+// apiStatus renders whether the API is reachable
+func (n *MonkFS) apiStatus() []byte {
+	reporter, ok := unaudited(n.staging.API).(healthReporter)
+	if !ok {
+		return []byte("api: unknown\n")
+	}
+
+	health := reporter.Health()
+	switch {
+	case !health.Up:
+		return fmt.Appendf(nil, "api: down since %s (%s)\n", health.Since.UTC().Format(time.RFC3339), health.Cause)
+	case !health.Since.IsZero():
+		return fmt.Appendf(nil, "api: up since %s\n", health.Since.UTC().Format(time.RFC3339))
+	default:
+		return []byte("api: up\n")
+	}
+}
+
+// Readdir lists the virtual control files
+func (d *controlDir) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
+	entries := []fuse.DirEntry{}
+	for name := range d.files() {
+		entries = append(entries, fuse.DirEntry{
+			Name: name,
+			Mode: syscall.S_IFREG | 0444,
+		})
+	}
+	for name := range d.commands() {
+		entries = append(entries, fuse.DirEntry{
+			Name: name,
+			Mode: syscall.S_IFREG | 0644,
+		})
+	}
+	return fs.NewListDirStream(entries), 0
+}
+
+// Lookup returns a virtual control file by name
+func (d *controlDir) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	if file, ok := d.commands()[name]; ok {
+		file.fillAttr(&out.Attr)
+		return d.NewInode(ctx, file, d.root.stableAttr(syscall.S_IFREG, "/"+controlDirName+"/"+name)), 0
+	}
+	content, ok := d.files()[name]
+	if !ok {
+		return nil, syscall.ENOENT
+	}
+
+	file := &virtualFile{content: content}
+	file.fillAttr(&out.Attr)
+	return d.NewInode(ctx, file, d.root.stableAttr(syscall.S_IFREG, "/"+controlDirName+"/"+name)), 0
+}
+
+// Getattr reports the control directory as read-only
+func (d *controlDir) Getattr(ctx context.Context, fh fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	out.Attr.Mode = syscall.S_IFDIR | 0555
+	return 0
+}
+
+// Statfs reports the same counts as the rest of the mount
+func (d *controlDir) Statfs(ctx context.Context, out *fuse.StatfsOut) syscall.Errno {
+	return d.root.Statfs(ctx, out)
+}
+
+// virtualFile is a read-only file whose content is generated on each read
+type virtualFile struct {
+	fs.Inode
+	content func() []byte
+}
+
+var _ = (fs.NodeOpener)((*virtualFile)(nil))
+var _ = (fs.NodeReader)((*virtualFile)(nil))
+var _ = (fs.NodeGetattrer)((*virtualFile)(nil))
+
+// Open opens the file with direct I/O since its size changes between reads
+func (f *virtualFile) Open(ctx context.Context, flags uint32) (fs.FileHandle, uint32, syscall.Errno) {
+	if flags&(syscall.O_WRONLY|syscall.O_RDWR) != 0 {
+		return nil, 0, syscall.EACCES
+	}
+	return nil, fuse.FOPEN_DIRECT_IO, 0
+}
+
+// Read returns the generated content at the given offset
+func (f *virtualFile) Read(ctx context.Context, fh fs.FileHandle, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	data := f.content()
+	if off >= int64(len(data)) {
+		return fuse.ReadResultData([]byte{}), 0
+	}
+	end := off + int64(len(dest))
+	if end > int64(len(data)) {
+		end = int64(len(data))
+	}
+	return fuse.ReadResultData(data[off:end]), 0
+}
+
+// Getattr reports the current size of the generated content
+func (f *virtualFile) Getattr(ctx context.Context, fh fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	f.fillAttr(&out.Attr)
+	return 0
+}
+
+func (f *virtualFile) fillAttr(attr *fuse.Attr) {
+	attr.Mode = syscall.S_IFREG | 0444
+	attr.Size = uint64(len(f.content()))
+	attr.Nlink = 1
+	fillBlocks(attr)
+}
+
+// commandFile is a virtual file whose content is generated on each read
+// and whose writes are commands. Only the user running the mount and root
+// may write to it, as commands affect every user of the mount.
+type commandFile struct {
+	fs.Inode
+	content func() []byte
+	run     func(ctx context.Context, cmd string) syscall.Errno
+}
+
+var _ = (fs.NodeOpener)((*commandFile)(nil))
+var _ = (fs.NodeReader)((*commandFile)(nil))
+var _ = (fs.NodeWriter)((*commandFile)(nil))
+var _ = (fs.NodeGetattrer)((*commandFile)(nil))
+var _ = (fs.NodeSetattrer)((*commandFile)(nil))
+
+// Open checks that the caller may write commands, if opening for writing
+func (f *commandFile) Open(ctx context.Context, flags uint32) (fs.FileHandle, uint32, syscall.Errno) {
+	if flags&(syscall.O_WRONLY|syscall.O_RDWR) != 0 {
+		caller, ok := fuse.FromContext(ctx)
+		if !ok || caller.Uid != 0 && caller.Uid != uint32(os.Getuid()) {
+			return nil, 0, syscall.EACCES
+		}
+	}
+	return nil, fuse.FOPEN_DIRECT_IO, 0
+}
+
+// Read returns the generated content at the given offset
+func (f *commandFile) Read(ctx context.Context, fh fs.FileHandle, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	data := f.content()
+	if off >= int64(len(data)) {
+		return fuse.ReadResultData([]byte{}), 0
+	}
+	return fuse.ReadResultData(data[off:min(off+int64(len(dest)), int64(len(data)))]), 0
+}
+
+// Write runs each non-empty line written, stopping at the first that fails
+func (f *commandFile) Write(ctx context.Context, fh fs.FileHandle, data []byte, off int64) (uint32, syscall.Errno) {
+	for _, line := range strings.Split(string(data), "\n") {
+		if cmd := strings.TrimSpace(line); cmd != "" {
+			if errno := f.run(ctx, cmd); errno != 0 {
+				return 0, errno
+			}
+		}
+	}
+	return uint32(len(data)), 0
+}
+
+// Getattr reports the current size of the generated content
+func (f *commandFile) Getattr(ctx context.Context, fh fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	f.fillAttr(&out.Attr)
+	return 0
+}
+
+// Setattr accepts the truncation of opening with O_TRUNC, as shells do
+func (f *commandFile) Setattr(ctx context.Context, fh fs.FileHandle, in *fuse.SetAttrIn, out *fuse.AttrOut) syscall.Errno {
+	f.fillAttr(&out.Attr)
+	return 0
+}
+
+func (f *commandFile) fillAttr(attr *fuse.Attr) {
+	attr.Mode = syscall.S_IFREG | 0644
+	attr.Size = uint64(len(f.content()))
+	attr.Nlink = 1
+	fillBlocks(attr)
+}
+
+// newErrorsFile creates the virtual <name>.errors sibling reporting why the
+// last write to target was rejected
+func (n *MonkFS) newErrorsFile(ctx context.Context, target string, out *fuse.EntryOut) *fs.Inode {
+	file := &virtualFile{content: func() []byte {
+		return []byte(n.errLog.Validation(target))
+	}}
+	file.fillAttr(&out.Attr)
+	return n.NewInode(ctx, file, n.stableAttr(syscall.S_IFREG, target+errorsSuffix))
+}
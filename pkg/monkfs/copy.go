@@ -0,0 +1,83 @@
+package monkfs
+
+import (
+	"context"
+	"math"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/ianzepp/monk-api-fuse/pkg/monkapi"
+)
+
+var _ = (fs.NodeCopyFileRanger)((*MonkFS)(nil))
+
+// CopyFileRange implements copy_file_range with a server-side copy.
+//
+// The File API copies whole files only, so just a copy of the entire
+// source onto the start of a destination no larger than it is offloaded.
+// Anything else returns EOPNOTSUPP and the kernel or cp falls back to
+// read/write.
+func (n *MonkFS) CopyFileRange(ctx context.Context, fhIn fs.FileHandle, offIn uint64, out *fs.Inode, fhOut fs.FileHandle, offOut uint64, length uint64, flags uint64) (uint32, syscall.Errno) {
+	ctx, cancel := n.withDeadline(ctx, opWrite)
+	defer cancel()
+
+	dest, ok := out.Operations().(*MonkFS)
+	if !ok || offIn != 0 || offOut != 0 || flags != 0 {
+		return 0, syscall.EOPNOTSUPP
+	}
+
+	// Pending local writes on either side are not visible to the server
+	if n.pending(fhIn) || dest.pending(fhOut) {
+		return 0, syscall.EOPNOTSUPP
+	}
+
+	var srcAttr, destAttr fuse.AttrOut
+	if errno := n.Getattr(ctx, nil, &srcAttr); errno != 0 {
+		return 0, errno
+	}
+	if errno := dest.Getattr(ctx, nil, &destAttr); errno != 0 {
+		return 0, errno
+	}
+
+	size := srcAttr.Attr.Size
+	if length < size || destAttr.Attr.Size > size || size > math.MaxUint32 {
+		return 0, syscall.EOPNOTSUPP
+	}
+
+	source, destination := n.getPath(), dest.getPath()
+	if _, err := n.apiClient.Copy(ctx, source, destination, monkapi.CopyOptions{Overwrite: true}, ""); err != nil {
+		return 0, dest.apiErrno(destination, err)
+	}
+
+	// Drop anything the destination handle read before the copy
+	if mfh, ok := fhOut.(*MonkFileHandle); ok {
+		mfh.mu.Lock()
+		mfh.writeCache = nil
+		mfh.content = nil
+		mfh.mu.Unlock()
+	}
+	dest.invalidate(destination)
+	dest.errLog.Clear(destination)
+
+	return uint32(size), 0
+}
+
+// pending reports whether fh or any other handle open on the node holds
+// writes that have not been flushed
+func (n *MonkFS) pending(fh fs.FileHandle) bool {
+	handles := n.openFiles.list(n.StableAttr().Ino)
+	if mfh, ok := fh.(*MonkFileHandle); ok {
+		handles = append(handles, mfh)
+	}
+
+	for _, h := range handles {
+		h.mu.Lock()
+		dirty := h.dirty
+		h.mu.Unlock()
+		if dirty {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,246 @@
+package monkfs
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/ianzepp/monk-api-fuse/pkg/monkapi"
+)
+
+// dataDirName is the top-level directory served by the Data API when
+// Options.DataAPI is set
+//
+// Layout:
+//
+//	/data/<schema>/<record-id>.json   record (read-write)
+//	/data/<schema>/<record-id>/<field> single field, with Options.ExpandFields
+//	/data/<schema>/.schema.json       schema definition (read-only)
+const dataDirName = "data"
+
+// dataDir implements /data and /data/<schema> in Data API mode
+type dataDir struct {
+	fs.Inode
+	root   *MonkFS
+	schema string // empty for /data itself
+}
+
+var _ = (fs.NodeReaddirer)((*dataDir)(nil))
+var _ = (fs.NodeLookuper)((*dataDir)(nil))
+var _ = (fs.NodeGetattrer)((*dataDir)(nil))
+var _ = (fs.NodeStatfser)((*dataDir)(nil))
+var _ = (fs.NodeCreater)((*dataDir)(nil))
+var _ = (fs.NodeUnlinker)((*dataDir)(nil))
+
+// newDataDir creates a Data API directory inode
+func (n *MonkFS) newDataDir(ctx context.Context, parent *fs.Inode, schema string, out *fuse.EntryOut) *fs.Inode {
+	dir := &dataDir{root: n, schema: schema}
+	out.Attr.Mode = syscall.S_IFDIR | 0755
+	return parent.NewInode(ctx, dir, n.stableAttr(syscall.S_IFDIR, dir.path()))
+}
+
+// path returns the mount path of this directory
+func (d *dataDir) path() string {
+	if d.schema == "" {
+		return "/" + dataDirName
+	}
+	return "/" + dataDirName + "/" + d.schema
+}
+
+// Readdir lists schemas at /data and records within a schema
+func (d *dataDir) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
+	entries := []fuse.DirEntry{}
+
+	if d.schema == "" {
+		schemas, err := d.root.apiClient.ListSchemas(ctx)
+		if err != nil {
+			return nil, d.root.apiErrno(d.path(), err)
+		}
+		for _, schema := range schemas {
+			entries = append(entries, fuse.DirEntry{Name: schema, Mode: syscall.S_IFDIR | 0755})
+		}
+		return fs.NewListDirStream(entries), 0
+	}
+
+	records, err := d.root.apiClient.ListRecords(ctx, d.schema)
+	if err != nil {
+		return nil, d.root.apiErrno(d.path(), err)
+	}
+
+	entries = append(entries, fuse.DirEntry{Name: schemaFileName, Mode: syscall.S_IFREG | 0444})
+	for _, record := range records {
+		id := monkapi.RecordID(record)
+		if id == "" {
+			continue
+		}
+		entries = append(entries, fuse.DirEntry{
+			Name: d.root.names.display(id + ".json"),
+			Mode: syscall.S_IFREG | 0644,
+			Ino:  d.root.inodes.number(d.path() + "/" + id + ".json"),
+		})
+		if d.root.opts.ExpandFields {
+			entries = append(entries, fuse.DirEntry{
+				Name: d.root.names.display(id),
+				Mode: syscall.S_IFDIR | 0755,
+				Ino:  d.root.inodes.number(d.path() + "/" + id),
+			})
+		}
+	}
+
+	return fs.NewListDirStream(entries), 0
+}
+
+// Lookup resolves a schema directory or record file
+func (d *dataDir) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	if d.schema == "" {
+		if _, err := d.root.apiClient.Describe(ctx, name); err != nil {
+			if monkapi.IsNotFound(err) {
+				return nil, syscall.ENOENT
+			}
+			return nil, d.root.apiErrno(d.path()+"/"+name, err)
+		}
+		return d.root.newDataDir(ctx, &d.Inode, name, out), 0
+	}
+
+	if name == schemaFileName {
+		return d.root.newSchemaFile(ctx, &d.Inode, d.schema, out)
+	}
+	if isShortened(name) && !d.root.names.known(name) {
+		// Shortened names map back through their listing
+		if records, err := d.root.apiClient.ListRecords(ctx, d.schema); err == nil {
+			for _, record := range records {
+				id := monkapi.RecordID(record)
+				d.root.names.display(id)
+				d.root.names.display(id + ".json")
+			}
+		}
+	}
+	name = d.root.names.api(name)
+	if !strings.HasSuffix(name, ".json") {
+		if d.root.opts.ExpandFields {
+			return d.lookupFields(ctx, name, out)
+		}
+		return nil, syscall.ENOENT
+	}
+
+	file := d.newRecordFile(strings.TrimSuffix(name, ".json"))
+	if errno := file.load(ctx); errno != 0 {
+		return nil, errno
+	}
+
+	file.fillAttr(&out.Attr)
+	return d.NewInode(ctx, file, d.root.stableAttr(syscall.S_IFREG, file.path)), 0
+}
+
+// Create starts a new record; it is created on first flush with the id
+// taken from the file name unless the document supplies one
+func (d *dataDir) Create(ctx context.Context, name string, flags uint32, mode uint32, out *fuse.EntryOut) (*fs.Inode, fs.FileHandle, uint32, syscall.Errno) {
+	if d.schema == "" || !strings.HasSuffix(name, ".json") {
+		return nil, nil, 0, syscall.EPERM
+	}
+
+	id := strings.TrimSuffix(d.root.names.api(name), ".json")
+	if errno := d.root.checkPathLength(d.path() + "/" + id); errno != 0 {
+		return nil, nil, 0, errno
+	}
+	file := d.newRecordFile(id)
+	update := file.save
+	file.save = func(ctx context.Context, data json.RawMessage) error {
+		record, err := withRecordID(data, id)
+		if err != nil {
+			return err
+		}
+		if err := d.root.apiClient.CreateRecord(ctx, d.schema, record); err != nil {
+			return err
+		}
+		// Later saves of the same inode update the record that now exists
+		file.save = update
+		return nil
+	}
+
+	file.fillAttr(&out.Attr)
+	child := d.NewInode(ctx, file, d.root.stableAttr(syscall.S_IFREG, file.path))
+	return child, nil, fuse.FOPEN_DIRECT_IO, 0
+}
+
+// Unlink deletes a record
+func (d *dataDir) Unlink(ctx context.Context, name string) syscall.Errno {
+	if d.schema == "" || !strings.HasSuffix(name, ".json") {
+		return syscall.EPERM
+	}
+
+	name = d.root.names.api(name)
+	path := d.path() + "/" + name
+	if errno := d.root.mayDelete(path); errno != 0 {
+		return errno
+	}
+	if err := d.root.apiClient.DeleteRecord(ctx, d.schema, strings.TrimSuffix(name, ".json")); err != nil {
+		return d.root.apiErrno(path, err)
+	}
+	d.root.inodes.removed(path)
+	return 0
+}
+
+// Getattr reports Data API directories as writable
+func (d *dataDir) Getattr(ctx context.Context, fh fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	out.Attr.Mode = syscall.S_IFDIR | 0755
+	return 0
+}
+
+// Statfs reports the same counts as the rest of the mount
+func (d *dataDir) Statfs(ctx context.Context, out *fuse.StatfsOut) syscall.Errno {
+	return d.root.Statfs(ctx, out)
+}
+
+// lookupFields exposes a record as a directory of its fields, served by
+// the File API's field addressing (/data/<schema>/<id>/<field>)
+func (d *dataDir) lookupFields(ctx context.Context, id string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	path := d.path() + "/" + id
+
+	gen := d.root.cache.Generation()
+	stat, err := d.root.apiClient.Stat(ctx, path, d.root.statPick())
+	if err != nil {
+		if monkapi.IsNotFound(err) {
+			return nil, syscall.ENOENT
+		}
+		return nil, d.root.apiErrno(path, err)
+	}
+	d.root.cache.SetSince(path, stat, gen)
+
+	node := d.root.newChild()
+	node.apiPath = path
+	d.root.fillAttr(&out.Attr, stat)
+	return d.NewInode(ctx, node, d.root.stableAttr(syscall.S_IFDIR, path)), 0
+}
+
+// newRecordFile builds the editable file for a record id in this schema
+func (d *dataDir) newRecordFile(id string) *jsonFile {
+	client := d.root.apiClient
+	schema := d.schema
+
+	return &jsonFile{
+		root: d.root,
+		path: d.path() + "/" + id + ".json",
+		fetch: func(ctx context.Context) (json.RawMessage, error) {
+			return client.GetRecord(ctx, schema, id)
+		},
+		save: func(ctx context.Context, data json.RawMessage) error {
+			return client.UpdateRecord(ctx, schema, id, data)
+		},
+	}
+}
+
+// withRecordID sets the id field of a record document if it is missing
+func withRecordID(data json.RawMessage, id string) (json.RawMessage, error) {
+	var record map[string]interface{}
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, err
+	}
+	if _, ok := record["id"]; !ok {
+		record["id"] = id
+	}
+	return json.Marshal(record)
+}
@@ -0,0 +1,43 @@
+package monkfs
+
+import (
+	"context"
+	"time"
+)
+
+// Deadlines bound how long one filesystem operation may take in total,
+// across all the API requests it makes and failovers between replicas.
+// An operation past its deadline fails with ETIMEDOUT, or is answered
+// from the cache with StaleIfError. Zero leaves a class bounded only by
+// the timeout of each request.
+type Deadlines struct {
+	Metadata time.Duration // getattr, lookup, readdir, open, xattrs, statfs
+	Read     time.Duration // reads of file content
+	Write    time.Duration // flush, fsync, setattr, unlink, rename, copy
+}
+
+// opClass selects which deadline applies to an operation
+type opClass int
+
+const (
+	opMetadata opClass = iota
+	opRead
+	opWrite
+)
+
+// withDeadline bounds ctx by the deadline of the operation's class
+func (n *MonkFS) withDeadline(ctx context.Context, class opClass) (context.Context, context.CancelFunc) {
+	var d time.Duration
+	switch class {
+	case opMetadata:
+		d = n.opts.Deadlines.Metadata
+	case opRead:
+		d = n.opts.Deadlines.Read
+	case opWrite:
+		d = n.opts.Deadlines.Write
+	}
+	if d <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, d)
+}
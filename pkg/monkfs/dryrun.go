@@ -0,0 +1,344 @@
+package monkfs
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ianzepp/monk-api-fuse/pkg/monkapi"
+)
+
+// dryRunFileName is the control file switching the mount in and out of
+// dry-run mode
+const dryRunFileName = "dryrun"
+
+// stagingAPI queues the changes made through an API client while the
+// mount is in dry-run mode, answering them as if they had been made, until
+// they are committed or discarded. Reads of the File API see the queued
+// changes laid over what the API holds. Outside dry-run mode it passes
+// everything on.
+type stagingAPI struct {
+	monkapi.API
+
+	mu     sync.Mutex
+	on     bool
+	queued []stagedChange
+
+	// commitMu serializes commit and discard, which send and drop the head
+	// of the queue without holding mu
+	commitMu sync.Mutex
+}
+
+// stagedChange is one queued change and how to send it
+type stagedChange struct {
+	op, path, destination string
+	size                  int
+	send                  func(context.Context) error
+
+	// What reads see of a queued File API change: the content stored, the
+	// permissions updated and when
+	data []byte
+	perm string
+	at   time.Time
+}
+
+// stage queues a change if dry-run mode is on, reporting whether it did
+func (s *stagingAPI) stage(c stagedChange) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.on {
+		return false
+	}
+	c.at = time.Now()
+	s.queued = append(s.queued, c)
+	return true
+}
+
+// changes returns the queued changes, or nil outside dry-run mode
+func (s *stagingAPI) changes() []stagedChange {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.on {
+		return nil
+	}
+	return slices.Clip(s.queued)
+}
+
+// active reports whether dry-run mode is on
+func (s *stagingAPI) active() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.on
+}
+
+// start switches dry-run mode on
+func (s *stagingAPI) start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.on = true
+}
+
+// commit sends the queued changes in order and leaves dry-run mode,
+// returning those sent. It stops at the first that fails, keeping it and
+// those after it queued and the mount in dry-run mode. Changes are sent
+// one at a time without holding the queue, so changes made meanwhile are
+// queued behind them and sent too.
+func (s *stagingAPI) commit(ctx context.Context) ([]stagedChange, error) {
+	s.commitMu.Lock()
+	defer s.commitMu.Unlock()
+
+	var sent []stagedChange
+	for {
+		s.mu.Lock()
+		if len(s.queued) == 0 {
+			s.queued = nil
+			s.on = false
+			s.mu.Unlock()
+			return sent, nil
+		}
+		c := s.queued[0]
+		s.mu.Unlock()
+
+		if err := c.send(ctx); err != nil {
+			return sent, fmt.Errorf("%s %s: %w", c.op, c.path, err)
+		}
+
+		// The change stays queued, and visible to reads, until the API
+		// has it
+		s.mu.Lock()
+		s.queued = s.queued[1:]
+		s.mu.Unlock()
+		sent = append(sent, c)
+	}
+}
+
+// discard drops the queued changes and leaves dry-run mode, returning
+// those dropped. It waits for a commit in progress.
+func (s *stagingAPI) discard() []stagedChange {
+	s.commitMu.Lock()
+	defer s.commitMu.Unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dropped := s.queued
+	s.queued = nil
+	s.on = false
+	return dropped
+}
+
+// Bytes renders the mode and the queued changes, for /.monk/dryrun
+func (s *stagingAPI) Bytes() []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.on {
+		return []byte("off\n")
+	}
+	out := fmt.Appendf(nil, "on, %d changes queued\n", len(s.queued))
+	for _, c := range s.queued {
+		out = fmt.Appendf(out, "%s %s", c.op, c.path)
+		if c.destination != "" {
+			out = fmt.Appendf(out, " -> %s", c.destination)
+		}
+		if c.size >= 0 {
+			out = fmt.Appendf(out, " (%d bytes)", c.size)
+		}
+		out = append(out, '\n')
+	}
+	return out
+}
+
+// status summarizes dry-run mode for /.monk/status, or returns nil if off
+func (s *stagingAPI) status() []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.on {
+		return nil
+	}
+	return fmt.Appendf(nil, "dry-run: on, %d changes queued\n", len(s.queued))
+}
+
+func (s *stagingAPI) Store(ctx context.Context, path string, content interface{}, opts monkapi.StoreOptions, pick string) (*monkapi.StoreResponse, error) {
+	size := -1
+	var data []byte
+	switch c := content.(type) {
+	case []byte:
+		// The write buffer is reused once this returns
+		content = bytes.Clone(c)
+		size, data = len(c), content.([]byte)
+	case string:
+		size, data = len(c), []byte(c)
+		if opts.Encoding == encodingBase64 {
+			data, _ = base64.StdEncoding.DecodeString(c)
+		}
+	default:
+		data, _ = json.Marshal(c)
+	}
+	queued := s.stage(stagedChange{op: "store", path: path, size: size, data: data, send: func(ctx context.Context) error {
+		_, err := s.API.Store(ctx, path, content, opts, pick)
+		return err
+	}})
+	if queued {
+		return &monkapi.StoreResponse{Success: true, FileMetadata: monkapi.FileMetadata{Size: int64(max(size, 0))}}, nil
+	}
+	return s.API.Store(ctx, path, content, opts, pick)
+}
+
+// Patch forwards to the client's Patch, when it has one. In dry-run mode
+// it reports patching unsupported, so the whole file is stored and queued.
+func (s *stagingAPI) Patch(ctx context.Context, path string, ranges []monkapi.PatchRange, size int64, pick string) (*monkapi.StoreResponse, error) {
+	p, ok := s.API.(patcher)
+	if !ok {
+		return nil, errors.ErrUnsupported
+	}
+	if s.active() {
+		return nil, errors.ErrUnsupported
+	}
+	return p.Patch(ctx, path, ranges, size, pick)
+}
+
+func (s *stagingAPI) Delete(ctx context.Context, path string, opts monkapi.DeleteOptions, pick string) (*monkapi.DeleteResponse, error) {
+	if s.stage(stagedChange{op: "delete", path: path, size: -1, send: func(ctx context.Context) error {
+		_, err := s.API.Delete(ctx, path, opts, pick)
+		return err
+	}}) {
+		return &monkapi.DeleteResponse{Success: true}, nil
+	}
+	return s.API.Delete(ctx, path, opts, pick)
+}
+
+func (s *stagingAPI) Copy(ctx context.Context, source, destination string, opts monkapi.CopyOptions, pick string) (*monkapi.CopyResponse, error) {
+	if s.stage(stagedChange{op: "copy", path: source, destination: destination, size: -1, send: func(ctx context.Context) error {
+		_, err := s.API.Copy(ctx, source, destination, opts, pick)
+		return err
+	}}) {
+		return &monkapi.CopyResponse{Success: true}, nil
+	}
+	return s.API.Copy(ctx, source, destination, opts, pick)
+}
+
+func (s *stagingAPI) Move(ctx context.Context, source, destination string, opts monkapi.MoveOptions, pick string) (*monkapi.MoveResponse, error) {
+	if s.stage(stagedChange{op: "move", path: source, destination: destination, size: -1, send: func(ctx context.Context) error {
+		_, err := s.API.Move(ctx, source, destination, opts, pick)
+		return err
+	}}) {
+		return &monkapi.MoveResponse{Success: true}, nil
+	}
+	return s.API.Move(ctx, source, destination, opts, pick)
+}
+
+func (s *stagingAPI) Update(ctx context.Context, path string, opts monkapi.UpdateOptions, pick string) (*monkapi.UpdateResponse, error) {
+	if s.stage(stagedChange{op: "update", path: path, size: -1, perm: opts.Permissions, send: func(ctx context.Context) error {
+		_, err := s.API.Update(ctx, path, opts, pick)
+		return err
+	}}) {
+		// Echo the change, as the server would
+		resp := &monkapi.UpdateResponse{Success: true}
+		resp.FileMetadata.Permissions = opts.Permissions
+		return resp, nil
+	}
+	return s.API.Update(ctx, path, opts, pick)
+}
+
+func (s *stagingAPI) CreateSchema(ctx context.Context, schema string, definition json.RawMessage) error {
+	definition = bytes.Clone(definition)
+	return s.record(ctx, "create_schema", schemaPath(schema), len(definition), func(ctx context.Context) error {
+		return s.API.CreateSchema(ctx, schema, definition)
+	})
+}
+
+func (s *stagingAPI) UpdateSchema(ctx context.Context, schema string, definition json.RawMessage) error {
+	definition = bytes.Clone(definition)
+	return s.record(ctx, "update_schema", schemaPath(schema), len(definition), func(ctx context.Context) error {
+		return s.API.UpdateSchema(ctx, schema, definition)
+	})
+}
+
+func (s *stagingAPI) DeleteSchema(ctx context.Context, schema string) error {
+	return s.record(ctx, "delete_schema", schemaPath(schema), -1, func(ctx context.Context) error {
+		return s.API.DeleteSchema(ctx, schema)
+	})
+}
+
+func (s *stagingAPI) UpdateColumn(ctx context.Context, schema, column string, definition json.RawMessage) error {
+	definition = bytes.Clone(definition)
+	path := "/" + metaDirName + "/columns/" + schema + "/" + column
+	return s.record(ctx, "update_column", path, len(definition), func(ctx context.Context) error {
+		return s.API.UpdateColumn(ctx, schema, column, definition)
+	})
+}
+
+func (s *stagingAPI) CreateRecord(ctx context.Context, schema string, record json.RawMessage) error {
+	record = bytes.Clone(record)
+	return s.record(ctx, "create_record", "/"+dataDirName+"/"+schema, len(record), func(ctx context.Context) error {
+		return s.API.CreateRecord(ctx, schema, record)
+	})
+}
+
+func (s *stagingAPI) UpdateRecord(ctx context.Context, schema, id string, record json.RawMessage) error {
+	record = bytes.Clone(record)
+	return s.record(ctx, "update_record", recordPath(schema, id), len(record), func(ctx context.Context) error {
+		return s.API.UpdateRecord(ctx, schema, id, record)
+	})
+}
+
+func (s *stagingAPI) DeleteRecord(ctx context.Context, schema, id string) error {
+	return s.record(ctx, "delete_record", recordPath(schema, id), -1, func(ctx context.Context) error {
+		return s.API.DeleteRecord(ctx, schema, id)
+	})
+}
+
+func (s *stagingAPI) SetACL(ctx context.Context, schema, id string, acl monkapi.ACL) error {
+	return s.record(ctx, "set_acl", recordPath(schema, id), -1, func(ctx context.Context) error {
+		return s.API.SetACL(ctx, schema, id, acl)
+	})
+}
+
+// record queues or makes a change that only returns an error
+func (s *stagingAPI) record(ctx context.Context, op, path string, size int, change func(context.Context) error) error {
+	if s.stage(stagedChange{op: op, path: path, size: size, send: change}) {
+		return nil
+	}
+	return change(ctx)
+}
+
+// forgetStaged drops what is cached about the paths of changes that were
+// committed or discarded, as it was cached while they were queued
+func (n *MonkFS) forgetStaged(changes []stagedChange) {
+	for _, c := range changes {
+		n.invalidate(c.path)
+		if c.destination != "" {
+			n.invalidate(c.destination)
+		}
+	}
+}
+
+// dryRunCommand runs a command written to /.monk/dryrun: "on", "commit"
+// or "discard". A commit that fails returns the error of the change that
+// failed, which is also logged to /.monk/errors.log.
+func (n *MonkFS) dryRunCommand(ctx context.Context, cmd string) syscall.Errno {
+	ctx, cancel := n.withDeadline(ctx, opWrite)
+	defer cancel()
+
+	switch cmd {
+	case "on":
+		n.staging.start()
+	case "commit":
+		sent, err := n.staging.commit(ctx)
+		n.forgetStaged(sent)
+		if err != nil {
+			return n.apiErrno("/"+controlDirName+"/"+dryRunFileName, err)
+		}
+	case "discard":
+		n.forgetStaged(n.staging.discard())
+	default:
+		return syscall.EINVAL
+	}
+	return 0
+}
@@ -0,0 +1,77 @@
+package monkfs
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+// encryptedMagic starts every encrypted file, so content stored before
+// encryption was enabled can still be read
+var encryptedMagic = []byte("MONKENC1")
+
+// errDecrypt reports content that carries the encryption header but does
+// not open with the mount's key, because it was encrypted with another
+// key or altered on the server
+var errDecrypt = errors.New("encrypted content does not match the key")
+
+// ContentCipher encrypts file content with AES-256-GCM before it is stored
+// and decrypts it after it is retrieved, so the server only ever holds
+// ciphertext. Names, sizes and other metadata are not encrypted.
+//
+// Stored content is the magic, a random nonce, then the sealed content.
+type ContentCipher struct {
+	aead cipher.AEAD
+}
+
+// NewContentCipher derives the content key from secret, which should hold
+// at least 32 random bytes
+func NewContentCipher(secret []byte) (*ContentCipher, error) {
+	if len(secret) < 16 {
+		return nil, errors.New("encryption key is too short: want at least 16 bytes, ideally 32 random ones")
+	}
+	key, err := hkdf.Key(sha256.New, secret, nil, "monk-fuse content encryption", 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &ContentCipher{aead: aead}, nil
+}
+
+// seal encrypts plaintext for storing
+func (c *ContentCipher) seal(plaintext []byte) []byte {
+	out := make([]byte, len(encryptedMagic)+c.aead.NonceSize(), len(encryptedMagic)+c.aead.NonceSize()+len(plaintext)+c.aead.Overhead())
+	copy(out, encryptedMagic)
+	rand.Read(out[len(encryptedMagic):])
+	return c.aead.Seal(out, out[len(encryptedMagic):], plaintext, nil)
+}
+
+// open decrypts retrieved content. Content without the encryption header
+// was stored in the clear and is returned as is.
+func (c *ContentCipher) open(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, encryptedMagic) {
+		return data, nil
+	}
+	data = data[len(encryptedMagic):]
+	if len(data) < c.aead.NonceSize() {
+		return nil, fmt.Errorf("%w: truncated", errDecrypt)
+	}
+	nonce, sealed := data[:c.aead.NonceSize()], data[c.aead.NonceSize():]
+	plaintext, err := c.aead.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return nil, errDecrypt
+	}
+	return plaintext, nil
+}
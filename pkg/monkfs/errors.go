@@ -1,8 +1,17 @@
 package monkfs
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
 	"syscall"
+	"time"
 
+	"github.com/ianzepp/monk-api-fuse/internal/cache"
 	"github.com/ianzepp/monk-api-fuse/pkg/monkapi"
 )
 
@@ -12,6 +21,19 @@ func HTTPErrorToErrno(err error) syscall.Errno {
 		return 0
 	}
 
+	// Fail fast while the API is unreachable; callers may retry
+	if errors.Is(err, monkapi.ErrUnavailable) {
+		return syscall.EAGAIN
+	}
+	// Audit-only mode logged the change instead of making it
+	if errors.Is(err, errAuditOnly) {
+		return syscall.EROFS
+	}
+	// The operation ran out of its deadline
+	if errors.Is(err, context.DeadlineExceeded) {
+		return syscall.ETIMEDOUT
+	}
+
 	apiErr, ok := err.(*monkapi.APIError)
 	if !ok {
 		return syscall.EIO
@@ -32,12 +54,124 @@ func HTTPErrorToErrno(err error) syscall.Errno {
 			return syscall.EISDIR
 		case "WILDCARDS_NOT_ALLOWED":
 			return syscall.EINVAL
+		case "PATH_TOO_LONG", "NAME_TOO_LONG":
+			return syscall.ENAMETOOLONG
 		default:
 			return syscall.EINVAL
 		}
 	case 409: // RECORD_EXISTS
 		return syscall.EEXIST
+	case 422: // VALIDATION_FAILED
+		return syscall.EINVAL
+	case 423: // LOCKED
+		return syscall.EWOULDBLOCK
 	default:
 		return syscall.EIO
 	}
 }
+
+// errorsSuffix names the virtual sibling file holding validation details
+const errorsSuffix = ".errors"
+
+// errorTTL is how long the last error of a path is remembered
+const errorTTL = time.Hour
+
+// errorLog records the most recent API error seen for each path, plus a
+// bounded history of formatted entries for /.monk/errors.log. The errors
+// of at most max paths are kept, each for errorTTL, so paths that fail
+// once are not remembered for the life of the mount.
+type errorLog struct {
+	last       *cache.Store[string]
+	validation *cache.Store[string]
+
+	mu      sync.Mutex
+	history []string
+	max     int
+}
+
+// newErrorLog creates an error log keeping at most max paths and max
+// history entries
+func newErrorLog(max int) *errorLog {
+	return &errorLog{
+		last:       cache.NewStore[string](errorTTL, max),
+		validation: cache.NewStore[string](errorTTL, max),
+		max:        max,
+	}
+}
+
+// Record stores err as the last error for path
+func (l *errorLog) Record(path string, err error) {
+	msg := err.Error()
+	if apiErr, ok := err.(*monkapi.APIError); ok {
+		msg = fmt.Sprintf("%s: %s", apiErr.ErrorCode, apiErr.Message)
+	}
+
+	l.last.Set(path, msg)
+	if monkapi.IsValidation(err) {
+		l.validation.Set(path, formatValidation(err.(*monkapi.APIError)))
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.history = append(l.history, fmt.Sprintf("%s %s %s", time.Now().UTC().Format(time.RFC3339), path, msg))
+	if len(l.history) > l.max {
+		l.history = l.history[len(l.history)-l.max:]
+	}
+}
+
+// Last returns the last error recorded for path, or "" if none
+func (l *errorLog) Last(path string) string {
+	msg, _ := l.last.Get(path)
+	return msg
+}
+
+// Clear forgets the last error for path after a successful operation
+func (l *errorLog) Clear(path string) {
+	l.last.Delete(path)
+	l.validation.Delete(path)
+}
+
+// Validation returns the validation report for a rejected write to path,
+// or "" if the last write was not rejected
+func (l *errorLog) Validation(path string) string {
+	report, _ := l.validation.Get(path)
+	return report
+}
+
+// formatValidation renders a validation failure with its details indented
+// so it can be read next to the file being edited
+func formatValidation(apiErr *monkapi.APIError) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %s\n", apiErr.ErrorCode, apiErr.Message)
+	if len(apiErr.Details) > 0 && string(apiErr.Details) != "null" {
+		var pretty bytes.Buffer
+		if err := json.Indent(&pretty, apiErr.Details, "", "  "); err == nil {
+			b.Write(pretty.Bytes())
+		} else {
+			b.Write(apiErr.Details)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// Bytes renders the error history, one entry per line
+func (l *errorLog) Bytes() []byte {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.history) == 0 {
+		return []byte{}
+	}
+	return []byte(strings.Join(l.history, "\n") + "\n")
+}
+
+// apiErrno records a failed API call against path and maps it to an errno.
+// Not-found errors are expected during lookups and are not recorded.
+func (n *MonkFS) apiErrno(path string, err error) syscall.Errno {
+	if !monkapi.IsNotFound(err) {
+		n.errLog.Record(path, err)
+	}
+	return HTTPErrorToErrno(err)
+}
@@ -0,0 +1,76 @@
+package monkfs
+
+import (
+	"context"
+	"strings"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/ianzepp/monk-api-fuse/pkg/monkapi"
+)
+
+// xattrFieldPrefix addresses single fields of a record, e.g.
+// user.monk.field.email, through the File API's field paths
+const xattrFieldPrefix = "user.monk.field."
+
+// fieldPath returns the File API path of a field of the node's record
+func (n *MonkFS) fieldPath(ctx context.Context, field string) (string, syscall.Errno) {
+	if field == "" || strings.Contains(field, "/") {
+		return "", syscall.Errno(fuse.ENOATTR)
+	}
+
+	path := n.getPath()
+	stat := n.cache.Get(path)
+	if stat == nil || stat.APIContext == nil {
+		var err error
+		stat, err = n.apiClient.Stat(ctx, path, "api_context")
+		if err != nil {
+			return "", n.apiErrno(path, err)
+		}
+	}
+
+	schema, id := recordIdentity(stat.APIContext)
+	if schema == "" || id == "" || contextString(stat.APIContext, "field_name") != "" {
+		return "", syscall.Errno(fuse.ENOATTR)
+	}
+	return "/data/" + schema + "/" + id + "/" + field, 0
+}
+
+// getFieldXattr reads one field of the node's record
+func (n *MonkFS) getFieldXattr(ctx context.Context, field string, dest []byte) (uint32, syscall.Errno) {
+	path, errno := n.fieldPath(ctx, field)
+	if errno != 0 {
+		return 0, errno
+	}
+
+	value, err := n.retrieve(ctx, path, monkapi.RetrieveOptions{})
+	if err != nil {
+		if monkapi.IsNotFound(err) {
+			return 0, syscall.Errno(fuse.ENOATTR)
+		}
+		return 0, n.apiErrno(path, err)
+	}
+	return copyXattr(dest, value)
+}
+
+// setFieldXattr writes one field of the node's record, as writing the
+// field's file under --expand-fields would
+func (n *MonkFS) setFieldXattr(ctx context.Context, field string, data []byte) syscall.Errno {
+	if n.pattern {
+		return syscall.EROFS
+	}
+	path, errno := n.fieldPath(ctx, field)
+	if errno == syscall.Errno(fuse.ENOATTR) {
+		return syscall.ENOTSUP
+	}
+	if errno != 0 {
+		return errno
+	}
+
+	if err := n.store(ctx, path, data); err != nil {
+		return n.apiErrno(path, err)
+	}
+	n.invalidate(n.getPath())
+	n.invalidate(path)
+	return 0
+}
@@ -1,17 +1,24 @@
 package monkfs
 
 import (
+	"bytes"
 	"context"
-	"encoding/json"
+	"crypto/sha256"
+	"fmt"
 	"hash/fnv"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/hanwen/go-fuse/v2/fs"
 	"github.com/hanwen/go-fuse/v2/fuse"
 	"github.com/ianzepp/monk-api-fuse/internal/cache"
+	"github.com/ianzepp/monk-api-fuse/internal/traverse"
 	"github.com/ianzepp/monk-api-fuse/pkg/monkapi"
+	"golang.org/x/sys/unix"
 )
 
 // parseMonkTimestamp converts ISO 8601 (RFC3339) format to Unix timestamp
@@ -21,24 +28,265 @@ func parseMonkTimestamp(ts string) uint64 {
 	}
 	// Parse ISO 8601: 2025-11-17T19:26:40Z
 	t, err := time.Parse(time.RFC3339, ts)
-	if err != nil {
+	if err != nil || t.Unix() < 0 {
 		return 0
 	}
 	return uint64(t.Unix())
 }
 
+// Options configures optional filesystem behavior
+type Options struct {
+	// DataAPI serves /data from the record-oriented Data API as
+	// /data/<schema>/<record-id>.json instead of the File API
+	DataAPI bool
+
+	// ExpandFields additionally presents each Data API record as a
+	// directory of individually readable and writable field files
+	ExpandFields bool
+
+	// Wildcards forwards lookups of glob-like names (e.g. *admin*) as
+	// pattern list requests instead of failing with EINVAL
+	Wildcards bool
+
+	// PrettyJSON re-indents JSON documents on read and compacts them on
+	// write, leaving the stored representation unchanged
+	PrettyJSON bool
+
+	// VerifyReads checks downloaded content against the server-provided
+	// SHA-256 checksum and fails reads with EIO on mismatch
+	VerifyReads bool
+
+	// Encryption encrypts file content before it is stored and decrypts it
+	// after it is retrieved; nil stores content as is. Encrypted files are
+	// read whole, with direct I/O, since the sizes the API reports are
+	// those of the ciphertext.
+	Encryption *ContentCipher
+
+	// Binary transports content base64-encoded so binary files and
+	// arbitrary bytes round-trip exactly
+	Binary bool
+
+	// DirectIO opens files with FOPEN_DIRECT_IO instead of
+	// FOPEN_KEEP_CACHE, so every read reaches the API and sees writes made
+	// through other mounts, at the cost of throughput
+	DirectIO bool
+
+	// RecursiveList fetches a directory's whole subtree in one list request
+	// on first access and serves later listings and stats below it from
+	// the snapshot
+	RecursiveList bool
+
+	// DeferUnlink keeps an unlinked file on the server until its last open
+	// handle is closed, so programs holding it open can still read it
+	DeferUnlink bool
+
+	// Locks forwards flock() to server-side advisory locks, so processes
+	// on different machines can coordinate access to a file, and keeps
+	// fcntl() byte-range locks for processes using this mount
+	Locks bool
+
+	// EscalateLocks additionally holds a server-side whole-file lock while
+	// any byte-range lock is held on a file
+	EscalateLocks bool
+
+	// WriteLeases takes a short server-side lease when a file is opened for
+	// writing, held until the file is closed
+	WriteLeases bool
+
+	// FileMode and DirMode are the permission bits of files and
+	// directories for which the API reports no permissions; zero means
+	// 0644 and 0755
+	FileMode uint32
+	DirMode  uint32
+
+	// Umask clears permission bits from every file and directory, so a
+	// shared mount can be locked down without server changes
+	Umask uint32
+
+	// Atime controls whether access times are fetched and written back;
+	// empty fetches them but never writes them
+	Atime AtimePolicy
+
+	// Owners maps record owners from api_context to local uids
+	Owners *OwnerMap
+
+	// Groups presents a role's record access as the group permission bits
+	Groups *GroupAccess
+
+	// Warm lists subtrees to prefetch metadata for in the background after
+	// mounting
+	Warm []string
+
+	// CacheEntries caps how many paths have their metadata cached, evicting
+	// the least recently used; zero is unbounded
+	CacheEntries int
+
+	// CacheMemoryLimit bounds the estimated memory of the metadata,
+	// listing, not-found and stale content caches together, in bytes; each
+	// evicts its least recently used entries in proportion to its share.
+	// Zero is unbounded.
+	CacheMemoryLimit int64
+
+	// CompressCache deflates the file content kept for StaleIfError, so
+	// several times more JSON fits under CacheMemoryLimit for a little CPU
+	// on each stale read. It has no effect without StaleIfError.
+	CompressCache bool
+
+	// StaleWhileRevalidate answers stat calls from metadata that expired no
+	// longer ago than this, refreshing it in the background; zero waits
+	// for the API once metadata expires
+	StaleWhileRevalidate time.Duration
+
+	// StaleIfError answers with expired cached metadata, listings and
+	// small files' content when the API fails transiently, instead of EIO
+	StaleIfError bool
+
+	// CachePolicy chooses between keeping and bypassing the page cache per
+	// file; nil keeps the cache for all files
+	CachePolicy *CachePolicy
+
+	// MaxOpenFiles caps how many files may be open at once; opens beyond
+	// it fail with EMFILE. Zero is unbounded.
+	MaxOpenFiles int
+
+	// CaseInsensitive finds a file looked up with the wrong case by its
+	// name in the parent's listing, as case-insensitive platforms expect
+	CaseInsensitive bool
+
+	// Deadlines bound the total time of each kind of operation
+	Deadlines Deadlines
+
+	// Audit records every change made through the mount; nil records none
+	Audit *AuditLog
+
+	// AuditOnly records changes in Audit without sending them to the API,
+	// failing them with EROFS, to see what a script would change
+	AuditOnly bool
+
+	// DryRun starts the mount in dry-run mode, queueing changes until they
+	// are committed or discarded through /.monk/dryrun
+	DryRun bool
+
+	// Protect lists glob patterns of paths that may only be deleted after
+	// the delete is approved through /.monk/approve
+	Protect []string
+
+	// Trash moves deleted files to /.Trash and keeps them there this long
+	// before PurgeTrash deletes them; zero deletes files straight away
+	Trash time.Duration
+}
+
+// missingTTL bounds how long a path found not to exist is trusted to stay
+// missing; other clients may create it at any time
+const missingTTL = 5 * time.Second
+
+// missingEntries bounds the not-found cache when Options.CacheEntries
+// doesn't. Expired misses are not swept, and a scan of names that don't
+// exist, like a build probing include paths, would otherwise grow it
+// without limit; a miss evicted early only costs one more stat.
+const missingEntries = 10000
+
 // MonkFS implements the FUSE filesystem interface
 type MonkFS struct {
 	fs.Inode
-	apiClient *monkapi.Client
-	cache     *cache.MetadataCache
+	apiClient    monkapi.API
+	cache        *cache.MetadataCache
+	listings     *cache.ListingCache
+	missing      *cache.Store[struct{}] // paths recently found not to exist
+	budget       *cache.Budget          // nil unless Options.CacheMemoryLimit
+	stale        *staleState            // nil unless Options.StaleIfError
+	revalidating *revalidator
+	warmProgress *atomic.Pointer[traverse.Progress]
+	entries      *entryCount
+	errLog       *errorLog
+	subtrees     *subtreeCache
+	inodes       *inodeTable
+	openFiles    *openFileTable
+	rangeLocks   *rangeLockTable
+	staging      *stagingAPI
+	protect      *protection // nil unless Options.Protect
+	names        *nameTable
+	opts         *Options
+
+	// apiPath overrides the inode tree path for nodes reached through a
+	// wildcard directory, whose real location differs from their mount
+	// path. It is set before the node is added to the tree; Rename changes
+	// it afterwards, under pathMu.
+	pathMu  sync.RWMutex
+	apiPath string
+	pattern bool
 }
 
 // NewMonkFS creates a new Monk FUSE filesystem
-func NewMonkFS(apiClient *monkapi.Client) *MonkFS {
+func NewMonkFS(apiClient monkapi.API, opts Options) *MonkFS {
+	if opts.Audit != nil {
+		apiClient = &auditAPI{API: apiClient, log: opts.Audit, only: opts.AuditOnly}
+	}
+	// Outside the audit wrapper, so changes are logged when committed
+	staging := &stagingAPI{API: apiClient, on: opts.DryRun}
+	maxMissing := opts.CacheEntries
+	if maxMissing == 0 {
+		maxMissing = missingEntries
+	}
+	n := &MonkFS{
+		apiClient:    staging,
+		cache:        cache.NewMetadataCache(30*time.Second, opts.CacheEntries),
+		listings:     cache.NewListingCache(listingTTL),
+		missing:      cache.NewStore[struct{}](missingTTL, maxMissing),
+		stale:        newStaleState(&opts),
+		revalidating: newRevalidator(),
+		warmProgress: new(atomic.Pointer[traverse.Progress]),
+		entries:      new(entryCount),
+		errLog:       newErrorLog(1000),
+		subtrees:     newSubtreeCache(),
+		inodes:       newInodeTable(),
+		openFiles:    newOpenFileTable(opts.MaxOpenFiles),
+		rangeLocks:   newRangeLockTable(),
+		staging:      staging,
+		protect:      newProtection(opts.Protect),
+		names:        newNameTable(),
+		opts:         &opts,
+	}
+	if opts.CacheMemoryLimit > 0 {
+		n.shareBudget(cache.NewBudget(opts.CacheMemoryLimit))
+	}
+	return n
+}
+
+// shareBudget puts the caches of a new filesystem under one memory budget
+func (n *MonkFS) shareBudget(b *cache.Budget) {
+	n.budget = b
+	n.cache.ShareBudget(b)
+	n.listings.ShareBudget(b)
+	n.missing.ShareBudget(b, func(struct{}) int64 { return 0 })
+	n.subtrees.shareBudget(b)
+	if n.stale != nil {
+		n.stale.contents.ShareBudget(b, func(content []byte) int64 { return int64(cap(content)) })
+		n.stale.served.ShareBudget(b, func(time.Time) int64 { return 0 })
+	}
+}
+
+// newChild creates a node sharing this node's client and caches
+func (n *MonkFS) newChild() *MonkFS {
 	return &MonkFS{
-		apiClient: apiClient,
-		cache:     cache.NewMetadataCache(30 * time.Second),
+		apiClient:    n.apiClient,
+		cache:        n.cache,
+		listings:     n.listings,
+		missing:      n.missing,
+		budget:       n.budget,
+		stale:        n.stale,
+		revalidating: n.revalidating,
+		warmProgress: n.warmProgress,
+		entries:      n.entries,
+		errLog:       n.errLog,
+		subtrees:     n.subtrees,
+		inodes:       n.inodes,
+		openFiles:    n.openFiles,
+		rangeLocks:   n.rangeLocks,
+		staging:      n.staging,
+		protect:      n.protect,
+		names:        n.names,
+		opts:         n.opts,
 	}
 }
 
@@ -46,256 +294,885 @@ var _ = (fs.NodeReaddirer)((*MonkFS)(nil))
 var _ = (fs.NodeGetattrer)((*MonkFS)(nil))
 var _ = (fs.NodeOpener)((*MonkFS)(nil))
 var _ = (fs.NodeLookuper)((*MonkFS)(nil))
+var _ = (fs.NodeGetxattrer)((*MonkFS)(nil))
+var _ = (fs.NodeListxattrer)((*MonkFS)(nil))
+var _ = (fs.NodeSetattrer)((*MonkFS)(nil))
 
 // Readdir implements directory listing
 func (n *MonkFS) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
+	ctx, cancel := n.withDeadline(ctx, opMetadata)
+	defer cancel()
+
+	if n.pattern {
+		return n.readdirPattern(ctx)
+	}
+
 	path := n.getPath()
 
-	// Use pick=entries to get just the array (60% bandwidth reduction)
-	resp, err := n.apiClient.List(ctx, path, monkapi.ListOptions{
-		LongFormat: true,
-	}, "entries")
+	listing, err := n.listEntries(ctx, path)
 	if err != nil {
-		return nil, HTTPErrorToErrno(err)
+		var ok bool
+		if listing, ok = n.staleListing(path, err); !ok {
+			return nil, n.apiErrno(path, err)
+		}
 	}
 
 	entries := []fuse.DirEntry{}
-	for _, entry := range resp.Entries {
+	if path == "/" {
+		entries = append(entries, fuse.DirEntry{
+			Name: controlDirName,
+			Mode: syscall.S_IFDIR | 0555,
+		}, fuse.DirEntry{
+			Name: metaDirName,
+			Mode: syscall.S_IFDIR | 0755,
+		})
+	}
+	if _, ok := schemaForDir(path); ok {
+		entries = append(entries, fuse.DirEntry{
+			Name: schemaFileName,
+			Mode: syscall.S_IFREG | 0444,
+		})
+	}
+	for _, entry := range listing {
+		if n.openFiles.isDeleted(n.entryPath(entry.Name)) {
+			continue
+		}
+		name := n.names.display(entry.Name)
 		mode := parseFileMode(entry.FilePermissions, entry.FileType)
 		entries = append(entries, fuse.DirEntry{
-			Name: entry.Name,
+			Name: name,
 			Mode: mode,
-			Ino:  hashPath(entry.Path),
+			Ino:  n.entryInode(entry.Path, entry.APIContext),
 		})
+
+		// Surface rejected writes as a sibling file describing the failure
+		if n.errLog.Validation(n.entryPath(entry.Name)) != "" {
+			entries = append(entries, fuse.DirEntry{
+				Name: name + errorsSuffix,
+				Mode: syscall.S_IFREG | 0444,
+			})
+		}
 	}
 
+	n.prefetchStats(ctx, listing)
+
 	return fs.NewListDirStream(entries), 0
 }
 
+// prefetchStats caches metadata for listed entries in one batch. The kernel
+// follows a listing with a lookup per entry (READDIRPLUS, ls -l), which
+// would otherwise be a serial storm of stat requests.
+func (n *MonkFS) prefetchStats(ctx context.Context, entries []monkapi.FileEntry) {
+	paths := make([]string, 0, len(entries))
+	contexts := make(map[string]map[string]interface{}, len(entries))
+	for _, entry := range entries {
+		if path := n.entryPath(entry.Name); n.cache.Get(path) == nil {
+			paths = append(paths, path)
+			contexts[path] = entry.APIContext
+		}
+	}
+
+	gen := n.cache.Generation()
+	for _, result := range n.apiClient.StatBatch(ctx, paths, n.statPick()) {
+		if result.Err == nil {
+			// A server may leave api_context out of a stat; keep the
+			// listing's so lookups derive the same inode as Readdir
+			if result.Stat.APIContext == nil {
+				result.Stat.APIContext = contexts[result.Path]
+			}
+			n.cache.SetSince(result.Path, result.Stat, gen)
+		}
+	}
+}
+
 // Getattr implements stat() functionality
 func (n *MonkFS) Getattr(ctx context.Context, fh fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
-	path := n.getPath()
+	ctx, cancel := n.withDeadline(ctx, opMetadata)
+	defer cancel()
+
+	if n.pattern {
+		out.Attr.Mode = syscall.S_IFDIR | 0555
+		return 0
+	}
+
+	path := n.openPath(fh)
 
 	// Check cache first
-	if cached := n.cache.Get(path); cached != nil {
-		fillAttr(&out.Attr, cached)
+	if cached := n.cachedStat(path); cached != nil {
+		n.fillAttr(&out.Attr, cached)
+		n.fillNlink(&out.Attr, path)
+		n.fillPendingSize(&out.Attr, fh)
 		return 0
 	}
 
-	// Use pick=file_metadata to get only metadata (40-50% bandwidth reduction)
-	resp, err := n.apiClient.Stat(ctx, path, "file_metadata")
+	// Pick only metadata and the record identity inodes are keyed by
+	gen := n.cache.Generation()
+	resp, err := n.apiClient.Stat(ctx, path, n.statPick())
 	if err != nil {
 		if monkapi.IsNotFound(err) {
 			return syscall.ENOENT
 		}
-		return HTTPErrorToErrno(err)
+		if resp = n.staleStat(path, err); resp == nil {
+			return n.apiErrno(path, err)
+		}
+	} else {
+		// Cache the result, unless it was invalidated meanwhile
+		n.cache.SetSince(path, resp, gen)
+		n.markFresh(path)
 	}
 
-	// Cache the result
-	n.cache.Set(path, resp)
-
-	fillAttr(&out.Attr, resp)
+	n.fillAttr(&out.Attr, resp)
+	n.fillNlink(&out.Attr, path)
+	n.fillPendingSize(&out.Attr, fh)
 	return 0
 }
 
 // Lookup looks up a child node by name
 func (n *MonkFS) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
-	path := n.getPath() + "/" + name
+	ctx, cancel := n.withDeadline(ctx, opMetadata)
+	defer cancel()
+
+	if n.IsRoot() {
+		switch name {
+		case controlDirName:
+			return n.newControlDir(ctx, out), 0
+		case metaDirName:
+			return n.newMetaDir(ctx, &n.Inode, "/"+metaDirName, "", out), 0
+		case dataDirName:
+			if n.opts.DataAPI {
+				return n.newDataDir(ctx, &n.Inode, "", out), 0
+			}
+		}
+	}
+
+	if name == schemaFileName {
+		if schema, ok := schemaForDir(n.getPath()); ok {
+			return n.newSchemaFile(ctx, &n.Inode, schema, out)
+		}
+	}
+
+	if n.pattern {
+		return n.lookupPattern(ctx, name, out)
+	}
+	if n.opts.Wildcards && isPattern(name) {
+		return n.newPatternDir(ctx, name, out), 0
+	}
+
+	if isShortened(name) && !n.names.known(name) {
+		// Shortened names map back through their listing
+		if listing, err := n.listEntries(ctx, n.getPath()); err == nil {
+			for _, entry := range listing {
+				n.names.display(entry.Name)
+			}
+		}
+	}
+	path := n.childPath(name)
 
-	resp, err := n.apiClient.Stat(ctx, path, "file_metadata")
+	if strings.HasSuffix(name, errorsSuffix) {
+		target := strings.TrimSuffix(path, errorsSuffix)
+		if n.errLog.Validation(target) != "" {
+			return n.newErrorsFile(ctx, target, out), 0
+		}
+	}
+
+	if n.openFiles.isDeleted(path) {
+		return nil, syscall.ENOENT
+	}
+	if errno := n.checkPathLength(path); errno != 0 {
+		return nil, errno
+	}
+
+	resp, errno := n.lookupStat(ctx, path)
+	pinned := false
+	if errno == syscall.ENOENT && n.opts.CaseInsensitive {
+		if folded, ok := n.foldedPath(ctx, name); ok {
+			path, pinned = folded, true
+			resp, errno = n.lookupStat(ctx, path)
+		}
+	}
+	if errno != 0 {
+		return nil, errno
+	}
+
+	// Create child inode. One found under other casing keeps its real
+	// path, as the kernel knows it by the name looked up.
+	node := n.newChild()
+	if n.realPath() != "" || pinned {
+		node.apiPath = path
+	}
+	child := n.NewInode(ctx, node, n.stableAttr(parseStatMode(resp), entryKey(path, resp.APIContext)))
+
+	n.fillAttr(&out.Attr, resp)
+	n.fillNlink(&out.Attr, path)
+	return child, 0
+}
+
+// lookupStat returns the metadata of a path being looked up
+func (n *MonkFS) lookupStat(ctx context.Context, path string) (*monkapi.StatResponse, syscall.Errno) {
+	if _, ok := n.missing.Get(path); ok {
+		return nil, syscall.ENOENT
+	}
+
+	// Readdir prefetches child metadata, so lookups after a listing
+	// are usually served from the cache
+	if resp := n.cachedStat(path); resp != nil {
+		return resp, 0
+	}
+	gen := n.cache.Generation()
+	resp, err := n.apiClient.Stat(ctx, path, n.statPick())
 	if err != nil {
 		if monkapi.IsNotFound(err) {
+			// Editors and shells probe for the same missing names
+			// repeatedly
+			n.missing.Set(path, struct{}{})
 			return nil, syscall.ENOENT
 		}
-		return nil, HTTPErrorToErrno(err)
+		if resp = n.staleStat(path, err); resp == nil {
+			return nil, n.apiErrno(path, err)
+		}
+		return resp, 0
+	}
+	n.cache.SetSince(path, resp, gen)
+	n.markFresh(path)
+	return resp, 0
+}
+
+// Setattr implements chmod, chown, utimens, truncate and ftruncate. An
+// open handle is resized in its write buffer and stored on flush; a path
+// truncate, a mode or owner change and new times are applied through the
+// API immediately.
+func (n *MonkFS) Setattr(ctx context.Context, fh fs.FileHandle, in *fuse.SetAttrIn, out *fuse.AttrOut) syscall.Errno {
+	ctx, cancel := n.withDeadline(ctx, opWrite)
+	defer cancel()
+
+	uid, setUID := in.GetUID()
+	gid, setGID := in.GetGID()
+	if setUID || setGID {
+		if errno := n.chown(ctx, uid, gid, setUID, setGID); errno != 0 {
+			return errno
+		}
+	}
+	if mode, ok := in.GetMode(); ok {
+		if errno := n.chmod(ctx, mode); errno != 0 {
+			return errno
+		}
+	}
+	atime, _ := in.GetATime()
+	mtime, _ := in.GetMTime()
+	if !atime.IsZero() || !mtime.IsZero() {
+		if errno := n.utimens(ctx, atime, mtime); errno != 0 {
+			return errno
+		}
+	}
+	if size, ok := in.GetSize(); ok {
+		if errno := n.truncate(ctx, fh, int(size)); errno != 0 {
+			return errno
+		}
 	}
+	return n.Getattr(ctx, fh, out)
+}
 
-	// Cache the result
-	n.cache.Set(path, resp)
+// truncate resizes the file to size, zero-filling when it grows
+func (n *MonkFS) truncate(ctx context.Context, fh fs.FileHandle, size int) syscall.Errno {
+	if mfh, ok := fh.(*MonkFileHandle); ok {
+		mfh.mu.Lock()
+		defer mfh.mu.Unlock()
 
-	// Create child inode
-	child := n.NewInode(ctx, &MonkFS{
-		apiClient: n.apiClient,
-		cache:     n.cache,
-	}, fs.StableAttr{
-		Mode: parseStatMode(resp),
-		Ino:  hashPath(path),
-	})
+		if errno := mfh.loadWriteCache(ctx); errno != 0 {
+			return errno
+		}
+		mfh.resize(size)
+		mfh.dirty = true
+		return 0
+	}
 
-	fillAttr(&out.Attr, resp)
-	return child, 0
+	path := n.getPath()
+	content, err := n.retrieve(ctx, path, monkapi.RetrieveOptions{})
+	if err != nil {
+		return n.apiErrno(path, err)
+	}
+	if size <= len(content) {
+		content = content[:size]
+	} else {
+		content = append(content, make([]byte, size-len(content))...)
+	}
+
+	if err := n.store(ctx, path, content); err != nil {
+		return n.apiErrno(path, err)
+	}
+	n.invalidate(path)
+	n.errLog.Clear(path)
+	return 0
 }
 
 // Open implements file open
 func (n *MonkFS) Open(ctx context.Context, flags uint32) (fs.FileHandle, uint32, syscall.Errno) {
+	ctx, cancel := n.withDeadline(ctx, opMetadata)
+	defer cancel()
+
 	path := n.getPath()
 
+	if !n.openFiles.reserve() {
+		n.errLog.Record(path, fmt.Errorf("TOO_MANY_OPEN_FILES: %d handles already open", n.opts.MaxOpenFiles))
+		return nil, 0, syscall.EMFILE
+	}
+
 	// Validate file exists (pick="" for minimal validation)
-	_, err := n.apiClient.Stat(ctx, path, "")
+	stat, err := n.apiClient.Stat(ctx, path, "")
 	if err != nil {
 		if monkapi.IsNotFound(err) {
+			n.openFiles.unreserve()
 			return nil, 0, syscall.ENOENT
 		}
-		return nil, 0, HTTPErrorToErrno(err)
+		if stat = n.staleStat(path, err); stat == nil {
+			n.openFiles.unreserve()
+			return nil, 0, n.apiErrno(path, err)
+		}
 	}
 
-	return &MonkFileHandle{
-		node: n,
-		path: path,
-	}, fuse.FOPEN_KEEP_CACHE, 0
+	// Pretty-printed content is larger than the stored size reported by
+	// Getattr, and decrypted content smaller, so the kernel must not trim
+	// reads to that size
+	fuseFlags := uint32(fuse.FOPEN_KEEP_CACHE)
+	if n.opts.DirectIO || n.opts.PrettyJSON || n.opts.Encryption != nil {
+		fuseFlags = fuse.FOPEN_DIRECT_IO
+	} else if n.opts.CachePolicy != nil && n.opts.CachePolicy.Mode(path, stat) == CacheDirect {
+		fuseFlags = fuse.FOPEN_DIRECT_IO
+	}
+
+	fh := &MonkFileHandle{
+		node:      n,
+		path:      path,
+		appending: flags&syscall.O_APPEND != 0,
+	}
+	if n.opts.WriteLeases && flags&syscall.O_ACCMODE != syscall.O_RDONLY {
+		fh.acquireLease(ctx)
+	}
+	n.openFiles.add(n.StableAttr().Ino, fh)
+	n.touchAtime(path, stat)
+	return fh, fuseFlags, 0
 }
 
-// MonkFileHandle represents an open file handle
+// MonkFileHandle represents an open file handle. The kernel may call into
+// one handle concurrently (readahead alongside writes), so its buffers are
+// guarded by mu.
 type MonkFileHandle struct {
-	node       *MonkFS
-	path       string
+	node *MonkFS
+
+	mu         sync.Mutex
+	path       string // follows renames of the open file
 	writeCache []byte
 	dirty      bool
+	unlinked   bool   // the file was unlinked; pending writes are dropped
+	appending  bool   // opened O_APPEND; writes go to the end of the buffer
+	content    []byte // whole-file view, loaded once by readWhole
+	lease      *remoteLock
+
+	// dirtyRanges are the parts of writeCache changed since it last matched
+	// the stored file, which patchBase says it did when loaded
+	dirtyRanges []byteRange
+	patchBase   bool
+
+	// storedSum is the SHA-256 of the content the server holds, as far as
+	// this handle knows, when storedSumOK
+	storedSum   [sha256.Size]byte
+	storedSumOK bool
+
+	// lockMu serializes lock requests, which may block for a long time,
+	// separately from mu
+	lockMu sync.Mutex
+	lock   *remoteLock
 }
 
 var _ = (fs.FileReader)((*MonkFileHandle)(nil))
 var _ = (fs.FileWriter)((*MonkFileHandle)(nil))
 var _ = (fs.FileFlusher)((*MonkFileHandle)(nil))
+var _ = (fs.FileLseeker)((*MonkFileHandle)(nil))
+var _ = (fs.FileAllocater)((*MonkFileHandle)(nil))
+var _ = (fs.FileReleaser)((*MonkFileHandle)(nil))
 
 // Read implements file reading
 func (fh *MonkFileHandle) Read(ctx context.Context, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
-	// Use pick=content to get just the file content (80% reduction for single fields!)
-	resp, err := fh.node.apiClient.Retrieve(ctx, fh.path, monkapi.RetrieveOptions{
-		StartOffset: int(off),
-		MaxBytes:    len(dest),
-	}, "content")
-	if err != nil {
-		return nil, HTTPErrorToErrno(err)
+	ctx, cancel := fh.node.withDeadline(ctx, opRead)
+	defer cancel()
+
+	fh.mu.Lock()
+
+	// Unflushed writes are only in the local buffer
+	if fh.writeCache != nil {
+		defer fh.mu.Unlock()
+		return fh.readBuffer(dest, off), 0
 	}
 
-	// Convert content to bytes
-	data := contentToBytes(resp.Content)
+	if fh.node.opts.PrettyJSON || fh.node.opts.VerifyReads || fh.node.opts.Encryption != nil {
+		defer fh.mu.Unlock()
+		return fh.readWhole(ctx, dest, off)
+	}
 
-	// Handle offset
-	if off >= int64(len(data)) {
-		return fuse.ReadResultData([]byte{}), 0
+	// Range reads touch no other handle state, so they run unlocked and
+	// concurrent readahead requests are fetched in parallel
+	path := fh.path
+	fh.mu.Unlock()
+	read, err := fh.node.retrieveInto(ctx, path, dest, off)
+	if err != nil {
+		content, ok := fh.node.staleContent(path, err)
+		if !ok {
+			return nil, fh.node.apiErrno(path, err)
+		}
+		read = copy(dest, content[min(off, int64(len(content))):])
+	} else if off == 0 && read < len(dest) {
+		// The whole file fit in one read
+		fh.node.keepContent(path, bytes.Clone(dest[:read]))
+		fh.node.markFresh(path)
 	}
 
-	return fuse.ReadResultData(data[off:]), 0
+	return fuse.ReadResultData(dest[:read]), 0
 }
 
-// Write implements file writing
-func (fh *MonkFileHandle) Write(ctx context.Context, data []byte, off int64) (uint32, syscall.Errno) {
-	// Initialize write cache on first write
-	if fh.writeCache == nil {
-		// Read existing content to initialize cache
-		resp, err := fh.node.apiClient.Retrieve(ctx, fh.path, monkapi.RetrieveOptions{}, "content")
+// readWhole serves reads from the complete file content, fetched once per
+// handle, for views that cannot be computed from byte ranges. fh.mu must be
+// held.
+func (fh *MonkFileHandle) readWhole(ctx context.Context, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	if fh.content == nil {
+		data, err := fh.node.retrieve(ctx, fh.path, monkapi.RetrieveOptions{})
 		if err != nil {
-			// If file doesn't exist, start with empty cache
-			if monkapi.IsNotFound(err) {
-				fh.writeCache = []byte{}
-			} else {
-				return 0, HTTPErrorToErrno(err)
+			// Content kept for staleness was verified when it was read
+			var ok bool
+			if data, ok = fh.node.staleContent(fh.path, err); !ok {
+				return nil, fh.node.apiErrno(fh.path, err)
 			}
 		} else {
-			fh.writeCache = contentToBytes(resp.Content)
+			// The server's checksum is of the ciphertext, which decrypting
+			// has already authenticated
+			if fh.node.opts.VerifyReads && fh.node.opts.Encryption == nil {
+				if errno := fh.node.verifyChecksum(ctx, fh.path, data); errno != 0 {
+					return nil, errno
+				}
+			}
+			fh.node.keepContent(fh.path, data)
+			fh.node.markFresh(fh.path)
+		}
+		if fh.node.opts.PrettyJSON {
+			data = prettyJSON(data)
 		}
+		fh.content = data
 	}
 
-	// Expand cache if necessary
-	newSize := int(off) + len(data)
-	if newSize > len(fh.writeCache) {
-		newCache := make([]byte, newSize)
-		copy(newCache, fh.writeCache)
-		fh.writeCache = newCache
+	if off >= int64(len(fh.content)) {
+		return fuse.ReadResultData([]byte{}), 0
+	}
+	end := off + int64(len(dest))
+	if end > int64(len(fh.content)) {
+		end = int64(len(fh.content))
+	}
+	return fuse.ReadResultData(fh.content[off:end]), 0
+}
+
+// readBuffer serves a read from the handle's pending write buffer. The
+// data is copied out, since the buffer may change once fh.mu is released.
+func (fh *MonkFileHandle) readBuffer(dest []byte, off int64) fuse.ReadResult {
+	if off >= int64(len(fh.writeCache)) {
+		return fuse.ReadResultData([]byte{})
+	}
+	n := copy(dest, fh.writeCache[off:])
+	return fuse.ReadResultData(dest[:n])
+}
+
+// Write implements file writing
+func (fh *MonkFileHandle) Write(ctx context.Context, data []byte, off int64) (uint32, syscall.Errno) {
+	fh.mu.Lock()
+	defer fh.mu.Unlock()
+
+	if errno := fh.loadWriteCache(ctx); errno != 0 {
+		return 0, errno
+	}
+
+	// The kernel places appends at the size Getattr reported, which is not
+	// the content's length when it is shown pretty-printed or stored
+	// encrypted
+	if fh.appending {
+		off = int64(len(fh.writeCache))
+	}
+
+	// Expand cache if necessary; writing past EOF zero-fills the gap,
+	// as with a sparse local file
+	if newSize := int(off) + len(data); newSize > len(fh.writeCache) {
+		fh.resize(newSize)
 	}
 
 	// Write data at offset
 	copy(fh.writeCache[off:], data)
+	fh.markDirty(int(off), int(off)+len(data))
 	fh.dirty = true
 
 	return uint32(len(data)), 0
 }
 
-// Flush implements file flush (sync to API)
-func (fh *MonkFileHandle) Flush(ctx context.Context) syscall.Errno {
-	if !fh.dirty {
+// fallocKeepSize is FALLOC_FL_KEEP_SIZE; FUSE passes Linux fallocate modes
+const fallocKeepSize = 0x1
+
+// Allocate implements fallocate. There is no remote space to reserve, so
+// the default mode only extends the file with zeros and FALLOC_FL_KEEP_SIZE
+// is a no-op; hole punching and other modes are not supported.
+func (fh *MonkFileHandle) Allocate(ctx context.Context, off uint64, size uint64, mode uint32) syscall.Errno {
+	switch mode {
+	case 0:
+	case fallocKeepSize:
 		return 0
+	default:
+		return syscall.EOPNOTSUPP
 	}
 
-	// Store content to API
-	_, err := fh.node.apiClient.Store(ctx, fh.path, string(fh.writeCache), monkapi.StoreOptions{}, "")
+	fh.mu.Lock()
+	defer fh.mu.Unlock()
+
+	if errno := fh.loadWriteCache(ctx); errno != 0 {
+		return errno
+	}
+	if newSize := int(off + size); newSize > len(fh.writeCache) {
+		fh.resize(newSize)
+		fh.dirty = true
+	}
+	return 0
+}
+
+// loadWriteCache initializes the write buffer with the current content
+// on first modification. fh.mu must be held.
+func (fh *MonkFileHandle) loadWriteCache(ctx context.Context) syscall.Errno {
+	if fh.writeCache != nil {
+		return 0
+	}
+
+	existing, err := fh.node.retrieve(ctx, fh.path, monkapi.RetrieveOptions{})
 	if err != nil {
-		return HTTPErrorToErrno(err)
+		// If file doesn't exist, start with empty cache
+		if !monkapi.IsNotFound(err) {
+			return fh.node.apiErrno(fh.path, err)
+		}
+		fh.writeCache = []byte{}
+		return 0
+	}
+
+	fh.writeCache = existing
+	fh.storedSum, fh.storedSumOK = sha256.Sum256(existing), true
+	if fh.node.opts.PrettyJSON {
+		fh.writeCache = prettyJSON(fh.writeCache)
+	}
+	fh.dirtyRanges = nil
+	fh.patchBase = fh.node.storedAsShown()
+	return 0
+}
+
+// resize truncates or zero-extends the write buffer, growing capacity
+// geometrically so sequential appends do not copy the whole buffer on
+// every write
+func (fh *MonkFileHandle) resize(size int) {
+	oldSize := len(fh.writeCache)
+	if size <= oldSize {
+		fh.writeCache = fh.writeCache[:size]
+		return
+	}
+	fh.writeCache = slices.Grow(fh.writeCache, size-oldSize)[:size]
+	clear(fh.writeCache[oldSize:])
+	fh.markDirty(oldSize, size)
+}
+
+// Flush implements file flush (sync to API) on close(). FUSE doesn't say
+// which close of a shared handle is the last, so every one stores, also
+// under a write lease; closes with nothing pending store nothing.
+func (fh *MonkFileHandle) Flush(ctx context.Context) syscall.Errno {
+	ctx, cancel := fh.node.withDeadline(ctx, opWrite)
+	defer cancel()
+
+	return fh.sync(ctx)
+}
+
+// sync stores pending writes. Once stored, other handles open on the file
+// drop what they read before, so the last store is what every handle sees
+// afterwards.
+func (fh *MonkFileHandle) sync(ctx context.Context) syscall.Errno {
+	stored, errno := fh.flush(ctx)
+	if stored {
+		for _, other := range fh.node.openFiles.list(fh.node.StableAttr().Ino) {
+			if other != fh {
+				other.refresh()
+			}
+		}
+	}
+	return errno
+}
+
+// flush stores pending writes, reporting whether anything was stored
+func (fh *MonkFileHandle) flush(ctx context.Context) (bool, syscall.Errno) {
+	fh.mu.Lock()
+	defer fh.mu.Unlock()
+
+	if !fh.dirty {
+		return false, 0
+	}
+	if fh.unlinked {
+		// Storing would recreate a file that no longer exists by this name
+		fh.dirty = false
+		fh.writeCache = nil
+		return false, 0
 	}
 
-	// Clear cache after successful write
+	content := fh.writeCache
+	if fh.node.opts.PrettyJSON {
+		content = compactJSON(content)
+	}
+	sum := sha256.Sum256(content)
+	if fh.unchanged(sum) {
+		fh.dirtyRanges = nil
+		fh.dirty = false
+		return false, 0
+	}
+
+	patched := false
+	if fh.patchable() {
+		var err error
+		if patched, err = fh.patch(ctx); err != nil {
+			return false, fh.node.apiErrno(fh.path, err)
+		}
+	}
+	if !patched {
+		// Store content to API
+		if err := fh.node.store(ctx, fh.path, content); err != nil {
+			return false, fh.node.apiErrno(fh.path, err)
+		}
+	}
+
+	// Clear cache after successful write; the buffer now matches the
+	// stored file
+	fh.dirtyRanges = nil
+	fh.patchBase = fh.node.storedAsShown()
+	fh.storedSum, fh.storedSumOK = sum, true
 	fh.dirty = false
-	fh.node.cache.Invalidate(fh.path)
+	fh.content = nil
+	fh.node.invalidate(fh.path)
+	fh.node.errLog.Clear(fh.path)
 
+	return true, 0
+}
+
+// refresh drops content read through this handle that another handle's
+// flush has superseded; unflushed writes are kept
+func (fh *MonkFileHandle) refresh() {
+	fh.mu.Lock()
+	defer fh.mu.Unlock()
+
+	fh.content = nil
+	if !fh.dirty {
+		fh.writeCache = nil
+	}
+	// Unflushed writes no longer apply to what is stored; they are stored
+	// whole, replacing the other handle's
+	fh.patchBase = false
+	fh.storedSumOK = false
+}
+
+// Release gives up the handle's lease, drops its locks and removes it from
+// the open-file table once the last file descriptor referring to it is
+// closed, and performs an unlink that was deferred until then
+func (fh *MonkFileHandle) Release(ctx context.Context) syscall.Errno {
+	fh.releaseLease(ctx)
+
+	fh.lockMu.Lock()
+	fh.unlock(ctx)
+	fh.lockMu.Unlock()
+	fh.node.rangeLocks.release(ctx, fh)
+
+	path := fh.node.openFiles.remove(fh.node.StableAttr().Ino, fh)
+	if path == "" {
+		return 0
+	}
+
+	if err := fh.node.remove(ctx, path); err != nil && !monkapi.IsNotFound(err) {
+		return fh.node.apiErrno(path, err)
+	}
+	fh.node.inodes.removedInode(fh.node.StableAttr().Ino)
+	fh.node.forgetPath(path)
 	return 0
 }
 
+// pendingSize returns the size of unflushed writes, if there are any
+func (fh *MonkFileHandle) pendingSize() (uint64, bool) {
+	fh.mu.Lock()
+	defer fh.mu.Unlock()
+
+	if fh.writeCache == nil {
+		return 0, false
+	}
+	return uint64(len(fh.writeCache)), true
+}
+
+// Lseek implements SEEK_DATA and SEEK_HOLE. Remote files have no holes:
+// all content up to EOF is data and the only hole is at EOF.
+func (fh *MonkFileHandle) Lseek(ctx context.Context, off uint64, whence uint32) (uint64, syscall.Errno) {
+	size, ok := fh.pendingSize()
+	if !ok {
+		var out fuse.AttrOut
+		if errno := fh.node.Getattr(ctx, nil, &out); errno != 0 {
+			return 0, errno
+		}
+		size = out.Attr.Size
+	}
+
+	switch whence {
+	case unix.SEEK_DATA:
+		if off >= size {
+			return 0, syscall.ENXIO
+		}
+		return off, 0
+	case unix.SEEK_HOLE:
+		if off >= size {
+			return 0, syscall.ENXIO
+		}
+		return size, 0
+	default:
+		return 0, syscall.EINVAL
+	}
+}
+
 // Helper functions
 
+// fillPendingSize reports the size of unflushed writes, so stat reflects
+// extending writes before close. The handle passed in takes precedence over
+// other handles open on the node.
+func (n *MonkFS) fillPendingSize(attr *fuse.Attr, fh fs.FileHandle) {
+	handles := n.openFiles.list(n.StableAttr().Ino)
+	if mfh, ok := fh.(*MonkFileHandle); ok {
+		handles = append([]*MonkFileHandle{mfh}, handles...)
+	}
+
+	for _, h := range handles {
+		if size, ok := h.pendingSize(); ok {
+			attr.Size = size
+			fillBlocks(attr)
+			return
+		}
+	}
+}
+
+// openPath returns the API path of the file behind fh, or behind any other
+// handle open on the node. Open handles keep the path of a file that was
+// renamed or unlinked, while the node's tree path no longer names it.
+func (n *MonkFS) openPath(fh fs.FileHandle) string {
+	handles := n.openFiles.list(n.StableAttr().Ino)
+	if mfh, ok := fh.(*MonkFileHandle); ok {
+		handles = append([]*MonkFileHandle{mfh}, handles...)
+	}
+	if len(handles) == 0 {
+		return n.getPath()
+	}
+
+	h := handles[0]
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.path
+}
+
 func (n *MonkFS) getPath() string {
+	if p := n.realPath(); p != "" {
+		return p
+	}
 	path := n.Path(nil)
 	if path == "" {
 		return "/"
 	}
-	return "/" + path
+	return "/" + n.names.apiPath(path)
 }
 
-func parseFileMode(permissions string, fileType string) uint32 {
-	mode := uint32(0)
+// realPath returns the node's apiPath override, if it has one
+func (n *MonkFS) realPath() string {
+	n.pathMu.RLock()
+	defer n.pathMu.RUnlock()
+	return n.apiPath
+}
 
-	if fileType == "d" {
-		mode |= syscall.S_IFDIR | 0755
-	} else {
-		mode |= syscall.S_IFREG | 0644
+// childPath returns the API path of the child shown as name
+func (n *MonkFS) childPath(name string) string {
+	if child := n.GetChild(name); child != nil {
+		if node, ok := child.Operations().(*MonkFS); ok {
+			if p := node.realPath(); p != "" {
+				return p
+			}
+		}
 	}
+	return n.entryPath(n.names.fileName(name))
+}
 
-	return mode
+// entryPath returns the API path of the child with the API name name
+func (n *MonkFS) entryPath(name string) string {
+	path := n.getPath()
+	if path == "/" {
+		return "/" + name
+	}
+	return path + "/" + name
+}
+
+func parseFileMode(permissions string, fileType string) uint32 {
+	if fileType == "d" {
+		return syscall.S_IFDIR
+	}
+	return syscall.S_IFREG
 }
 
 func parseStatMode(stat *monkapi.StatResponse) uint32 {
 	if stat.Type == "directory" || stat.FileMetadata.Type == "directory" {
-		return syscall.S_IFDIR | 0755
+		return syscall.S_IFDIR
 	}
-	return syscall.S_IFREG | 0644
+	return syscall.S_IFREG
 }
 
-func fillAttr(attr *fuse.Attr, stat *monkapi.StatResponse) {
+func (n *MonkFS) fillAttr(attr *fuse.Attr, stat *monkapi.StatResponse) {
 	attr.Size = uint64(stat.FileMetadata.Size)
 	attr.Mtime = parseMonkTimestamp(stat.FileMetadata.ModifiedTime)
 	attr.Ctime = parseMonkTimestamp(stat.FileMetadata.CreatedTime)
-	attr.Atime = parseMonkTimestamp(stat.FileMetadata.AccessTime)
-
-	if stat.Type == "directory" || stat.FileMetadata.Type == "directory" {
-		attr.Mode = syscall.S_IFDIR | 0755
-	} else {
-		attr.Mode = syscall.S_IFREG | 0644
+	n.opts.fillAtime(attr, stat)
+	attr.Mode = parseStatMode(stat) | n.opts.permissions(stat)
+	if n.opts.Owners != nil {
+		attr.Uid = n.opts.Owners.uid(recordOwner(stat.APIContext))
+	}
+	if n.opts.Groups != nil {
+		attr.Gid = n.opts.Groups.Gid
 	}
+
+	// A directory link count of 1 tells find the subdirectory count is
+	// unknown, so it does not skip subdirectories
+	attr.Nlink = 1
+	fillBlocks(attr)
 }
 
-func hashPath(path string) uint64 {
-	h := fnv.New64a()
-	h.Write([]byte(path))
-	return h.Sum64()
+// fillBlocks sets st_blocks (512-byte units, as du expects) from the size
+func fillBlocks(attr *fuse.Attr) {
+	attr.Blksize = blockSize
+	attr.Blocks = (attr.Size + 511) / 512
 }
 
-func contentToBytes(content interface{}) []byte {
-	if content == nil {
-		return []byte{}
+// fillNlink sets a directory's link count to 2 plus its subdirectories
+// when a cached listing of it is available
+func (n *MonkFS) fillNlink(attr *fuse.Attr, path string) {
+	if attr.Mode&syscall.S_IFDIR == 0 {
+		return
 	}
-
-	switch v := content.(type) {
-	case string:
-		// Remove JSON quotes if present (pick returns valid JSON)
-		if strings.HasPrefix(v, "\"") && strings.HasSuffix(v, "\"") {
-			v = v[1 : len(v)-1]
+	entries, ok := n.subtrees.listing(path)
+	if !ok {
+		return
+	}
+	attr.Nlink = 2
+	for _, entry := range entries {
+		if entry.FileType == "d" {
+			attr.Nlink++
 		}
-		return []byte(v)
-	case []byte:
-		return v
-	default:
-		// Convert to JSON
-		data, _ := json.Marshal(v)
-		return data
 	}
 }
+
+// blockSize is the preferred I/O size reported in st_blksize
+const blockSize = 4096
+
+func hashPath(path string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(path))
+	return h.Sum64()
+}
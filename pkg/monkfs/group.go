@@ -0,0 +1,56 @@
+package monkfs
+
+import "slices"
+
+// GroupAccess presents a role's access to records as the group permission
+// bits, from the access_read, access_edit, access_full and access_deny
+// lists in their api_context
+type GroupAccess struct {
+	// Gid is the group shown on every file and directory
+	Gid uint32 `json:"gid"`
+
+	// Roles are the Monk roles or user IDs the group stands for; a record
+	// grants the group the strongest access any of them has
+	Roles []string `json:"roles"`
+}
+
+// apply replaces the group bits of perm with the roles' access to an entry.
+// Entries without access lists keep the bits the API reported.
+func (g *GroupAccess) apply(perm uint32, apiContext map[string]interface{}) uint32 {
+	read := g.granted(apiContext, "access_read")
+	edit := g.granted(apiContext, "access_edit")
+	full := g.granted(apiContext, "access_full")
+	deny := g.granted(apiContext, "access_deny")
+	if read == nil && edit == nil && full == nil && deny == nil {
+		return perm
+	}
+
+	group := uint32(0)
+	switch {
+	case deny != nil && *deny:
+	case (edit != nil && *edit) || (full != nil && *full):
+		group = 06
+	case read != nil && *read:
+		group = 04
+	}
+	// Execute follows read, since the API has no separate grant for it
+	if group&04 != 0 {
+		group |= perm >> 6 & 01
+	}
+	return perm&^0070 | group<<3
+}
+
+// granted reports whether an access list in apiContext includes one of the
+// roles, or nil when the entry has no such list
+func (g *GroupAccess) granted(apiContext map[string]interface{}, key string) *bool {
+	list, ok := apiContext[key].([]interface{})
+	if !ok {
+		return nil
+	}
+
+	found := slices.ContainsFunc(list, func(v interface{}) bool {
+		id, _ := v.(string)
+		return id != "" && slices.Contains(g.Roles, id)
+	})
+	return &found
+}
@@ -0,0 +1,190 @@
+package monkfs
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+)
+
+// inodeTable assigns inode numbers from hashed keys and guarantees they are
+// unique. FNV-64 collisions are rare but would silently alias two files in
+// the kernel, so a key whose hash is already owned by another key is
+// rehashed with a counter until a free number is found.
+type inodeTable struct {
+	mu         sync.Mutex
+	byKey      map[string]uint64
+	byIno      map[uint64]string
+	gens       map[string]uint64
+	collisions uint64
+}
+
+func newInodeTable() *inodeTable {
+	return &inodeTable{
+		byKey: make(map[string]uint64),
+		byIno: make(map[uint64]string),
+		gens:  make(map[string]uint64),
+	}
+}
+
+// assign returns the inode number for key, allocating it on first use
+func (t *inodeTable) assign(key string) uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if ino, ok := t.byKey[key]; ok {
+		return ino
+	}
+
+	ino := hashPath(key)
+	for attempt := 1; ; attempt++ {
+		// Inode 1 is the mount root
+		if _, taken := t.byIno[ino]; !taken && ino > 1 {
+			break
+		}
+		t.collisions++
+		ino = hashPath(key + "#" + strconv.Itoa(attempt))
+	}
+
+	t.byKey[key] = ino
+	t.byIno[ino] = key
+	return ino
+}
+
+// number returns key's inode number without allocating one: the number it
+// was assigned, or else the one it would most likely get. Readdir reports
+// a number for every entry it lists, and allocating them would keep every
+// name ever listed in the table.
+func (t *inodeTable) number(key string) uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if ino, ok := t.byKey[key]; ok {
+		return ino
+	}
+	return hashPath(key)
+}
+
+// forget releases ino's number once the kernel has forgotten the inode,
+// so the table only holds numbers in use. Generations are kept: NFS file
+// handles can outlive the kernel's inode, and they only grow with removes.
+func (t *inodeTable) forget(ino uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if key, ok := t.byIno[ino]; ok {
+		delete(t.byIno, ino)
+		delete(t.byKey, key)
+	}
+}
+
+// generation returns the generation of key's inode number
+func (t *inodeTable) generation(key string) uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.gens[key]
+}
+
+// removed bumps key's generation, so a file recreated at the same path
+// reuses its inode number but is a distinct inode to the kernel and to NFS
+// file handles
+func (t *inodeTable) removed(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.gens[key]++
+}
+
+// removedInode bumps the generation of the key ino was assigned for
+func (t *inodeTable) removedInode(ino uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if key, ok := t.byIno[ino]; ok {
+		t.gens[key]++
+	}
+}
+
+// Bytes reports table size and collisions for the /.monk/inodes file
+func (t *inodeTable) Bytes() []byte {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return fmt.Appendf(nil, "entries %d\ncollisions %d\n", len(t.byKey), t.collisions)
+}
+
+var _ = (fs.NodeOnForgetter)((*MonkFS)(nil))
+
+// OnForget releases the node's inode number once the kernel forgets it
+func (n *MonkFS) OnForget() {
+	n.inodes.forget(n.StableAttr().Ino)
+}
+
+// stableAttr returns the inode identity for key
+func (n *MonkFS) stableAttr(mode uint32, key string) fs.StableAttr {
+	return fs.StableAttr{
+		Mode: mode,
+		Ino:  n.inodes.assign(key),
+		Gen:  n.inodes.generation(key),
+	}
+}
+
+// removedAt bumps the generation of the inode that was at path, under the
+// key its number was derived from: the kernel's inode for it if there is
+// one, otherwise the key of its cached metadata. It must be called before
+// the path's metadata is forgotten.
+func (n *MonkFS) removedAt(path string, child *fs.Inode) {
+	if child != nil {
+		n.inodes.removedInode(child.StableAttr().Ino)
+		return
+	}
+	key := path
+	if stat := n.cache.GetStale(path); stat != nil {
+		key = entryKey(path, stat.APIContext)
+	}
+	n.inodes.removed(key)
+}
+
+// entryInode returns the inode number for an API entry, without
+// allocating one
+func (n *MonkFS) entryInode(path string, apiContext map[string]interface{}) uint64 {
+	return n.inodes.number(entryKey(path, apiContext))
+}
+
+// entryKey returns the inode identity key of an API entry. Entries backed
+// by a record are keyed by the schema, record ID and field name in their
+// api_context, so a record keeps its inode across renames and every mount
+// agrees on it; anything else is keyed by its path.
+func entryKey(path string, apiContext map[string]interface{}) string {
+	schema, id := recordIdentity(apiContext)
+	if schema == "" || id == "" {
+		return path
+	}
+
+	key := "record:" + schema + "/" + id
+	if field := contextString(apiContext, "field_name"); field != "" {
+		key += "/" + field
+	}
+	return key
+}
+
+// recordIdentity returns the schema and record ID in an api_context, or
+// empty strings for entries not backed by a record
+func recordIdentity(apiContext map[string]interface{}) (schema, id string) {
+	schema, _ = apiContext["schema"].(string)
+	id = contextString(apiContext, "record_id")
+	if id == "" {
+		id = contextString(apiContext, "id")
+	}
+	return schema, id
+}
+
+// contextString reads an api_context value as a string; IDs may be
+// encoded as JSON numbers
+func contextString(apiContext map[string]interface{}, key string) string {
+	switch v := apiContext[key].(type) {
+	case string:
+		return v
+	case float64:
+		return fmt.Sprintf("%.0f", v)
+	default:
+		return ""
+	}
+}
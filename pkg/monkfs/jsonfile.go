@@ -0,0 +1,174 @@
+package monkfs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sync"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/ianzepp/monk-api-fuse/pkg/monkapi"
+)
+
+// jsonFile is an editable JSON document buffered locally and saved through
+// its save callback on flush
+type jsonFile struct {
+	fs.Inode
+	root  *MonkFS
+	path  string
+	fetch func(ctx context.Context) (json.RawMessage, error)
+	save  func(ctx context.Context, data json.RawMessage) error
+
+	mu    sync.Mutex
+	data  []byte
+	dirty bool
+}
+
+var _ = (fs.NodeOpener)((*jsonFile)(nil))
+var _ = (fs.NodeReader)((*jsonFile)(nil))
+var _ = (fs.NodeWriter)((*jsonFile)(nil))
+var _ = (fs.NodeFlusher)((*jsonFile)(nil))
+var _ = (fs.NodeOnForgetter)((*jsonFile)(nil))
+var _ = (fs.NodeGetattrer)((*jsonFile)(nil))
+var _ = (fs.NodeSetattrer)((*jsonFile)(nil))
+
+// load fetches the current document unless local edits are pending
+func (f *jsonFile) load(ctx context.Context) syscall.Errno {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.dirty {
+		return 0
+	}
+
+	raw, err := f.fetch(ctx)
+	if err != nil {
+		if monkapi.IsNotFound(err) {
+			return syscall.ENOENT
+		}
+		return f.root.apiErrno(f.path, err)
+	}
+
+	var pretty bytes.Buffer
+	if err := json.Indent(&pretty, raw, "", "  "); err != nil {
+		return syscall.EIO
+	}
+	pretty.WriteByte('\n')
+	f.data = pretty.Bytes()
+	return 0
+}
+
+// OnForget releases the file's inode number once the kernel forgets it
+func (f *jsonFile) OnForget() {
+	f.root.inodes.forget(f.StableAttr().Ino)
+}
+
+// Open reloads the document and truncates it for O_TRUNC writers
+func (f *jsonFile) Open(ctx context.Context, flags uint32) (fs.FileHandle, uint32, syscall.Errno) {
+	if errno := f.load(ctx); errno != 0 {
+		return nil, 0, errno
+	}
+
+	if flags&syscall.O_TRUNC != 0 {
+		f.mu.Lock()
+		f.data = []byte{}
+		f.dirty = true
+		f.mu.Unlock()
+	}
+
+	return nil, fuse.FOPEN_DIRECT_IO, 0
+}
+
+// Read returns the buffered document at the given offset
+func (f *jsonFile) Read(ctx context.Context, fh fs.FileHandle, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if off >= int64(len(f.data)) {
+		return fuse.ReadResultData([]byte{}), 0
+	}
+	end := off + int64(len(dest))
+	if end > int64(len(f.data)) {
+		end = int64(len(f.data))
+	}
+	return fuse.ReadResultData(f.data[off:end]), 0
+}
+
+// Write modifies the local buffer
+func (f *jsonFile) Write(ctx context.Context, fh fs.FileHandle, data []byte, off int64) (uint32, syscall.Errno) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	newSize := int(off) + len(data)
+	if newSize > len(f.data) {
+		newData := make([]byte, newSize)
+		copy(newData, f.data)
+		f.data = newData
+	}
+	copy(f.data[off:], data)
+	f.dirty = true
+
+	return uint32(len(data)), 0
+}
+
+// Flush validates the buffered JSON and saves it
+func (f *jsonFile) Flush(ctx context.Context, fh fs.FileHandle) syscall.Errno {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !f.dirty || len(bytes.TrimSpace(f.data)) == 0 {
+		return 0
+	}
+	if !json.Valid(f.data) {
+		return syscall.EINVAL
+	}
+
+	if err := f.save(ctx, json.RawMessage(f.data)); err != nil {
+		return f.root.apiErrno(f.path, err)
+	}
+
+	f.dirty = false
+	f.root.errLog.Clear(f.path)
+	return 0
+}
+
+// Getattr reports the size of the buffered document
+func (f *jsonFile) Getattr(ctx context.Context, fh fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	f.fillAttr(&out.Attr)
+	return 0
+}
+
+// Setattr handles truncation of the local buffer. Documents have fixed
+// permissions, so any other mode is refused rather than forgotten.
+func (f *jsonFile) Setattr(ctx context.Context, fh fs.FileHandle, in *fuse.SetAttrIn, out *fuse.AttrOut) syscall.Errno {
+	if mode, ok := in.GetMode(); ok && mode&07777 != 0644 {
+		return syscall.EPERM
+	}
+	if size, ok := in.GetSize(); ok {
+		f.mu.Lock()
+		if int(size) < len(f.data) {
+			f.data = f.data[:size]
+		} else {
+			newData := make([]byte, size)
+			copy(newData, f.data)
+			f.data = newData
+		}
+		f.dirty = true
+		f.mu.Unlock()
+	}
+
+	f.fillAttr(&out.Attr)
+	return 0
+}
+
+func (f *jsonFile) fillAttr(attr *fuse.Attr) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	attr.Mode = syscall.S_IFREG | 0644
+	attr.Size = uint64(len(f.data))
+	attr.Nlink = 1
+	fillBlocks(attr)
+}
@@ -0,0 +1,61 @@
+package monkfs
+
+import (
+	"context"
+	"syscall"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+)
+
+// leaseTTL is the lifetime of a write lease between renewals. It is kept
+// short so a crashed client holds up other writers only briefly.
+const leaseTTL = 20 * time.Second
+
+var _ = (fs.FileFsyncer)((*MonkFileHandle)(nil))
+
+// acquireLease takes an exclusive server-side lease for a handle opened for
+// writing, held until it is closed so other clients' leases and locks wait
+// for it. Writes are stored on fsync and close as usual, and as soon as the
+// lease is lost. If another client holds the file, the handle goes without
+// a lease.
+func (fh *MonkFileHandle) acquireLease(ctx context.Context) {
+	l, errno := fh.node.acquireLock(ctx, fh.path, true, leaseTTL, fh.leaseBroken)
+	if errno == 0 {
+		fh.lease = l
+	}
+}
+
+// leaseBroken stores pending writes after the lease could not be renewed,
+// so they reach the server before another writer's
+func (fh *MonkFileHandle) leaseBroken() {
+	fh.mu.Lock()
+	l := fh.lease
+	fh.lease = nil
+	fh.mu.Unlock()
+
+	if l != nil {
+		fh.sync(context.Background())
+	}
+}
+
+// releaseLease gives up the lease, if the handle holds one. Pending writes
+// were stored by Flush, which unlike Release can report a failed store.
+func (fh *MonkFileHandle) releaseLease(ctx context.Context) {
+	fh.mu.Lock()
+	l := fh.lease
+	fh.lease = nil
+	fh.mu.Unlock()
+
+	if l != nil {
+		fh.node.releaseLock(ctx, l)
+	}
+}
+
+// Fsync stores pending writes
+func (fh *MonkFileHandle) Fsync(ctx context.Context, flags uint32) syscall.Errno {
+	ctx, cancel := fh.node.withDeadline(ctx, opWrite)
+	defer cancel()
+
+	return fh.sync(ctx)
+}
@@ -0,0 +1,202 @@
+package monkfs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/ianzepp/monk-api-fuse/pkg/monkapi"
+)
+
+// lockTTL is how long a server-side lock outlives its last renewal, so
+// locks of a crashed client are not held forever
+const lockTTL = 60 * time.Second
+
+// lockPollInterval is how often a blocking lock request retries
+const lockPollInterval = 500 * time.Millisecond
+
+var _ = (fs.FileSetlker)((*MonkFileHandle)(nil))
+var _ = (fs.FileSetlkwer)((*MonkFileHandle)(nil))
+var _ = (fs.FileGetlker)((*MonkFileHandle)(nil))
+
+// remoteLock is a server-side lock held by this mount, for one open file
+// description's flock() or for an inode's byte-range locks
+type remoteLock struct {
+	path      string
+	id        string
+	exclusive bool
+	ttl       time.Duration
+	stop      chan struct{}
+	onBreak   func()
+}
+
+// lockOwner describes this client to other lock holders
+var lockOwner = sync.OnceValue(func() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("monk-fuse@%s:%d", host, os.Getpid())
+})
+
+// Setlk implements flock(LOCK_NB) with a server-side lock, and
+// non-blocking fcntl() byte-range locks
+func (fh *MonkFileHandle) Setlk(ctx context.Context, owner uint64, lk *fuse.FileLock, flags uint32) syscall.Errno {
+	return fh.setLock(ctx, owner, lk, flags, false)
+}
+
+// Setlkw implements blocking flock(), polling while another client holds
+// a conflicting lock, and blocking fcntl() byte-range locks
+func (fh *MonkFileHandle) Setlkw(ctx context.Context, owner uint64, lk *fuse.FileLock, flags uint32) syscall.Errno {
+	return fh.setLock(ctx, owner, lk, flags, true)
+}
+
+// Getlk reports a byte-range lock held on this mount that would conflict
+// with lk
+func (fh *MonkFileHandle) Getlk(ctx context.Context, owner uint64, lk *fuse.FileLock, flags uint32, out *fuse.FileLock) syscall.Errno {
+	fh.node.rangeLocks.get(fh.node.StableAttr().Ino, owner, lk, out)
+	return 0
+}
+
+// setLock takes, converts or drops the handle's flock() lock. As with
+// flock(2), converting between shared and exclusive is not atomic.
+func (fh *MonkFileHandle) setLock(ctx context.Context, owner uint64, lk *fuse.FileLock, flags uint32, wait bool) syscall.Errno {
+	if flags&fuse.FUSE_LK_FLOCK == 0 {
+		return fh.node.rangeLocks.set(ctx, fh, owner, lk, wait)
+	}
+
+	fh.lockMu.Lock()
+	defer fh.lockMu.Unlock()
+
+	switch lk.Typ {
+	case syscall.F_UNLCK:
+		return fh.unlock(ctx)
+	case syscall.F_RDLCK, syscall.F_WRLCK:
+	default:
+		return syscall.EINVAL
+	}
+
+	exclusive := lk.Typ == syscall.F_WRLCK
+	if fh.lock != nil && fh.lock.exclusive == exclusive {
+		return 0
+	}
+	if errno := fh.unlock(ctx); errno != 0 {
+		return errno
+	}
+
+	fh.mu.Lock()
+	path := fh.path
+	fh.mu.Unlock()
+
+	for {
+		l, errno := fh.node.acquireLock(ctx, path, exclusive, lockTTL, nil)
+		if errno == 0 {
+			fh.lock = l
+			return 0
+		}
+		if errno != syscall.EWOULDBLOCK || !wait {
+			return errno
+		}
+		if errno := sleepLockPoll(ctx); errno != 0 {
+			return errno
+		}
+	}
+}
+
+// unlock releases the handle's lock, if it holds one. fh.lockMu must be
+// held.
+func (fh *MonkFileHandle) unlock(ctx context.Context) syscall.Errno {
+	l := fh.lock
+	fh.lock = nil
+	return fh.node.releaseLock(ctx, l)
+}
+
+// acquireLock takes a server-side lock and keeps it renewed until it is
+// released; onBreak, if not nil, is called if renewal finds it lost. A
+// conflicting lock held elsewhere fails with EWOULDBLOCK.
+func (n *MonkFS) acquireLock(ctx context.Context, path string, exclusive bool, ttl time.Duration, onBreak func()) (*remoteLock, syscall.Errno) {
+	resp, err := n.apiClient.Lock(ctx, path, monkapi.LockOptions{
+		Exclusive: exclusive,
+		TTL:       int(ttl / time.Second),
+		Owner:     lockOwner(),
+	})
+	if err != nil {
+		if monkapi.IsLocked(err) {
+			return nil, syscall.EWOULDBLOCK
+		}
+		return nil, n.apiErrno(path, err)
+	}
+
+	l := &remoteLock{
+		path:      path,
+		id:        resp.LockID,
+		exclusive: exclusive,
+		ttl:       ttl,
+		stop:      make(chan struct{}),
+		onBreak:   onBreak,
+	}
+	go n.renewLock(l)
+	return l, 0
+}
+
+// releaseLock stops renewing a server-side lock and releases it; a nil
+// lock is a no-op
+func (n *MonkFS) releaseLock(ctx context.Context, l *remoteLock) syscall.Errno {
+	if l == nil {
+		return 0
+	}
+	close(l.stop)
+
+	// An expired lock is already gone
+	if err := n.apiClient.Unlock(ctx, l.path, l.id); err != nil && !monkapi.IsNotFound(err) {
+		return n.apiErrno(l.path, err)
+	}
+	return 0
+}
+
+// sleepLockPoll waits before a blocking lock request retries, returning
+// EINTR if the request is interrupted
+func sleepLockPoll(ctx context.Context) syscall.Errno {
+	select {
+	case <-ctx.Done():
+		return syscall.EINTR
+	case <-time.After(lockPollInterval):
+		return 0
+	}
+}
+
+// renewLock keeps a lock alive until it is released or lost
+func (n *MonkFS) renewLock(l *remoteLock) {
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+
+	opts := monkapi.LockOptions{
+		Exclusive: l.exclusive,
+		TTL:       int(l.ttl / time.Second),
+		Owner:     lockOwner(),
+		LockID:    l.id,
+	}
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			_, err := n.apiClient.Lock(context.Background(), l.path, opts)
+			if err == nil {
+				continue
+			}
+			n.errLog.Record(l.path, fmt.Errorf("renew lock: %w", err))
+
+			// The lock expired or was taken over; transient failures are
+			// retried on the next tick
+			if monkapi.IsNotFound(err) || monkapi.IsLocked(err) {
+				if l.onBreak != nil {
+					l.onBreak()
+				}
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package monkfs
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/ianzepp/monk-api-fuse/pkg/monkapi"
+)
+
+// unmountedFS creates a filesystem whose API is never reached
+func unmountedFS(opts Options) *MonkFS {
+	return NewMonkFS(monkapi.NewClient("http://monk.invalid", "token"), opts)
+}
+
+func TestMissingCacheBounded(t *testing.T) {
+	root := unmountedFS(Options{})
+	for i := range 2 * missingEntries {
+		root.missing.Set(fmt.Sprintf("/probe/%d.h", i), struct{}{})
+	}
+	if n := root.missing.Len(); n > missingEntries {
+		t.Errorf("not-found cache holds %d paths, want at most %d", n, missingEntries)
+	}
+}
+
+// subtreeEntries returns a recursive listing of n files in dir
+func subtreeEntries(dir string, n int) []monkapi.FileEntry {
+	entries := make([]monkapi.FileEntry, n)
+	for i := range entries {
+		name := fmt.Sprintf("file-%06d.json", i)
+		entries[i] = monkapi.FileEntry{Name: name, Path: dir + "/" + name, FileType: "f"}
+	}
+	return entries
+}
+
+func TestSubtreeSnapshotsShareBudget(t *testing.T) {
+	const limit = 1 << 20
+	root := unmountedFS(Options{RecursiveList: true, CacheMemoryLimit: limit})
+
+	root.subtrees.store("/small", subtreeEntries("/small", 10), root.subtrees.generation())
+	if root.budget.Used() == 0 {
+		t.Error("snapshot not charged to the budget")
+	}
+	if _, ok := root.subtrees.listing("/small"); !ok {
+		t.Fatal("small snapshot not kept")
+	}
+
+	// A snapshot larger than the whole budget is evicted with the rest
+	root.subtrees.store("/big", subtreeEntries("/big", 20000), root.subtrees.generation())
+	if used := root.budget.Used(); used > limit {
+		t.Errorf("budget used %d, over its limit of %d", used, limit)
+	}
+	if _, ok := root.subtrees.listing("/big"); ok {
+		t.Error("snapshot over the budget still cached")
+	}
+}
+
+func TestInodeTableForget(t *testing.T) {
+	table := newInodeTable()
+	ino := table.assign("/docs/readme.md")
+	table.removed("/docs/readme.md")
+
+	if got := table.number("/docs/other.md"); got != hashPath("/docs/other.md") {
+		t.Errorf("number of an unassigned key = %d, want its hash", got)
+	}
+	if len(table.byKey) != 1 {
+		t.Errorf("number allocated: %d keys, want 1", len(table.byKey))
+	}
+
+	table.forget(ino)
+	if len(table.byKey) != 0 || len(table.byIno) != 0 {
+		t.Errorf("forgotten inode still in the table: %v %v", table.byKey, table.byIno)
+	}
+	if gen := table.generation("/docs/readme.md"); gen != 1 {
+		t.Errorf("generation after forget = %d, want 1", gen)
+	}
+	if got := table.assign("/docs/readme.md"); got != ino {
+		t.Errorf("reassigned inode %d, want %d", got, ino)
+	}
+}
@@ -0,0 +1,195 @@
+package monkfs
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/ianzepp/monk-api-fuse/pkg/monkapi"
+)
+
+// metaDirName is the top-level virtual directory backed by the Describe API
+//
+// Layout:
+//
+//	/meta/schemas/<schema>.json            schema definition (read-write)
+//	/meta/columns/<schema>/<column>.json   column definition (read-write)
+const metaDirName = "meta"
+
+// metaDir implements the directories of the /meta tree
+type metaDir struct {
+	fs.Inode
+	root   *MonkFS
+	path   string
+	schema string // set for /meta/columns/<schema>
+}
+
+var _ = (fs.NodeReaddirer)((*metaDir)(nil))
+var _ = (fs.NodeLookuper)((*metaDir)(nil))
+var _ = (fs.NodeGetattrer)((*metaDir)(nil))
+var _ = (fs.NodeStatfser)((*metaDir)(nil))
+var _ = (fs.NodeCreater)((*metaDir)(nil))
+var _ = (fs.NodeUnlinker)((*metaDir)(nil))
+
+// newMetaDir creates a /meta directory inode
+func (n *MonkFS) newMetaDir(ctx context.Context, parent *fs.Inode, path, schema string, out *fuse.EntryOut) *fs.Inode {
+	out.Attr.Mode = syscall.S_IFDIR | 0755
+	return parent.NewInode(ctx, &metaDir{root: n, path: path, schema: schema}, n.stableAttr(syscall.S_IFDIR, path))
+}
+
+// Readdir lists schemas, column directories or columns depending on depth
+func (d *metaDir) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
+	entries := []fuse.DirEntry{}
+
+	switch {
+	case d.path == "/"+metaDirName:
+		for _, name := range []string{"schemas", "columns"} {
+			entries = append(entries, fuse.DirEntry{Name: name, Mode: syscall.S_IFDIR | 0755})
+		}
+
+	case d.schema != "":
+		def, err := d.root.apiClient.Describe(ctx, d.schema)
+		if err != nil {
+			return nil, d.root.apiErrno(d.path, err)
+		}
+		for _, column := range monkapi.SchemaColumns(def) {
+			entries = append(entries, fuse.DirEntry{Name: column + ".json", Mode: syscall.S_IFREG | 0644})
+		}
+
+	default:
+		schemas, err := d.root.apiClient.ListSchemas(ctx)
+		if err != nil {
+			return nil, d.root.apiErrno(d.path, err)
+		}
+		for _, schema := range schemas {
+			if d.path == "/"+metaDirName+"/schemas" {
+				entries = append(entries, fuse.DirEntry{Name: schema + ".json", Mode: syscall.S_IFREG | 0644})
+			} else {
+				entries = append(entries, fuse.DirEntry{Name: schema, Mode: syscall.S_IFDIR | 0755})
+			}
+		}
+	}
+
+	return fs.NewListDirStream(entries), 0
+}
+
+// Lookup resolves a child of the /meta tree
+func (d *metaDir) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	path := d.path + "/" + name
+
+	switch {
+	case d.path == "/"+metaDirName:
+		if name != "schemas" && name != "columns" {
+			return nil, syscall.ENOENT
+		}
+		return d.root.newMetaDir(ctx, &d.Inode, path, "", out), 0
+
+	case d.path == "/"+metaDirName+"/columns":
+		if _, err := d.root.apiClient.Describe(ctx, name); err != nil {
+			if monkapi.IsNotFound(err) {
+				return nil, syscall.ENOENT
+			}
+			return nil, d.root.apiErrno(path, err)
+		}
+		return d.root.newMetaDir(ctx, &d.Inode, path, name, out), 0
+	}
+
+	file := d.newFile(strings.TrimSuffix(name, ".json"), path)
+	if file == nil || !strings.HasSuffix(name, ".json") {
+		return nil, syscall.ENOENT
+	}
+	if errno := file.load(ctx); errno != 0 {
+		return nil, errno
+	}
+
+	file.fillAttr(&out.Attr)
+	return d.NewInode(ctx, file, d.root.stableAttr(syscall.S_IFREG, path)), 0
+}
+
+// Create starts a new schema definition; it is created on first flush
+func (d *metaDir) Create(ctx context.Context, name string, flags uint32, mode uint32, out *fuse.EntryOut) (*fs.Inode, fs.FileHandle, uint32, syscall.Errno) {
+	if d.path != "/"+metaDirName+"/schemas" || !strings.HasSuffix(name, ".json") {
+		return nil, nil, 0, syscall.EPERM
+	}
+
+	schema := strings.TrimSuffix(name, ".json")
+	file := d.newFile(schema, d.path+"/"+name)
+	update := file.save
+	file.save = func(ctx context.Context, data json.RawMessage) error {
+		if err := d.root.apiClient.CreateSchema(ctx, schema, data); err != nil {
+			return err
+		}
+		// Later saves of the same inode update the schema that now exists
+		file.save = update
+		return nil
+	}
+
+	file.fillAttr(&out.Attr)
+	child := d.NewInode(ctx, file, d.root.stableAttr(syscall.S_IFREG, d.path+"/"+name))
+	return child, nil, fuse.FOPEN_DIRECT_IO, 0
+}
+
+// Unlink deletes a schema
+func (d *metaDir) Unlink(ctx context.Context, name string) syscall.Errno {
+	if d.path != "/"+metaDirName+"/schemas" || !strings.HasSuffix(name, ".json") {
+		return syscall.EPERM
+	}
+
+	path := d.path + "/" + name
+	if errno := d.root.mayDelete(path); errno != 0 {
+		return errno
+	}
+	if err := d.root.apiClient.DeleteSchema(ctx, strings.TrimSuffix(name, ".json")); err != nil {
+		return d.root.apiErrno(path, err)
+	}
+	d.root.inodes.removed(path)
+	return 0
+}
+
+// Getattr reports /meta directories as writable
+func (d *metaDir) Getattr(ctx context.Context, fh fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	out.Attr.Mode = syscall.S_IFDIR | 0755
+	return 0
+}
+
+// Statfs reports the same counts as the rest of the mount
+func (d *metaDir) Statfs(ctx context.Context, out *fuse.StatfsOut) syscall.Errno {
+	return d.root.Statfs(ctx, out)
+}
+
+// newFile builds the schema or column file for name in this directory
+func (d *metaDir) newFile(name string, path string) *jsonFile {
+	client := d.root.apiClient
+
+	if d.path == "/"+metaDirName+"/schemas" {
+		return &jsonFile{
+			root: d.root,
+			path: path,
+			fetch: func(ctx context.Context) (json.RawMessage, error) {
+				return client.Describe(ctx, name)
+			},
+			save: func(ctx context.Context, data json.RawMessage) error {
+				return client.UpdateSchema(ctx, name, data)
+			},
+		}
+	}
+
+	if d.schema != "" {
+		schema := d.schema
+		return &jsonFile{
+			root: d.root,
+			path: path,
+			fetch: func(ctx context.Context) (json.RawMessage, error) {
+				return client.DescribeColumn(ctx, schema, name)
+			},
+			save: func(ctx context.Context, data json.RawMessage) error {
+				return client.UpdateColumn(ctx, schema, name, data)
+			},
+		}
+	}
+
+	return nil
+}
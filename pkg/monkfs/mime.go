@@ -0,0 +1,58 @@
+package monkfs
+
+import (
+	"bytes"
+	"context"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"syscall"
+
+	"github.com/ianzepp/monk-api-fuse/pkg/monkapi"
+)
+
+// sniffLength is the number of leading bytes fetched for content sniffing
+const sniffLength = 512
+
+// mimeType determines the content type of this node, preferring the
+// server-provided type, then the file extension, then content sniffing
+func (n *MonkFS) mimeType(ctx context.Context) (string, syscall.Errno) {
+	path := n.getPath()
+
+	stat := n.cache.Get(path)
+	if stat == nil {
+		gen := n.cache.Generation()
+		resp, err := n.apiClient.Stat(ctx, path, n.statPick())
+		if err != nil {
+			return "", n.apiErrno(path, err)
+		}
+		n.cache.SetSince(path, resp, gen)
+		stat = resp
+	}
+
+	if stat.FileMetadata.ContentType != "" {
+		return stat.FileMetadata.ContentType, 0
+	}
+	if byExt := mime.TypeByExtension(filepath.Ext(path)); byExt != "" {
+		return byExt, 0
+	}
+
+	data, err := n.retrieve(ctx, path, monkapi.RetrieveOptions{
+		MaxBytes: sniffLength,
+	})
+	if err != nil {
+		return "", n.apiErrno(path, err)
+	}
+
+	return sniffMimeType(data), 0
+}
+
+// sniffMimeType detects a content type from leading bytes, recognizing
+// JSON records which http.DetectContentType reports as plain text
+func sniffMimeType(data []byte) string {
+	trimmed := bytes.TrimLeft(data, " \t\r\n")
+	if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		return "application/json"
+	}
+	return http.DetectContentType(data)
+}
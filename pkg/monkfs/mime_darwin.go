@@ -0,0 +1,18 @@
+package monkfs
+
+import "strings"
+
+// xattrTextEncoding tells TextEdit and Finder how text content is encoded
+const xattrTextEncoding = "com.apple.TextEncoding"
+
+// platformMimeXattrNames lists the attributes platformMimeXattrs may return
+var platformMimeXattrNames = []string{xattrTextEncoding}
+
+// platformMimeXattrs returns macOS-specific hints derived from a MIME type
+func platformMimeXattrs(mimeType string) map[string][]byte {
+	if strings.HasPrefix(mimeType, "text/") || strings.HasPrefix(mimeType, "application/json") {
+		// UTF-8 with its CFStringEncoding value
+		return map[string][]byte{xattrTextEncoding: []byte("utf-8;134217984")}
+	}
+	return nil
+}
@@ -0,0 +1,12 @@
+//go:build !darwin
+
+package monkfs
+
+// platformMimeXattrNames lists the attributes platformMimeXattrs may return
+var platformMimeXattrNames []string
+
+// platformMimeXattrs returns platform-specific hints derived from a MIME
+// type; only macOS defines any
+func platformMimeXattrs(mimeType string) map[string][]byte {
+	return nil
+}
@@ -0,0 +1,128 @@
+package monkfs
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/ianzepp/monk-api-fuse/pkg/monkapi"
+)
+
+// Default permission bits when the API reports none
+const (
+	defaultFileMode = 0644
+	defaultDirMode  = 0755
+)
+
+// permissions returns the permission bits of a file or directory: those
+// reported by the API, or the configured defaults, with the umask applied
+func (o *Options) permissions(stat *monkapi.StatResponse) uint32 {
+	dir := parseStatMode(stat) == syscall.S_IFDIR
+
+	perm, ok := parsePermissions(stat.FileMetadata.Permissions)
+	if !ok {
+		perm = o.defaultMode(dir)
+	}
+	if o.Groups != nil {
+		perm = o.Groups.apply(perm, stat.APIContext)
+	}
+	if dir {
+		// A readable directory must also be searchable to be usable
+		perm |= (perm & 0444) >> 2
+	}
+	return perm &^ o.Umask
+}
+
+// defaultMode returns the configured default mode for files or directories
+func (o *Options) defaultMode(dir bool) uint32 {
+	if dir {
+		if o.DirMode != 0 {
+			return o.DirMode
+		}
+		return defaultDirMode
+	}
+	if o.FileMode != 0 {
+		return o.FileMode
+	}
+	return defaultFileMode
+}
+
+// parsePermissions parses a permission string as either symbolic
+// ("rwxr-xr-x", optionally with a leading type character as in ls -l) or
+// octal ("0644")
+func parsePermissions(s string) (uint32, bool) {
+	if s == "" {
+		return 0, false
+	}
+	if v, err := strconv.ParseUint(s, 8, 32); err == nil {
+		return uint32(v) & 0777, true
+	}
+
+	if len(s) == 10 {
+		s = s[1:]
+	}
+	if len(s) != 9 {
+		return 0, false
+	}
+
+	var perm uint32
+	for i, c := range s {
+		want := "rwx"[i%3]
+		switch {
+		case byte(c) == want:
+			perm |= 1 << (8 - i)
+		case c == '-':
+		case want == 'x' && strings.ContainsRune("sStT", c):
+			// setuid, setgid and sticky are not presented; lower case
+			// means the execute bit is also set
+			if c == 's' || c == 't' {
+				perm |= 1 << (8 - i)
+			}
+		default:
+			return 0, false
+		}
+	}
+	return perm, true
+}
+
+// formatPermissions renders permission bits in the API's symbolic form
+func formatPermissions(perm uint32) string {
+	var b [9]byte
+	for i := range b {
+		b[i] = '-'
+		if perm&(1<<(8-i)) != 0 {
+			b[i] = "rwx"[i%3]
+		}
+	}
+	return string(b[:])
+}
+
+// chmod stores a mode change through the API, so execute bits set with
+// chmod +x survive on the server and scripts on the mount can be run.
+// Bits the API cannot represent (setuid, setgid, sticky), and changes the
+// server answers with different permissions, fail with EPERM instead of
+// appearing to succeed.
+func (n *MonkFS) chmod(ctx context.Context, mode uint32) syscall.Errno {
+	if n.pattern {
+		return syscall.EROFS
+	}
+	if mode&07000 != 0 {
+		return syscall.EPERM
+	}
+
+	path := n.getPath()
+	perm := mode & 0777
+	resp, err := n.apiClient.Update(ctx, path, monkapi.UpdateOptions{Permissions: formatPermissions(perm)}, "")
+	if err != nil {
+		return n.apiErrno(path, err)
+	}
+	n.invalidate(path)
+
+	if got, ok := parsePermissions(resp.FileMetadata.Permissions); ok && got != perm {
+		n.errLog.Record(path, fmt.Errorf("chmod %03o: server kept %s", perm, resp.FileMetadata.Permissions))
+		return syscall.EPERM
+	}
+	return 0
+}
@@ -0,0 +1,382 @@
+package monkfs
+
+import (
+	"bytes"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/ianzepp/monk-api-fuse/internal/mockserver"
+	"github.com/ianzepp/monk-api-fuse/pkg/monkapi"
+)
+
+// testMount mounts a filesystem backed by s and returns the mount point,
+// skipping the test where FUSE mounts are not possible
+func testMount(tb testing.TB, s *mockserver.Server, opts Options) string {
+	tb.Helper()
+	mnt, _ := testMountRoot(tb, s, opts)
+	return mnt
+}
+
+// testMountRoot is testMount, also returning the mounted filesystem so its
+// caches can be reached
+func testMountRoot(tb testing.TB, s *mockserver.Server, opts Options) (string, *MonkFS) {
+	tb.Helper()
+	ts := httptest.NewServer(s)
+	tb.Cleanup(ts.Close)
+
+	mnt := tb.TempDir()
+	root := NewMonkFS(monkapi.NewClient(ts.URL, "test-token"), opts)
+	server, err := fs.Mount(mnt, root, &fs.Options{
+		MountOptions: fuse.MountOptions{DirectMount: true},
+	})
+	if err != nil {
+		tb.Skipf("cannot mount FUSE filesystem: %v", err)
+	}
+	tb.Cleanup(func() { server.Unmount() })
+	return mnt, root
+}
+
+// listNames returns the sorted names in a directory of the mount
+func listNames(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("readdir %s: %v", dir, err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+func TestMountReadAndList(t *testing.T) {
+	s := mockserver.New()
+	s.Put("/docs/readme.md", []byte("# hello\n"))
+	s.Put("/docs/notes/todo.txt", []byte("one\ntwo\n"))
+	s.Put("/docs/empty", nil)
+	mnt := testMount(t, s, Options{})
+
+	if got := listNames(t, filepath.Join(mnt, "docs")); !slices.Equal(got, []string{"empty", "notes", "readme.md"}) {
+		t.Errorf("readdir docs = %v", got)
+	}
+
+	data, err := os.ReadFile(filepath.Join(mnt, "docs/notes/todo.txt"))
+	if err != nil || string(data) != "one\ntwo\n" {
+		t.Errorf("read todo.txt = %q, %v", data, err)
+	}
+	if data, err := os.ReadFile(filepath.Join(mnt, "docs/empty")); err != nil || len(data) != 0 {
+		t.Errorf("read empty = %q, %v", data, err)
+	}
+
+	info, err := os.Stat(filepath.Join(mnt, "docs/readme.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != 8 || !info.Mode().IsRegular() || info.Mode().Perm() != 0o644 {
+		t.Errorf("stat readme.md: size %d, mode %v", info.Size(), info.Mode())
+	}
+	if info, err := os.Stat(filepath.Join(mnt, "docs/notes")); err != nil || !info.IsDir() {
+		t.Errorf("stat notes: %v, %v", info, err)
+	}
+
+	if _, err := os.Stat(filepath.Join(mnt, "docs/missing")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("stat missing: %v, want not exist", err)
+	}
+}
+
+func TestMountReadAt(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 100_000)
+	s := mockserver.New()
+	s.Put("/big", content)
+	mnt := testMount(t, s, Options{})
+
+	f, err := os.Open(filepath.Join(mnt, "big"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	buf := make([]byte, 25)
+	for _, off := range []int64{0, 7, 123_457, int64(len(content)) - 25} {
+		if _, err := f.ReadAt(buf, off); err != nil {
+			t.Fatalf("read at %d: %v", off, err)
+		}
+		if !bytes.Equal(buf, content[off:off+25]) {
+			t.Errorf("read at %d = %q", off, buf)
+		}
+	}
+}
+
+func TestMountWrite(t *testing.T) {
+	s := mockserver.New()
+	s.Put("/notes.txt", []byte("first draft\n"))
+	mnt := testMount(t, s, Options{})
+	name := filepath.Join(mnt, "notes.txt")
+
+	if err := os.WriteFile(name, []byte("second draft\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.Get("/notes.txt"); string(got) != "second draft\n" {
+		t.Errorf("stored %q after close", got)
+	}
+
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("appended\n")
+	if got, _ := s.Get("/notes.txt"); string(got) != "second draft\n" {
+		t.Errorf("stored %q before close, want writes buffered", got)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.Get("/notes.txt"); string(got) != "second draft\nappended\n" {
+		t.Errorf("stored %q after append", got)
+	}
+
+	if err := os.Truncate(name, 6); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(name); string(got) != "second" {
+		t.Errorf("read %q after truncate", got)
+	}
+}
+
+func TestMountRenameAndUnlink(t *testing.T) {
+	s := mockserver.New()
+	s.Put("/a/one", []byte("1"))
+	s.Put("/a/two", []byte("2"))
+	s.Mkdir("/b")
+	mnt := testMount(t, s, Options{})
+
+	if err := os.Rename(filepath.Join(mnt, "a/one"), filepath.Join(mnt, "b/uno")); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.Get("/a/one"); ok {
+		t.Error("source still stored after rename")
+	}
+	if got, _ := os.ReadFile(filepath.Join(mnt, "b/uno")); string(got) != "1" {
+		t.Errorf("read renamed file = %q", got)
+	}
+	if got := listNames(t, filepath.Join(mnt, "a")); !slices.Equal(got, []string{"two"}) {
+		t.Errorf("readdir a after rename = %v", got)
+	}
+
+	if err := os.Rename(filepath.Join(mnt, "b/uno"), filepath.Join(mnt, "a/two")); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.Get("/a/two"); string(got) != "1" {
+		t.Errorf("replaced file holds %q", got)
+	}
+
+	if err := os.Remove(filepath.Join(mnt, "a/two")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(mnt, "a/two")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("stat after unlink: %v", err)
+	}
+	if _, ok := s.Get("/a/two"); ok {
+		t.Error("file still stored after unlink")
+	}
+}
+
+func TestMountChmod(t *testing.T) {
+	s := mockserver.New()
+	s.Put("/script.sh", []byte("#!/bin/sh\n"))
+	mnt := testMount(t, s, Options{})
+	name := filepath.Join(mnt, "script.sh")
+
+	if err := os.Chmod(name, 0o750); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(name)
+	if err != nil || info.Mode().Perm() != 0o750 {
+		t.Errorf("mode after chmod = %v, %v", info.Mode(), err)
+	}
+}
+
+func TestMountErrors(t *testing.T) {
+	s := mockserver.New()
+	s.Put("/locked/file", []byte("x"))
+	s.Put("/ok", []byte("x"))
+	mnt := testMount(t, s, Options{})
+
+	s.Inject("/locked/file", 403, "PERMISSION_DENIED")
+	if _, err := os.ReadFile(filepath.Join(mnt, "locked/file")); !errors.Is(err, syscall.EPERM) {
+		t.Errorf("read of forbidden file: %v, want EPERM", err)
+	}
+	s.ClearFaults()
+
+	f, err := os.OpenFile(filepath.Join(mnt, "ok"), os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("rejected")
+	s.Inject("/ok", 422, "VALIDATION_FAILED")
+	if err := f.Close(); !errors.Is(err, syscall.EINVAL) {
+		t.Errorf("close of rejected write: %v, want EINVAL", err)
+	}
+	s.ClearFaults()
+
+	log, err := os.ReadFile(filepath.Join(mnt, controlDirName, "errors.log"))
+	if err != nil || !strings.Contains(string(log), "/ok VALIDATION_FAILED") {
+		t.Errorf("errors.log = %q, %v", log, err)
+	}
+}
+
+func TestMountSeesRemoteChanges(t *testing.T) {
+	s := mockserver.New()
+	s.Put("/shared", []byte("v1"))
+	mnt := testMount(t, s, Options{DirectIO: true})
+	name := filepath.Join(mnt, "shared")
+
+	if got, _ := os.ReadFile(name); string(got) != "v1" {
+		t.Fatalf("read %q", got)
+	}
+	s.Put("/shared", []byte("v2"))
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got, _ := os.ReadFile(name)
+		if string(got) == "v2" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("still reading %q after the remote change", got)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestMountRecordInode(t *testing.T) {
+	s := mockserver.New()
+	s.Put("/users/42.json", []byte("{}"))
+	s.SetContext("/users/42.json", map[string]interface{}{"schema": "users", "record_id": "42"})
+	mnt, root := testMountRoot(t, s, Options{})
+
+	// A cold lookup and a listing both key the inode by record
+	want := root.inodes.number("record:users/42")
+	info, err := os.Stat(filepath.Join(mnt, "users/42.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ino := info.Sys().(*syscall.Stat_t).Ino; ino != want {
+		t.Errorf("lookup inode = %d, want the record's %d", ino, want)
+	}
+	entries, err := os.ReadDir(filepath.Join(mnt, "users"))
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("readdir users = %v, %v", entries, err)
+	}
+	if info, err := entries[0].Info(); err != nil || info.Sys().(*syscall.Stat_t).Ino != want {
+		t.Errorf("listed inode = %v, %v, want %d", info, err, want)
+	}
+}
+
+func TestMountRemovedGeneration(t *testing.T) {
+	s := mockserver.New()
+	s.Put("/users/42.json", []byte("{}"))
+	s.SetContext("/users/42.json", map[string]interface{}{"schema": "users", "record_id": "42"})
+	s.Put("/notes/old", []byte("old"))
+	s.Put("/notes/new", []byte("new"))
+	mnt, root := testMountRoot(t, s, Options{})
+
+	// Removing a file bumps the generation of the key its inode was
+	// numbered by, whether unlinked or replaced by a rename
+	if _, err := os.Stat(filepath.Join(mnt, "users/42.json")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(mnt, "users/42.json")); err != nil {
+		t.Fatal(err)
+	}
+	if gen := root.inodes.generation("record:users/42"); gen != 1 {
+		t.Errorf("record generation after unlink = %d, want 1", gen)
+	}
+
+	if err := os.Rename(filepath.Join(mnt, "notes/new"), filepath.Join(mnt, "notes/old")); err != nil {
+		t.Fatal(err)
+	}
+	if gen := root.inodes.generation("/notes/old"); gen != 1 {
+		t.Errorf("replaced file generation after rename = %d, want 1", gen)
+	}
+}
+
+func TestMountRenameOverOpenFile(t *testing.T) {
+	s := mockserver.New()
+	s.Put("/notes/old", []byte("old"))
+	s.Put("/notes/new", []byte("new"))
+	mnt := testMount(t, s, Options{})
+
+	// Writes pending on the replaced file are dropped, as after unlink,
+	// instead of overwriting the file renamed into its place on close
+	f, err := os.OpenFile(filepath.Join(mnt, "notes/old"), os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString("stale"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(filepath.Join(mnt, "notes/new"), filepath.Join(mnt, "notes/old")); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if got, _ := s.Get("/notes/old"); string(got) != "new" {
+		t.Errorf("renamed file holds %q, want new", got)
+	}
+}
+
+func TestMountRenameTrashesReplaced(t *testing.T) {
+	s := mockserver.New()
+	s.Put("/notes/old", []byte("old"))
+	s.Put("/notes/new", []byte("new"))
+	s.Put("/notes/other", []byte("other"))
+	mnt, root := testMountRoot(t, s, Options{Trash: time.Hour})
+
+	trashed := func() []string {
+		var names []string
+		for _, name := range listNames(t, filepath.Join(mnt, trashDirName)) {
+			if name != trashMarkerName {
+				names = append(names, name)
+			}
+		}
+		return names
+	}
+
+	// A failed move puts the replaced file back
+	if _, err := os.Stat(filepath.Join(mnt, "notes/new")); err != nil {
+		t.Fatal(err)
+	}
+	s.Inject("/notes/new", 403, "FORBIDDEN")
+	if err := os.Rename(filepath.Join(mnt, "notes/new"), filepath.Join(mnt, "notes/old")); err == nil {
+		t.Fatal("rename succeeded despite the injected failure")
+	}
+	s.ClearFaults()
+	if got, _ := s.Get("/notes/old"); string(got) != "old" {
+		t.Errorf("replaced file holds %q after a failed rename, want old", got)
+	}
+	root.invalidate("/" + trashDirName)
+	if got := trashed(); len(got) != 0 {
+		t.Errorf("trash after a failed rename = %v, want empty", got)
+	}
+
+	// A successful one leaves it in the trash
+	if err := os.Rename(filepath.Join(mnt, "notes/other"), filepath.Join(mnt, "notes/old")); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.Get("/notes/old"); string(got) != "other" {
+		t.Errorf("renamed file holds %q, want other", got)
+	}
+	root.invalidate("/" + trashDirName)
+	if got := trashed(); len(got) != 1 || !strings.Contains(got[0], "old.") {
+		t.Errorf("trash after rename = %v", got)
+	}
+}
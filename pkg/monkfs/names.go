@@ -0,0 +1,194 @@
+package monkfs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"path"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// maxNameLen is the longest name the kernel will look up
+const maxNameLen = 255
+
+// nameHashLen is how many hex digits of a name's hash end its shortened
+// form
+const nameHashLen = 16
+
+// Names from the API are shown as they are unless they can't be, and then
+// escaped deterministically, so every entry listed can be opened and maps
+// back to exactly one API name:
+//
+//   - A name holding "/" or a control character is shown with those bytes,
+//     and any "%", percent-escaped as %XX.
+//   - A name that would otherwise be taken for escaped (it holds one of the
+//     sequences escaping produces) is escaped too, so "100%25" is shown as
+//     "100%2525" and not mistaken for "100%".
+//   - A name longer than maxNameLen bytes, once escaped, is shortened to a
+//     prefix, "~", a hash of the name and its extension. Shortened names
+//     are mapped back through the listing they were shown in.
+
+// escapedByte reports whether b is shown percent-escaped in names
+func escapedByte(b byte) bool {
+	return b == '/' || b == '%' || b < 0x20 || b == 0x7f
+}
+
+// escapeSequence returns the byte encoded by the escape at the start of s,
+// if s starts with one that escaping produces
+func escapeSequence(s string) (byte, bool) {
+	if len(s) < 3 || s[0] != '%' {
+		return 0, false
+	}
+	b, err := hex.DecodeString(s[1:3])
+	if err != nil || s[1:3] != strings.ToUpper(s[1:3]) || !escapedByte(b[0]) {
+		return 0, false
+	}
+	return b[0], true
+}
+
+// needsEscape reports whether name can't be shown as it is
+func needsEscape(name string) bool {
+	for i := 0; i < len(name); i++ {
+		if name[i] == '%' {
+			if _, ok := escapeSequence(name[i:]); ok {
+				return true
+			}
+		} else if escapedByte(name[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// escapeName returns how an API name is shown, before any shortening
+func escapeName(name string) string {
+	if !needsEscape(name) {
+		return name
+	}
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		if c := name[i]; escapedByte(c) {
+			b.WriteByte('%')
+			b.WriteString(strings.ToUpper(hex.EncodeToString([]byte{c})))
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// unescapeName returns the API name an escaped name stands for
+func unescapeName(name string) string {
+	if !needsEscape(name) {
+		return name
+	}
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		if c, ok := escapeSequence(name[i:]); ok {
+			b.WriteByte(c)
+			i += 2
+		} else {
+			b.WriteByte(name[i])
+		}
+	}
+	return b.String()
+}
+
+// shortenName cuts an escaped name down to maxNameLen bytes, keeping a
+// prefix at a character boundary, a hash of the whole name and a short
+// extension
+func shortenName(name string) string {
+	ext := path.Ext(name)
+	if len(ext) > 16 || strings.Contains(ext, "%") {
+		ext = ""
+	}
+	sum := sha256.Sum256([]byte(name))
+	keep := maxNameLen - len(ext) - 1 - nameHashLen
+	for keep > 0 && !utf8.RuneStart(name[keep]) {
+		keep--
+	}
+	return name[:keep] + "~" + hex.EncodeToString(sum[:])[:nameHashLen] + ext
+}
+
+// isShortened reports whether name has the form of a shortened name
+func isShortened(name string) bool {
+	base := strings.TrimSuffix(name, path.Ext(name))
+	if len(name) < maxNameLen-16 || len(base) <= nameHashLen {
+		return false
+	}
+	hash := base[len(base)-nameHashLen:]
+	if _, err := hex.DecodeString(hash); err != nil || hash != strings.ToLower(hash) {
+		return false
+	}
+	return base[len(base)-nameHashLen-1] == '~'
+}
+
+// nameTable maps the names shown for API names both ways, remembering the
+// API names of shortened ones
+type nameTable struct {
+	mu        sync.Mutex
+	shortened map[string]string // shown name -> API name
+}
+
+// newNameTable creates an empty name table
+func newNameTable() *nameTable {
+	return &nameTable{shortened: make(map[string]string)}
+}
+
+// display returns the name shown for an API name
+func (t *nameTable) display(apiName string) string {
+	name := escapeName(apiName)
+	if len(name) <= maxNameLen {
+		return name
+	}
+	short := shortenName(name)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.shortened[short] = apiName
+	return short
+}
+
+// api returns the API name a shown name stands for. A shortened name
+// can only be mapped back once its listing has been seen.
+func (t *nameTable) api(name string) string {
+	if isShortened(name) {
+		t.mu.Lock()
+		apiName, ok := t.shortened[name]
+		t.mu.Unlock()
+		if ok {
+			return apiName
+		}
+	}
+	return unescapeName(name)
+}
+
+// fileName returns the File API name a shown name stands for. File names
+// can't hold "/", so a name that would unescape to one is taken as it is.
+func (t *nameTable) fileName(name string) string {
+	if apiName := t.api(name); !strings.Contains(apiName, "/") {
+		return apiName
+	}
+	return name
+}
+
+// known reports whether a shortened name has been seen in a listing
+func (t *nameTable) known(name string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, ok := t.shortened[name]
+	return ok
+}
+
+// apiPath maps each name of a path shown in the mount to its File API
+// name
+func (t *nameTable) apiPath(shown string) string {
+	if !strings.ContainsAny(shown, "%~") {
+		return shown
+	}
+	names := strings.Split(shown, "/")
+	for i, name := range names {
+		names[i] = t.fileName(name)
+	}
+	return strings.Join(names, "/")
+}
@@ -0,0 +1,166 @@
+package monkfs
+
+import (
+	"context"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/ianzepp/monk-api-fuse/pkg/monkapi"
+)
+
+var _ = (fs.NodeUnlinker)((*MonkFS)(nil))
+var _ = (fs.NodeRenamer)((*MonkFS)(nil))
+
+// renameNoReplace is RENAME_NOREPLACE; FUSE passes Linux renameat2 flags
+const renameNoReplace = 0x1
+
+// Unlink deletes a file, or moves it to the trash. Handles still open on
+// it keep working: with DeferUnlink the remote file survives until the last
+// one is closed, as on a local filesystem; otherwise it is deleted now and
+// their pending writes are discarded instead of recreating it on close.
+func (n *MonkFS) Unlink(ctx context.Context, name string) syscall.Errno {
+	ctx, cancel := n.withDeadline(ctx, opWrite)
+	defer cancel()
+
+	if n.pattern {
+		return syscall.EROFS
+	}
+
+	path := n.childPath(name)
+	child := n.GetChild(name)
+	if child != nil && child.IsDir() {
+		return syscall.EISDIR
+	}
+	if errno := n.mayDelete(path); errno != 0 {
+		return errno
+	}
+
+	if child != nil {
+		ino := child.StableAttr().Ino
+		if n.opts.DeferUnlink && n.openFiles.deferUnlink(ino, path) {
+			n.markUnlinked(ino)
+			n.forgetPath(path)
+			return 0
+		}
+	}
+
+	if err := n.remove(ctx, path); err != nil {
+		return n.apiErrno(path, err)
+	}
+	if child != nil {
+		n.markUnlinked(child.StableAttr().Ino)
+	}
+	n.removedAt(path, child)
+	n.forgetPath(path)
+	return 0
+}
+
+// Rename moves a file through the File API. Handles open on it follow the
+// file, so writes still pending are stored under the new name on close.
+func (n *MonkFS) Rename(ctx context.Context, name string, newParent fs.InodeEmbedder, newName string, flags uint32) syscall.Errno {
+	ctx, cancel := n.withDeadline(ctx, opWrite)
+	defer cancel()
+
+	dest, ok := newParent.(*MonkFS)
+	if !ok || n.pattern || dest.pattern {
+		return syscall.EXDEV
+	}
+	if flags&^renameNoReplace != 0 {
+		return syscall.EINVAL
+	}
+
+	source, destination := n.childPath(name), dest.childPath(newName)
+	if errno := n.checkPathLength(destination); errno != 0 {
+		return errno
+	}
+	opts := monkapi.MoveOptions{Overwrite: flags&renameNoReplace == 0}
+	replaced := false
+	var trashed string
+	if opts.Overwrite {
+		// Replacing a file deletes it, so protection and the trash apply
+		// as in Unlink
+		_, errno := dest.lookupStat(ctx, destination)
+		replaced = errno == 0
+		if errno == 0 {
+			errno = n.mayDelete(destination)
+		}
+		if errno != 0 && errno != syscall.ENOENT {
+			return errno
+		}
+		// The move would overwrite the file, so it goes to the trash
+		// first and comes back if the move fails
+		if errno == 0 && n.opts.Trash > 0 && !inTrash(destination) {
+			var err error
+			if trashed, err = n.trash(ctx, destination); err != nil {
+				return n.apiErrno(destination, err)
+			}
+		}
+	}
+	if _, err := n.apiClient.Move(ctx, source, destination, opts, ""); err != nil {
+		if trashed != "" {
+			// If this fails too, the file is still in the trash
+			n.apiClient.Move(ctx, trashed, destination, monkapi.MoveOptions{}, "")
+			n.invalidate(trashed)
+		}
+		return n.apiErrno(source, err)
+	}
+
+	if child := n.GetChild(name); child != nil {
+		// A node found under other casing keeps its real path
+		if node, ok := child.Operations().(*MonkFS); ok {
+			node.pathMu.Lock()
+			if node.apiPath != "" {
+				node.apiPath = destination
+			}
+			node.pathMu.Unlock()
+		}
+		for _, fh := range n.openFiles.list(child.StableAttr().Ino) {
+			fh.mu.Lock()
+			fh.path = destination
+			fh.mu.Unlock()
+		}
+	}
+	if replaced {
+		// Handles open on the replaced file must not store it back under
+		// the name it lost, as after Unlink; and its inode number now
+		// belongs to another file
+		old := dest.GetChild(newName)
+		if old != nil && old != n.GetChild(name) {
+			n.markUnlinked(old.StableAttr().Ino)
+		}
+		dest.removedAt(destination, old)
+	}
+	n.openFiles.forget(destination)
+	n.forgetPath(source)
+	n.forgetPath(destination)
+	return 0
+}
+
+// markUnlinked flags the open handles of an unlinked inode, so their
+// pending writes are not stored back under the old name
+func (n *MonkFS) markUnlinked(ino uint64) {
+	for _, fh := range n.openFiles.list(ino) {
+		fh.mu.Lock()
+		fh.unlinked = true
+		fh.mu.Unlock()
+	}
+}
+
+// forgetPath drops cached metadata and listings for a path that was
+// removed or replaced
+func (n *MonkFS) forgetPath(path string) {
+	n.invalidate(path)
+	n.errLog.Clear(path)
+}
+
+// invalidate drops everything cached about path after it changed through
+// the mount: its metadata and that of its ancestors, whose modification
+// times moved; its own listing and its parent's; a cached miss; and any
+// recursive listing snapshot containing it. New and changed files then
+// show up in the next ls instead of after the caches expire.
+func (n *MonkFS) invalidate(path string) {
+	n.cache.Invalidate(path)
+	n.listings.Invalidate(path)
+	n.missing.Delete(path)
+	n.subtrees.invalidate(path)
+}
@@ -0,0 +1,161 @@
+package monkfs
+
+import (
+	"sync"
+)
+
+// openFileTable tracks the open handles of each inode, so operations on a
+// node can see writes pending on any of its handles and not only the one
+// the kernel passes in. The number of handles is the inode's open count;
+// unlinks deferred until the last close are recorded here as well.
+type openFileTable struct {
+	mu      sync.Mutex
+	files   map[uint64]*openFile
+	deleted map[string]bool // paths unlinked while open, deleted on last close
+
+	// open counts handles across all inodes, including ones still being
+	// opened; it never exceeds limit unless limit is zero
+	open    int
+	peak    int
+	refused uint64
+	limit   int
+}
+
+// openFile is the open state of one inode
+type openFile struct {
+	handles    []*MonkFileHandle
+	deferredRm string // path to delete once the last handle is released
+}
+
+func newOpenFileTable(limit int) *openFileTable {
+	return &openFileTable{
+		files:   make(map[uint64]*openFile),
+		deleted: make(map[string]bool),
+		limit:   limit,
+	}
+}
+
+// reserve counts a handle about to be opened, and reports false when the
+// limit is already reached. A reservation is ended by remove once the
+// handle is added, or by unreserve if the open fails.
+func (t *openFileTable) reserve() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.limit > 0 && t.open >= t.limit {
+		t.refused++
+		return false
+	}
+	t.open++
+	t.peak = max(t.peak, t.open)
+	return true
+}
+
+// unreserve ends the reservation of a handle that was not opened
+func (t *openFileTable) unreserve() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.open--
+}
+
+// counts returns the handles open now, the most open at once and how many
+// opens the limit refused
+func (t *openFileTable) counts() (open, peak int, refused uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.open, t.peak, t.refused
+}
+
+// add registers an opened handle, whose count was already reserved
+func (t *openFileTable) add(ino uint64, fh *MonkFileHandle) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	f, ok := t.files[ino]
+	if !ok {
+		f = &openFile{}
+		t.files[ino] = f
+	}
+	f.handles = append(f.handles, fh)
+}
+
+// remove unregisters a released handle. When it was the last one and an
+// unlink was deferred, it returns the path that should now be deleted.
+func (t *openFileTable) remove(ino uint64, fh *MonkFileHandle) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.open--
+	f, ok := t.files[ino]
+	if !ok {
+		return ""
+	}
+	for i, h := range f.handles {
+		if h == fh {
+			f.handles = append(f.handles[:i], f.handles[i+1:]...)
+			break
+		}
+	}
+	if len(f.handles) > 0 {
+		return ""
+	}
+
+	delete(t.files, ino)
+	if f.deferredRm != "" {
+		delete(t.deleted, f.deferredRm)
+	}
+	return f.deferredRm
+}
+
+// list returns the open handles of an inode
+func (t *openFileTable) list(ino uint64) []*MonkFileHandle {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	f, ok := t.files[ino]
+	if !ok {
+		return nil
+	}
+	return append([]*MonkFileHandle(nil), f.handles...)
+}
+
+// deferUnlink postpones deleting path until the inode's last handle is
+// released. It returns false when the inode is not open, in which case the
+// caller deletes immediately.
+func (t *openFileTable) deferUnlink(ino uint64, path string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	f, ok := t.files[ino]
+	if !ok {
+		return false
+	}
+	f.deferredRm = path
+	t.deleted[path] = true
+	return true
+}
+
+// isDeleted reports whether path was unlinked and is only kept until its
+// last handle closes, so it should no longer be visible by name
+func (t *openFileTable) isDeleted(path string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.deleted[path]
+}
+
+// forget cancels a deferred unlink of path, after something else has been
+// moved into its place
+func (t *openFileTable) forget(path string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.deleted[path] {
+		return
+	}
+	delete(t.deleted, path)
+	for _, f := range t.files {
+		if f.deferredRm == path {
+			f.deferredRm = ""
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package monkfs
+
+import (
+	"context"
+	"os"
+	"slices"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/ianzepp/monk-api-fuse/pkg/monkapi"
+)
+
+// xattrOwner exposes the Monk user that owns a record
+const xattrOwner = "user.monk.owner"
+
+// ownerContextKeys are the api_context fields naming a record's owner, in
+// order of preference
+var ownerContextKeys = []string{"owner", "owner_id", "created_by"}
+
+// OwnerMap maps the Monk users owning records to local uids, so ls -l shows
+// real ownership instead of the mounting user everywhere
+type OwnerMap struct {
+	// Users maps Monk user identifiers to uids
+	Users map[string]uint32 `json:"users"`
+
+	// Default is the uid of records whose owner is unknown or not in Users;
+	// zero leaves them owned by the mounting user
+	Default uint32 `json:"default"`
+}
+
+// uid returns the local uid of a record owner
+func (m *OwnerMap) uid(owner string) uint32 {
+	if uid, ok := m.Users[owner]; ok && owner != "" {
+		return uid
+	}
+	return m.Default
+}
+
+// mapsAny reports whether any of ids has a uid in the map
+func (m *OwnerMap) mapsAny(ids []string) bool {
+	if m == nil {
+		return false
+	}
+	return slices.ContainsFunc(ids, func(id string) bool {
+		_, ok := m.Users[id]
+		return ok
+	})
+}
+
+// user returns the Monk user mapped to uid. A uid mapped from several
+// users is ambiguous and not resolved.
+func (m *OwnerMap) user(uid uint32) (string, bool) {
+	found := ""
+	for user, u := range m.Users {
+		if u == uid {
+			if found != "" {
+				return "", false
+			}
+			found = user
+		}
+	}
+	return found, found != ""
+}
+
+// recordOwner returns the Monk user owning an entry, from its api_context
+func recordOwner(apiContext map[string]interface{}) string {
+	for _, key := range ownerContextKeys {
+		if owner := contextString(apiContext, key); owner != "" {
+			return owner
+		}
+	}
+	return ""
+}
+
+// statPick is the pick for stat requests. api_context is always fetched,
+// though it is most of a stat response: a record's inode number is derived
+// from it, and a lookup without it would key the inode by path instead,
+// giving the file a different number than Readdir does.
+func (n *MonkFS) statPick() string {
+	return "file_metadata,api_context"
+}
+
+// getOwnerXattr reads the owner of the node's record
+func (n *MonkFS) getOwnerXattr(ctx context.Context, dest []byte) (uint32, syscall.Errno) {
+	path := n.getPath()
+	stat, err := n.apiClient.Stat(ctx, path, "api_context")
+	if err != nil {
+		return 0, n.apiErrno(path, err)
+	}
+
+	owner := recordOwner(stat.APIContext)
+	if owner == "" {
+		return 0, syscall.Errno(fuse.ENOATTR)
+	}
+	return copyXattr(dest, []byte(owner))
+}
+
+// chown implements ownership changes. Keeping the current owner and group
+// always succeeds, so cp -p and tar work; with an owner map, a new owner
+// is transferred through the API. Anything else fails with EPERM.
+func (n *MonkFS) chown(ctx context.Context, uid, gid uint32, setUID, setGID bool) syscall.Errno {
+	var out fuse.AttrOut
+	if errno := n.Getattr(ctx, nil, &out); errno != 0 {
+		return errno
+	}
+
+	// Zero is filled in with the mounting user when the kernel sees it
+	owner, group := out.Attr.Uid, out.Attr.Gid
+	if owner == 0 {
+		owner = uint32(os.Getuid())
+	}
+	if group == 0 {
+		group = uint32(os.Getgid())
+	}
+
+	if setGID && gid != group {
+		return syscall.EPERM
+	}
+	if !setUID || uid == owner {
+		return 0
+	}
+	if n.pattern || n.opts.Owners == nil {
+		return syscall.EPERM
+	}
+	user, ok := n.opts.Owners.user(uid)
+	if !ok {
+		return syscall.EPERM
+	}
+
+	path := n.getPath()
+	if _, err := n.apiClient.Update(ctx, path, monkapi.UpdateOptions{Owner: user}, ""); err != nil {
+		return n.apiErrno(path, err)
+	}
+	n.invalidate(path)
+	return 0
+}
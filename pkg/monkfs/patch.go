@@ -0,0 +1,89 @@
+package monkfs
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	"github.com/ianzepp/monk-api-fuse/pkg/monkapi"
+)
+
+// patchMinSize is the file size below which changes are always stored
+// whole; sending the file costs about as much as sending its changes
+const patchMinSize = 64 << 10
+
+// patcher is implemented by API clients that can rewrite byte ranges of a
+// file in place
+type patcher interface {
+	Patch(ctx context.Context, path string, ranges []monkapi.PatchRange, size int64, pick string) (*monkapi.StoreResponse, error)
+}
+
+// storedAsShown reports whether files are stored byte for byte as they are
+// shown, so that ranges of a write buffer are ranges of the stored file
+func (n *MonkFS) storedAsShown() bool {
+	return !n.opts.PrettyJSON && n.opts.Encryption == nil
+}
+
+// byteRange is the half-open span [start, end) of a write buffer
+type byteRange struct {
+	start, end int
+}
+
+// markDirty records that [start, end) of the write buffer changed, keeping
+// the ranges sorted and merging ranges that touch. fh.mu must be held.
+func (fh *MonkFileHandle) markDirty(start, end int) {
+	if start >= end {
+		return
+	}
+	i, _ := slices.BinarySearchFunc(fh.dirtyRanges, start, func(r byteRange, start int) int {
+		return r.end - start
+	})
+	j := i
+	for j < len(fh.dirtyRanges) && fh.dirtyRanges[j].start <= end {
+		start = min(start, fh.dirtyRanges[j].start)
+		end = max(end, fh.dirtyRanges[j].end)
+		j++
+	}
+	fh.dirtyRanges = slices.Replace(fh.dirtyRanges, i, j, byteRange{start, end})
+}
+
+// patchable reports whether the pending writes are better sent as a patch:
+// the buffer holds the file as stored, unchanged but for the dirty ranges,
+// the file is large, and little of it changed. fh.mu must be held.
+func (fh *MonkFileHandle) patchable() bool {
+	if !fh.patchBase || len(fh.writeCache) < patchMinSize {
+		return false
+	}
+	changed := 0
+	for _, r := range fh.dirtyRanges {
+		changed += min(r.end, len(fh.writeCache)) - min(r.start, len(fh.writeCache))
+	}
+	return changed*2 <= len(fh.writeCache)
+}
+
+// patch stores the dirty ranges of the write buffer, reporting false if
+// the server cannot patch and the whole file must be stored instead.
+// fh.mu must be held.
+func (fh *MonkFileHandle) patch(ctx context.Context) (bool, error) {
+	p, ok := fh.node.apiClient.(patcher)
+	if !ok {
+		return false, nil
+	}
+
+	ranges := make([]monkapi.PatchRange, 0, len(fh.dirtyRanges))
+	for _, r := range fh.dirtyRanges {
+		if r.start >= len(fh.writeCache) {
+			break
+		}
+		ranges = append(ranges, monkapi.PatchRange{
+			Offset: int64(r.start),
+			Data:   fh.writeCache[r.start:min(r.end, len(fh.writeCache))],
+		})
+	}
+
+	_, err := p.Patch(ctx, fh.path, ranges, int64(len(fh.writeCache)), "")
+	if errors.Is(err, errors.ErrUnsupported) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,56 @@
+package monkfs
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+
+	"github.com/ianzepp/monk-api-fuse/pkg/monkapi"
+)
+
+// capabilityReporter is implemented by API clients that negotiate what the
+// server supports
+type capabilityReporter interface {
+	Capabilities() *monkapi.Capabilities
+}
+
+// pathLimits returns the path and name length limits the server reported,
+// zero where it reported none
+func (n *MonkFS) pathLimits() (maxPath, maxName int) {
+	reporter, ok := unaudited(n.staging.API).(capabilityReporter)
+	if !ok {
+		return 0, 0
+	}
+	caps := reporter.Capabilities()
+	if caps == nil {
+		return 0, 0
+	}
+	return caps.MaxPathLength, caps.MaxNameLength
+}
+
+// lengthLimit renders a length limit for /.monk/status
+func lengthLimit(limit int) string {
+	if limit <= 0 {
+		return "unlimited"
+	}
+	return fmt.Sprintf("%d bytes", limit)
+}
+
+// checkPathLength refuses a path the server would reject as too long with
+// ENAMETOOLONG, logging the limit it exceeds
+func (n *MonkFS) checkPathLength(path string) syscall.Errno {
+	maxPath, maxName := n.pathLimits()
+	if maxPath > 0 && len(path) > maxPath {
+		n.errLog.Record(path, fmt.Errorf("PATH_TOO_LONG: path is %d bytes, the API allows %d", len(path), maxPath))
+		return syscall.ENAMETOOLONG
+	}
+	if maxName > 0 {
+		for _, name := range strings.Split(path, "/") {
+			if len(name) > maxName {
+				n.errLog.Record(path, fmt.Errorf("NAME_TOO_LONG: %q is %d bytes, the API allows %d", name, len(name), maxName))
+				return syscall.ENAMETOOLONG
+			}
+		}
+	}
+	return 0
+}
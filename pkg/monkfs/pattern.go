@@ -0,0 +1,89 @@
+package monkfs
+
+import (
+	"context"
+	"strings"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/ianzepp/monk-api-fuse/pkg/monkapi"
+)
+
+// isPattern reports whether a name contains glob metacharacters
+func isPattern(name string) bool {
+	return strings.ContainsAny(name, "*?[")
+}
+
+// newPatternDir creates a virtual directory whose listing is the result of
+// a pattern list request for name under this node
+func (n *MonkFS) newPatternDir(ctx context.Context, name string, out *fuse.EntryOut) *fs.Inode {
+	node := n.newChild()
+	node.apiPath = n.childPath(name)
+	node.pattern = true
+
+	out.Attr.Mode = syscall.S_IFDIR | 0555
+	return n.NewInode(ctx, node, n.stableAttr(syscall.S_IFDIR, node.apiPath))
+}
+
+// listPattern forwards the wildcard path to the File API
+func (n *MonkFS) listPattern(ctx context.Context) (*monkapi.ListResponse, syscall.Errno) {
+	resp, err := n.apiClient.List(ctx, n.getPath(), monkapi.ListOptions{
+		LongFormat:          true,
+		PatternOptimization: true,
+	}, "entries")
+	if err != nil {
+		return nil, n.apiErrno(n.getPath(), err)
+	}
+	return resp, 0
+}
+
+// readdirPattern lists the entries matching this node's pattern
+func (n *MonkFS) readdirPattern(ctx context.Context) (fs.DirStream, syscall.Errno) {
+	resp, errno := n.listPattern(ctx)
+	if errno != 0 {
+		return nil, errno
+	}
+
+	entries := []fuse.DirEntry{}
+	for _, entry := range resp.Entries {
+		entries = append(entries, fuse.DirEntry{
+			Name: n.names.display(entry.Name),
+			Mode: parseFileMode(entry.FilePermissions, entry.FileType),
+			Ino:  n.entryInode(entry.Path, entry.APIContext),
+		})
+	}
+
+	return fs.NewListDirStream(entries), 0
+}
+
+// lookupPattern resolves a matched entry to its real API path
+func (n *MonkFS) lookupPattern(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	resp, errno := n.listPattern(ctx)
+	if errno != 0 {
+		return nil, errno
+	}
+
+	for _, entry := range resp.Entries {
+		if n.names.display(entry.Name) != name {
+			continue
+		}
+
+		gen := n.cache.Generation()
+		stat, err := n.apiClient.Stat(ctx, entry.Path, n.statPick())
+		if err != nil {
+			if monkapi.IsNotFound(err) {
+				return nil, syscall.ENOENT
+			}
+			return nil, n.apiErrno(entry.Path, err)
+		}
+		n.cache.SetSince(entry.Path, stat, gen)
+
+		node := n.newChild()
+		node.apiPath = entry.Path
+		n.fillAttr(&out.Attr, stat)
+		return n.NewInode(ctx, node, n.stableAttr(parseStatMode(stat), entryKey(entry.Path, entry.APIContext))), 0
+	}
+
+	return nil, syscall.ENOENT
+}
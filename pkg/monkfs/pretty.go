@@ -0,0 +1,45 @@
+package monkfs
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// isJSONDocument reports whether data is a JSON object or array, the only
+// content reformatted by the pretty-json view
+func isJSONDocument(data []byte) bool {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 || (trimmed[0] != '{' && trimmed[0] != '[') {
+		return false
+	}
+	return json.Valid(trimmed)
+}
+
+// prettyJSON re-indents JSON documents for display, returning other
+// content unchanged
+func prettyJSON(data []byte) []byte {
+	if !isJSONDocument(data) {
+		return data
+	}
+
+	var out bytes.Buffer
+	if err := json.Indent(&out, data, "", "  "); err != nil {
+		return data
+	}
+	out.WriteByte('\n')
+	return out.Bytes()
+}
+
+// compactJSON strips insignificant whitespace from JSON documents before
+// they are stored, returning other content unchanged
+func compactJSON(data []byte) []byte {
+	if !isJSONDocument(data) {
+		return data
+	}
+
+	var out bytes.Buffer
+	if err := json.Compact(&out, data); err != nil {
+		return data
+	}
+	return out.Bytes()
+}
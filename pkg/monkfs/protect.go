@@ -0,0 +1,120 @@
+package monkfs
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// approveFileName is the control file approving deletes of protected paths
+const approveFileName = "approve"
+
+// approvalTTL is how long an approval waits to be used
+const approvalTTL = 5 * time.Minute
+
+// protection refuses to delete paths matching its patterns unless the
+// delete was approved beforehand. Patterns containing "/" match the full
+// path; others match the base name. A path is also protected when one of
+// its parent directories matches, so a pattern can cover a whole tree.
+type protection struct {
+	patterns []string
+
+	mu       sync.Mutex
+	approved map[string]time.Time // path -> when the approval expires
+}
+
+// newProtection creates the protection for patterns, or nil if there are
+// none
+func newProtection(patterns []string) *protection {
+	if len(patterns) == 0 {
+		return nil
+	}
+	return &protection{patterns: patterns, approved: make(map[string]time.Time)}
+}
+
+// protected reports whether path or one of its parents matches a pattern
+func (p *protection) protected(filePath string) bool {
+	for dir := filePath; dir != "/" && dir != "."; dir = path.Dir(dir) {
+		for _, pattern := range p.patterns {
+			name := dir
+			if !strings.Contains(pattern, "/") {
+				name = path.Base(dir)
+			}
+			if ok, _ := path.Match(pattern, name); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// allow reports whether path may be deleted, using up its approval if it
+// is protected
+func (p *protection) allow(filePath string) bool {
+	if p == nil || !p.protected(filePath) {
+		return true
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	expires, ok := p.approved[filePath]
+	delete(p.approved, filePath)
+	return ok && time.Now().Before(expires)
+}
+
+// approve lets the next delete of path within approvalTTL go ahead
+func (p *protection) approve(ctx context.Context, filePath string) syscall.Errno {
+	if p == nil || !strings.HasPrefix(filePath, "/") {
+		return syscall.EINVAL
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	for approved, expires := range p.approved {
+		if !now.Before(expires) {
+			delete(p.approved, approved)
+		}
+	}
+	p.approved[path.Clean(filePath)] = now.Add(approvalTTL)
+	return 0
+}
+
+// Bytes renders the patterns and the approvals not yet used, for
+// /.monk/approve
+func (p *protection) Bytes() []byte {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var out []byte
+	for _, pattern := range p.patterns {
+		out = fmt.Appendf(out, "protect %s\n", pattern)
+	}
+	now := time.Now()
+	paths := make([]string, 0, len(p.approved))
+	for approved, expires := range p.approved {
+		if now.Before(expires) {
+			paths = append(paths, approved)
+		}
+	}
+	sort.Strings(paths)
+	for _, approved := range paths {
+		out = fmt.Appendf(out, "approved %s for %s\n", approved, p.approved[approved].Sub(now).Round(time.Second))
+	}
+	return out
+}
+
+// mayDelete refuses to delete a protected path that wasn't approved,
+// logging how to approve it
+func (n *MonkFS) mayDelete(filePath string) syscall.Errno {
+	if n.protect.allow(filePath) {
+		return 0
+	}
+	n.errLog.Record(filePath, fmt.Errorf("PROTECTED: write %s to /%s/%s to allow deleting it", filePath, controlDirName, approveFileName))
+	return syscall.EPERM
+}
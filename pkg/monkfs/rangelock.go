@@ -0,0 +1,215 @@
+package monkfs
+
+import (
+	"context"
+	"sync"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// rangeLock is an fcntl() byte-range lock held by one lock owner. The
+// range is inclusive, as in fuse.FileLock.
+type rangeLock struct {
+	owner      uint64
+	fh         *MonkFileHandle
+	start, end uint64
+	typ        uint32
+	pid        uint32
+}
+
+// rangeLockTable keeps the fcntl() byte-range locks of every inode on this
+// mount. The locks only exclude processes using this mount; with
+// EscalateLocks, an inode with any range locked also holds a server-side
+// whole-file lock, exclusive while any write lock is held, so other
+// clients are kept out as well.
+type rangeLockTable struct {
+	mu      sync.Mutex
+	locks   map[uint64][]rangeLock
+	remote  map[uint64]*remoteLock
+	changed chan struct{} // closed and replaced whenever locks change
+}
+
+func newRangeLockTable() *rangeLockTable {
+	return &rangeLockTable{
+		locks:   make(map[uint64][]rangeLock),
+		remote:  make(map[uint64]*remoteLock),
+		changed: make(chan struct{}),
+	}
+}
+
+// get reports the first lock conflicting with lk in out, or F_UNLCK
+func (t *rangeLockTable) get(ino uint64, owner uint64, lk *fuse.FileLock, out *fuse.FileLock) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if c := t.conflict(ino, owner, lk); c != nil {
+		*out = fuse.FileLock{Start: c.start, End: c.end, Typ: c.typ, Pid: c.pid}
+		return
+	}
+	*out = *lk
+	out.Typ = syscall.F_UNLCK
+}
+
+// set locks or unlocks a range for owner. A conflicting lock fails with
+// EAGAIN, or is waited for when wait is set.
+func (t *rangeLockTable) set(ctx context.Context, fh *MonkFileHandle, owner uint64, lk *fuse.FileLock, wait bool) syscall.Errno {
+	switch lk.Typ {
+	case syscall.F_UNLCK, syscall.F_RDLCK, syscall.F_WRLCK:
+	default:
+		return syscall.EINVAL
+	}
+	ino := fh.node.StableAttr().Ino
+
+	for {
+		t.mu.Lock()
+		if c := t.conflict(ino, owner, lk); c != nil {
+			changed := t.changed
+			t.mu.Unlock()
+
+			if !wait {
+				return syscall.EAGAIN
+			}
+			select {
+			case <-ctx.Done():
+				return syscall.EINTR
+			case <-changed:
+			}
+			continue
+		}
+
+		next := applyRangeLock(t.locks[ino], owner, fh, lk)
+		errno := t.escalate(ctx, fh, ino, next)
+		if errno == syscall.EWOULDBLOCK && wait {
+			t.mu.Unlock()
+			if errno := sleepLockPoll(ctx); errno != 0 {
+				return errno
+			}
+			continue
+		}
+		if errno == 0 {
+			t.update(ino, next)
+		}
+		t.mu.Unlock()
+		return errno
+	}
+}
+
+// release drops every lock taken through fh when it is closed
+func (t *rangeLockTable) release(ctx context.Context, fh *MonkFileHandle) {
+	ino := fh.node.StableAttr().Ino
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var next []rangeLock
+	for _, l := range t.locks[ino] {
+		if l.fh != fh {
+			next = append(next, l)
+		}
+	}
+	t.escalate(ctx, fh, ino, next)
+	t.update(ino, next)
+}
+
+// conflict returns a lock of another owner overlapping lk where either
+// side is a write lock. t.mu must be held.
+func (t *rangeLockTable) conflict(ino uint64, owner uint64, lk *fuse.FileLock) *rangeLock {
+	if lk.Typ == syscall.F_UNLCK {
+		return nil
+	}
+	for i, l := range t.locks[ino] {
+		if l.owner != owner && l.start <= lk.End && lk.Start <= l.end &&
+			(l.typ == syscall.F_WRLCK || lk.Typ == syscall.F_WRLCK) {
+			return &t.locks[ino][i]
+		}
+	}
+	return nil
+}
+
+// update replaces an inode's locks and wakes waiters. t.mu must be held.
+func (t *rangeLockTable) update(ino uint64, locks []rangeLock) {
+	if len(locks) == 0 {
+		delete(t.locks, ino)
+	} else {
+		t.locks[ino] = locks
+	}
+	close(t.changed)
+	t.changed = make(chan struct{})
+}
+
+// escalate brings the inode's server-side lock in line with the locks it
+// is about to hold. Converting between shared and exclusive is not atomic;
+// if the new lock cannot be taken, the previous one is restored when
+// possible. t.mu must be held.
+func (t *rangeLockTable) escalate(ctx context.Context, fh *MonkFileHandle, ino uint64, locks []rangeLock) syscall.Errno {
+	n := fh.node
+	if !n.opts.EscalateLocks {
+		return 0
+	}
+
+	held := len(locks) > 0
+	exclusive := false
+	for _, l := range locks {
+		if l.typ == syscall.F_WRLCK {
+			exclusive = true
+		}
+	}
+
+	current := t.remote[ino]
+	if current != nil && held && current.exclusive == exclusive {
+		return 0
+	}
+	if current == nil && !held {
+		return 0
+	}
+
+	delete(t.remote, ino)
+	if errno := n.releaseLock(ctx, current); errno != 0 || !held {
+		return errno
+	}
+
+	fh.mu.Lock()
+	path := fh.path
+	fh.mu.Unlock()
+
+	l, errno := n.acquireLock(ctx, path, exclusive, lockTTL, nil)
+	if errno != 0 {
+		if current != nil {
+			if restored, e := n.acquireLock(ctx, path, current.exclusive, lockTTL, nil); e == 0 {
+				t.remote[ino] = restored
+			}
+		}
+		return errno
+	}
+	t.remote[ino] = l
+	return 0
+}
+
+// applyRangeLock returns the locks after owner locks or unlocks lk's
+// range: the owner's existing locks there are replaced or split, as
+// fcntl(2) specifies
+func applyRangeLock(locks []rangeLock, owner uint64, fh *MonkFileHandle, lk *fuse.FileLock) []rangeLock {
+	next := make([]rangeLock, 0, len(locks)+2)
+	for _, l := range locks {
+		if l.owner != owner || l.end < lk.Start || lk.End < l.start {
+			next = append(next, l)
+			continue
+		}
+		if l.start < lk.Start {
+			left := l
+			left.end = lk.Start - 1
+			next = append(next, left)
+		}
+		if l.end > lk.End {
+			right := l
+			right.start = lk.End + 1
+			next = append(next, right)
+		}
+	}
+
+	if lk.Typ != syscall.F_UNLCK {
+		next = append(next, rangeLock{owner: owner, fh: fh, start: lk.Start, end: lk.End, typ: lk.Typ, pid: lk.Pid})
+	}
+	return next
+}
@@ -0,0 +1,177 @@
+package monkfs
+
+import (
+	"context"
+	"path"
+	"time"
+
+	"github.com/ianzepp/monk-api-fuse/internal/cache"
+	"github.com/ianzepp/monk-api-fuse/pkg/monkapi"
+)
+
+// listingTTL bounds how long a directory listing is reused. It is shorter
+// than the metadata TTL, since new and removed files show up in listings.
+const listingTTL = 10 * time.Second
+
+// subtreeTTL bounds how long a recursive listing snapshot is trusted
+const subtreeTTL = 30 * time.Second
+
+// subtreeSnapshot holds the listings of every directory below a root,
+// fetched with a single recursive list request, keyed by directory
+type subtreeSnapshot map[string][]monkapi.FileEntry
+
+// subtreeCache stores recursive listing snapshots keyed by subtree root.
+// A snapshot covers its root and every directory below it, so the
+// snapshots covering a directory are those of it and its ancestors.
+type subtreeCache struct {
+	snapshots *cache.Store[subtreeSnapshot]
+}
+
+func newSubtreeCache() *subtreeCache {
+	return &subtreeCache{snapshots: cache.NewStore[subtreeSnapshot](subtreeTTL, 0)}
+}
+
+// shareBudget counts the snapshots against b
+func (c *subtreeCache) shareBudget(b *cache.Budget) {
+	c.snapshots.ShareBudget(b, snapshotSize)
+}
+
+// snapshotSize estimates the memory a snapshot keeps alive
+func snapshotSize(snapshot subtreeSnapshot) int64 {
+	size := int64(0)
+	for dir, entries := range snapshot {
+		size += int64(len(dir)) + cache.ListingSize(entries)
+	}
+	return size
+}
+
+// listing returns the entries of dir from any live snapshot covering it
+func (c *subtreeCache) listing(dir string) ([]monkapi.FileEntry, bool) {
+	for root := dir; ; root = path.Dir(root) {
+		if snapshot, ok := c.snapshots.Get(root); ok {
+			if entries, ok := snapshot[dir]; ok {
+				return entries, true
+			}
+		}
+		if root == "/" {
+			return nil, false
+		}
+	}
+}
+
+// invalidate drops every snapshot listing the parent of p, after p was
+// created, removed or renamed
+func (c *subtreeCache) invalidate(p string) {
+	var roots []string
+	for root := path.Dir(p); ; root = path.Dir(root) {
+		roots = append(roots, root)
+		if root == "/" {
+			break
+		}
+	}
+	c.snapshots.Delete(roots...)
+}
+
+// generation returns the number of invalidations so far; read it before
+// fetching a listing to store
+func (c *subtreeCache) generation() uint64 {
+	return c.snapshots.Generation()
+}
+
+// store records a recursive listing of root, grouping entries by parent,
+// unless the cache was invalidated since generation returned gen
+func (c *subtreeCache) store(root string, entries []monkapi.FileEntry, gen uint64) {
+	snapshot := subtreeSnapshot{root: {}}
+	for _, entry := range entries {
+		parent := path.Dir(entry.Path)
+		snapshot[parent] = append(snapshot[parent], entry)
+		if entry.FileType == "d" {
+			if _, ok := snapshot[entry.Path]; !ok {
+				snapshot[entry.Path] = []monkapi.FileEntry{}
+			}
+		}
+	}
+	// Expired snapshots are never read again, and there is one per
+	// subtree listed
+	c.snapshots.Sweep()
+	c.snapshots.SetSince(root, snapshot, gen)
+}
+
+// listEntries lists a directory, reusing a listing fetched within
+// listingTTL. With RecursiveList, the first listing
+// fetches the whole subtree in one request and caches every entry's
+// metadata, so find and grep -r below it need no further list or stat
+// calls until the snapshot expires.
+func (n *MonkFS) listEntries(ctx context.Context, dir string) ([]monkapi.FileEntry, error) {
+	if !n.opts.RecursiveList {
+		if entries, ok := n.listings.Get(dir); ok {
+			return entries, nil
+		}
+
+		// Use pick=entries to get just the array (60% bandwidth reduction)
+		gen := n.listings.Generation()
+		resp, err := n.apiClient.List(ctx, dir, monkapi.ListOptions{
+			LongFormat: true,
+		}, "entries")
+		if err != nil {
+			return nil, err
+		}
+		n.listings.SetSince(dir, resp.Entries, gen)
+		return resp.Entries, nil
+	}
+
+	if entries, ok := n.subtrees.listing(dir); ok {
+		return entries, nil
+	}
+
+	gen, statGen := n.subtrees.generation(), n.cache.Generation()
+	resp, err := n.apiClient.List(ctx, dir, monkapi.ListOptions{
+		LongFormat: true,
+		Recursive:  true,
+	}, "entries")
+	if err != nil {
+		return nil, err
+	}
+
+	n.subtrees.store(dir, resp.Entries, gen)
+	for _, entry := range resp.Entries {
+		n.cache.SetSince(entry.Path, statFromEntry(entry), statGen)
+	}
+
+	if entries, ok := n.subtrees.listing(dir); ok {
+		return entries, nil
+	}
+	// Invalidated while listing; answer with what was listed
+	return childEntries(dir, resp.Entries), nil
+}
+
+// childEntries returns the entries of a recursive listing directly inside
+// dir
+func childEntries(dir string, entries []monkapi.FileEntry) []monkapi.FileEntry {
+	children := []monkapi.FileEntry{}
+	for _, entry := range entries {
+		if path.Dir(entry.Path) == dir {
+			children = append(children, entry)
+		}
+	}
+	return children
+}
+
+// statFromEntry builds the metadata of a long-format list entry
+func statFromEntry(entry monkapi.FileEntry) *monkapi.StatResponse {
+	fileType := "file"
+	if entry.FileType == "d" {
+		fileType = "directory"
+	}
+	return &monkapi.StatResponse{
+		Success:    true,
+		Type:       fileType,
+		APIContext: entry.APIContext,
+		FileMetadata: monkapi.FileMetadata{
+			Size:         entry.FileSize,
+			ModifiedTime: entry.FileModified,
+			Type:         fileType,
+			Permissions:  entry.FilePermissions,
+		},
+	}
+}
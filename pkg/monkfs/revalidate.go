@@ -0,0 +1,80 @@
+package monkfs
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ianzepp/monk-api-fuse/pkg/monkapi"
+)
+
+// revalidateTimeout bounds a background metadata refresh
+const revalidateTimeout = 30 * time.Second
+
+// revalidator tracks the paths being refreshed in the background, so a
+// burst of stat calls on an expired entry sends one request
+type revalidator struct {
+	mu      sync.Mutex
+	pending map[string]bool
+}
+
+func newRevalidator() *revalidator {
+	return &revalidator{pending: make(map[string]bool)}
+}
+
+// cachedStat returns the cached metadata for path, or nil. With
+// StaleWhileRevalidate, an entry that expired no longer ago than that is
+// still returned, and refreshed in the background so the caller does not
+// wait on the API.
+func (n *MonkFS) cachedStat(path string) *monkapi.StatResponse {
+	if n.opts.StaleWhileRevalidate <= 0 {
+		return n.cache.Get(path)
+	}
+
+	stat, expires := n.cache.Peek(path)
+	if stat == nil {
+		return nil
+	}
+	if expired := time.Since(expires); expired > 0 {
+		if expired > n.opts.StaleWhileRevalidate {
+			return nil
+		}
+		n.revalidate(path)
+	}
+	return stat
+}
+
+// revalidate refreshes the metadata of path in the background unless a
+// refresh is already under way
+func (n *MonkFS) revalidate(path string) {
+	r := n.revalidating
+	r.mu.Lock()
+	if r.pending[path] {
+		r.mu.Unlock()
+		return
+	}
+	r.pending[path] = true
+	r.mu.Unlock()
+
+	go func() {
+		defer func() {
+			r.mu.Lock()
+			delete(r.pending, path)
+			r.mu.Unlock()
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), revalidateTimeout)
+		defer cancel()
+
+		gen := n.cache.Generation()
+		stat, err := n.apiClient.Stat(ctx, path, n.statPick())
+		switch {
+		case err == nil:
+			n.cache.SetSince(path, stat, gen)
+			n.markFresh(path)
+		case monkapi.IsNotFound(err):
+			// Deleted elsewhere; the next lookup finds it missing
+			n.invalidate(path)
+		}
+	}()
+}
@@ -0,0 +1,113 @@
+package monkfs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// schemaFileName is the virtual file exposing a schema's definition inside
+// its data directory
+const schemaFileName = ".schema.json"
+
+// schemaForDir returns the schema name when path is a /data/<schema>
+// directory
+func schemaForDir(path string) (string, bool) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) != 2 || parts[0] != "data" || parts[1] == "" {
+		return "", false
+	}
+	return parts[1], true
+}
+
+// schemaFile is a read-only view of a schema definition from the Describe API
+type schemaFile struct {
+	fs.Inode
+	root   *MonkFS
+	schema string
+
+	mu   sync.Mutex
+	data []byte
+}
+
+var _ = (fs.NodeOpener)((*schemaFile)(nil))
+var _ = (fs.NodeReader)((*schemaFile)(nil))
+var _ = (fs.NodeGetattrer)((*schemaFile)(nil))
+
+// newSchemaFile fetches the schema definition and creates its inode
+func (n *MonkFS) newSchemaFile(ctx context.Context, parent *fs.Inode, schema string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	file := &schemaFile{root: n, schema: schema}
+	if errno := file.refresh(ctx); errno != 0 {
+		return nil, errno
+	}
+
+	file.fillAttr(&out.Attr)
+	return parent.NewInode(ctx, file, n.stableAttr(syscall.S_IFREG, "/data/"+schema+"/"+schemaFileName)), 0
+}
+
+// refresh re-fetches the definition from the Describe API
+func (f *schemaFile) refresh(ctx context.Context) syscall.Errno {
+	raw, err := f.root.apiClient.Describe(ctx, f.schema)
+	if err != nil {
+		return f.root.apiErrno("/data/"+f.schema+"/"+schemaFileName, err)
+	}
+
+	var pretty bytes.Buffer
+	if err := json.Indent(&pretty, raw, "", "  "); err != nil {
+		return syscall.EIO
+	}
+	pretty.WriteByte('\n')
+
+	f.mu.Lock()
+	f.data = pretty.Bytes()
+	f.mu.Unlock()
+	return 0
+}
+
+// Open refreshes the definition so each open sees the current schema
+func (f *schemaFile) Open(ctx context.Context, flags uint32) (fs.FileHandle, uint32, syscall.Errno) {
+	if flags&(syscall.O_WRONLY|syscall.O_RDWR) != 0 {
+		return nil, 0, syscall.EACCES
+	}
+	if errno := f.refresh(ctx); errno != 0 {
+		return nil, 0, errno
+	}
+	return nil, fuse.FOPEN_DIRECT_IO, 0
+}
+
+// Read returns the definition at the given offset
+func (f *schemaFile) Read(ctx context.Context, fh fs.FileHandle, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if off >= int64(len(f.data)) {
+		return fuse.ReadResultData([]byte{}), 0
+	}
+	end := off + int64(len(dest))
+	if end > int64(len(f.data)) {
+		end = int64(len(f.data))
+	}
+	return fuse.ReadResultData(f.data[off:end]), 0
+}
+
+// Getattr reports the size of the last fetched definition
+func (f *schemaFile) Getattr(ctx context.Context, fh fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	f.fillAttr(&out.Attr)
+	return 0
+}
+
+func (f *schemaFile) fillAttr(attr *fuse.Attr) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	attr.Mode = syscall.S_IFREG | 0444
+	attr.Size = uint64(len(f.data))
+	attr.Nlink = 1
+	fillBlocks(attr)
+}
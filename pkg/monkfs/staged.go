@@ -0,0 +1,392 @@
+package monkfs
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ianzepp/monk-api-fuse/pkg/monkapi"
+)
+
+// stagedState is what the queued changes make of one path. A path no
+// queued change touches is whatever the API holds at source, which is the
+// path itself.
+type stagedState struct {
+	changed bool // a queued change decides what the path is
+	deleted bool
+	dir     bool // a directory, made by a queued change if source has none
+
+	// A file stored in dry-run mode has its content in data; otherwise
+	// the API holds the file or directory at source, under its own name
+	// unless it was moved or copied here
+	stored bool
+	data   []byte
+	source string
+
+	perm string    // permissions set by a queued update
+	at   time.Time // when the content was queued
+}
+
+// below reports whether p is inside the directory dir
+func below(p, dir string) bool {
+	if dir == "/" {
+		return p != "/"
+	}
+	return strings.HasPrefix(p, dir+"/")
+}
+
+// stagedAt replays changes backwards to find what they make of p
+func stagedAt(changes []stagedChange, p string) stagedState {
+	for j := len(changes) - 1; j >= 0; j-- {
+		c := changes[j]
+		switch c.op {
+		case "store":
+			if c.path == p {
+				return stagedState{changed: true, stored: true, data: c.data, at: c.at}
+			}
+			if below(c.path, p) {
+				return stagedDir(changes[:j], p)
+			}
+		case "delete":
+			if c.path == p || below(p, c.path) {
+				return stagedState{changed: true, deleted: true}
+			}
+		case "move", "copy":
+			if c.destination == p || below(p, c.destination) {
+				st := stagedAt(changes[:j], c.path+strings.TrimPrefix(p, c.destination))
+				st.changed = true
+				return st
+			}
+			if below(c.destination, p) {
+				return stagedDir(changes[:j], p)
+			}
+			if c.op == "move" && (c.path == p || below(p, c.path)) {
+				return stagedState{changed: true, deleted: true}
+			}
+		case "update":
+			if c.path == p {
+				st := stagedAt(changes[:j], p)
+				st.changed = true
+				if c.perm != "" {
+					st.perm = c.perm
+				}
+				return st
+			}
+		}
+	}
+	return stagedState{source: p}
+}
+
+// stagedDir is the state of p once a queued change put something inside
+// it: the directory it was, or a new one
+func stagedDir(changes []stagedChange, p string) stagedState {
+	st := stagedAt(changes, p)
+	if st.deleted || st.stored {
+		return stagedState{changed: true, dir: true}
+	}
+	st.changed, st.dir = true, true
+	return st
+}
+
+// stagedChildren returns the names of the entries queued changes may have
+// put directly inside dir, including those put inside a directory moved or
+// copied to it; stagedAt tells which are still there
+func stagedChildren(changes []stagedChange, dir string) []string {
+	var names []string
+	for j, c := range changes {
+		added := c.destination
+		if c.op == "store" {
+			added = c.path
+		}
+		if added == "" {
+			continue
+		}
+		if below(added, dir) {
+			rest := strings.TrimPrefix(strings.TrimPrefix(added, dir), "/")
+			names = append(names, strings.SplitN(rest, "/", 2)[0])
+		}
+		if added == dir || below(dir, added) {
+			names = append(names, stagedChildren(changes[:j], c.path+strings.TrimPrefix(dir, added))...)
+		}
+	}
+	return names
+}
+
+// notFound is the error the API answers for a path that does not exist
+func notFound(p string) error {
+	return &monkapi.APIError{StatusCode: 404, ErrorCode: "FILE_NOT_FOUND", Message: "not found: " + p}
+}
+
+// stat returns the metadata of a path in the state queued changes made of
+// it
+func (s *stagingAPI) stat(ctx context.Context, p string, st stagedState, pick string) (*monkapi.StatResponse, error) {
+	switch {
+	case st.deleted:
+		return nil, notFound(p)
+	case st.stored:
+		return &monkapi.StatResponse{Success: true, Type: "file", FileMetadata: monkapi.FileMetadata{
+			Size:         int64(len(st.data)),
+			ModifiedTime: st.at.UTC().Format(time.RFC3339),
+			CreatedTime:  st.at.UTC().Format(time.RFC3339),
+			AccessTime:   st.at.UTC().Format(time.RFC3339),
+			Type:         "file",
+			Permissions:  st.perm,
+		}}, nil
+	}
+
+	if st.source != "" {
+		resp, err := s.API.Stat(ctx, st.source, pick)
+		if err == nil {
+			if st.perm != "" {
+				copied := *resp
+				copied.FileMetadata.Permissions = st.perm
+				resp = &copied
+			}
+			return resp, nil
+		}
+		if !st.dir || !monkapi.IsNotFound(err) {
+			return nil, err
+		}
+	}
+	return &monkapi.StatResponse{Success: true, Type: "directory", FileMetadata: monkapi.FileMetadata{
+		Type:        "directory",
+		Permissions: st.perm,
+	}}, nil
+}
+
+// entry returns the list entry of a path in the state queued changes made
+// of it
+func (s *stagingAPI) entry(ctx context.Context, p string, st stagedState) (monkapi.FileEntry, error) {
+	stat, err := s.stat(ctx, p, st, "")
+	if err != nil {
+		return monkapi.FileEntry{}, err
+	}
+	fileType := "f"
+	if stat.Type == "directory" || stat.FileMetadata.Type == "directory" {
+		fileType = "d"
+	}
+	return monkapi.FileEntry{
+		Name:            path.Base(p),
+		FileType:        fileType,
+		FileSize:        stat.FileMetadata.Size,
+		FilePermissions: stat.FileMetadata.Permissions,
+		FileModified:    stat.FileMetadata.ModifiedTime,
+		Path:            p,
+		APIContext:      stat.APIContext,
+	}, nil
+}
+
+func (s *stagingAPI) Stat(ctx context.Context, p string, pick string) (*monkapi.StatResponse, error) {
+	st := stagedAt(s.changes(), p)
+	if !st.changed {
+		return s.API.Stat(ctx, p, pick)
+	}
+	return s.stat(ctx, p, st, pick)
+}
+
+func (s *stagingAPI) StatBatch(ctx context.Context, paths []string, pick string) []monkapi.StatResult {
+	changes := s.changes()
+	if len(changes) == 0 {
+		return s.API.StatBatch(ctx, paths, pick)
+	}
+
+	results := make([]monkapi.StatResult, len(paths))
+	var unchanged []string
+	var at []int
+	for i, p := range paths {
+		st := stagedAt(changes, p)
+		if !st.changed {
+			unchanged = append(unchanged, p)
+			at = append(at, i)
+			continue
+		}
+		stat, err := s.stat(ctx, p, st, pick)
+		results[i] = monkapi.StatResult{Path: p, Stat: stat, Err: err}
+	}
+	if len(unchanged) > 0 {
+		for i, r := range s.API.StatBatch(ctx, unchanged, pick) {
+			results[at[i]] = r
+		}
+	}
+	return results
+}
+
+// window returns the part of queued content a retrieve asks for
+func (st stagedState) window(opts monkapi.RetrieveOptions) []byte {
+	data := st.data[min(max(opts.StartOffset, 0), len(st.data)):]
+	if opts.MaxBytes > 0 && opts.MaxBytes < len(data) {
+		data = data[:opts.MaxBytes]
+	}
+	return data
+}
+
+// readable returns an error unless p is a file in the state queued changes
+// made of it
+func (st stagedState) readable(p string) error {
+	switch {
+	case st.deleted:
+		return notFound(p)
+	case st.dir:
+		return &monkapi.APIError{StatusCode: 400, ErrorCode: "NOT_A_FILE", Message: "not a file: " + p}
+	}
+	return nil
+}
+
+func (s *stagingAPI) Retrieve(ctx context.Context, p string, opts monkapi.RetrieveOptions, pick string) (*monkapi.RetrieveResponse, error) {
+	st := stagedAt(s.changes(), p)
+	if !st.changed {
+		return s.API.Retrieve(ctx, p, opts, pick)
+	}
+	if err := st.readable(p); err != nil {
+		return nil, err
+	}
+	if !st.stored {
+		return s.API.Retrieve(ctx, st.source, opts, pick)
+	}
+
+	// Answer as the API would, in base64 when asked or when the content
+	// can't be sent as a JSON string
+	data := st.window(opts)
+	resp := &monkapi.RetrieveResponse{Success: true}
+	if opts.Encoding == encodingBase64 || !utf8.Valid(data) {
+		resp.Encoding = encodingBase64
+		resp.Content, _ = json.Marshal(base64.StdEncoding.EncodeToString(data))
+	} else {
+		resp.Content, _ = json.Marshal(string(data))
+	}
+	return resp, nil
+}
+
+func (s *stagingAPI) RetrieveStream(ctx context.Context, p string, opts monkapi.RetrieveOptions) (io.ReadCloser, error) {
+	st := stagedAt(s.changes(), p)
+	if !st.changed {
+		return s.API.RetrieveStream(ctx, p, opts)
+	}
+	if err := st.readable(p); err != nil {
+		return nil, err
+	}
+	if !st.stored {
+		return s.API.RetrieveStream(ctx, st.source, opts)
+	}
+	return io.NopCloser(bytes.NewReader(st.window(opts))), nil
+}
+
+// List lays queued changes over the listing of a directory. A recursive
+// listing of a directory they touch is put together from listings of each
+// directory in it.
+func (s *stagingAPI) List(ctx context.Context, dir string, opts monkapi.ListOptions, pick string) (*monkapi.ListResponse, error) {
+	changes := s.changes()
+	touched := false
+	for _, c := range changes {
+		for _, p := range []string{c.path, c.destination} {
+			if p != "" && (p == dir || below(p, dir) || below(dir, p)) {
+				touched = true
+			}
+		}
+	}
+	// Totals are only used for statistics, which can do without the
+	// requests putting a whole tree together would take
+	if !touched || pick == "total" {
+		return s.API.List(ctx, dir, opts, pick)
+	}
+
+	entries, err := s.list(ctx, changes, dir, opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Recursive {
+		for depth, todo := 1, entries; len(todo) > 0 && (opts.MaxDepth <= 0 || depth < opts.MaxDepth); depth++ {
+			var next []monkapi.FileEntry
+			for _, e := range todo {
+				if e.FileType != "d" {
+					continue
+				}
+				children, err := s.list(ctx, changes, e.Path, opts)
+				if err != nil {
+					return nil, err
+				}
+				next = append(next, children...)
+			}
+			entries = append(entries, next...)
+			todo = next
+		}
+	}
+	return &monkapi.ListResponse{Success: true, Entries: entries, Total: len(entries)}, nil
+}
+
+// list returns the entries directly inside dir with queued changes laid
+// over them
+func (s *stagingAPI) list(ctx context.Context, changes []stagedChange, dir string, opts monkapi.ListOptions) ([]monkapi.FileEntry, error) {
+	st := stagedAt(changes, dir)
+	if st.deleted {
+		return nil, notFound(dir)
+	}
+	if st.stored {
+		return nil, &monkapi.APIError{StatusCode: 400, ErrorCode: "NOT_A_DIRECTORY", Message: "not a directory: " + dir}
+	}
+
+	var listed []monkapi.FileEntry
+	if st.source != "" {
+		opts.Recursive, opts.MaxDepth = false, 0
+		resp, err := s.API.List(ctx, st.source, opts, "entries")
+		if err == nil {
+			listed = resp.Entries
+		} else if !st.dir || !monkapi.IsNotFound(err) {
+			return nil, err
+		}
+	}
+
+	var entries []monkapi.FileEntry
+	seen := make(map[string]bool)
+	for _, e := range listed {
+		p := path.Join(dir, e.Name)
+		seen[e.Name] = true
+		child := stagedAt(changes, p)
+		if !child.changed {
+			e.Path = p
+			entries = append(entries, e)
+			continue
+		}
+		if child.deleted {
+			continue
+		}
+		e, err := s.entry(ctx, p, child)
+		if monkapi.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+
+	names := stagedChildren(changes, dir)
+	sort.Strings(names)
+	for _, name := range names {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		p := path.Join(dir, name)
+		child := stagedAt(changes, p)
+		if child.deleted {
+			continue
+		}
+		e, err := s.entry(ctx, p, child)
+		if monkapi.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
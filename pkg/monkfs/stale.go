@@ -0,0 +1,146 @@
+package monkfs
+
+import (
+	"context"
+	"errors"
+	"syscall"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/ianzepp/monk-api-fuse/internal/cache"
+	"github.com/ianzepp/monk-api-fuse/pkg/monkapi"
+)
+
+// xattrStale is present on paths whose metadata, listing or content was
+// last served from an expired cache entry because the API failed; its
+// value is when that happened
+const xattrStale = "user.monk.stale"
+
+// Limits of the content kept for StaleIfError: only files read whole in
+// one request are kept, so large files are never held in memory
+const (
+	staleContentEntries = 1024
+	staleContentMax     = 1 << 20
+)
+
+// staleState holds what StaleIfError needs beyond the metadata and listing
+// caches
+type staleState struct {
+	contents *cache.Store[[]byte]    // content of small files as last read
+	served   *cache.Store[time.Time] // paths answered with stale data, and when
+}
+
+// newStaleState returns the stale state for opts, or nil when StaleIfError
+// is off
+func newStaleState(opts *Options) *staleState {
+	if !opts.StaleIfError {
+		return nil
+	}
+	// Content is only ever used once stale, so it is stored already expired
+	return &staleState{
+		contents: cache.NewStore[[]byte](0, staleContentEntries),
+		served:   cache.NewStore[time.Time](24*time.Hour, opts.CacheEntries),
+	}
+}
+
+// transient reports whether err may clear up on its own: the API being
+// unreachable, timing out or failing with a server error. Answers about
+// the request itself, such as not found or permission denied, are not.
+func transient(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, errDecrypt) {
+		return false
+	}
+	var apiErr *monkapi.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode >= 500
+	}
+	var fieldErr *monkapi.FieldError
+	return !errors.As(err, &fieldErr)
+}
+
+// staleStat returns expired cached metadata for path in place of a
+// transient failure, when StaleIfError is set
+func (n *MonkFS) staleStat(path string, err error) *monkapi.StatResponse {
+	if n.stale == nil || !transient(err) {
+		return nil
+	}
+	stat := n.cache.GetStale(path)
+	if stat != nil {
+		n.markStale(path)
+	}
+	return stat
+}
+
+// staleListing returns the expired cached listing of dir in place of a
+// transient failure, when StaleIfError is set
+func (n *MonkFS) staleListing(dir string, err error) ([]monkapi.FileEntry, bool) {
+	if n.stale == nil || !transient(err) {
+		return nil, false
+	}
+	entries, ok := n.listings.GetStale(dir)
+	if ok {
+		n.markStale(dir)
+	}
+	return entries, ok
+}
+
+// staleContent returns the content of path as last read in place of a
+// transient failure, when StaleIfError is set
+func (n *MonkFS) staleContent(path string, err error) ([]byte, bool) {
+	if n.stale == nil || !transient(err) {
+		return nil, false
+	}
+	content, ok := n.stale.contents.GetStale(path)
+	if !ok {
+		return nil, false
+	}
+	if n.opts.CompressCache {
+		if content, err = decompressContent(content); err != nil {
+			return nil, false
+		}
+	}
+	n.markStale(path)
+	return content, true
+}
+
+// keepContent remembers the content of path for staleRead if it is small
+// enough
+func (n *MonkFS) keepContent(path string, content []byte) {
+	if n.stale == nil || len(content) > staleContentMax {
+		return
+	}
+	if n.opts.CompressCache {
+		content = compressContent(content)
+	}
+	n.stale.contents.Set(path, content)
+}
+
+// markStale records that path was answered with stale data
+func (n *MonkFS) markStale(path string) {
+	n.stale.served.Set(path, time.Now())
+}
+
+// markFresh records that path was answered from the API again
+func (n *MonkFS) markFresh(path string) {
+	if n.stale != nil {
+		n.stale.served.Delete(path)
+	}
+}
+
+// staleSince returns when path was last answered with stale data, if it
+// has not been answered from the API since
+func (n *MonkFS) staleSince(path string) (time.Time, bool) {
+	if n.stale == nil {
+		return time.Time{}, false
+	}
+	return n.stale.served.Get(path)
+}
+
+// getStaleXattr reports when this path was served stale
+func (n *MonkFS) getStaleXattr(dest []byte) (uint32, syscall.Errno) {
+	since, ok := n.staleSince(n.getPath())
+	if !ok {
+		return 0, syscall.Errno(fuse.ENOATTR)
+	}
+	return copyXattr(dest, []byte(since.UTC().Format(time.RFC3339)))
+}
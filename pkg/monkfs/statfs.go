@@ -0,0 +1,64 @@
+package monkfs
+
+import (
+	"context"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/ianzepp/monk-api-fuse/pkg/monkapi"
+)
+
+// statfsTTL is how long the entry count is trusted; counting walks the
+// whole tree server-side, and df is often run in a loop
+const statfsTTL = time.Minute
+
+// statfsFreeFiles is reported as the free inode count. The API has no
+// limit on entries, so tools checking for inode exhaustion should always
+// find plenty left.
+const statfsFreeFiles = 1 << 32
+
+var _ = (fs.NodeStatfser)((*MonkFS)(nil))
+
+// entryCount caches the number of entries below the mount root
+type entryCount struct {
+	mu      sync.Mutex
+	total   uint64
+	fetched time.Time
+}
+
+// Statfs reports the entries below the mount root as used inodes
+func (n *MonkFS) Statfs(ctx context.Context, out *fuse.StatfsOut) syscall.Errno {
+	ctx, cancel := n.withDeadline(ctx, opMetadata)
+	defer cancel()
+
+	out.Files = n.entries.get(ctx, n.apiClient) + statfsFreeFiles
+	out.Ffree = statfsFreeFiles
+	out.Bsize = 4096
+	out.Frsize = 4096
+	out.NameLen = maxNameLen
+	if _, maxName := n.pathLimits(); maxName > 0 {
+		out.NameLen = uint32(min(maxName, maxNameLen))
+	}
+	return 0
+}
+
+// get returns the entry count, counting again once it is older than
+// statfsTTL. A failed count keeps the previous one, so df keeps working
+// through an outage.
+func (c *entryCount) get(ctx context.Context, apiClient monkapi.API) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Since(c.fetched) < statfsTTL {
+		return c.total
+	}
+	resp, err := apiClient.List(ctx, "/", monkapi.ListOptions{Recursive: true}, "total")
+	if err != nil {
+		return c.total
+	}
+	c.total = uint64(max(resp.Total, 0))
+	c.fetched = time.Now()
+	return c.total
+}
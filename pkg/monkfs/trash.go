@@ -0,0 +1,125 @@
+package monkfs
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ianzepp/monk-api-fuse/pkg/monkapi"
+)
+
+// trashDirName is the directory at the mount root that deleted files are
+// moved to when Options.Trash is set. It lives in the API, so every client
+// of the mount shares it.
+const trashDirName = ".Trash"
+
+// trashMarkerName is the empty file stored to create the trash directory;
+// having no time stamp, it is never purged
+const trashMarkerName = ".keep"
+
+// trashPurgeInterval is how often the trash is checked for files kept
+// longer than Options.Trash
+const trashPurgeInterval = 10 * time.Minute
+
+// trashTimeFormat stamps trashed files with when they were deleted; it has
+// a fixed length, so the stamp can be found at the end of the name
+const trashTimeFormat = "20060102T150405.000Z"
+
+// trashPath returns where a file deleted at now is kept: a name in /.Trash
+// made of its path, with "/" escaped as "%2F", and the time
+func trashPath(filePath string, now time.Time) string {
+	name := strings.ReplaceAll(strings.TrimPrefix(filePath, "/"), "/", "%2F")
+	return "/" + trashDirName + "/" + name + "." + now.UTC().Format(trashTimeFormat)
+}
+
+// trashedAt returns when a file in the trash was deleted, from its name
+func trashedAt(name string) (time.Time, bool) {
+	stamp := len(name) - len(trashTimeFormat)
+	if stamp < 1 || name[stamp-1] != '.' {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(trashTimeFormat, name[stamp:])
+	return t, err == nil
+}
+
+// inTrash reports whether path is the trash or in it
+func inTrash(filePath string) bool {
+	return filePath == "/"+trashDirName || strings.HasPrefix(filePath, "/"+trashDirName+"/")
+}
+
+// remove deletes a file, or moves it to the trash when Options.Trash is
+// set. Files already in the trash are deleted.
+func (n *MonkFS) remove(ctx context.Context, filePath string) error {
+	if n.opts.Trash <= 0 || inTrash(filePath) {
+		_, err := n.apiClient.Delete(ctx, filePath, monkapi.DeleteOptions{}, "")
+		return err
+	}
+	_, err := n.trash(ctx, filePath)
+	return err
+}
+
+// trash moves a file to the trash and returns where it is kept
+func (n *MonkFS) trash(ctx context.Context, filePath string) (string, error) {
+	trashed := trashPath(filePath, time.Now())
+	_, err := n.apiClient.Move(ctx, filePath, trashed, monkapi.MoveOptions{}, "")
+	if monkapi.IsNotFound(err) {
+		// Moves need the destination directory to exist, and the API
+		// creates directories only for the files stored in them
+		marker := "/" + trashDirName + "/" + trashMarkerName
+		if _, err := n.apiClient.Store(ctx, marker, "", monkapi.StoreOptions{CreateMissing: true}, ""); err != nil {
+			return "", err
+		}
+		_, err = n.apiClient.Move(ctx, filePath, trashed, monkapi.MoveOptions{}, "")
+	}
+	if err != nil {
+		return "", err
+	}
+	n.invalidate(trashed)
+	return trashed, nil
+}
+
+// PurgeTrash deletes files kept in the trash longer than Options.Trash,
+// now and every trashPurgeInterval until ctx is done
+func (n *MonkFS) PurgeTrash(ctx context.Context) {
+	ticker := time.NewTicker(trashPurgeInterval)
+	defer ticker.Stop()
+	for {
+		n.purgeTrash(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purgeTrash deletes the files in the trash that have expired. Nothing is
+// purged in dry-run mode, which would only queue the deletes.
+func (n *MonkFS) purgeTrash(ctx context.Context) {
+	if n.staging.active() {
+		return
+	}
+	dir := "/" + trashDirName
+	resp, err := n.apiClient.List(ctx, dir, monkapi.ListOptions{}, "entries")
+	if err != nil {
+		if !monkapi.IsNotFound(err) && ctx.Err() == nil {
+			n.errLog.Record(dir, fmt.Errorf("purge trash: %w", err))
+		}
+		return
+	}
+
+	expired := time.Now().Add(-n.opts.Trash)
+	for _, entry := range resp.Entries {
+		deleted, ok := trashedAt(entry.Name)
+		if !ok || !deleted.Before(expired) {
+			continue
+		}
+		filePath := dir + "/" + entry.Name
+		if _, err := n.apiClient.Delete(ctx, filePath, monkapi.DeleteOptions{}, ""); err != nil && !monkapi.IsNotFound(err) {
+			n.errLog.Record(filePath, fmt.Errorf("purge trash: %w", err))
+			continue
+		}
+		n.forgetPath(filePath)
+	}
+}
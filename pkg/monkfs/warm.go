@@ -0,0 +1,33 @@
+package monkfs
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ianzepp/monk-api-fuse/internal/traverse"
+	"github.com/ianzepp/monk-api-fuse/pkg/monkapi"
+)
+
+// warmMaxEntries bounds how many entries a warm-up caches, so warming a
+// huge tree by mistake doesn't list it all
+const warmMaxEntries = 100000
+
+// Warm prefetches listings and metadata for the subtrees below paths, so
+// the first interactive ls or IDE index after mounting is served from the
+// cache. It stops when ctx is done; failures are recorded in the error log
+// and progress is shown in /.monk/status.
+func (n *MonkFS) Warm(ctx context.Context, paths []string) {
+	traverse.Walk(ctx, paths, n.listEntries, traverse.Options{
+		MaxEntries: warmMaxEntries,
+		Visit: func(entry monkapi.FileEntry) bool {
+			n.cache.Set(entry.Path, statFromEntry(entry))
+			return true
+		},
+		Failed: func(dir string, err error) {
+			n.errLog.Record(dir, fmt.Errorf("warm: %w", err))
+		},
+		Progress: func(p traverse.Progress) {
+			n.warmProgress.Store(&p)
+		},
+	})
+}
@@ -0,0 +1,124 @@
+package monkfs
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// Extended attribute names exposed on every node
+const (
+	xattrLastError = "user.monk.last_error"
+	xattrMimeType  = "user.mime_type"
+)
+
+// Getxattr implements extended attribute reads
+func (n *MonkFS) Getxattr(ctx context.Context, attr string, dest []byte) (uint32, syscall.Errno) {
+	ctx, cancel := n.withDeadline(ctx, opMetadata)
+	defer cancel()
+
+	switch attr {
+	case xattrLastError:
+		msg := n.errLog.Last(n.getPath())
+		if msg == "" {
+			return 0, syscall.Errno(fuse.ENOATTR)
+		}
+		return copyXattr(dest, []byte(msg))
+
+	case xattrMimeType:
+		if !n.isFile() {
+			return 0, syscall.Errno(fuse.ENOATTR)
+		}
+		mimeType, errno := n.mimeType(ctx)
+		if errno != 0 {
+			return 0, errno
+		}
+		return copyXattr(dest, []byte(mimeType))
+
+	case xattrOwner:
+		return n.getOwnerXattr(ctx, dest)
+
+	case xattrACL:
+		return n.getACLXattr(ctx, dest)
+
+	case xattrPosixACL:
+		return n.getPosixACLXattr(ctx, dest)
+
+	case xattrStale:
+		return n.getStaleXattr(dest)
+
+	case xattrSHA256:
+		if !n.isFile() {
+			return 0, syscall.Errno(fuse.ENOATTR)
+		}
+		return n.getChecksumXattr(ctx, dest)
+	}
+
+	if field, ok := strings.CutPrefix(attr, xattrFieldPrefix); ok {
+		return n.getFieldXattr(ctx, field, dest)
+	}
+
+	if n.isFile() && slices.Contains(platformMimeXattrNames, attr) {
+		mimeType, errno := n.mimeType(ctx)
+		if errno != 0 {
+			return 0, errno
+		}
+		if value, ok := platformMimeXattrs(mimeType)[attr]; ok {
+			return copyXattr(dest, value)
+		}
+	}
+
+	return 0, syscall.Errno(fuse.ENOATTR)
+}
+
+// Listxattr implements extended attribute listing
+func (n *MonkFS) Listxattr(ctx context.Context, dest []byte) (uint32, syscall.Errno) {
+	var names []byte
+	add := func(name string) {
+		names = append(names, name...)
+		names = append(names, 0)
+	}
+
+	if n.errLog.Last(n.getPath()) != "" {
+		add(xattrLastError)
+	}
+	if _, ok := n.staleSince(n.getPath()); ok {
+		add(xattrStale)
+	}
+	if stat := n.cache.Get(n.getPath()); stat != nil {
+		if recordOwner(stat.APIContext) != "" {
+			add(xattrOwner)
+		}
+		if acl := parseRecordACL(stat.APIContext); acl != nil {
+			add(xattrACL)
+			if n.opts.Owners.mapsAny(acl.ids()) {
+				add(xattrPosixACL)
+			}
+		}
+	}
+	if n.isFile() {
+		add(xattrMimeType)
+		if stat := n.cache.Get(n.getPath()); stat != nil && stat.FileMetadata.SHA256 != "" {
+			add(xattrSHA256)
+		}
+	}
+
+	return copyXattr(dest, names)
+}
+
+// isFile reports whether this node is a regular file
+func (n *MonkFS) isFile() bool {
+	return n.StableAttr().Mode&syscall.S_IFMT == syscall.S_IFREG
+}
+
+// copyXattr copies an attribute value into dest, returning ERANGE and the
+// required size when dest is too small
+func copyXattr(dest []byte, value []byte) (uint32, syscall.Errno) {
+	if len(dest) < len(value) {
+		return uint32(len(value)), syscall.ERANGE
+	}
+	return uint32(copy(dest, value)), 0
+}
@@ -0,0 +1,390 @@
+// Package monkftp serves the Monk File API namespace read-only over FTP,
+// for legacy systems that cannot speak any other protocol
+package monkftp
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ianzepp/monk-api-fuse/pkg/monkapi"
+)
+
+// dataTimeout bounds how long a passive data connection waits for the client
+const dataTimeout = 30 * time.Second
+
+// Server is a read-only FTP server backed by the File API. LIST, NLST and
+// RETR map to List and RetrieveStream. Every command that would modify data
+// is refused, and there is no option to allow them: FTP sends passwords in
+// the clear and its data connections are unauthenticated, so the bridge is
+// kept to reading.
+//
+// Requests are made with the server's own API credentials. Unless
+// RequireLogin is called, any user name and password are accepted.
+type Server struct {
+	client monkapi.API
+
+	// user and password are the login required before any file command;
+	// no password means any login is accepted
+	user, password string
+}
+
+// NewServer creates an FTP server
+func NewServer(client monkapi.API) *Server {
+	return &Server{client: client}
+}
+
+// RequireLogin makes clients log in with user and password before they
+// can list or retrieve anything
+func (s *Server) RequireLogin(user, password string) {
+	s.user, s.password = user, password
+}
+
+// Serve accepts control connections on l until it is closed
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		nc, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.serveConn(nc)
+	}
+}
+
+// session is the state of one control connection
+type session struct {
+	server *Server
+	ctrl   net.Conn
+	r      *bufio.Reader
+	cwd    string
+	offset int64        // REST offset for the next RETR
+	pasv   net.Listener // pending passive data listener
+	user   string       // name given by USER
+	authed bool         // logged in, or no login is required
+}
+
+func (s *Server) serveConn(nc net.Conn) {
+	sess := &session{server: s, ctrl: nc, r: bufio.NewReader(nc), cwd: "/", authed: s.password == ""}
+	defer sess.close()
+
+	sess.reply(220, "Monk File API FTP bridge (read-only)")
+	for {
+		line, err := sess.r.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		cmd, arg, _ := strings.Cut(strings.TrimRight(line, "\r\n"), " ")
+		if !sess.handle(strings.ToUpper(cmd), arg) {
+			return
+		}
+	}
+}
+
+func (sess *session) close() {
+	if sess.pasv != nil {
+		sess.pasv.Close()
+	}
+	sess.ctrl.Close()
+}
+
+func (sess *session) reply(code int, msg string) {
+	fmt.Fprintf(sess.ctrl, "%d %s\r\n", code, msg)
+}
+
+// handle runs one command; it returns false when the session should end
+func (sess *session) handle(cmd, arg string) bool {
+	ctx := context.Background()
+
+	switch cmd {
+	case "USER":
+		sess.user = arg
+		if sess.server.password == "" {
+			sess.reply(331, "Any password will do")
+		} else {
+			sess.authed = false
+			sess.reply(331, "Password required")
+		}
+	case "PASS":
+		if !sess.server.login(sess.user, arg) {
+			sess.reply(530, "Login incorrect")
+			break
+		}
+		sess.authed = true
+		sess.reply(230, "Logged in")
+	case "QUIT":
+		sess.reply(221, "Bye")
+		return false
+	case "SYST":
+		sess.reply(215, "UNIX Type: L8")
+	case "FEAT":
+		fmt.Fprint(sess.ctrl, "211-Features:\r\n EPSV\r\n PASV\r\n SIZE\r\n MDTM\r\n REST STREAM\r\n UTF8\r\n211 End\r\n")
+	case "OPTS":
+		sess.reply(200, "OK")
+	case "NOOP":
+		sess.reply(200, "OK")
+	default:
+		return sess.handleFile(ctx, cmd, arg)
+	}
+	return true
+}
+
+// handleFile runs a command that needs a login
+func (sess *session) handleFile(ctx context.Context, cmd, arg string) bool {
+	if !sess.authed {
+		sess.reply(530, "Log in with USER and PASS")
+		return true
+	}
+
+	switch cmd {
+	case "TYPE", "MODE", "STRU":
+		// Content is always sent as stored
+		sess.reply(200, "OK")
+	case "PWD", "XPWD":
+		sess.reply(257, strconv.Quote(sess.cwd))
+	case "CWD", "XCWD":
+		sess.changeDir(ctx, sess.resolve(arg))
+	case "CDUP", "XCUP":
+		sess.changeDir(ctx, path.Dir(sess.cwd))
+	case "PASV", "EPSV":
+		sess.passive(cmd)
+	case "LIST", "NLST":
+		sess.list(ctx, cmd, arg)
+	case "RETR":
+		sess.retr(ctx, sess.resolve(arg))
+	case "REST":
+		offset, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil || offset < 0 {
+			sess.reply(501, "Invalid offset")
+			break
+		}
+		sess.offset = offset
+		sess.reply(350, "Restarting at "+arg)
+	case "SIZE":
+		if stat := sess.stat(ctx, sess.resolve(arg)); stat != nil {
+			sess.reply(213, strconv.FormatInt(stat.FileMetadata.Size, 10))
+		}
+	case "MDTM":
+		if stat := sess.stat(ctx, sess.resolve(arg)); stat != nil {
+			t, err := time.Parse(time.RFC3339, stat.FileMetadata.ModifiedTime)
+			if err != nil {
+				sess.reply(550, "Modification time unavailable")
+				break
+			}
+			sess.reply(213, t.UTC().Format("20060102150405"))
+		}
+	case "STOR", "STOU", "APPE", "DELE", "MKD", "XMKD", "RMD", "XRMD", "RNFR", "RNTO", "SITE":
+		sess.reply(550, "Read-only server")
+	default:
+		sess.reply(502, "Command not implemented")
+	}
+	return true
+}
+
+// login checks a USER and PASS pair
+func (s *Server) login(user, password string) bool {
+	if s.password == "" {
+		return true
+	}
+	userOK := subtle.ConstantTimeCompare([]byte(user), []byte(s.user)) == 1
+	passwordOK := subtle.ConstantTimeCompare([]byte(password), []byte(s.password)) == 1
+	return userOK && passwordOK
+}
+
+// resolve turns a command argument into an absolute API path
+func (sess *session) resolve(arg string) string {
+	if strings.HasPrefix(arg, "/") {
+		return path.Clean(arg)
+	}
+	return path.Join(sess.cwd, arg)
+}
+
+// changeDir changes the working directory after checking it exists
+func (sess *session) changeDir(ctx context.Context, dir string) {
+	stat := sess.stat(ctx, dir)
+	if stat == nil {
+		return
+	}
+	if !isDir(stat) {
+		sess.reply(550, "Not a directory")
+		return
+	}
+	sess.cwd = dir
+	sess.reply(250, "Directory changed to "+dir)
+}
+
+// stat stats a path, replying with an error and returning nil on failure
+func (sess *session) stat(ctx context.Context, p string) *monkapi.StatResponse {
+	stat, err := sess.server.client.Stat(ctx, p, "file_metadata")
+	if err != nil {
+		sess.replyError(err)
+		return nil
+	}
+	return stat
+}
+
+// passive opens a data listener for the next transfer
+func (sess *session) passive(cmd string) {
+	if sess.pasv != nil {
+		sess.pasv.Close()
+	}
+
+	host, _, _ := net.SplitHostPort(sess.ctrl.LocalAddr().String())
+	l, err := net.Listen("tcp", net.JoinHostPort(host, "0"))
+	if err != nil {
+		sess.reply(425, "Cannot open data connection")
+		return
+	}
+	sess.pasv = l
+	port := l.Addr().(*net.TCPAddr).Port
+
+	if cmd == "EPSV" {
+		sess.reply(229, fmt.Sprintf("Entering Extended Passive Mode (|||%d|)", port))
+		return
+	}
+
+	ip := net.ParseIP(host).To4()
+	if ip == nil {
+		sess.reply(425, "PASV requires IPv4; use EPSV")
+		return
+	}
+	sess.reply(227, fmt.Sprintf("Entering Passive Mode (%d,%d,%d,%d,%d,%d)",
+		ip[0], ip[1], ip[2], ip[3], port>>8, port&0xff))
+}
+
+// transfer accepts the passive data connection and runs send over it
+func (sess *session) transfer(send func(w io.Writer) error) {
+	if sess.pasv == nil {
+		sess.reply(425, "Use PASV or EPSV first")
+		return
+	}
+	l := sess.pasv
+	sess.pasv = nil
+	defer l.Close()
+
+	sess.reply(150, "Opening data connection")
+	l.(*net.TCPListener).SetDeadline(time.Now().Add(dataTimeout))
+	data, err := sess.acceptData(l)
+	if err != nil {
+		sess.reply(425, "Data connection failed")
+		return
+	}
+
+	err = send(data)
+	data.Close()
+	if err != nil {
+		log.Printf("ftp: %v", err)
+		sess.reply(451, "Transfer aborted")
+		return
+	}
+	sess.reply(226, "Transfer complete")
+}
+
+// acceptData accepts the data connection from the control connection's
+// host, dropping connections from anywhere else so another host cannot
+// steal the transfer by connecting to the passive port first
+func (sess *session) acceptData(l net.Listener) (net.Conn, error) {
+	peer, _, _ := net.SplitHostPort(sess.ctrl.RemoteAddr().String())
+	peerIP := net.ParseIP(peer)
+	for {
+		data, err := l.Accept()
+		if err != nil {
+			return nil, err
+		}
+		host, _, _ := net.SplitHostPort(data.RemoteAddr().String())
+		if ip := net.ParseIP(host); ip != nil && ip.Equal(peerIP) {
+			return data, nil
+		}
+		log.Printf("ftp: refused data connection from %s for %s", data.RemoteAddr(), sess.ctrl.RemoteAddr())
+		data.Close()
+	}
+}
+
+// list sends a directory listing; NLST sends names only
+func (sess *session) list(ctx context.Context, cmd, arg string) {
+	// Ignore ls-style flags such as "-la"
+	if strings.HasPrefix(arg, "-") {
+		_, arg, _ = strings.Cut(arg, " ")
+	}
+	dir := sess.resolve(arg)
+
+	resp, err := sess.server.client.List(ctx, dir, monkapi.ListOptions{LongFormat: true}, "entries")
+	if err != nil {
+		sess.replyError(err)
+		return
+	}
+
+	sess.transfer(func(w io.Writer) error {
+		bw := bufio.NewWriter(w)
+		for _, entry := range resp.Entries {
+			if cmd == "NLST" {
+				fmt.Fprintf(bw, "%s\r\n", entry.Name)
+				continue
+			}
+			mode := "-r--r--r--"
+			if entry.FileType == "d" {
+				mode = "dr-xr-xr-x"
+			}
+			fmt.Fprintf(bw, "%s 1 monk monk %12d %s %s\r\n", mode, entry.FileSize, listTime(entry.FileModified), entry.Name)
+		}
+		return bw.Flush()
+	})
+}
+
+// retr streams file content, honoring a preceding REST
+func (sess *session) retr(ctx context.Context, p string) {
+	offset := sess.offset
+	sess.offset = 0
+
+	stream, err := sess.server.client.RetrieveStream(ctx, p, monkapi.RetrieveOptions{StartOffset: int(offset)})
+	if err != nil {
+		sess.replyError(err)
+		return
+	}
+	defer stream.Close()
+
+	sess.transfer(func(w io.Writer) error {
+		_, err := io.Copy(w, stream)
+		return err
+	})
+}
+
+// replyError reports an API error on the control connection
+func (sess *session) replyError(err error) {
+	var apiErr *monkapi.APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == 404 {
+		sess.reply(550, "No such file or directory")
+		return
+	}
+	if errors.As(err, &apiErr) && (apiErr.StatusCode == 401 || apiErr.StatusCode == 403) {
+		sess.reply(550, "Permission denied")
+		return
+	}
+	log.Printf("ftp: %v", err)
+	sess.reply(451, "Requested action aborted: API error")
+}
+
+func isDir(stat *monkapi.StatResponse) bool {
+	return stat.Type == "directory" || stat.FileMetadata.Type == "directory"
+}
+
+// listTime formats a timestamp like ls -l
+func listTime(ts string) string {
+	t, err := time.Parse(time.RFC3339, ts)
+	if err != nil {
+		t = time.Unix(0, 0)
+	}
+	if time.Since(t) > 180*24*time.Hour {
+		return t.Format("Jan _2  2006")
+	}
+	return t.Format("Jan _2 15:04")
+}
@@ -0,0 +1,204 @@
+package monkftp
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ianzepp/monk-api-fuse/internal/mockserver"
+	"github.com/ianzepp/monk-api-fuse/pkg/monkapi"
+)
+
+// testClient is an FTP control connection to a Server
+type testClient struct {
+	t    *testing.T
+	nc   net.Conn
+	r    *bufio.Reader
+	host string
+}
+
+// testServer serves s over FTP and connects to it
+func testServer(t *testing.T, s *mockserver.Server, login ...string) *testClient {
+	t.Helper()
+	api := httptest.NewServer(s)
+	t.Cleanup(api.Close)
+	server := NewServer(monkapi.NewClient(api.URL, "token"))
+	if len(login) == 2 {
+		server.RequireLogin(login[0], login[1])
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go server.Serve(l)
+
+	nc, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { nc.Close() })
+	c := &testClient{t: t, nc: nc, r: bufio.NewReader(nc), host: "127.0.0.1"}
+	c.expect(220)
+	return c
+}
+
+// expect reads a reply, skipping multi-line continuations, and fails
+// unless it has the wanted code
+func (c *testClient) expect(code int) string {
+	c.t.Helper()
+	c.nc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if len(line) < 4 || line[3] == '-' || line[0] == ' ' {
+			continue
+		}
+		if got, _ := strconv.Atoi(line[:3]); got != code {
+			c.t.Fatalf("reply %q, want %d", line, code)
+		}
+		return line[4:]
+	}
+}
+
+// cmd sends a command and checks its reply code
+func (c *testClient) cmd(code int, line string) string {
+	c.t.Helper()
+	if _, err := io.WriteString(c.nc, line+"\r\n"); err != nil {
+		c.t.Fatal(err)
+	}
+	return c.expect(code)
+}
+
+// transfer enters extended passive mode, sends a command and returns what
+// arrives on the data connection
+func (c *testClient) transfer(line string) string {
+	c.t.Helper()
+	msg := c.cmd(229, "EPSV")
+	port := msg[strings.Index(msg, "|||")+3 : strings.LastIndex(msg, "|")]
+
+	data, err := net.Dial("tcp", net.JoinHostPort(c.host, port))
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	defer data.Close()
+	c.cmd(150, line)
+	body, err := io.ReadAll(data)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	c.expect(226)
+	return string(body)
+}
+
+func TestControlChannel(t *testing.T) {
+	s := mockserver.New()
+	s.Put("/docs/readme.md", []byte("hello, world\n"))
+	s.Put("/docs/notes/todo.txt", []byte("one\n"))
+	c := testServer(t, s)
+
+	c.cmd(331, "USER anyone")
+	c.cmd(230, "PASS anything")
+	c.cmd(215, "SYST")
+	if got := c.cmd(257, "PWD"); got != `"/"` {
+		t.Errorf("PWD = %s", got)
+	}
+	c.cmd(250, "CWD docs")
+	if got := c.cmd(257, "PWD"); got != `"/docs"` {
+		t.Errorf("PWD after CWD = %s", got)
+	}
+	c.cmd(550, "CWD readme.md")
+	c.cmd(550, "CWD missing")
+	if got := c.cmd(213, "SIZE readme.md"); got != "13" {
+		t.Errorf("SIZE = %s, want 13", got)
+	}
+
+	if got := c.transfer("NLST"); got != "notes\r\nreadme.md\r\n" {
+		t.Errorf("NLST = %q", got)
+	}
+	if got := c.transfer("LIST -la"); !strings.Contains(got, "dr-xr-xr-x") || !strings.Contains(got, " readme.md\r\n") {
+		t.Errorf("LIST = %q", got)
+	}
+	if got := c.transfer("RETR readme.md"); got != "hello, world\n" {
+		t.Errorf("RETR = %q", got)
+	}
+	c.cmd(350, "REST 7")
+	if got := c.transfer("RETR /docs/readme.md"); got != "world\n" {
+		t.Errorf("RETR after REST = %q", got)
+	}
+
+	c.cmd(425, "RETR readme.md")
+	c.cmd(550, "STOR new.txt")
+	c.cmd(550, "DELE readme.md")
+	c.cmd(250, "CDUP")
+	c.cmd(221, "QUIT")
+}
+
+func TestLogin(t *testing.T) {
+	s := mockserver.New()
+	s.Put("/readme.md", []byte("hi"))
+	c := testServer(t, s, "monk", "secret")
+
+	c.cmd(530, "PWD")
+	c.cmd(331, "USER monk")
+	c.cmd(530, "PASS wrong")
+	c.cmd(530, "SIZE readme.md")
+	c.cmd(331, "USER other")
+	c.cmd(530, "PASS secret")
+	c.cmd(331, "USER monk")
+	c.cmd(230, "PASS secret")
+	if got := c.cmd(213, "SIZE readme.md"); got != "2" {
+		t.Errorf("SIZE = %s, want 2", got)
+	}
+}
+
+func TestDataConnectionFromOtherHost(t *testing.T) {
+	s := mockserver.New()
+	s.Put("/readme.md", []byte("hi"))
+	c := testServer(t, s)
+
+	msg := c.cmd(229, "EPSV")
+	port := msg[strings.Index(msg, "|||")+3 : strings.LastIndex(msg, "|")]
+
+	// The control connection comes from 127.0.0.1; a connection from
+	// another loopback address is a different host and must be dropped
+	thief, err := net.DialTCP("tcp", &net.TCPAddr{IP: net.ParseIP("127.0.0.2")}, &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: mustAtoi(t, port)})
+	if err != nil {
+		t.Skipf("cannot dial from 127.0.0.2: %v", err)
+	}
+	defer thief.Close()
+	data, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer data.Close()
+
+	c.cmd(150, "RETR readme.md")
+	if body, err := io.ReadAll(data); err != nil || string(body) != "hi" {
+		t.Errorf("RETR = %q, %v", body, err)
+	}
+	c.expect(226)
+
+	thief.SetReadDeadline(time.Now().Add(time.Second))
+	if body, _ := io.ReadAll(thief); len(body) != 0 {
+		t.Errorf("other host received %q", body)
+	}
+}
+
+func mustAtoi(t *testing.T, s string) int {
+	t.Helper()
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
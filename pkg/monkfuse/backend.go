@@ -0,0 +1,90 @@
+package monkfuse
+
+import (
+	"context"
+	"os"
+	"slices"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/ianzepp/monk-api-fuse/pkg/monkapi"
+	"github.com/ianzepp/monk-api-fuse/pkg/monkfs"
+)
+
+// Backend attaches a filesystem serving the File API to the operating
+// system. FUSE is the only backend; another, such as WinFsp for drive
+// letters on Windows, would share the API client, capability negotiation
+// and session lifecycle Mount sets up around it.
+type Backend interface {
+	// Mount serves the File API through client at opts.Mountpoint and
+	// returns once the mount is ready. Background work it starts stops
+	// when ctx is cancelled.
+	Mount(ctx context.Context, client *monkapi.Client, opts Options) (Mounted, error)
+}
+
+// Mounted is a filesystem attached by a Backend
+type Mounted interface {
+	// Unmount detaches the filesystem; it fails while files are open
+	Unmount() error
+
+	// Wait blocks until the filesystem is detached
+	Wait()
+}
+
+// fuseBackend mounts pkg/monkfs through go-fuse
+type fuseBackend struct{}
+
+func (fuseBackend) Mount(ctx context.Context, client *monkapi.Client, opts Options) (Mounted, error) {
+	root := monkfs.NewMonkFS(client, opts.FS)
+
+	// Kernel capabilities: go-fuse v2.9.0 accepts async reads, parallel
+	// lookups and readdir in one directory (FUSE_PARALLEL_DIROPS),
+	// readdirplus and large requests whenever the kernel offers them, so
+	// none need asking for. Readdirplus costs no extra requests because
+	// Readdir prefetches child metadata. The rest aren't available:
+	//   - FUSE_WRITEBACK_CACHE and FUSE_READDIRPLUS_AUTO are masked during
+	//     INIT with no option to enable them. Writes are instead aggregated
+	//     per handle in MonkFileHandle and stored once on flush.
+	//   - Splice only applies to replies backed by a file descriptor, and
+	//     content arrives in HTTP bodies. go-fuse leaves it off on macOS
+	//     and FreeBSD itself.
+	// Explicit modes are enforced by the kernel, so a locked down mount
+	// is not just cosmetic
+	fuseOpts := opts.FuseOptions
+	if opts.FS.FileMode != 0 || opts.FS.DirMode != 0 || opts.FS.Umask != 0 {
+		fuseOpts = append(slices.Clip(fuseOpts), "default_permissions")
+	}
+
+	server, err := fs.Mount(opts.Mountpoint, root, &fs.Options{
+		UID: uint32(os.Getuid()),
+		GID: uint32(os.Getgid()),
+		MountOptions: fuse.MountOptions{
+			Name:          "monk-fuse",
+			FsName:        "monk",
+			Debug:         opts.Debug,
+			AllowOther:    opts.AllowOther,
+			DisableXAttrs: false,
+			EnableLocks:   opts.FS.Locks,
+			MaxBackground: opts.MaxBackground,
+			MaxWrite:      opts.MaxWrite,
+			MaxReadAhead:  opts.MaxReadAhead,
+			Options:       fuseOpts,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.MaxReadAhead > 0 {
+		// Best effort: without root the kernel's readahead stays in place
+		raiseReadAhead(opts.Mountpoint, opts.MaxReadAhead)
+	}
+
+	if len(opts.FS.Warm) > 0 {
+		go root.Warm(ctx, opts.FS.Warm)
+	}
+	if opts.FS.Trash > 0 {
+		go root.PurgeTrash(ctx)
+	}
+	return server, nil
+}
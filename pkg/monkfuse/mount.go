@@ -0,0 +1,205 @@
+// Package monkfuse mounts the Monk File API from Go programs, so they can
+// embed the mount lifecycle instead of running the monk-fuse CLI
+package monkfuse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ianzepp/monk-api-fuse/pkg/monkapi"
+	"github.com/ianzepp/monk-api-fuse/pkg/monkfs"
+)
+
+// Options configures a mount
+type Options struct {
+	// APIURL is the Monk API base URL
+	APIURL string
+
+	// TokenSource supplies the JWT for each request; use
+	// monkapi.StaticToken for a fixed token
+	TokenSource monkapi.TokenSource
+
+	// Signer HMAC-signs every request; it may replace TokenSource for
+	// services that authenticate with a shared secret
+	Signer *monkapi.HMACSigner
+
+	// Mountpoint is the directory to mount on
+	Mountpoint string
+
+	// FS configures filesystem behavior, including the cache policy
+	FS monkfs.Options
+
+	// Transport overrides the HTTP transport for API requests; nil keeps
+	// the client's pooled transport
+	Transport http.RoundTripper
+
+	// GETReads sends stat, list and retrieve requests as GET so HTTP
+	// caches in front of the API can serve them
+	GETReads bool
+
+	// Headers are added to every API request
+	Headers http.Header
+
+	// MountID is sent in the X-Client-Mount-ID header of every request so
+	// server operators can attribute traffic to this mount; empty omits it
+	MountID string
+
+	// StrictDecoding fails requests whose responses use field names of
+	// other API versions instead of accepting them
+	StrictDecoding bool
+
+	// FuseOptions are extra mount options passed to the FUSE helper
+	FuseOptions []string
+
+	// MaxBackground limits the asynchronous requests (readahead, async
+	// direct I/O) the kernel keeps in flight; it starts throttling callers
+	// at three quarters of it. Zero keeps the kernel default of 12.
+	MaxBackground int
+
+	// MaxWrite is the largest read or write request the kernel sends, and
+	// so the largest range fetched per read; zero keeps go-fuse's 128 KiB.
+	// Kernels cap it at 1 MiB.
+	MaxWrite int
+
+	// MaxReadAhead is how far the kernel reads ahead of sequential reads;
+	// zero keeps the kernel default of 128 KiB. On Linux, raising it above
+	// that needs root, and reads are still no larger than MaxWrite.
+	MaxReadAhead int
+
+	// IdleCheck pings the API at this interval while the mount is idle and
+	// drops pooled connections that no longer answer, so the next operation
+	// doesn't wait out the HTTP timeout on one; zero disables the pings.
+	// Connections are always dropped after the machine wakes from sleep.
+	IdleCheck time.Duration
+
+	// Verify stats the root before mounting, so an unreachable API or
+	// rejected credentials fail Mount instead of every file operation
+	Verify bool
+
+	// AllowOther lets users other than the mounting user access the mount
+	AllowOther bool
+
+	// Debug enables FUSE request logging
+	Debug bool
+
+	// Backend attaches the filesystem to the operating system; nil mounts
+	// it through FUSE
+	Backend Backend
+}
+
+// Session is a mounted filesystem
+type Session struct {
+	mounted    Mounted
+	mountpoint string
+	caps       *monkapi.Capabilities
+	done       chan struct{}
+}
+
+// Mount mounts the File API at opts.Mountpoint and returns once the mount
+// is ready. Cancelling ctx unmounts it.
+func Mount(ctx context.Context, opts Options) (*Session, error) {
+	if opts.Mountpoint == "" {
+		return nil, errors.New("monkfuse: no mountpoint")
+	}
+	apiClient, err := NewClient(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Verify {
+		if err := verify(ctx, apiClient, opts.APIURL); err != nil {
+			return nil, err
+		}
+	}
+
+	// Learn what the server supports up front, so older servers get
+	// fallbacks instead of errors on first use
+	caps, err := apiClient.Negotiate(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("monkfuse: negotiate capabilities: %w", err)
+	}
+
+	// Once mounted, an outage makes operations fail quickly with EAGAIN
+	// until the API answers again, rather than each one blocking for the
+	// full HTTP timeout
+	apiClient.SetFailFast(true)
+
+	backend := opts.Backend
+	if backend == nil {
+		backend = fuseBackend{}
+	}
+	// Background work stops on unmount
+	bgCtx, cancel := context.WithCancel(ctx)
+	mounted, err := backend.Mount(bgCtx, apiClient, opts)
+	if err != nil {
+		cancel()
+		apiClient.Close()
+		return nil, err
+	}
+
+	s := &Session{mounted: mounted, mountpoint: opts.Mountpoint, caps: caps, done: make(chan struct{})}
+	if opts.IdleCheck > 0 {
+		go apiClient.CheckIdle(bgCtx, opts.IdleCheck)
+	}
+	go func() {
+		mounted.Wait()
+		cancel()
+		apiClient.Close()
+		close(s.done)
+	}()
+	go func() {
+		select {
+		case <-ctx.Done():
+			mounted.Unmount()
+		case <-s.done:
+		}
+	}()
+	return s, nil
+}
+
+// NewClient builds the API client a mount with opts would use, from its
+// credentials, transport and request options. Servers exposing the API
+// over other protocols use it to reach the API the same way.
+func NewClient(opts Options) (*monkapi.Client, error) {
+	tokens := opts.TokenSource
+	if tokens == nil {
+		if opts.Signer == nil {
+			return nil, errors.New("monkfuse: no token source or signer")
+		}
+		tokens = monkapi.StaticToken("")
+	}
+
+	apiClient := monkapi.NewClientWithTokenSource(opts.APIURL, tokens)
+	apiClient.SetSigner(opts.Signer)
+	if opts.Transport != nil {
+		apiClient.SetTransport(opts.Transport)
+	}
+	apiClient.SetGETReads(opts.GETReads)
+	apiClient.SetStrictDecoding(opts.StrictDecoding)
+	apiClient.SetMountID(opts.MountID)
+	apiClient.SetHeaders(opts.Headers)
+	return apiClient, nil
+}
+
+// Mountpoint returns the directory the filesystem is mounted on
+func (s *Session) Mountpoint() string {
+	return s.mountpoint
+}
+
+// Capabilities returns the features the server reported at mount time
+func (s *Session) Capabilities() *monkapi.Capabilities {
+	return s.caps
+}
+
+// Close unmounts the filesystem. It fails while files are still open.
+func (s *Session) Close() error {
+	return s.mounted.Unmount()
+}
+
+// Wait blocks until the filesystem is unmounted
+func (s *Session) Wait() {
+	<-s.done
+}
@@ -0,0 +1,22 @@
+package monkfuse
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+// raiseReadAhead sets the readahead of the filesystem mounted at
+// mountpoint. The FUSE handshake can only lower the kernel's offer of
+// 128 KiB; raising it goes through the mount's backing device info, which
+// only root may write.
+func raiseReadAhead(mountpoint string, bytes int) error {
+	var st unix.Stat_t
+	if err := unix.Stat(mountpoint, &st); err != nil {
+		return err
+	}
+	bdi := fmt.Sprintf("/sys/class/bdi/%d:%d/read_ahead_kb", unix.Major(st.Dev), unix.Minor(st.Dev))
+	return os.WriteFile(bdi, []byte(strconv.Itoa(bytes>>10)), 0)
+}
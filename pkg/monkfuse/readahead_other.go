@@ -0,0 +1,8 @@
+//go:build !linux
+
+package monkfuse
+
+// raiseReadAhead is a no-op where readahead can't be raised after mounting
+func raiseReadAhead(mountpoint string, bytes int) error {
+	return nil
+}
@@ -0,0 +1,36 @@
+package monkfuse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/ianzepp/monk-api-fuse/pkg/monkapi"
+)
+
+// verify checks that the API is reachable at apiURL and accepts the
+// client's credentials by stating the root, so a wrong URL or a bad token
+// fails the mount with a clear message instead of every file operation
+// failing afterwards
+func verify(ctx context.Context, apiClient *monkapi.Client, apiURL string) error {
+	_, err := apiClient.Stat(ctx, "/", "file_metadata")
+	if err == nil {
+		return nil
+	}
+
+	var apiErr *monkapi.APIError
+	if !errors.As(err, &apiErr) {
+		return fmt.Errorf("monkfuse: cannot reach the API at %s: %w", apiURL, err)
+	}
+	switch apiErr.StatusCode {
+	case http.StatusUnauthorized:
+		return fmt.Errorf("monkfuse: the API at %s rejected the credentials (check the token or HMAC key): %w", apiURL, err)
+	case http.StatusForbidden:
+		return fmt.Errorf("monkfuse: the credentials may not read / on %s: %w", apiURL, err)
+	case http.StatusNotFound, http.StatusMethodNotAllowed:
+		return fmt.Errorf("monkfuse: no File API at %s (check --api-url): %w", apiURL, err)
+	default:
+		return fmt.Errorf("monkfuse: verify API at %s: %w", apiURL, err)
+	}
+}